@@ -0,0 +1,327 @@
+package gosse
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AdminHandler serves operational endpoints for a Server as JSON. Mount it
+// under a prefix with http.StripPrefix:
+//
+//	admin, err := gosse.NewAdminHandler(server, checkAdminToken)
+//	http.Handle("/sse/admin/", http.StripPrefix("/sse/admin", admin))
+//
+// Endpoints:
+//
+//	GET    /                   instance ID, labels and client count
+//	GET    /clients            every connected client
+//	PUT    /clients/{id}/debug enable debug frames for a client
+//	DELETE /clients/{id}/debug disable them again
+//	GET    /clients/{id}/queue the client's queued events (see below)
+//	GET    /topics             every topic with its statistics (see Topics)
+//	POST   /publish            publish the request body (see below)
+//	GET    /stream             live ops events as an SSE stream (see below)
+//
+// GET /clients/{id}/queue reports how many events wait in the client's
+// buffer and its capacity. With preview=N it also lists the first N queued
+// events (at most 100), each with its payload truncated to 256 bytes.
+// Taking the snapshot briefly holds up sends to that client.
+//
+// POST /publish takes exactly one of the query parameters topic=name,
+// client=id or broadcast=true to choose the recipients, and sends the
+// request body, up to 1 MiB, as the event data.
+//
+// GET /stream is an SSE stream of the server's own operational events, so a
+// dashboard can watch its health live. Each event is a JSON object whose
+// type is connect, disconnect (with the reason), drop (with the topic, if
+// any) or alert (see WithAlert). Watchers are not themselves reported, and
+// a watcher that falls behind loses the oldest events.
+type AdminHandler struct {
+	server *Server
+	auth   func(*http.Request) error
+}
+
+// NewAdminHandler returns an AdminHandler for server. Every request must be
+// admitted by auth, which is required because the endpoints expose and
+// change server state; rejected requests get 401 Unauthorized.
+func NewAdminHandler(server *Server, auth func(r *http.Request) error) (*AdminHandler, error) {
+	if auth == nil {
+		return nil, invalidOption("auth", "nil", "admin endpoints must be authenticated")
+	}
+	return &AdminHandler{server: server, auth: auth}, nil
+}
+
+// adminClient is the JSON form of a connected client.
+type adminClient struct {
+	ID           string    `json:"id"`
+	ConnectedAt  time.Time `json:"connected_at"`
+	LastActiveAt time.Time `json:"last_active_at"`
+	Topics       []string  `json:"topics,omitempty"`
+	Debug        bool      `json:"debug"`
+}
+
+// ServeHTTP routes admin requests.
+func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := h.auth(r); err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "":
+		h.serveInstance(w, r)
+	case len(parts) == 1 && parts[0] == "clients":
+		h.serveClients(w, r)
+	case len(parts) == 3 && parts[0] == "clients" && parts[2] == "debug":
+		h.serveDebug(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "clients" && parts[2] == "queue":
+		h.serveQueue(w, r, parts[1])
+	case len(parts) == 1 && parts[0] == "topics":
+		h.serveTopics(w, r)
+	case len(parts) == 1 && parts[0] == "publish":
+		h.servePublish(w, r)
+	case len(parts) == 1 && parts[0] == "stream":
+		if allowMethods(w, r, http.MethodGet) {
+			h.server.serveMonitor(w, r)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveInstance describes the server instance.
+func (h *AdminHandler) serveInstance(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, http.StatusOK, struct {
+		InstanceID string            `json:"instance_id"`
+		Labels     map[string]string `json:"labels,omitempty"`
+		Clients    int               `json:"clients"`
+	}{h.server.InstanceID(), h.server.Labels(), h.server.ClientCount()})
+}
+
+// serveClients lists the connected clients, oldest first.
+func (h *AdminHandler) serveClients(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+	clients := []adminClient{}
+	h.server.rangeClients(func(client *Client) bool {
+		info := client.Info()
+		clients = append(clients, adminClient{
+			ID:           info.ID,
+			ConnectedAt:  info.ConnectedAt,
+			LastActiveAt: info.LastActiveAt,
+			Topics:       client.Topics(),
+			Debug:        client.Debug(),
+		})
+		return true
+	})
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].ConnectedAt.Before(clients[j].ConnectedAt)
+	})
+	writeJSON(w, http.StatusOK, clients)
+}
+
+// adminTopic is the JSON form of a topic. The retained event is described
+// like a queued one rather than included in full.
+type adminTopic struct {
+	Name            string       `json:"name"`
+	Subscribers     int          `json:"subscribers"`
+	Retained        *queuedEvent `json:"retained,omitempty"`
+	LastPublishedAt *time.Time   `json:"last_published_at,omitempty"`
+	PublishRate     float64      `json:"publish_rate"`
+}
+
+// serveTopics lists the topics, sorted by name.
+func (h *AdminHandler) serveTopics(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+	topics := []adminTopic{}
+	for _, info := range h.server.Topics() {
+		topic := adminTopic{
+			Name:        info.Name,
+			Subscribers: info.Subscribers,
+			PublishRate: info.PublishRate,
+		}
+		if info.Retained != nil {
+			retained := previewEvent(*info.Retained)
+			topic.Retained = &retained
+			topic.LastPublishedAt = &info.LastPublishedAt
+		}
+		topics = append(topics, topic)
+	}
+	writeJSON(w, http.StatusOK, topics)
+}
+
+// serveDebug turns debug frames on (PUT) or off (DELETE) for a client.
+func (h *AdminHandler) serveDebug(w http.ResponseWriter, r *http.Request, clientID string) {
+	if !allowMethods(w, r, http.MethodPut, http.MethodDelete) {
+		return
+	}
+	client, ok := h.server.loadClient(clientID)
+	if !ok {
+		http.Error(w, "Client not found", http.StatusNotFound)
+		return
+	}
+	client.SetDebug(r.Method == http.MethodPut)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+const (
+	maxQueuePreviews    = 100 // Most events listed by GET /clients/{id}/queue
+	maxQueuePreviewSize = 256 // Payload bytes shown per listed event
+)
+
+// queuedEvent is the JSON form of a queued event.
+type queuedEvent struct {
+	Topic     string `json:"topic,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Size      int    `json:"size"`
+	Preview   string `json:"preview"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+// serveQueue reports the contents of a client's message buffer.
+func (h *AdminHandler) serveQueue(w http.ResponseWriter, r *http.Request, clientID string) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+	previews := 0
+	if raw := r.URL.Query().Get("preview"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			http.Error(w, "preview must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		previews = n
+	}
+	if previews > maxQueuePreviews {
+		previews = maxQueuePreviews
+	}
+	client, ok := h.server.loadClient(clientID)
+	if !ok {
+		http.Error(w, "Client not found", http.StatusNotFound)
+		return
+	}
+
+	queued := client.queued()
+	resp := struct {
+		ID       string        `json:"id"`
+		Length   int           `json:"length"`
+		Capacity int           `json:"capacity"`
+		Events   []queuedEvent `json:"events,omitempty"`
+	}{ID: client.ID, Length: len(queued), Capacity: cap(client.messages)}
+	for i, ev := range queued {
+		if i == previews {
+			break
+		}
+		resp.Events = append(resp.Events, previewEvent(ev))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// previewEvent describes ev with its payload truncated to
+// maxQueuePreviewSize bytes.
+func previewEvent(ev Event) queuedEvent {
+	preview := ev.Data
+	if len(preview) > maxQueuePreviewSize {
+		preview = preview[:maxQueuePreviewSize]
+	}
+	return queuedEvent{
+		Topic:     ev.Topic,
+		Name:      ev.Name,
+		Size:      len(ev.Data),
+		Preview:   string(preview),
+		Truncated: len(preview) < len(ev.Data),
+	}
+}
+
+// maxAdminPublishSize limits the body of POST /publish.
+const maxAdminPublishSize = 1 << 20
+
+// servePublish publishes the request body to a topic, a client or everyone.
+func (h *AdminHandler) servePublish(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+	query := r.URL.Query()
+	topic, clientID, broadcast := query.Get("topic"), query.Get("client"), query.Get("broadcast") == "true"
+	targets := 0
+	for _, set := range []bool{topic != "", clientID != "", broadcast} {
+		if set {
+			targets++
+		}
+	}
+	if targets != 1 {
+		http.Error(w, "Exactly one of topic, client or broadcast=true is required", http.StatusBadRequest)
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxAdminPublishSize))
+	if err != nil {
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	switch {
+	case topic != "":
+		h.server.logf(LevelInfo, "admin publish to topic %s (%d bytes)", topic, len(data))
+		err = h.server.Publish(topic, data)
+	case clientID != "":
+		h.server.logf(LevelInfo, "admin publish to client %s (%d bytes)", clientID, len(data))
+		err = h.server.SendMessageToClient(clientID, data)
+	default:
+		h.server.logf(LevelInfo, "admin broadcast (%d bytes)", len(data))
+		err = h.server.BroadcastMessage(data)
+	}
+	switch {
+	case errors.Is(err, ErrClientNotFound):
+		http.Error(w, "Client not found", http.StatusNotFound)
+	case errors.Is(err, ErrServerClosed), errors.Is(err, ErrMaintenance):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	default:
+		// Full buffers are partial failures: report how many clients missed it
+		writeJSON(w, http.StatusOK, struct {
+			Failed int `json:"failed"`
+		}{countErrors(err)})
+	}
+}
+
+// countErrors returns how many errors err joins, or 1 for a single error.
+func countErrors(err error) int {
+	if err == nil {
+		return 0
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return len(joined.Unwrap())
+	}
+	return 1
+}
+
+// allowMethods reports whether r uses one of methods, answering 405 Method
+// Not Allowed if not.
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if r.Method == method {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	return false
+}
+
+// writeJSON writes v as a JSON response with the given status.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,321 @@
+package gosse_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/Firoz01/gosse/v2"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// adminAuth admits requests carrying the test token.
+func adminAuth(r *http.Request) error {
+	if r.Header.Get("Authorization") != "Bearer admin" {
+		return errors.New("not an admin")
+	}
+	return nil
+}
+
+// adminRequest performs an authenticated admin request.
+func adminRequest(t *testing.T, method, url string, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer admin")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	return resp
+}
+
+func TestAdminHandler_DebugFrames(t *testing.T) {
+	// One event per thousand seconds, so the second event is throttled
+	server := gosse.NewServer(gosse.WithRateLimit(0.001, 1), gosse.WithInstanceID("edge-1"))
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	admin, err := gosse.NewAdminHandler(server, adminAuth)
+	if err != nil {
+		t.Fatalf("Unexpected error creating admin handler: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/admin/", http.StripPrefix("/admin", admin))
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		gosse.SSEHandlerEndpoint(server, w, r)
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	// Unauthenticated requests are rejected
+	resp, err := http.Get(ts.URL + "/admin/clients")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without credentials, got %s", resp.Status)
+	}
+
+	stream, err := http.Get(ts.URL + "/events")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer stream.Body.Close()
+
+	// Find the streaming client and turn on its debug frames
+	resp = adminRequest(t, http.MethodGet, ts.URL+"/admin/clients", "")
+	var clients []struct {
+		ID    string `json:"id"`
+		Debug bool   `json:"debug"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&clients); err != nil || len(clients) != 1 {
+		t.Fatalf("Expected one client, got %v (%v)", clients, err)
+	}
+	resp.Body.Close()
+	resp = adminRequest(t, http.MethodPut, ts.URL+"/admin/clients/"+clients[0].ID+"/debug", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected 204 enabling debug, got %s", resp.Status)
+	}
+
+	_ = server.BroadcastMessage([]byte("one"))
+	_ = server.BroadcastMessage([]byte("two"))
+
+	reader := bufio.NewReader(stream.Body)
+	found := make(chan bool)
+	go func() {
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				found <- false
+				return
+			}
+			if strings.HasPrefix(line, ": debug: throttled") {
+				found <- true
+				return
+			}
+		}
+	}()
+	select {
+	case ok := <-found:
+		if !ok {
+			t.Error("Expected a debug frame for the throttled event")
+		}
+	case <-time.After(time.Second):
+		t.Error("Timeout waiting for a debug frame")
+	}
+
+	// Unknown clients are reported
+	resp = adminRequest(t, http.MethodDelete, ts.URL+"/admin/clients/missing/debug", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown client, got %s", resp.Status)
+	}
+
+	// The root describes the instance
+	resp = adminRequest(t, http.MethodGet, ts.URL+"/admin/", "")
+	defer resp.Body.Close()
+	var instance struct {
+		InstanceID string `json:"instance_id"`
+		Clients    int    `json:"clients"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&instance); err != nil || instance.InstanceID != "edge-1" || instance.Clients != 1 {
+		t.Errorf("Unexpected instance description %+v (%v)", instance, err)
+	}
+}
+
+func TestNewAdminHandler_RequiresAuth(t *testing.T) {
+	if _, err := gosse.NewAdminHandler(gosse.NewServer(), nil); !errors.Is(err, gosse.ErrInvalidOption) {
+		t.Errorf("Expected ErrInvalidOption without auth, got %v", err)
+	}
+}
+
+func TestAdminHandler_Publish(t *testing.T) {
+	server := gosse.NewServer()
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	admin, err := gosse.NewAdminHandler(server, adminAuth)
+	if err != nil {
+		t.Fatalf("Unexpected error creating admin handler: %v", err)
+	}
+	ts := httptest.NewServer(admin)
+	defer ts.Close()
+
+	subscriber, err := server.SubscribeContext(context.Background(), "alerts")
+	if err != nil {
+		t.Fatalf("Unexpected error subscribing: %v", err)
+	}
+	other := server.AddClient()
+
+	// Publish in order: to the topic, to one client, then to everyone
+	for _, publish := range []struct{ query, data string }{
+		{"topic=alerts", "to the topic"},
+		{"client=" + other.ID, "to one client"},
+		{"broadcast=true", "to everyone"},
+	} {
+		resp := adminRequest(t, http.MethodPost, ts.URL+"/publish?"+publish.query, publish.data)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected 200 publishing with %s, got %s", publish.query, resp.Status)
+		}
+	}
+	for _, want := range []string{"to the topic", "to everyone"} {
+		if ev := <-subscriber.Messages(); string(ev.Data) != want {
+			t.Errorf("Expected %q for the subscriber, got %q", want, ev.Data)
+		}
+	}
+	for _, want := range []string{"to one client", "to everyone"} {
+		if ev := <-other.Messages(); string(ev.Data) != want {
+			t.Errorf("Expected %q for the other client, got %q", want, ev.Data)
+		}
+	}
+
+	// The topic lists the admin's event as its latest
+	resp := adminRequest(t, http.MethodGet, ts.URL+"/topics", "")
+	var topics []struct {
+		Name        string
+		Subscribers int
+		Retained    struct{ Preview string }
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&topics); err != nil {
+		t.Fatalf("Failed to decode topics: %v", err)
+	}
+	resp.Body.Close()
+	if len(topics) != 1 || topics[0].Name != "alerts" || topics[0].Subscribers != 1 || topics[0].Retained.Preview != "to the topic" {
+		t.Errorf("Unexpected topics %+v", topics)
+	}
+
+	for query, want := range map[string]int{
+		"":                            http.StatusBadRequest,
+		"topic=alerts&broadcast=true": http.StatusBadRequest,
+		"client=missing":              http.StatusNotFound,
+	} {
+		resp := adminRequest(t, http.MethodPost, ts.URL+"/publish?"+query, "x")
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("Expected %d publishing with %q, got %s", want, query, resp.Status)
+		}
+	}
+}
+
+func TestAdminHandler_Queue(t *testing.T) {
+	server := gosse.NewServer(gosse.WithBufferSize(4))
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	admin, err := gosse.NewAdminHandler(server, adminAuth)
+	if err != nil {
+		t.Fatalf("Unexpected error creating admin handler: %v", err)
+	}
+	ts := httptest.NewServer(admin)
+	defer ts.Close()
+
+	client := server.AddClient()
+	_ = server.SendMessageToClient(client.ID, []byte("first"))
+	_ = server.SendMessageToClient(client.ID, []byte(strings.Repeat("x", 300)))
+	_ = server.SendMessageToClient(client.ID, []byte("third"))
+
+	resp := adminRequest(t, http.MethodGet, ts.URL+"/clients/"+client.ID+"/queue?preview=2", "")
+	defer resp.Body.Close()
+	var queue struct {
+		Length   int `json:"length"`
+		Capacity int `json:"capacity"`
+		Events   []struct {
+			Size      int    `json:"size"`
+			Preview   string `json:"preview"`
+			Truncated bool   `json:"truncated"`
+		} `json:"events"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&queue); err != nil {
+		t.Fatalf("Failed to decode queue: %v", err)
+	}
+	if queue.Length != 3 || queue.Capacity != 4 || len(queue.Events) != 2 {
+		t.Fatalf("Unexpected queue %+v", queue)
+	}
+	if queue.Events[0].Preview != "first" || queue.Events[1].Size != 300 || !queue.Events[1].Truncated || len(queue.Events[1].Preview) != 256 {
+		t.Errorf("Unexpected previews %+v", queue.Events)
+	}
+
+	// Inspecting the queue leaves it intact and in order
+	for _, want := range []string{"first", strings.Repeat("x", 300), "third"} {
+		if ev := <-client.Messages(); string(ev.Data) != want {
+			t.Errorf("Expected %.10q after the snapshot, got %.10q", want, ev.Data)
+		}
+	}
+}
+
+func TestAdminHandler_Stream(t *testing.T) {
+	server := gosse.NewServer(gosse.WithBufferSize(1))
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	admin, err := gosse.NewAdminHandler(server, adminAuth)
+	if err != nil {
+		t.Fatalf("Unexpected error creating admin handler: %v", err)
+	}
+	ts := httptest.NewServer(admin)
+	defer ts.Close()
+
+	stream := adminRequest(t, http.MethodGet, ts.URL+"/stream", "")
+	defer stream.Body.Close()
+	if stream.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 for the stream, got %s", stream.Status)
+	}
+
+	client := server.AddClient()
+	_ = server.BroadcastMessage([]byte("one"))
+	_ = server.BroadcastMessage([]byte("two")) // The buffer holds one event
+	server.RemoveClient(client.ID)
+
+	type opsEvent struct {
+		Type   string `json:"type"`
+		Client string `json:"client"`
+		Reason string `json:"reason"`
+	}
+	events := make(chan opsEvent)
+	go func() {
+		defer close(events)
+		reader := bufio.NewReader(stream.Body)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			var ev opsEvent
+			if data, ok := strings.CutPrefix(strings.TrimSpace(line), "data: "); ok && json.Unmarshal([]byte(data), &ev) == nil {
+				events <- ev
+			}
+		}
+	}()
+	for _, want := range []opsEvent{
+		{Type: "connect", Client: client.ID},
+		{Type: "drop", Client: client.ID},
+		{Type: "disconnect", Client: client.ID, Reason: string(gosse.DisconnectClientRemoved)},
+	} {
+		select {
+		case ev := <-events:
+			if ev != want {
+				t.Errorf("Expected %+v, got %+v", want, ev)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timeout waiting for %+v", want)
+		}
+	}
+}
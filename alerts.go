@@ -0,0 +1,182 @@
+package gosse
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// AlertMetric names a value that WithAlert can watch.
+type AlertMetric string
+
+const (
+	// AlertDropRate is the share of events lost to full buffers among those
+	// sent to clients since the previous check, from 0 to 1.
+	AlertDropRate AlertMetric = "drop_rate"
+	// AlertQueueUtilization is how full the fullest client buffer is, from
+	// 0 to 1.
+	AlertQueueUtilization AlertMetric = "queue_utilization"
+	// AlertConnectFailures is the number of clients per second that could
+	// not be added since the previous check (see Metrics.ConnectFailures).
+	AlertConnectFailures AlertMetric = "connect_failures"
+)
+
+// defaultAlertInterval is how often thresholds are checked when
+// WithAlertInterval is not set.
+const defaultAlertInterval = 10 * time.Second
+
+// Alert reports a watched metric crossing its threshold.
+type Alert struct {
+	Metric    AlertMetric
+	Value     float64   // The value that crossed the threshold.
+	Threshold float64   // The threshold given to WithAlert.
+	At        time.Time // When the value was measured.
+
+	// Resolved is false when the value rises above the threshold and true
+	// when it falls back to or below it.
+	Resolved bool
+}
+
+// String describes the alert for logs.
+func (a Alert) String() string {
+	if a.Resolved {
+		return fmt.Sprintf("%s resolved: %.3g is back within %.3g", a.Metric, a.Value, a.Threshold)
+	}
+	return fmt.Sprintf("%s above threshold: %.3g > %.3g", a.Metric, a.Value, a.Threshold)
+}
+
+// alertRule is a threshold registered with WithAlert.
+type alertRule struct {
+	metric    AlertMetric
+	threshold float64
+	fn        func(Alert)
+}
+
+// WithAlert calls fn when metric rises above threshold, and again with
+// Alert.Resolved set once it falls back, so operators can page or scale
+// without scraping metrics. Drop rate and queue utilization thresholds are
+// fractions between 0 and 1; connect failures are counted per second.
+//
+// Thresholds are checked every WithAlertInterval while Run is running. fn
+// is called from the checking goroutine, so it should hand slow work off.
+// WithAlert may be given several times, including for the same metric to
+// set warning and critical levels.
+func WithAlert(metric AlertMetric, threshold float64, fn func(Alert)) Option {
+	return func(o *options) error {
+		switch metric {
+		case AlertDropRate, AlertQueueUtilization:
+			if threshold < 0 || threshold >= 1 {
+				return invalidOption("WithAlert", threshold, fmt.Sprintf("%s threshold must be at least 0 and below 1", metric))
+			}
+		case AlertConnectFailures:
+			if threshold < 0 {
+				return invalidOption("WithAlert", threshold, "connect_failures threshold must not be negative")
+			}
+		default:
+			return invalidOption("WithAlert", metric, "unknown metric")
+		}
+		if fn == nil {
+			return invalidOption("WithAlert", "nil", "callback must not be nil")
+		}
+		o.alerts = append(o.alerts, alertRule{metric: metric, threshold: threshold, fn: fn})
+		return nil
+	}
+}
+
+// WithAlertInterval sets how often the thresholds set with WithAlert are
+// checked. The default is 10 seconds.
+func WithAlertInterval(interval time.Duration) Option {
+	return func(o *options) error {
+		if interval < time.Millisecond {
+			return invalidOption("WithAlertInterval", interval, "must be at least 1ms")
+		}
+		o.alertInterval = interval
+		return nil
+	}
+}
+
+// alertSample holds the counters at the previous check, so rates cover
+// only the time since.
+type alertSample struct {
+	at              time.Time
+	delivered       uint64
+	dropped         uint64
+	connectFailures uint64
+}
+
+// watchAlerts checks the alert thresholds until the server shuts down.
+func (s *Server) watchAlerts() {
+	ticker := time.NewTicker(s.opts.alertInterval)
+	defer ticker.Stop()
+	breached := make([]bool, len(s.opts.alerts))
+	last := s.alertSample(time.Now())
+	for {
+		select {
+		case tick := <-ticker.C:
+			sample := s.alertSample(tick)
+			values := s.alertValues(last, sample)
+			last = sample
+			for i, rule := range s.opts.alerts {
+				value := values[rule.metric]
+				if above := value > rule.threshold; above != breached[i] {
+					breached[i] = above
+					s.alert(rule, Alert{
+						Metric:    rule.metric,
+						Value:     value,
+						Threshold: rule.threshold,
+						At:        s.opts.now(),
+						Resolved:  !above,
+					})
+				}
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// alertSample reads the counters the alert metrics are derived from.
+func (s *Server) alertSample(at time.Time) alertSample {
+	return alertSample{
+		at:              at,
+		delivered:       atomic.LoadUint64(&s.metrics.delivered),
+		dropped:         atomic.LoadUint64(&s.metrics.dropped),
+		connectFailures: atomic.LoadUint64(&s.metrics.connectFailures),
+	}
+}
+
+// alertValues computes each alert metric from the counters at two checks.
+func (s *Server) alertValues(last, now alertSample) map[AlertMetric]float64 {
+	values := make(map[AlertMetric]float64, 3)
+	delivered, dropped := now.delivered-last.delivered, now.dropped-last.dropped
+	if sent := delivered + dropped; sent > 0 {
+		values[AlertDropRate] = float64(dropped) / float64(sent)
+	}
+	if elapsed := now.at.Sub(last.at).Seconds(); elapsed > 0 {
+		values[AlertConnectFailures] = float64(now.connectFailures-last.connectFailures) / elapsed
+	}
+	s.rangeClients(func(client *Client) bool {
+		if used := float64(len(client.messages)) / float64(cap(client.messages)); used > values[AlertQueueUtilization] {
+			values[AlertQueueUtilization] = used
+		}
+		return true
+	})
+	return values
+}
+
+// alert logs a, reports it on the monitor stream and passes it to the
+// rule's callback.
+func (s *Server) alert(rule alertRule, a Alert) {
+	if a.Resolved {
+		s.logf(LevelInfo, "alert %s", a)
+	} else {
+		s.logf(LevelWarn, "alert %s", a)
+	}
+	s.emitOps(opsEvent{Type: "alert", Alert: &opsAlert{
+		Metric:    a.Metric,
+		Value:     a.Value,
+		Threshold: a.Threshold,
+		Resolved:  a.Resolved,
+	}})
+	rule.fn(a)
+}
@@ -0,0 +1,162 @@
+package gosse
+
+import (
+	"sort"
+	"sync/atomic"
+)
+
+// AliasMetrics counts the use of a topic alias (see AddTopicAlias). Once
+// both counters stop growing and Metrics.Topics lists no subscribers for
+// the alias, nothing uses the old name any more and the alias can go.
+type AliasMetrics struct {
+	Topic      string // Topic the alias stands for.
+	Publishes  uint64 // Publishes to the alias name.
+	Deliveries uint64 // Events queued for clients subscribed by the alias name.
+}
+
+// topicAlias is a registered alias and its counters.
+type topicAlias struct {
+	alias, topic string
+	publishes    uint64
+	deliveries   uint64
+}
+
+// aliasTable is the registered aliases, replaced as a whole on changes.
+type aliasTable struct {
+	byAlias map[string]*topicAlias   // Alias name to the alias
+	byTopic map[string][]*topicAlias // Topic to the aliases standing for it
+}
+
+// AddTopicAlias makes alias another name of topic while a topic is being
+// renamed: events published to either name are delivered to the clients
+// subscribed to either, so publishers and subscribers can move to the new
+// name independently. Publishes to the alias are treated as publishes to
+// topic, which keeps the topic's history, retained event and metrics; the
+// alias's use is counted in Metrics.TopicAliases. Adding an alias again
+// points it at the new topic and restarts its counters.
+//
+// AddTopicAlias returns an error wrapping ErrInvalidOption if either name
+// is empty, they are equal, alias is itself aliased by another name, or
+// topic is an alias: aliases do not chain.
+func (s *Server) AddTopicAlias(alias, topic string) error {
+	if s == nil {
+		return ErrNilServer
+	}
+	if err := validateTopics("AddTopicAlias", alias, topic); err != nil {
+		return err
+	}
+	if alias == topic {
+		return invalidOption("AddTopicAlias", alias, "alias and topic must differ")
+	}
+	s.aliasesM.Lock()
+	defer s.aliasesM.Unlock()
+	current := s.aliases.Load()
+	if current != nil {
+		if len(current.byTopic[alias]) > 0 {
+			return invalidOption("AddTopicAlias", alias, "topic has aliases of its own")
+		}
+		if current.byAlias[topic] != nil {
+			return invalidOption("AddTopicAlias", topic, "topic is an alias")
+		}
+	}
+	s.storeAliases(current, alias, &topicAlias{alias: alias, topic: topic})
+	return nil
+}
+
+// RemoveTopicAlias removes alias, so its name is an ordinary topic again.
+// Removing an unknown alias does nothing.
+func (s *Server) RemoveTopicAlias(alias string) {
+	if s == nil {
+		return
+	}
+	s.aliasesM.Lock()
+	defer s.aliasesM.Unlock()
+	if current := s.aliases.Load(); current != nil && current.byAlias[alias] != nil {
+		s.storeAliases(current, alias, nil)
+	}
+}
+
+// storeAliases replaces the aliases with a copy of current in which alias
+// is replaced by added, or removed if added is nil. Callers hold aliasesM.
+func (s *Server) storeAliases(current *aliasTable, alias string, added *topicAlias) {
+	// Build a new table rather than edit current: publishes resolve their
+	// topic from the table they loaded without taking aliasesM, and the
+	// topicAlias entries carried over keep their counters
+	next := &aliasTable{byAlias: make(map[string]*topicAlias), byTopic: make(map[string][]*topicAlias)}
+	if current != nil {
+		for name, a := range current.byAlias {
+			if name != alias {
+				next.byAlias[name] = a
+			}
+		}
+	}
+	if added != nil {
+		next.byAlias[alias] = added
+	}
+	names := make([]string, 0, len(next.byAlias))
+	for name := range next.byAlias {
+		names = append(names, name)
+	}
+	sort.Strings(names) // Clients subscribed by several names match the first
+	for _, name := range names {
+		a := next.byAlias[name]
+		next.byTopic[a.topic] = append(next.byTopic[a.topic], a)
+	}
+	if len(next.byAlias) == 0 {
+		next = nil
+	}
+	s.aliases.Store(next)
+}
+
+// resolve returns the topic that name stands for, counting a publish to
+// the alias if it is one, and the aliases of that topic.
+func (t *aliasTable) resolve(name string) (string, []*topicAlias) {
+	if t == nil {
+		return name, nil
+	}
+	if a := t.byAlias[name]; a != nil {
+		atomic.AddUint64(&a.publishes, 1)
+		name = a.topic
+	}
+	return name, t.byTopic[name]
+}
+
+// of returns the aliases of topic.
+func (t *aliasTable) of(topic string) []*topicAlias {
+	if t == nil {
+		return nil
+	}
+	return t.byTopic[topic]
+}
+
+// match returns the name by which client is subscribed to topic, whose
+// aliases are aliases, and the alias if it is one; name is empty if the
+// client is not subscribed by any of them.
+func match(client *Client, topic string, aliases []*topicAlias) (name string, alias *topicAlias) {
+	if client.subscribed(topic) {
+		return topic, nil
+	}
+	for _, a := range aliases {
+		if client.subscribed(a.alias) {
+			return a.alias, a
+		}
+	}
+	return "", nil
+}
+
+// aliasMetrics returns the counters of every alias, nil if there are none.
+func (s *Server) aliasMetrics() map[string]AliasMetrics {
+	t := s.aliases.Load()
+	if t == nil {
+		return nil
+	}
+	m := make(map[string]AliasMetrics, len(t.byAlias))
+	for name, a := range t.byAlias {
+		m[name] = AliasMetrics{
+			Topic:      a.topic,
+			Publishes:  atomic.LoadUint64(&a.publishes),
+			Deliveries: atomic.LoadUint64(&a.deliveries),
+		}
+	}
+	return m
+}
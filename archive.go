@@ -0,0 +1,135 @@
+package gosse
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// archiveRecord is one line of an archive: an event as JSON, with Data in
+// standard base64 so binary payloads survive.
+type archiveRecord struct {
+	Time   time.Time `json:"time"`
+	Topic  string    `json:"topic"`
+	ID     string    `json:"id,omitempty"`
+	Name   string    `json:"name,omitempty"`
+	Key    string    `json:"key,omitempty"`
+	Schema int       `json:"schema,omitempty"`
+	Data   []byte    `json:"data"`
+
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// ArchiveSink is a BatchSink writing events to an io.Writer as JSON lines,
+// one object per event with its publish time, topic, ID, name, key, schema
+// version, fields and base64 data, ready for ReplayArchive. Each batch is written
+// with a single Write call.
+type ArchiveSink struct {
+	mu  sync.Mutex
+	w   io.Writer
+	buf []byte
+}
+
+// NewArchiveSink returns an ArchiveSink writing to w, such as a file opened
+// for appending.
+func NewArchiveSink(w io.Writer) *ArchiveSink {
+	return &ArchiveSink{w: w}
+}
+
+// Write archives ev.
+func (a *ArchiveSink) Write(ev Event) error {
+	return a.WriteBatch([]Event{ev})
+}
+
+// WriteBatch archives events.
+func (a *ArchiveSink) WriteBatch(events []Event) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.buf = a.buf[:0]
+	for _, ev := range events {
+		line, err := json.Marshal(archiveRecord{
+			Time:   ev.PublishedAt(),
+			Topic:  ev.Topic,
+			ID:     ev.ID,
+			Name:   ev.Name,
+			Key:    ev.Key,
+			Schema: ev.Schema,
+			Data:   ev.Data,
+			Fields: ev.Fields,
+		})
+		if err != nil {
+			return err
+		}
+		a.buf = append(append(a.buf, line...), '\n')
+	}
+	_, err := a.w.Write(a.buf)
+	return err
+}
+
+// maxArchiveLine bounds a line of an archive read by ReplayArchive.
+const maxArchiveLine = 16 << 20
+
+// ReplayArchive republishes the events archived in r by an ArchiveSink to
+// their topics on s, and broadcasts those archived without one, for demos, debugging and reproducing regressions. The
+// gaps between events are kept, divided by speed, so 1 replays at the
+// original pace and 10 ten times faster; zero publishes them back to back.
+// Events get new IDs if s keeps a history. Full subscriber buffers do not
+// stop the replay; it stops when ctx is done, at a malformed line or when
+// a publish is rejected as a whole, returning the number of events
+// republished so far and the error.
+func ReplayArchive(ctx context.Context, s *Server, r io.Reader, speed float64) (int, error) {
+	if s == nil {
+		return 0, ErrNilServer
+	}
+	if speed < 0 {
+		return 0, invalidOption("ReplayArchive", speed, "speed must not be negative")
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxArchiveLine)
+	var first time.Time
+	start := time.Now()
+	n := 0
+	for line := 1; scanner.Scan(); line++ {
+		var rec archiveRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return n, fmt.Errorf("replay archive: line %d: %w", line, err)
+		}
+		if first.IsZero() {
+			first = rec.Time
+		}
+		if speed > 0 && !rec.Time.IsZero() {
+			due := start.Add(time.Duration(float64(rec.Time.Sub(first)) / speed))
+			timer := time.NewTimer(time.Until(due))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return n, fmt.Errorf("replay archive: %w", ctx.Err())
+			case <-timer.C:
+			}
+		} else if err := ctx.Err(); err != nil {
+			return n, fmt.Errorf("replay archive: %w", err)
+		}
+		ev := Event{Data: rec.Data, Topic: rec.Topic, Name: rec.Name, Key: rec.Key, Schema: rec.Schema, Fields: rec.Fields}
+		if err := ev.validate(); err != nil {
+			return n, fmt.Errorf("replay archive: line %d: %w", line, err)
+		}
+		var err error
+		if ev.Topic == "" {
+			_, err = s.fanOutAll(ev)
+		} else {
+			_, err = s.fanOut(ev)
+		}
+		if err != nil {
+			return n, fmt.Errorf("replay archive: line %d: %w", line, err)
+		}
+		n++
+	}
+	if err := scanner.Err(); err != nil {
+		return n, fmt.Errorf("replay archive: %w", err)
+	}
+	return n, nil
+}
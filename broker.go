@@ -0,0 +1,190 @@
+package gosse
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+)
+
+// Broker carries events between the servers of a distributed deployment,
+// so that an event published on one instance reaches the clients connected
+// to all of them (see WithBroker). Implementations wrap a message bus such
+// as Redis pub/sub (see the redis package), NATS or Kafka; MemoryBroker
+// connects servers within one process.
+//
+// Publish hands ev, published on the instance named origin, to the bus. It
+// is called on the publishing goroutine, after the local clients have the
+// event, so it should not wait long; ev.Data must not be kept after it
+// returns. Subscribe is called once, when Run starts, and from then on
+// deliver must be called with every event published to the bus, by any
+// instance including this one, in the order the bus delivers them. Close
+// is called once, by Shutdown, and ends the subscription.
+type Broker interface {
+	Publish(origin string, ev Event) error
+	Subscribe(deliver func(origin string, ev Event)) error
+	Close() error
+}
+
+// WithBroker attaches the server to broker. Broadcasts (BroadcastMessage,
+// BroadcastEvent, BroadcastJSON and the like) and events published to
+// topics, including those replayed with ReplayArchive, are handed to the
+// broker once the local clients have them, and events other instances hand
+// to it are delivered here as if published locally, except that they skip
+// WithPublishRate. Instances tell their own events apart by WithInstanceID,
+// which must therefore differ between them. Events keep their data, topic,
+// name, partition key, retry, schema and fields, and their history ID (see
+// WithHistory): an instance whose history is behind adopts the ID, so one
+// fed only by the publishing instance, such as a standby (see
+// WithStandby), numbers its history the same way and clients resume there
+// with the Last-Event-ID they had. Otherwise each instance numbers events
+// after its own newest. Targeted messages, rooms and BroadcastWhere stay
+// local, as do the events of routes (see AddRoute), which each instance
+// applies to the events it receives. Without a broker the server stands
+// alone.
+//
+// Failures of the broker are logged and do not fail the publish.
+func WithBroker(broker Broker) Option {
+	return func(o *options) error {
+		if broker == nil {
+			return invalidOption("WithBroker", "nil", "must not be nil")
+		}
+		o.broker = broker
+		return nil
+	}
+}
+
+// subscribeBroker starts delivering the broker's events, if there is one.
+func (s *Server) subscribeBroker() {
+	if s.opts.broker == nil {
+		return
+	}
+	if err := s.opts.broker.Subscribe(s.fromBroker); err != nil {
+		s.logf(LevelError, "broker subscribe failed, events of other instances will not arrive: %v", err)
+	}
+}
+
+// closeBroker ends the broker's subscription, if there is one.
+func (s *Server) closeBroker() {
+	if s.opts.broker == nil {
+		return
+	}
+	if err := s.opts.broker.Close(); err != nil {
+		s.logf(LevelWarn, "broker close failed: %v", err)
+	}
+}
+
+// relay hands ev, published here, to the broker, if there is one.
+func (s *Server) relay(ev Event) {
+	if s.opts.broker == nil {
+		return
+	}
+	out := Event{Data: ev.Data, Topic: ev.Topic, ID: ev.ID, Name: ev.Name, Key: ev.Key, Retry: ev.Retry, Schema: ev.Schema, Fields: ev.Fields}
+	if err := s.opts.broker.Publish(s.opts.instanceID, out); err != nil {
+		s.logf(LevelWarn, "broker publish failed, other instances miss the event: %v", err)
+	}
+}
+
+// fromBroker delivers an event the broker received from origin to the
+// local clients, unless it was published here.
+func (s *Server) fromBroker(origin string, ev Event) {
+	if origin == s.opts.instanceID {
+		return
+	}
+	ev = Event{Data: ev.Data, Topic: ev.Topic, ID: ev.ID, Name: ev.Name, Key: ev.Key, Retry: ev.Retry, Schema: ev.Schema, Fields: ev.Fields}
+	if seq, err := strconv.ParseUint(ev.ID, 10, 64); err == nil && s.history != nil {
+		ev.seq = seq // Adopted by the history if it is ahead
+	}
+	var err error
+	if ev.Topic != "" {
+		if _, err = s.offer(ev, false); err == nil {
+			s.route(ev, 0)
+		}
+	} else {
+		_, err = s.offerAll(ev, false) // Full buffers are counted in Metrics
+	}
+	if err != nil {
+		s.logf(LevelDebug, "broker event from %s not delivered: %v", origin, err)
+	}
+}
+
+// MemoryBroker is a Broker for servers within one process, for tests and
+// for running several servers, for example one per tenant, that share
+// their events. Connect attaches one server:
+//
+//	broker := gosse.NewMemoryBroker()
+//	a := gosse.NewServer(gosse.WithInstanceID("a"), gosse.WithBroker(broker.Connect()))
+//	b := gosse.NewServer(gosse.WithInstanceID("b"), gosse.WithBroker(broker.Connect()))
+//
+// Events are delivered on the publishing goroutine.
+type MemoryBroker struct {
+	mu    sync.Mutex
+	conns map[*memoryConn]struct{}
+}
+
+// NewMemoryBroker returns a MemoryBroker without connections.
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{conns: make(map[*memoryConn]struct{})}
+}
+
+// Connect returns a new connection to the broker, to be passed to
+// WithBroker. Every connection receives the events of all of them.
+func (b *MemoryBroker) Connect() Broker {
+	return &memoryConn{broker: b}
+}
+
+// memoryConn is one server's connection to a MemoryBroker.
+type memoryConn struct {
+	broker  *MemoryBroker
+	mu      sync.Mutex
+	deliver func(origin string, ev Event) // Set by Subscribe, nil before
+	closed  bool
+}
+
+// Publish implements Broker.
+func (c *memoryConn) Publish(origin string, ev Event) error {
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if closed {
+		return errors.New("memory broker: connection closed")
+	}
+	b := c.broker
+	b.mu.Lock()
+	deliver := make([]func(string, Event), 0, len(b.conns))
+	for conn := range b.conns {
+		deliver = append(deliver, conn.deliver)
+	}
+	b.mu.Unlock()
+	for _, d := range deliver {
+		d(origin, ev)
+	}
+	return nil
+}
+
+// Subscribe implements Broker.
+func (c *memoryConn) Subscribe(deliver func(origin string, ev Event)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return errors.New("memory broker: connection closed")
+	}
+	if c.deliver != nil {
+		return errors.New("memory broker: already subscribed")
+	}
+	c.deliver = deliver
+	c.broker.mu.Lock()
+	c.broker.conns[c] = struct{}{}
+	c.broker.mu.Unlock()
+	return nil
+}
+
+// Close implements Broker.
+func (c *memoryConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	c.broker.mu.Lock()
+	delete(c.broker.conns, c)
+	c.broker.mu.Unlock()
+	return nil
+}
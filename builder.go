@@ -0,0 +1,82 @@
+package gosse
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// Builder assembles a Server and its Handler step by step and validates the
+// whole setup before starting anything, for setups that combine several
+// subsystems. Simple servers are easier to create with New.
+//
+//	server, handler, err := gosse.Build().
+//		With(gosse.ProfileNotifications()).
+//		WithAuth(checkToken).
+//		Start(ctx)
+//
+// A Builder is not safe for concurrent use.
+type Builder struct {
+	opts        []Option
+	handlerOpts []HandlerOption
+}
+
+// Build returns an empty Builder.
+func Build() *Builder {
+	return &Builder{}
+}
+
+// With adds server Options.
+func (b *Builder) With(opts ...Option) *Builder {
+	b.opts = append(b.opts, opts...)
+	return b
+}
+
+// WithHandler adds HandlerOptions for the Handler returned by Start.
+func (b *Builder) WithHandler(opts ...HandlerOption) *Builder {
+	b.handlerOpts = append(b.handlerOpts, opts...)
+	return b
+}
+
+// WithAuth is shorthand for WithHandler(WithHandlerAuth(auth)).
+func (b *Builder) WithAuth(auth func(r *http.Request) error) *Builder {
+	return b.WithHandler(WithHandlerAuth(auth))
+}
+
+// Validate reports every problem with the server and handler settings,
+// each wrapping ErrInvalidOption, without creating anything.
+func (b *Builder) Validate() error {
+	_, _, err := b.build()
+	return err
+}
+
+// Start validates the setup, then creates and runs the Server and returns
+// it with a Handler serving it. The server is shut down when ctx is done.
+// If the setup is invalid, nothing is started and the returned error lists
+// every problem.
+func (b *Builder) Start(ctx context.Context) (*Server, *Handler, error) {
+	server, handler, err := b.build()
+	if err != nil {
+		return nil, nil, err
+	}
+	go server.Run()
+	go func() {
+		select {
+		case <-ctx.Done():
+			server.Shutdown()
+		case <-server.done:
+		}
+	}()
+	return server, handler, nil
+}
+
+// build creates the server and handler without starting them, reporting
+// the errors of both together.
+func (b *Builder) build() (*Server, *Handler, error) {
+	server, serverErr := New(b.opts...)
+	handler, handlerErr := NewHandler(server, b.handlerOpts...)
+	if err := errors.Join(serverErr, handlerErr); err != nil {
+		return nil, nil, err
+	}
+	return server, handler, nil
+}
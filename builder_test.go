@@ -0,0 +1,69 @@
+package gosse_test
+
+import (
+	"context"
+	"errors"
+	"github.com/Firoz01/gosse/v2"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuilder_Start(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server, handler, err := gosse.Build().
+		With(gosse.ProfileTicker()).
+		WithHandler(gosse.WithHandlerTopics("prices")).
+		WithAuth(func(r *http.Request) error { return nil }).
+		Start(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error starting: %v", err)
+	}
+
+	// The server is running and the handler serves it
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+	resp, err := http.Get(ts.URL + "?topic=news")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected the handler options to apply, got %s", resp.Status)
+	}
+	if server.AddClient() == nil {
+		t.Error("Expected the server to be running")
+	}
+
+	// Canceling the context shuts the server down
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for server.BroadcastMessage(nil) == nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := server.BroadcastMessage(nil); !errors.Is(err, gosse.ErrServerClosed) {
+		t.Errorf("Expected ErrServerClosed after cancel, got %v", err)
+	}
+}
+
+func TestBuilder_ValidatesEverythingFirst(t *testing.T) {
+	b := gosse.Build().
+		With(gosse.WithBufferSize(0)).
+		WithHandler(gosse.WithHandlerHeartbeat(-time.Second))
+	err := b.Validate()
+	if !errors.Is(err, gosse.ErrInvalidOption) {
+		t.Fatalf("Expected ErrInvalidOption, got %v", err)
+	}
+	for _, name := range []string{"WithBufferSize", "WithHandlerHeartbeat"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("Expected error to mention %s, got %v", name, err)
+		}
+	}
+	if server, _, err := b.Start(context.Background()); server != nil || err == nil {
+		t.Errorf("Expected Start to fail without a server, got %v, %v", server, err)
+	}
+}
@@ -0,0 +1,128 @@
+package gosse
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Capabilities are what a client declared it can handle when it connected,
+// so transforms (see WithHandlerTransform) can tailor events to each
+// generation of consumers during a rollout. Clients declare them as a
+// comma-separated list in the "capabilities" query parameter, which
+// EventSource can send, or the SSE-Capabilities header, for example
+// "binary,patches,max-event-size=65536,compression=zstd". Capabilities a
+// handler does not know are kept in Other, for application-defined ones.
+type Capabilities struct {
+	Binary       bool     // Accepts binary payloads, such as base64-encoded or compressed data
+	Patches      bool     // Accepts patches against earlier events instead of full payloads
+	MaxEventSize int      // Largest payload the client accepts in bytes, 0 for no limit
+	Other        []string // Unrecognized capabilities, in the order given
+
+	// Compression names the payload codecs the client decodes, one per
+	// "compression" capability, in the order given (see
+	// WithHandlerPayloadCodecs).
+	Compression []string
+}
+
+// Has reports whether the client declared the application-defined
+// capability name.
+func (c Capabilities) Has(name string) bool {
+	for _, other := range c.Other {
+		if other == name {
+			return true
+		}
+	}
+	return false
+}
+
+// maxCapabilities bounds the capabilities kept per client.
+const maxCapabilities = 32
+
+// requestedCapabilities returns the capabilities declared by the request's
+// "capabilities" query parameter and SSE-Capabilities headers.
+func requestedCapabilities(r *http.Request) (Capabilities, error) {
+	var caps Capabilities
+	lists := append(r.URL.Query()["capabilities"], r.Header.Values("SSE-Capabilities")...)
+	for _, list := range lists {
+		for _, token := range strings.Split(list, ",") {
+			token = strings.ToLower(strings.TrimSpace(token))
+			name, value, hasValue := strings.Cut(token, "=")
+			switch {
+			case token == "":
+			case name == "binary" && !hasValue:
+				caps.Binary = true
+			case name == "patches" && !hasValue:
+				caps.Patches = true
+			case name == "max-event-size":
+				size, err := strconv.ParseUint(value, 10, 31)
+				if err != nil || size == 0 {
+					return Capabilities{}, invalidOption("capabilities", strconv.Quote(token), "max-event-size must be a positive number of bytes")
+				}
+				caps.MaxEventSize = int(size)
+			case name == "compression" && hasValue:
+				if !validCodecName(value) {
+					return Capabilities{}, invalidOption("capabilities", strconv.Quote(token), "compression must name a codec")
+				}
+				if len(caps.Compression) < maxCapabilities {
+					caps.Compression = append(caps.Compression, value)
+				}
+			case len(caps.Other) < maxCapabilities:
+				caps.Other = append(caps.Other, token)
+			}
+		}
+	}
+	return caps, nil
+}
+
+// Capabilities returns what the client declared it can handle when it
+// connected through a Handler, or the zero value for other clients.
+func (c *Client) Capabilities() Capabilities {
+	caps := c.capabilities
+	caps.Other = append([]string(nil), caps.Other...)
+	caps.Compression = append([]string(nil), caps.Compression...)
+	return caps
+}
+
+// WithHandlerTransform rewrites each event before it is written to a
+// stream, or drops it by returning false, with the client it is written to
+// at hand, so payloads can be tailored to what the client can handle (see
+// Client.Capabilities). It applies to live events, replayed events and the
+// final event of WithShutdownEvent, after any schema conversion (see
+// WithHandlerSchemas), and runs on the connection's goroutine.
+// The event passed in is shared with other clients: transform must not
+// modify its Data in place.
+func WithHandlerTransform(transform func(client *Client, ev Event) (Event, bool)) HandlerOption {
+	return func(h *Handler) error {
+		if transform == nil {
+			return invalidOption("WithHandlerTransform", "nil", "must not be nil")
+		}
+		h.transform = transform
+		return nil
+	}
+}
+
+// transformed is ev as converted and transformed for client, and false if
+// it is dropped.
+func (h *Handler) transformed(client *Client, ev Event) (Event, bool) {
+	out := ev
+	if h.schemas != nil {
+		converted, err := h.schemas.convert(ev, client.schema)
+		if err != nil {
+			h.server.logf(LevelWarn, "not sending event to client %s: %v", client.ID, err)
+			h.server.traceDelivery(ev, client.ID, DeliveryDropped, err)
+			return ev, false
+		}
+		out = converted
+	}
+	if h.transform == nil {
+		return out, true
+	}
+	out, ok := h.transform(client, out)
+	if !ok {
+		h.server.traceDelivery(ev, client.ID, DeliveryDropped, errTransformDropped)
+	} else if out.Trace == "" {
+		out.Trace = ev.Trace // Follow the event through transforms that rebuild it
+	}
+	return out, ok
+}
@@ -0,0 +1,56 @@
+package gosse
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// checkpointEvent names the frames written by WithHandlerCheckpoints.
+const checkpointEvent = "checkpoint"
+
+// WithHandlerCheckpoints writes a "checkpoint" event to every live stream
+// each interval, so consumers without acknowledgements can persist their
+// progress cheaply instead of storing every event ID. Its data holds the
+// ID of the last event written to the stream, the position the consumer
+// resumes from with Last-Event-ID or the "last_event_id" query parameter,
+// and the server's time:
+//
+//	{"last_event_id":"42","time":"2024-05-01T12:00:00Z"}
+//
+// last_event_id is left out until the stream has resumed from or written
+// an event with an ID (see WithHistory). Checkpoints are not written during
+// a replay.
+func WithHandlerCheckpoints(interval time.Duration) HandlerOption {
+	return func(h *Handler) error {
+		if interval <= 0 {
+			return invalidOption("WithHandlerCheckpoints", interval, "must be positive")
+		}
+		h.checkpoints = interval
+		return nil
+	}
+}
+
+// checkpoint formats the checkpoint frame for a stream whose last event ID
+// is lastID, at now.
+func checkpoint(lastID string, now time.Time) string {
+	data, _ := json.Marshal(struct {
+		LastEventID string    `json:"last_event_id,omitempty"`
+		Time        time.Time `json:"time"`
+	}{lastID, now.UTC()})
+	return "event: " + checkpointEvent + "\ndata: " + string(data) + "\n\n"
+}
+
+// writeEvent writes the frame of ev, keeping track of the stream's last
+// event ID for checkpoints.
+func (h *Handler) writeEvent(fw *frameWriter, ev Event) error {
+	if err := fw.write(h.frame(ev, fw.codec)); err != nil {
+		h.server.traceDelivery(ev, fw.client.ID, DeliveryDropped, err)
+		return err
+	}
+	h.server.traceDelivery(ev, fw.client.ID, DeliveryWritten, nil)
+	fw.client.wrote()
+	if ev.ID != "" {
+		fw.lastID = ev.ID
+	}
+	return nil
+}
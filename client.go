@@ -0,0 +1,428 @@
+package gosse
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Client represents a single SSE (Server-Sent Events) client connection.
+// It contains fields for uniquely identifying the client, managing message
+// communication, and tracking connection and activity times.
+//
+// The message channel is owned by the Server: it is only written by the
+// Server's send methods and closed when the client is removed, which keeps
+// callers from sending on or closing it by mistake. Use Messages to read it.
+type Client struct {
+	ID          string    // Unique identifier for the client.
+	ConnectedAt time.Time // Timestamp when the client initially connected to the server.
+
+	messages     chan Event   // Channel for receiving messages from the server.
+	mu           sync.RWMutex // Held for reading by sends and for writing by close, so messages is never sent on after closing
+	infoM        sync.Mutex   // Guards lastActiveAt, lastWriteAt and the disconnect record below
+	lastActiveAt time.Time    // Timestamp of the client's last activity, updated on each message received
+	lastWriteAt  time.Time    // When a Handler last wrote an event to the client's stream
+	endedAt      time.Time    // When the client disconnected
+	reason       DisconnectReason
+	reasonErr    error
+	closed       bool          // Set once messages has been closed
+	done         chan struct{} // Closed by close to wake up sends blocked on a full message channel
+	registered   chan struct{} // Closed by the Run loop once the client is stored
+	closeOnce    sync.Once     // Ensures messages is closed exactly once
+	now          func() time.Time
+	onClose      func(ClientInfo)       // Called once with the final record after close
+	server       *Server                // Server the client was added to, for Send and Close
+	topics       map[string]struct{}    // Topics the client receives Publish calls for; set before registration and read-only afterwards
+	onDrop       func(Event)            // Called for every event lost to a full buffer
+	debug        int32                  // Set to 1 (atomically) while debug frames are enabled
+	notes        chan string            // Debug notes waiting to be written as comment frames; full means notes are dropped
+	filter       atomic.Pointer[Filter] // Selects the broadcasts and topic events delivered, nil for all
+	samplingM    sync.Mutex
+	samplers     map[string]*sampler // Topic to its sampling, guarded by samplingM
+	identity     *identity           // Shared state of the client's coalesced identity, nil if none; set before registration
+	streamed     bool                // Consumed by a Handler, which honors barrier events; set before registration
+
+	partitionM sync.Mutex                           // Serializes SetPartition
+	partitions atomic.Pointer[map[string]Partition] // Topic to the client's partition of it, replaced as a whole
+	groupM     sync.Mutex                           // Serializes SetGroup
+	groups     atomic.Pointer[map[string]string]    // Topic to the client's group for it, replaced as a whole
+	metadataM  sync.Mutex                           // Serializes SetMetadata
+	metadata   atomic.Pointer[map[string]string]    // Set with SetMetadata, replaced as a whole
+
+	finished chan struct{} // Closed when the Handler streaming the client returns, nil if not streamed
+	held     atomic.Int32  // 1 while the Handler holds back an event it took from messages for the rate limiter
+
+	capabilities Capabilities // Declared when connecting through a Handler; set before registration
+	schema       int          // Payload schema version asked for through a Handler, 0 if not versioned
+
+	bufferedBytes atomic.Int64 // Payload bytes queued in messages while streamed, counted into the server's total
+}
+
+// newClient creates a Client with the given ID and message buffer size,
+// timestamped with the now clock.
+func newClient(id string, size int, now func() time.Time) *Client {
+	connectedAt := now()
+	return &Client{
+		ID:           id,
+		messages:     make(chan Event, size),
+		ConnectedAt:  connectedAt,
+		lastActiveAt: connectedAt,
+		lastWriteAt:  connectedAt,
+		done:         make(chan struct{}),
+		registered:   make(chan struct{}),
+		now:          now,
+		notes:        make(chan string, maxDebugNotes),
+	}
+}
+
+// maxDebugNotes bounds the debug notes waiting for the handler to write them.
+const maxDebugNotes = 16
+
+// Messages returns the channel on which the client receives events. The
+// channel is closed once the client has been removed from the server.
+func (c *Client) Messages() <-chan Event {
+	return c.messages
+}
+
+// Send sends msg to the client, like Server.SendMessageToClient, for code
+// that holds the client rather than its ID. It reports errors like
+// SendMessageToClient; once the client has been removed, it returns an
+// error wrapping ErrClientNotReady.
+func (c *Client) Send(msg []byte) error {
+	return c.sendTargeted(Event{Data: msg})
+}
+
+// SendEvent sends ev to the client, like Server.SendEventToClient. It
+// reports errors like Send, and one wrapping ErrInvalidOption for an event
+// Server.BroadcastEvent would reject.
+func (c *Client) SendEvent(ev Event) error {
+	if err := ev.validate(); err != nil {
+		return err
+	}
+	return c.sendTargeted(Event{Data: ev.Data, ID: ev.ID, Name: ev.Name, Retry: ev.Retry, Schema: ev.Schema, Fields: ev.Fields, Trace: ev.Trace})
+}
+
+// sendTargeted is Send for a prepared event.
+func (c *Client) sendTargeted(ev Event) error {
+	if c.server == nil {
+		return fmt.Errorf("%w: client %s was not added to a server", ErrClientNotFound, c.ID)
+	}
+	if err := c.server.acquireOpen(); err != nil {
+		return err
+	}
+	defer c.server.releaseOpen()
+	return c.server.sendAdmitted(c, ev)
+}
+
+// Close removes the client from its server, like Server.RemoveClient: its
+// message channel is closed and it is reported with DisconnectClientRemoved.
+// Closing a client that has already been removed does nothing.
+func (c *Client) Close() error {
+	if c.server == nil {
+		return nil
+	}
+	return c.server.RemoveClientContext(context.Background(), c.ID)
+}
+
+// send queues ev on the client's message channel without blocking, applying
+// policy when the channel is full. It returns an error wrapping
+// ErrClientNotReady if the client has been closed, and additionally
+// ErrBufferFull if the message was rejected because the channel is full.
+func (c *Client) send(ev Event, policy BackpressurePolicy) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed {
+		return c.closedError()
+	}
+	for {
+		select {
+		case c.messages <- ev:
+			c.buffer(len(ev.Data))
+			c.touch()
+			return nil
+		default:
+		}
+		if policy != DropOldest {
+			c.note("dropped event: buffer full (%d queued)", len(c.messages))
+			c.dropped(ev)
+			return notReadyError(c.ID)
+		}
+		// Discard the oldest queued message and try again; the reader may
+		// have drained the channel in the meantime, which is just as good.
+		select {
+		case old := <-c.messages:
+			c.buffer(-len(old.Data))
+			c.note("dropped oldest queued event to make room")
+			c.dropped(old)
+		default:
+		}
+	}
+}
+
+// sendContext queues ev on the client's message channel, waiting for space
+// until ctx is done or the client is closed.
+func (c *Client) sendContext(ctx context.Context, ev Event) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed {
+		return c.closedError()
+	}
+	select {
+	case c.messages <- ev:
+		c.buffer(len(ev.Data))
+		if ev.barrier == nil {
+			c.touch()
+		}
+		return nil
+	case <-c.done:
+		return c.closedError()
+	case <-ctx.Done():
+		return fmt.Errorf("send to client %s: %w", c.ID, ctx.Err())
+	}
+}
+
+// subscribe adds topics to the client's subscriptions. It must only be
+// called before the client is registered.
+func (c *Client) subscribe(topics []string) {
+	if len(topics) == 0 {
+		return
+	}
+	if c.topics == nil {
+		c.topics = make(map[string]struct{}, len(topics))
+	}
+	for _, topic := range topics {
+		c.topics[topic] = struct{}{}
+	}
+}
+
+// subscribed reports whether the client receives events published to topic.
+func (c *Client) subscribed(topic string) bool {
+	_, ok := c.topics[topic]
+	return ok
+}
+
+// Topics returns the topics the client is subscribed to, in sorted order.
+func (c *Client) Topics() []string {
+	topics := make([]string, 0, len(c.topics))
+	for topic := range c.topics {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// SetFilter makes the server deliver only the broadcasts and topic events
+// whose payload matches f, so a client can follow a busy topic without
+// receiving all of it. Messages sent to the client by ID are always
+// delivered. A nil filter delivers everything again.
+func (c *Client) SetFilter(f *Filter) {
+	c.filter.Store(f)
+}
+
+// Filter returns the filter set with SetFilter, or nil if there is none.
+func (c *Client) Filter() *Filter {
+	return c.filter.Load()
+}
+
+// wants reports whether the client's filter lets in the event whose
+// payload is in.
+func (c *Client) wants(in *filterInput) bool {
+	f := c.filter.Load()
+	return f == nil || f.matches(in)
+}
+
+// SetDebug turns debug frames on or off. While they are on, the handler
+// streaming to the client writes comment frames describing decisions taken
+// for it, such as dropped or throttled events. Browsers ignore comments, so
+// this only affects someone watching the raw stream.
+func (c *Client) SetDebug(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&c.debug, v)
+}
+
+// Debug reports whether debug frames are enabled for the client.
+func (c *Client) Debug() bool {
+	return atomic.LoadInt32(&c.debug) == 1
+}
+
+// note queues a debug note for the client's stream if debug frames are
+// enabled. Notes never block: when too many are pending, new ones are lost.
+func (c *Client) note(format string, v ...interface{}) {
+	if !c.Debug() {
+		return
+	}
+	select {
+	case c.notes <- fmt.Sprintf(format, v...):
+	default:
+	}
+}
+
+// dropped reports ev as lost to a full buffer.
+func (c *Client) dropped(ev Event) {
+	if ev.barrier != nil {
+		close(ev.barrier) // Nothing before it is left to write
+		return
+	}
+	if c.onDrop != nil {
+		c.onDrop(ev)
+	}
+}
+
+// buffer counts n more payload bytes as queued in messages, or fewer if n
+// is negative, for clients streamed by a Handler; WithMaxBufferedBytes
+// limits their total. Callers hold mu.
+func (c *Client) buffer(n int) {
+	if !c.streamed || n == 0 {
+		return
+	}
+	c.bufferedBytes.Add(int64(n))
+	if c.server != nil {
+		c.server.bufferedBytes.Add(int64(n))
+	}
+}
+
+// taken uncounts ev, which the Handler streaming the client took from
+// messages. Once the client is closed its remaining bytes have been
+// uncounted as a whole.
+func (c *Client) taken(ev Event) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.closed {
+		c.buffer(-len(ev.Data))
+	}
+}
+
+// queued returns a copy of the events waiting in the client's message
+// channel, oldest first. Sends to the client are held up while the channel
+// is being copied, so queued is meant for occasional inspection only.
+func (c *Client) queued() []Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	// Holding mu keeps senders out, so the channel can only shrink while it
+	// is drained, and putting the events back can never block. A reader
+	// racing with the copy simply receives its events a moment later.
+	var events []Event
+drain:
+	for {
+		select {
+		case ev := <-c.messages:
+			events = append(events, ev)
+		default:
+			break drain
+		}
+	}
+	for _, ev := range events {
+		c.messages <- ev
+	}
+	return events
+}
+
+// touch records a successful delivery in lastActiveAt.
+func (c *Client) touch() {
+	c.infoM.Lock()
+	c.lastActiveAt = c.now()
+	c.infoM.Unlock()
+}
+
+// closedError is returned by sends to a client that has been closed.
+func (c *Client) closedError() error {
+	return fmt.Errorf("%w: client %s is closed", ErrClientNotReady, c.ID)
+}
+
+// LastActiveAt returns when a message was last queued for the client, or
+// when it connected if none has been. A queued message may still wait in
+// the client's buffer behind a stalled connection, so WithIdleTimeout
+// measures idleness by the events written to the stream instead.
+func (c *Client) LastActiveAt() time.Time {
+	c.infoM.Lock()
+	defer c.infoM.Unlock()
+	return c.lastActiveAt
+}
+
+// wrote records that a Handler wrote an event to the client's stream.
+func (c *Client) wrote() {
+	c.infoM.Lock()
+	c.lastWriteAt = c.now()
+	c.infoM.Unlock()
+}
+
+// lastDelivery returns when an event last reached the client: when a
+// Handler last wrote one to its stream, or for clients read directly
+// through Messages, when one was last queued. Either is the connection time
+// if no event has been.
+func (c *Client) lastDelivery() time.Time {
+	c.infoM.Lock()
+	defer c.infoM.Unlock()
+	if c.streamed {
+		return c.lastWriteAt
+	}
+	return c.lastActiveAt
+}
+
+// Info returns a snapshot of the client. After the client has disconnected,
+// the snapshot includes why.
+func (c *Client) Info() ClientInfo {
+	c.infoM.Lock()
+	defer c.infoM.Unlock()
+	return ClientInfo{
+		ID:             c.ID,
+		ConnectedAt:    c.ConnectedAt,
+		LastActiveAt:   c.lastActiveAt,
+		DisconnectedAt: c.endedAt,
+		Reason:         c.reason,
+		Err:            c.reasonErr,
+		Identity:       c.identityName(),
+	}
+}
+
+// identityName returns the name of the client's coalesced identity, if any.
+func (c *Client) identityName() string {
+	if c.identity == nil {
+		return ""
+	}
+	return c.identity.name
+}
+
+// disconnect records why the client's stream ended. Only the first reason is
+// kept, so the handler can record the root cause (a write error, say) before
+// its deferred RemoveClient runs.
+func (c *Client) disconnect(reason DisconnectReason, err error) {
+	c.infoM.Lock()
+	defer c.infoM.Unlock()
+	if c.reason != "" {
+		return
+	}
+	c.endedAt = c.now()
+	c.reason = reason
+	c.reasonErr = err
+}
+
+// close records reason, closes the client's message channel and reports the
+// final record to the OnDisconnect hook, if any. It is safe
+// to call close any number of times and concurrently with sends: blocked
+// sends are woken up through done before the channel is closed.
+func (c *Client) close(reason DisconnectReason) {
+	c.disconnect(reason, nil)
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.mu.Lock()
+		c.closed = true
+		close(c.messages)
+		c.buffer(-int(c.bufferedBytes.Load())) // Events left in messages stop counting, see taken
+		c.mu.Unlock()
+
+		// Report the final record outside the lock
+		if c.onClose != nil {
+			c.onClose(c.Info())
+		}
+	})
+}
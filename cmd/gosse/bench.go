@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Firoz01/gosse/v2/sseclient"
+)
+
+// benchConfig is what "gosse bench" measures.
+type benchConfig struct {
+	stream   string        // URL of the SSE stream the clients connect to
+	publish  string        // URL the events are POSTed to, such as the admin API's /publish
+	clients  int           // Concurrent connections
+	rate     float64       // Events published per second
+	duration time.Duration // How long to publish
+	warmup   time.Duration // Time for the clients to connect before publishing
+	drain    time.Duration // Time for the last events to arrive after publishing
+	header   http.Header   // Sent with every request, for example for authentication
+}
+
+// benchPayload is the data of the events bench publishes. Sent is read from
+// the same clock that times their arrival, so latencies need no clock sync.
+type benchPayload struct {
+	Seq  uint64 `json:"bench_seq"`
+	Sent int64  `json:"bench_sent_ns"`
+}
+
+// benchResult is what the clients observed.
+type benchResult struct {
+	clients   int             // Connections that received at least one event
+	published uint64          // Events the server accepted
+	failed    uint64          // Publish requests that failed
+	expected  uint64          // Deliveries if every connected client got every event
+	received  uint64          // Distinct events received, over all clients
+	latencies []time.Duration // From publish to arrival, sorted
+}
+
+// bench implements "gosse bench".
+func bench(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	cfg := benchConfig{header: make(http.Header)}
+	flags.IntVar(&cfg.clients, "clients", 100, "concurrent connections")
+	rate := flags.String("rate", "10/s", "events published per second, as N/s or N/m")
+	flags.StringVar(&cfg.publish, "publish", "", "URL to POST events to, for example https://host/sse/admin/publish?broadcast=true")
+	flags.DurationVar(&cfg.duration, "duration", 30*time.Second, "how long to publish")
+	flags.DurationVar(&cfg.warmup, "warmup", 2*time.Second, "time for the clients to connect before publishing")
+	flags.DurationVar(&cfg.drain, "drain", 2*time.Second, "time for the last events to arrive")
+	flags.Func("header", "`name: value` sent with every request; may be repeated", func(raw string) error {
+		name, value, ok := strings.Cut(raw, ":")
+		if !ok {
+			return errors.New("want name: value")
+		}
+		cfg.header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+		return nil
+	})
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 || cfg.publish == "" || cfg.clients < 1 {
+		fmt.Fprintln(stderr, "gosse bench: want -publish, at least one client and exactly one stream URL")
+		return 2
+	}
+	cfg.stream = flags.Arg(0)
+	var err error
+	if cfg.rate, err = parseRate(*rate); err != nil {
+		fmt.Fprintf(stderr, "gosse bench: -rate: %v\n", err)
+		return 2
+	}
+
+	result, err := runBench(context.Background(), cfg)
+	if err != nil {
+		fmt.Fprintf(stderr, "gosse bench: %v\n", err)
+		return 1
+	}
+	result.print(stdout)
+	return 0
+}
+
+// parseRate parses a rate such as "100/s", "600/m" or "100" into events per
+// second.
+func parseRate(raw string) (float64, error) {
+	count, unit, _ := strings.Cut(raw, "/")
+	n, err := strconv.ParseFloat(count, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("%q: want a positive number of events", raw)
+	}
+	switch unit {
+	case "", "s":
+		return n, nil
+	case "m":
+		return n / 60, nil
+	}
+	return 0, fmt.Errorf("%q: unit must be s or m", raw)
+}
+
+// runBench connects the clients, publishes at the configured rate and
+// collects what the clients received.
+func runBench(ctx context.Context, cfg benchConfig) (benchResult, error) {
+	transport := &headerTransport{base: http.DefaultTransport, header: cfg.header}
+	httpClient := &http.Client{Transport: transport}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+	receivers := make([]*benchReceiver, cfg.clients)
+	errs := make(chan error, cfg.clients)
+	for i := range receivers {
+		client, err := sseclient.New(cfg.stream, sseclient.WithHTTPClient(httpClient), sseclient.WithReconnectDelay(100*time.Millisecond))
+		if err != nil {
+			return benchResult{}, err
+		}
+		r := &benchReceiver{seen: make(map[uint64]struct{})}
+		receivers[i] = r
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := client.Run(ctx, r.handle); errors.Is(err, sseclient.ErrBadResponse) {
+				errs <- err
+			}
+		}()
+	}
+
+	var result benchResult
+	published, err := publishEvents(ctx, httpClient, cfg, &result)
+	if err == nil {
+		select {
+		case err = <-errs:
+		case <-time.After(cfg.drain):
+		}
+	}
+	cancel()
+	wg.Wait()
+	if err != nil {
+		return benchResult{}, err
+	}
+
+	for _, r := range receivers {
+		if len(r.seen) == 0 {
+			continue
+		}
+		result.clients++
+		// A client connected late could not receive the earlier events
+		result.expected += uint64(len(published)) - uint64(sort.Search(len(published), func(i int) bool { return published[i] >= r.first }))
+		result.received += uint64(len(r.seen))
+		result.latencies = append(result.latencies, r.latencies...)
+	}
+	result.published = uint64(len(published))
+	sort.Slice(result.latencies, func(i, j int) bool { return result.latencies[i] < result.latencies[j] })
+	return result, nil
+}
+
+// publishEvents waits for the warmup, then POSTs numbered events to
+// cfg.publish at cfg.rate for cfg.duration. It returns the numbers of the
+// events the server accepted, in order.
+func publishEvents(ctx context.Context, httpClient *http.Client, cfg benchConfig, result *benchResult) ([]uint64, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(cfg.warmup):
+	}
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / cfg.rate))
+	defer ticker.Stop()
+	end := time.After(cfg.duration)
+	var published []uint64
+	for seq := uint64(1); ; seq++ {
+		select {
+		case <-ctx.Done():
+			return published, ctx.Err()
+		case <-end:
+			return published, nil
+		case <-ticker.C:
+		}
+		body, _ := json.Marshal(benchPayload{Seq: seq, Sent: time.Now().UnixNano()})
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.publish, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			result.failed++
+			continue
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			if seq == 1 {
+				return nil, fmt.Errorf("publish: %s", resp.Status)
+			}
+			result.failed++
+			continue
+		}
+		published = append(published, seq)
+	}
+}
+
+// benchReceiver records the bench events one client receives. Run calls
+// handle on a single goroutine, and the fields are read after it returns.
+type benchReceiver struct {
+	first     uint64 // Number of the first bench event received
+	seen      map[uint64]struct{}
+	latencies []time.Duration
+}
+
+// handle records one event, ignoring those bench did not publish.
+func (r *benchReceiver) handle(ev sseclient.Event) {
+	now := time.Now()
+	var p benchPayload
+	if json.Unmarshal(ev.Data, &p) != nil || p.Seq == 0 {
+		return
+	}
+	if _, ok := r.seen[p.Seq]; ok {
+		return // Redelivered after a reconnect
+	}
+	if len(r.seen) == 0 {
+		r.first = p.Seq
+	}
+	r.seen[p.Seq] = struct{}{}
+	r.latencies = append(r.latencies, now.Sub(time.Unix(0, p.Sent)))
+}
+
+// print writes a human-readable report of r.
+func (r benchResult) print(w io.Writer) {
+	fmt.Fprintf(w, "clients:   %d connected\n", r.clients)
+	fmt.Fprintf(w, "published: %d events, %d failed\n", r.published, r.failed)
+	var loss float64
+	if r.expected > 0 && r.received < r.expected {
+		loss = 100 * float64(r.expected-r.received) / float64(r.expected)
+	}
+	fmt.Fprintf(w, "delivered: %d of %d (%.2f%% lost)\n", r.received, r.expected, loss)
+	if len(r.latencies) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "latency:   p50 %v  p95 %v  p99 %v  max %v\n",
+		r.percentile(50), r.percentile(95), r.percentile(99), r.latencies[len(r.latencies)-1])
+}
+
+// percentile returns the nearest-rank pth percentile of the latencies.
+func (r benchResult) percentile(p int) time.Duration {
+	return r.latencies[(len(r.latencies)*p+99)/100-1]
+}
+
+// headerTransport adds fixed headers to every request.
+type headerTransport struct {
+	base   http.RoundTripper
+	header http.Header
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for name, values := range t.header {
+		req.Header[name] = append(req.Header[name], values...)
+	}
+	return t.base.RoundTrip(req)
+}
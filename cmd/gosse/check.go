@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Firoz01/gosse/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// proxyIdleTimeout is the idle timeout after which common proxies and load
+// balancers, nginx and AWS ALB among them, close a quiet stream by default.
+const proxyIdleTimeout = 60 * time.Second
+
+// check implements "gosse check".
+func check(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("check", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	env := flags.Bool("env", true, "apply GOSSE_* environment variables on top of the file")
+	strict := flags.Bool("strict", false, "treat warnings as errors")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(stderr, "gosse check: want exactly one configuration file")
+		return 2
+	}
+
+	cfg, err := gosse.LoadConfigFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(stderr, "gosse check: %v\n", err)
+		return 1
+	}
+	if *env {
+		if err := cfg.LoadEnv(); err != nil {
+			printErrors(stderr, "environment", err)
+			return 1
+		}
+	}
+	effective, err := cfg.Effective()
+	if err != nil {
+		printErrors(stderr, "invalid", err)
+		return 1
+	}
+	warnings := lint(effective)
+	for _, w := range warnings {
+		fmt.Fprintf(stderr, "gosse check: warning: %s\n", w)
+	}
+
+	out, err := yaml.Marshal(effective)
+	if err != nil {
+		fmt.Fprintf(stderr, "gosse check: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "# Effective configuration of %s\n%s", flags.Arg(0), out)
+	if *strict && len(warnings) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// lint returns the settings of cfg that are valid but likely deployment
+// mistakes.
+func lint(cfg gosse.Config) []string {
+	var warnings []string
+	if cfg.RateLimit == 0 && cfg.RateBurst != 0 {
+		warnings = append(warnings, "rate_burst has no effect without rate_limit")
+	}
+	if cfg.PublishRate == 0 && cfg.PublishBurst != 0 {
+		warnings = append(warnings, "publish_burst has no effect without publish_rate")
+	}
+	if cfg.Heartbeat == 0 {
+		warnings = append(warnings, fmt.Sprintf("heartbeat is off: proxies commonly close streams idle for %v", proxyIdleTimeout))
+	} else if cfg.Heartbeat >= proxyIdleTimeout {
+		warnings = append(warnings, fmt.Sprintf("heartbeat %v is not below the %v idle timeout common in proxies", cfg.Heartbeat, proxyIdleTimeout))
+	}
+	if cfg.WriteTimeout == 0 {
+		warnings = append(warnings, "write_timeout is off: a peer that stops reading holds its stream until TCP gives up")
+	} else if cfg.Heartbeat != 0 && cfg.WriteTimeout > cfg.Heartbeat {
+		warnings = append(warnings, fmt.Sprintf("write_timeout %v exceeds heartbeat %v, so a stalled stream misses heartbeats before it is closed", cfg.WriteTimeout, cfg.Heartbeat))
+	}
+	if cfg.Backpressure == gosse.Disconnect && cfg.BufferSize < 8 {
+		warnings = append(warnings, fmt.Sprintf("backpressure disconnect with buffer_size %d evicts clients at the first burst", cfg.BufferSize))
+	}
+	return warnings
+}
+
+// printErrors prints each of the errors joined in err on its own line.
+func printErrors(w io.Writer, prefix string, err error) {
+	var joined interface{ Unwrap() []error }
+	if errors.As(err, &joined) {
+		for _, e := range joined.Unwrap() {
+			printErrors(w, prefix, e)
+		}
+		return
+	}
+	fmt.Fprintf(w, "gosse check: %s: %v\n", prefix, err)
+}
@@ -0,0 +1,69 @@
+// Command gosse helps deploy and operate gosse servers.
+//
+// Usage:
+//
+//	gosse check [-env=false] [-strict] config.yaml
+//	gosse bench -publish URL [-clients N] [-rate N/s] [-duration D] stream-URL
+//	gosse replay [-addr host:port] [-speed X] [-wait D] archive.jsonl
+//
+// check validates a server configuration file (see gosse.LoadConfigFile),
+// warns about settings that are valid but likely mistakes, and prints the
+// effective configuration with every default spelled out.
+//
+// bench load-tests a running server: it opens many connections to the
+// stream with the sseclient package, POSTs numbered events to the publish
+// URL, such as the admin API's /publish, at the given rate and reports how
+// many events each connection missed and how long delivery took.
+//
+// replay serves the events archived by a gosse.ArchiveSink on a fresh
+// server, at the original pace or faster, for demos, debugging and
+// reproducing regressions. Clients subscribe to the archived topics with
+// the "topic" query parameter.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+const usage = `Usage:
+
+	gosse check [-env=false] [-strict] config.yaml
+	gosse bench -publish URL [-clients N] [-rate N/s] [-duration D] stream-URL
+	gosse replay [-addr host:port] [-speed X] [-wait D] archive.jsonl
+
+Commands:
+
+	check	validate a configuration file and print the effective settings
+	bench	measure delivery latency and loss of a running server
+	replay	serve the events of an archive again
+
+Run "gosse <command> -h" for a command's flags.
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes the command line args and returns the exit status: 0 on
+// success, 1 if the command failed and 2 for usage errors.
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	switch args[0] {
+	case "check":
+		return check(args[1:], stdout, stderr)
+	case "bench":
+		return bench(args[1:], stdout, stderr)
+	case "replay":
+		return replay(args[1:], stdout, stderr)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	}
+	fmt.Fprintf(stderr, "gosse: unknown command %q\n\n%s", args[0], usage)
+	return 2
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/Firoz01/gosse/v2"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	var stdout, stderr bytes.Buffer
+	good := write("good.yaml", "heartbeat: 15s\nwrite_timeout: 10s\nrate_burst: 5\npublish_burst: 3\n")
+	if code := run([]string{"check", "-env=false", good}, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected status 0, got %d: %s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "buffer_size: 10\n") {
+		t.Errorf("Expected the default buffer size in the effective config, got:\n%s", stdout.String())
+	}
+	if !strings.Contains(stderr.String(), "rate_burst has no effect") {
+		t.Errorf("Expected a warning about rate_burst, got %q", stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "publish_burst has no effect") {
+		t.Errorf("Expected a warning about publish_burst, got %q", stderr.String())
+	}
+
+	// Warnings fail the check in strict mode
+	stdout.Reset()
+	stderr.Reset()
+	if code := run([]string{"check", "-env=false", "-strict", good}, &stdout, &stderr); code != 1 {
+		t.Errorf("Expected status 1 in strict mode, got %d", code)
+	}
+
+	// Every invalid setting is reported
+	stderr.Reset()
+	bad := write("bad.yaml", "buffer_size: -1\nmax_clients: -3\n")
+	if code := run([]string{"check", "-env=false", bad}, &stdout, &stderr); code != 1 {
+		t.Errorf("Expected status 1 for an invalid config, got %d", code)
+	}
+	if n := strings.Count(stderr.String(), "invalid:"); n != 2 {
+		t.Errorf("Expected two invalid settings, got %q", stderr.String())
+	}
+
+	if code := run([]string{"frobnicate"}, &stdout, &stderr); code != 2 {
+		t.Errorf("Expected status 2 for an unknown command, got %d", code)
+	}
+}
+
+func TestBench(t *testing.T) {
+	server := gosse.NewServer(gosse.WithAutoRun(), gosse.WithBufferSize(100))
+	defer server.Shutdown()
+	admin, err := gosse.NewAdminHandler(server, func(r *http.Request) error {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			return errors.New("bad token")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error creating admin handler: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/admin/", http.StripPrefix("/admin", admin))
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		gosse.SSEHandlerEndpoint(server, w, r)
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	cfg := benchConfig{
+		stream:   ts.URL + "/events",
+		publish:  ts.URL + "/admin/publish?broadcast=true",
+		clients:  5,
+		rate:     100,
+		duration: 200 * time.Millisecond,
+		warmup:   200 * time.Millisecond,
+		drain:    200 * time.Millisecond,
+		header:   http.Header{"Authorization": {"Bearer secret"}},
+	}
+	result, err := runBench(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.clients != 5 || result.published == 0 || result.failed != 0 {
+		t.Errorf("Expected 5 clients and every publish accepted, got %+v", result)
+	}
+	if result.received != result.expected || len(result.latencies) != int(result.received) {
+		t.Errorf("Expected no loss, got %d of %d", result.received, result.expected)
+	}
+
+	// A rejected publish fails the run
+	cfg.header = nil
+	if _, err := runBench(context.Background(), cfg); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Expected the publish to be rejected, got %v", err)
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	for raw, want := range map[string]float64{"100/s": 100, "120/m": 2, "5": 5} {
+		if got, err := parseRate(raw); err != nil || got != want {
+			t.Errorf("parseRate(%q) = %v, %v; want %v", raw, got, err, want)
+		}
+	}
+	for _, raw := range []string{"", "0/s", "-1", "10/h", "fast"} {
+		if _, err := parseRate(raw); err == nil {
+			t.Errorf("Expected an error for %q", raw)
+		}
+	}
+}
+
+func TestReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "archive.jsonl")
+	archive := `{"time":"2026-01-02T15:04:05Z","topic":"orders","data":"Zmlyc3Q="}
+{"time":"2026-01-02T15:04:06Z","topic":"orders","name":"update","data":"c2Vjb25k"}
+`
+	if err := os.WriteFile(path, []byte(archive), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"replay", "-addr", "127.0.0.1:0", "-wait", "0", "-speed", "0", path}, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected status 0, got %d: %s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "replayed 2 events\n") {
+		t.Errorf("Expected both events replayed, got %q", stdout.String())
+	}
+
+	stderr.Reset()
+	if code := run([]string{"replay", "-speed", "-1", path}, &stdout, &stderr); code != 2 {
+		t.Errorf("Expected status 2 for a negative speed, got %d", code)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/Firoz01/gosse/v2"
+)
+
+// replayShutdownTimeout bounds how long "gosse replay" waits for the
+// streams to flush once the archive has been replayed.
+const replayShutdownTimeout = 10 * time.Second
+
+// replay implements "gosse replay".
+func replay(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	addr := flags.String("addr", "localhost:8080", "address to serve the stream on")
+	speed := flags.Float64("speed", 1, "replay speed: 1 for the original pace, 10 for ten times faster, 0 for as fast as possible")
+	wait := flags.Duration("wait", 5*time.Second, "time for clients to connect before the replay starts")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 || *speed < 0 {
+		fmt.Fprintln(stderr, "gosse replay: want a speed of at least 0 and exactly one archive file")
+		return 2
+	}
+
+	archive, err := os.Open(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(stderr, "gosse replay: %v\n", err)
+		return 1
+	}
+	defer archive.Close()
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		fmt.Fprintf(stderr, "gosse replay: %v\n", err)
+		return 1
+	}
+
+	server := gosse.NewServer(gosse.WithAutoRun())
+	handler, _ := gosse.NewHandler(server) // No options to fail
+	httpServer := &http.Server{Handler: handler}
+	served := make(chan error, 1)
+	go func() { served <- httpServer.Serve(listener) }()
+	fmt.Fprintf(stdout, "serving on http://%s/?topic=NAME, replaying in %s\n", listener.Addr(), *wait)
+	time.Sleep(*wait)
+
+	n, err := gosse.ReplayArchive(context.Background(), server, archive, *speed)
+	ctx, cancel := context.WithTimeout(context.Background(), replayShutdownTimeout)
+	defer cancel()
+	_, _ = server.ShutdownContext(ctx)
+	_ = httpServer.Shutdown(ctx)
+	if serveErr := <-served; !errors.Is(serveErr, http.ErrServerClosed) {
+		fmt.Fprintf(stderr, "gosse replay: %v\n", serveErr)
+		return 1
+	}
+	fmt.Fprintf(stdout, "replayed %d events\n", n)
+	if err != nil {
+		fmt.Fprintf(stderr, "gosse replay: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,194 @@
+package gosse
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Codec compresses event payloads for WithHandlerPayloadCompression. A
+// compressed payload is sent as the codec's name, ";base64," and the
+// compressed payload in standard base64, so consumers can tell which codec
+// to decode it with; DecodePayload does so for every registered codec.
+// Compress must not fail, as in-memory compression does not, and both
+// methods must be safe for concurrent use.
+type Codec interface {
+	Name() string
+	Compress(data []byte) []byte
+	Decompress(data []byte) ([]byte, error)
+}
+
+// codecSeparator follows the codec name in the data of compressed payloads.
+const codecSeparator = ";base64,"
+
+// maxCodecName bounds the length of codec names.
+const maxCodecName = 32
+
+// Registered codecs by name, replaced as a whole on changes.
+var (
+	codecs  atomic.Pointer[map[string]Codec]
+	codecsM sync.Mutex // Serializes RegisterCodec
+)
+
+func init() {
+	codecs.Store(&map[string]Codec{"gzip": gzipCodec{}})
+}
+
+// RegisterCodec makes codec available to WithHandlerPayloadCodecs and
+// DecodePayload under its name, which consumers also declare in their
+// "compression" capabilities (see Capabilities). gzip is registered from
+// the start; the codecs package adds zstd and snappy. Codecs are usually
+// registered from an init function.
+//
+// RegisterCodec returns an error wrapping ErrInvalidOption if codec is nil,
+// its name is not 1 to 32 lowercase letters, digits, dots, dashes or
+// underscores, or a codec of that name is already registered.
+func RegisterCodec(codec Codec) error {
+	if codec == nil {
+		return invalidOption("RegisterCodec", "nil", "must not be nil")
+	}
+	name := codec.Name()
+	if !validCodecName(name) {
+		return invalidOption("RegisterCodec", strconv.Quote(name), "names must be 1 to 32 lowercase letters, digits, dots, dashes or underscores")
+	}
+	codecsM.Lock()
+	defer codecsM.Unlock()
+	// Handlers and DecodePayload look codecs up without codecsM, possibly
+	// while a late RegisterCodec runs, so it stores a new map instead of
+	// writing to the one they read
+	current := *codecs.Load()
+	if current[name] != nil {
+		return invalidOption("RegisterCodec", strconv.Quote(name), "already registered")
+	}
+	next := make(map[string]Codec, len(current)+1)
+	for n, c := range current {
+		next[n] = c
+	}
+	next[name] = codec
+	codecs.Store(&next)
+	return nil
+}
+
+// validCodecName reports whether name can name a codec.
+func validCodecName(name string) bool {
+	if name == "" || len(name) > maxCodecName {
+		return false
+	}
+	for _, r := range name {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '.' && r != '-' && r != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// lookupCodec returns the codec registered as name, nil if there is none.
+func lookupCodec(name string) Codec {
+	return (*codecs.Load())[name]
+}
+
+// compressedWith returns the codec data was compressed with and the
+// encoded payload, or a nil codec if data does not start with the prefix of
+// a registered codec.
+func compressedWith(data string) (Codec, string) {
+	head := data
+	if len(head) > maxCodecName+len(codecSeparator) {
+		head = head[:maxCodecName+len(codecSeparator)]
+	}
+	i := strings.Index(head, codecSeparator)
+	if i < 0 {
+		return nil, ""
+	}
+	codec := lookupCodec(data[:i])
+	if codec == nil {
+		return nil, ""
+	}
+	return codec, data[i+len(codecSeparator):]
+}
+
+// WithHandlerPayloadCodecs sets the codecs WithHandlerPayloadCompression
+// compresses payloads with, by name, in order of preference: each client
+// gets the first of them it declares in its "compression" capabilities,
+// for example ?capabilities=compression=zstd,compression=gzip, and
+// uncompressed payloads if it declares none of them, except for payloads
+// that start like compressed ones, which are still sent with gzip so they
+// are not mistaken for compressed ones. Clients declaring no codecs at all
+// get gzip if it is among names, as every consumer of CompressedPrefix
+// decodes it. Without this option payloads are compressed with gzip only.
+// The codecs must be registered (see RegisterCodec).
+func WithHandlerPayloadCodecs(names ...string) HandlerOption {
+	return func(h *Handler) error {
+		if len(names) == 0 {
+			return invalidOption("WithHandlerPayloadCodecs", "none", "need at least one codec")
+		}
+		codecs := make([]Codec, 0, len(names))
+		for _, name := range names {
+			codec := lookupCodec(name)
+			if codec == nil {
+				return invalidOption("WithHandlerPayloadCodecs", strconv.Quote(name), "not a registered codec")
+			}
+			codecs = append(codecs, codec)
+		}
+		h.codecs = codecs
+		return nil
+	}
+}
+
+// payloadCodec returns the codec the handler compresses payloads for a
+// client with caps with, nil if it sends them uncompressed.
+func (h *Handler) payloadCodec(caps Capabilities) Codec {
+	if h.compress == 0 {
+		return nil
+	}
+	offered := h.codecs
+	if offered == nil {
+		offered = []Codec{gzipCodec{}}
+	}
+	for _, codec := range offered {
+		if len(caps.Compression) == 0 {
+			if codec.Name() == "gzip" {
+				return codec // Clients from before codecs decode gzip
+			}
+			continue
+		}
+		for _, name := range caps.Compression {
+			if name == codec.Name() {
+				return codec
+			}
+		}
+	}
+	return nil
+}
+
+// gzipCodec is the built-in gzip Codec.
+type gzipCodec struct{}
+
+// gzipWriters pools the compressors of gzipCodec.
+var gzipWriters = sync.Pool{New: func() interface{} { return gzip.NewWriter(io.Discard) }}
+
+// Name implements Codec.
+func (gzipCodec) Name() string { return "gzip" }
+
+// Compress implements Codec.
+func (gzipCodec) Compress(data []byte) []byte {
+	var buf bytes.Buffer
+	gz := gzipWriters.Get().(*gzip.Writer)
+	gz.Reset(&buf)
+	_, _ = gz.Write(data) // Writes to a bytes.Buffer cannot fail
+	_ = gz.Close()
+	gzipWriters.Put(gz)
+	return buf.Bytes()
+}
+
+// Decompress implements Codec.
+func (gzipCodec) Decompress(data []byte) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(gz)
+}
@@ -0,0 +1,81 @@
+// Package codecs adds the zstd and snappy payload codecs to gosse, for
+// handlers that compress payloads (see gosse.WithHandlerPayloadCompression).
+// Importing the package registers them:
+//
+//	import _ "github.com/Firoz01/gosse/v2/codecs"
+//
+//	handler, err := gosse.NewHandler(server,
+//		gosse.WithHandlerPayloadCompression(1024),
+//		gosse.WithHandlerPayloadCodecs("zstd", "gzip"))
+//
+// Consumers that declare "compression=zstd" in their capabilities then get
+// zstd-compressed payloads, and the others gzip. zstd compresses better
+// than gzip at a similar speed; snappy compresses less but costs little
+// CPU. Consumers written in Go decode either with gosse.DecodePayload once
+// they import the package too.
+package codecs
+
+import (
+	"github.com/Firoz01/gosse/v2"
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+	"sync"
+)
+
+func init() {
+	for _, codec := range []gosse.Codec{Zstd{}, Snappy{}} {
+		if err := gosse.RegisterCodec(codec); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Zstd is the gosse.Codec named "zstd", compressing with Zstandard at its
+// default level.
+type Zstd struct{}
+
+// The zstd encoder and decoder, created on first use as each holds
+// buffers of several megabytes. Both are safe for concurrent use.
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+)
+
+// zstdInit creates the zstd encoder and decoder.
+func zstdInit() {
+	zstdEncoder, _ = zstd.NewWriter(nil) // Fails only for invalid options
+	zstdDecoder, _ = zstd.NewReader(nil)
+}
+
+// Name implements gosse.Codec.
+func (Zstd) Name() string { return "zstd" }
+
+// Compress implements gosse.Codec.
+func (Zstd) Compress(data []byte) []byte {
+	zstdOnce.Do(zstdInit)
+	return zstdEncoder.EncodeAll(data, nil)
+}
+
+// Decompress implements gosse.Codec.
+func (Zstd) Decompress(data []byte) ([]byte, error) {
+	zstdOnce.Do(zstdInit)
+	return zstdDecoder.DecodeAll(data, nil)
+}
+
+// Snappy is the gosse.Codec named "snappy", compressing with the Snappy
+// block format.
+type Snappy struct{}
+
+// Name implements gosse.Codec.
+func (Snappy) Name() string { return "snappy" }
+
+// Compress implements gosse.Codec.
+func (Snappy) Compress(data []byte) []byte {
+	return snappy.Encode(nil, data)
+}
+
+// Decompress implements gosse.Codec.
+func (Snappy) Decompress(data []byte) ([]byte, error) {
+	return snappy.Decode(nil, data)
+}
@@ -0,0 +1,34 @@
+package codecs_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"github.com/Firoz01/gosse/v2"
+	"github.com/Firoz01/gosse/v2/codecs"
+	"testing"
+)
+
+func TestCodecs(t *testing.T) {
+	payload := bytes.Repeat([]byte(`{"symbol":"ACME","price":42}`), 50)
+	for _, codec := range []gosse.Codec{codecs.Zstd{}, codecs.Snappy{}} {
+		compressed := codec.Compress(payload)
+		if len(compressed) >= len(payload) {
+			t.Errorf("Expected %s to shrink the payload, got %d bytes from %d", codec.Name(), len(compressed), len(payload))
+		}
+
+		// Registered codecs are decoded by their prefix
+		data := codec.Name() + ";base64," + base64.StdEncoding.EncodeToString(compressed)
+		got, err := gosse.DecodePayload(data)
+		if err != nil || !bytes.Equal(got, payload) {
+			t.Errorf("Expected %s payload to decode, got %q (%v)", codec.Name(), got, err)
+		}
+
+		if _, err := gosse.DecodePayload(codec.Name() + ";base64,bm90IGNvbXByZXNzZWQ="); err == nil {
+			t.Errorf("Expected an error decoding a corrupt %s payload", codec.Name())
+		}
+	}
+
+	if _, err := gosse.NewHandler(gosse.NewServer(), gosse.WithHandlerPayloadCodecs("zstd", "snappy", "gzip")); err != nil {
+		t.Errorf("Expected the codecs to be registered, got %v", err)
+	}
+}
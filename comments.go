@@ -0,0 +1,64 @@
+package gosse
+
+import (
+	"errors"
+	"fmt"
+)
+
+// BroadcastComment writes text as a comment frame to every connected
+// stream. EventSource ignores comments, so operators can leave
+// human-readable diagnostics in streams, visible with curl or the browser's
+// network tab, without affecting application event handling. Line breaks
+// in text are replaced with spaces.
+//
+// Comments are queued like events but never evict clients or displace
+// queued events; clients whose buffer is full are reported in the returned
+// error as with BroadcastMessage. They are not counted in Metrics nor kept
+// in history.
+func (s *Server) BroadcastComment(text string) error {
+	if s == nil {
+		return ErrNilServer
+	}
+	if s.isClosed() {
+		return ErrServerClosed
+	}
+	var errs []error
+	s.rangeClients(func(client *Client) bool {
+		if err := client.sendComment(text); err != nil {
+			errs = append(errs, err)
+		}
+		return true
+	})
+	return errors.Join(errs...)
+}
+
+// SendCommentToClient is like BroadcastComment for a single client. It
+// returns an error wrapping ErrClientNotFound if no client has the ID.
+func (s *Server) SendCommentToClient(clientID, text string) error {
+	if s == nil {
+		return ErrNilServer
+	}
+	if s.isClosed() {
+		return ErrServerClosed
+	}
+	client, ok := s.loadClient(clientID)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrClientNotFound, clientID)
+	}
+	return client.sendComment(text)
+}
+
+// sendComment queues a comment frame if the buffer has room.
+func (c *Client) sendComment(text string) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed {
+		return c.closedError()
+	}
+	select {
+	case c.messages <- Event{Comment: text}:
+		return nil
+	default:
+		return notReadyError(c.ID)
+	}
+}
@@ -0,0 +1,253 @@
+package gosse
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is a serializable form of the server's Options, so deployments can
+// tune a server without recompiling. It can be loaded from YAML (see
+// LoadConfigFile) and overridden from environment variables (see LoadEnv),
+// and is turned into a Server with NewServerFromConfig.
+//
+// Zero values mean "use the default", exactly like omitting the matching Option.
+type Config struct {
+	BufferSize   int                `yaml:"buffer_size" env:"GOSSE_BUFFER_SIZE"`     // See WithBufferSize.
+	MaxClients   int                `yaml:"max_clients" env:"GOSSE_MAX_CLIENTS"`     // See WithMaxClients.
+	Heartbeat    time.Duration      `yaml:"heartbeat" env:"GOSSE_HEARTBEAT"`         // See WithHeartbeat.
+	Backpressure BackpressurePolicy `yaml:"backpressure" env:"GOSSE_BACKPRESSURE"`   // See WithBackpressure.
+	RateLimit    float64            `yaml:"rate_limit" env:"GOSSE_RATE_LIMIT"`       // See WithRateLimit.
+	RateBurst    int                `yaml:"rate_burst" env:"GOSSE_RATE_BURST"`       // See WithRateLimit.
+	LogLevel     LogLevel           `yaml:"log_level" env:"GOSSE_LOG_LEVEL"`         // See WithLogLevel.
+	WriteTimeout time.Duration      `yaml:"write_timeout" env:"GOSSE_WRITE_TIMEOUT"` // See WithWriteTimeout.
+	InstanceID   string             `yaml:"instance_id" env:"GOSSE_INSTANCE_ID"`     // See WithInstanceID.
+	Labels       map[string]string  `yaml:"labels" env:"GOSSE_LABELS"`               // See WithLabels; in the environment as name=value pairs separated by commas.
+	History      int                `yaml:"history" env:"GOSSE_HISTORY"`             // See WithHistory.
+	TopicExpiry  time.Duration      `yaml:"topic_expiry" env:"GOSSE_TOPIC_EXPIRY"`   // See WithTopicExpiry.
+	IdleTimeout  time.Duration      `yaml:"idle_timeout" env:"GOSSE_IDLE_TIMEOUT"`   // See WithIdleTimeout.
+
+	PublishRate      float64 `yaml:"publish_rate" env:"GOSSE_PUBLISH_RATE"`             // See WithPublishRate.
+	PublishBurst     int     `yaml:"publish_burst" env:"GOSSE_PUBLISH_BURST"`           // See WithPublishRate.
+	MaxBufferedBytes int     `yaml:"max_buffered_bytes" env:"GOSSE_MAX_BUFFERED_BYTES"` // See WithMaxBufferedBytes.
+}
+
+// DefaultConfig returns a Config with every setting at its default.
+func DefaultConfig() Config {
+	return Config{}
+}
+
+// ConfigFromYAML decodes a YAML document on top of DefaultConfig. Unknown
+// keys are rejected so that typos do not go unnoticed.
+func ConfigFromYAML(r io.Reader) (Config, error) {
+	cfg := DefaultConfig()
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return Config{}, fmt.Errorf("decode config: %w", err)
+	}
+	return cfg, nil
+}
+
+// LoadConfigFile reads a YAML configuration file with ConfigFromYAML.
+func LoadConfigFile(path string) (Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("load config: %w", err)
+	}
+	defer f.Close()
+	return ConfigFromYAML(f)
+}
+
+// LoadEnv overrides the fields of c from the environment variables named by
+// their env tags (for example GOSSE_HEARTBEAT=15s). Unset variables leave
+// the field unchanged.
+func (c *Config) LoadEnv() error {
+	return c.loadEnv(os.LookupEnv)
+}
+
+// loadEnv is LoadEnv with a pluggable variable lookup.
+func (c *Config) loadEnv(lookup func(string) (string, bool)) error {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	var errs []error
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("env")
+		if name == "" {
+			continue
+		}
+		raw, ok := lookup(name)
+		if !ok {
+			continue
+		}
+		if err := setFromString(v.Field(i), raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s=%q: %w", name, raw, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// setFromString parses raw into field according to its type.
+func setFromString(field reflect.Value, raw string) error {
+	if u, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(raw))
+	}
+	if field.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+	if field.Type() == reflect.TypeOf(map[string]string(nil)) {
+		m, err := parseLabels(raw)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(m))
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
+
+// parseLabels parses comma-separated name=value pairs such as
+// "region=eu,zone=a".
+func parseLabels(raw string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(raw, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("label %q: want name=value", pair)
+		}
+		labels[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return labels, nil
+}
+
+// Options converts c into the equivalent Options. Zero values are skipped
+// so that the defaults apply.
+func (c Config) Options() []Option {
+	var opts []Option
+	if c.BufferSize != 0 {
+		opts = append(opts, WithBufferSize(c.BufferSize))
+	}
+	if c.MaxClients != 0 {
+		opts = append(opts, WithMaxClients(c.MaxClients))
+	}
+	if c.Heartbeat != 0 {
+		opts = append(opts, WithHeartbeat(c.Heartbeat))
+	}
+	if c.Backpressure != DropNewest {
+		opts = append(opts, WithBackpressure(c.Backpressure))
+	}
+	if c.RateLimit != 0 || c.RateBurst != 0 {
+		opts = append(opts, WithRateLimit(c.RateLimit, c.RateBurst))
+	}
+	if c.LogLevel != LevelInfo {
+		opts = append(opts, WithLogLevel(c.LogLevel))
+	}
+	if c.WriteTimeout != 0 {
+		opts = append(opts, WithWriteTimeout(c.WriteTimeout))
+	}
+	if c.InstanceID != "" {
+		opts = append(opts, WithInstanceID(c.InstanceID))
+	}
+	if len(c.Labels) > 0 {
+		opts = append(opts, WithLabels(c.Labels))
+	}
+	if c.History != 0 {
+		opts = append(opts, WithHistory(c.History))
+	}
+	if c.TopicExpiry != 0 {
+		opts = append(opts, WithTopicExpiry(c.TopicExpiry))
+	}
+	if c.IdleTimeout != 0 {
+		opts = append(opts, WithIdleTimeout(c.IdleTimeout))
+	}
+	if c.PublishRate != 0 || c.PublishBurst != 0 {
+		opts = append(opts, WithPublishRate(c.PublishRate, c.PublishBurst))
+	}
+	if c.MaxBufferedBytes != 0 {
+		opts = append(opts, WithMaxBufferedBytes(c.MaxBufferedBytes))
+	}
+	return opts
+}
+
+// Validate reports every invalid setting in c, each wrapping ErrInvalidOption.
+func (c Config) Validate() error {
+	_, err := newOptions(c.Options()...)
+	return err
+}
+
+// Effective returns c with every default spelled out, as a server created
+// from it would run, or the errors Validate reports. InstanceID stays empty
+// when unset, as the default depends on the host and process running the
+// server.
+func (c Config) Effective() (Config, error) {
+	o, err := newOptions(c.Options()...)
+	if err != nil {
+		return Config{}, err
+	}
+	return Config{
+		BufferSize:   o.bufferSize,
+		MaxClients:   o.maxClients,
+		Heartbeat:    o.heartbeat,
+		Backpressure: o.backpressure,
+		RateLimit:    o.rateLimit,
+		RateBurst:    o.rateBurst,
+		LogLevel:     o.logLevel,
+		WriteTimeout: o.writeTimeout,
+		InstanceID:   c.InstanceID,
+		Labels:       o.labels,
+		History:      o.historySize,
+		TopicExpiry:  o.topicExpiry,
+		IdleTimeout:  o.idleTimeout,
+
+		PublishRate:      o.publishRate,
+		PublishBurst:     o.publishBurst,
+		MaxBufferedBytes: o.maxBufferedBytes,
+	}, nil
+}
+
+// NewServerFromConfig creates a Server configured by cfg followed by any
+// extra opts, which take precedence. Unlike NewServer it returns
+// configuration errors instead of panicking.
+func NewServerFromConfig(cfg Config, opts ...Option) (*Server, error) {
+	return New(append(cfg.Options(), opts...)...)
+}
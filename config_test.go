@@ -0,0 +1,136 @@
+package gosse_test
+
+import (
+	"errors"
+	"github.com/Firoz01/gosse/v2"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigFromYAML(t *testing.T) {
+	cfg, err := gosse.ConfigFromYAML(strings.NewReader(`
+buffer_size: 32
+max_clients: 100
+heartbeat: 15s
+backpressure: drop_oldest
+instance_id: edge-1
+labels:
+  region: eu
+history: 500
+publish_rate: 50
+publish_burst: 10
+max_buffered_bytes: 1048576
+`))
+	if err != nil {
+		t.Fatalf("Unexpected error decoding config: %v", err)
+	}
+
+	want := gosse.Config{
+		BufferSize:   32,
+		MaxClients:   100,
+		Heartbeat:    15 * time.Second,
+		Backpressure: gosse.DropOldest,
+		InstanceID:   "edge-1",
+		Labels:       map[string]string{"region": "eu"},
+		History:      500,
+
+		PublishRate:      50,
+		PublishBurst:     10,
+		MaxBufferedBytes: 1 << 20,
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("Expected config %+v, got %+v", want, cfg)
+	}
+
+	// Typos must not be silently ignored
+	if _, err := gosse.ConfigFromYAML(strings.NewReader("bufer_size: 3")); err == nil {
+		t.Error("Expected an error for an unknown key")
+	}
+}
+
+func TestConfig_LoadEnvOverridesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gosse.yaml")
+	if err := os.WriteFile(path, []byte("buffer_size: 32\nheartbeat: 15s\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := gosse.LoadConfigFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected error loading config: %v", err)
+	}
+
+	t.Setenv("GOSSE_HEARTBEAT", "5s")
+	t.Setenv("GOSSE_BACKPRESSURE", "disconnect")
+	t.Setenv("GOSSE_LABELS", "region=eu, zone=a")
+	t.Setenv("GOSSE_PUBLISH_RATE", "2.5")
+	t.Setenv("GOSSE_PUBLISH_BURST", "5")
+	if err := cfg.LoadEnv(); err != nil {
+		t.Fatalf("Unexpected error loading environment: %v", err)
+	}
+	if cfg.BufferSize != 32 || cfg.Heartbeat != 5*time.Second || cfg.Backpressure != gosse.Disconnect || cfg.PublishRate != 2.5 || cfg.PublishBurst != 5 {
+		t.Errorf("Unexpected config after LoadEnv: %+v", cfg)
+	}
+	if want := map[string]string{"region": "eu", "zone": "a"}; !reflect.DeepEqual(cfg.Labels, want) {
+		t.Errorf("Expected labels %v, got %v", want, cfg.Labels)
+	}
+
+	t.Setenv("GOSSE_MAX_CLIENTS", "many")
+	if err := cfg.LoadEnv(); err == nil || !strings.Contains(err.Error(), "GOSSE_MAX_CLIENTS") {
+		t.Errorf("Expected an error naming GOSSE_MAX_CLIENTS, got %v", err)
+	}
+}
+
+func TestNewServerFromConfig(t *testing.T) {
+	if _, err := gosse.NewServerFromConfig(gosse.Config{BufferSize: -1}); !errors.Is(err, gosse.ErrInvalidOption) {
+		t.Errorf("Expected ErrInvalidOption, got %v", err)
+	}
+
+	server, err := gosse.NewServerFromConfig(gosse.Config{MaxClients: 1})
+	if err != nil {
+		t.Fatalf("Unexpected error creating server: %v", err)
+	}
+	defer server.Shutdown()
+	go server.Run()
+
+	server.AddClient()
+	if server.AddClient() != nil {
+		t.Error("Expected MaxClients from the config to be enforced")
+	}
+
+	limited, err := gosse.NewServerFromConfig(gosse.Config{PublishRate: 0.001, PublishBurst: 1})
+	if err != nil {
+		t.Fatalf("Unexpected error creating server: %v", err)
+	}
+	defer limited.Shutdown()
+	go limited.Run()
+	_ = limited.BroadcastMessage([]byte("first"))
+	if err := limited.BroadcastMessage([]byte("second")); !errors.Is(err, gosse.ErrQuotaExceeded) {
+		t.Errorf("Expected the publish rate from the config to be enforced, got %v", err)
+	}
+	if _, err := gosse.NewServerFromConfig(gosse.Config{PublishRate: 5}); !errors.Is(err, gosse.ErrInvalidOption) {
+		t.Errorf("Expected ErrInvalidOption for a publish rate without burst, got %v", err)
+	}
+}
+
+func TestNewServerFromConfig_History(t *testing.T) {
+	server, err := gosse.NewServerFromConfig(gosse.Config{History: 2})
+	if err != nil {
+		t.Fatalf("Unexpected error creating server: %v", err)
+	}
+	go server.Run()
+	defer server.Shutdown()
+
+	for _, msg := range []string{"one", "two", "three"} {
+		_ = server.BroadcastMessage([]byte(msg))
+	}
+	events, cursor := server.Snapshot()
+	if cursor != "3" || len(events) != 0 {
+		t.Errorf("Expected cursor 3 from the history, got %q with %v", cursor, events)
+	}
+	if _, err := gosse.NewServerFromConfig(gosse.Config{History: -1}); !errors.Is(err, gosse.ErrInvalidOption) {
+		t.Errorf("Expected ErrInvalidOption for a negative history, got %v", err)
+	}
+}
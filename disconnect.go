@@ -0,0 +1,78 @@
+package gosse
+
+import "time"
+
+// DisconnectReason describes why a client's stream ended.
+type DisconnectReason string
+
+const (
+	// DisconnectClientRemoved means the client was removed with RemoveClient.
+	DisconnectClientRemoved DisconnectReason = "client_removed"
+
+	// DisconnectClientClosed means the request context was canceled,
+	// usually because the remote peer closed the connection.
+	DisconnectClientClosed DisconnectReason = "client_closed"
+
+	// DisconnectContextCanceled is the former name of DisconnectClientClosed.
+	//
+	// Deprecated: Use DisconnectClientClosed.
+	DisconnectContextCanceled = DisconnectClientClosed
+
+	// DisconnectWriteError means writing or flushing a frame failed.
+	DisconnectWriteError DisconnectReason = "write_error"
+
+	// DisconnectWriteTimeout means a frame could not be written within the
+	// time set with WithWriteTimeout, usually because the peer stopped
+	// reading.
+	DisconnectWriteTimeout DisconnectReason = "write_timeout"
+
+	// DisconnectAuthRevoked means the client was disconnected with
+	// RevokeClient.
+	DisconnectAuthRevoked DisconnectReason = "auth_revoked"
+
+	// DisconnectServerShutdown means the server was shut down.
+	DisconnectServerShutdown DisconnectReason = "server_shutdown"
+
+	// DisconnectEvictedSlow means the client's buffer was full under the
+	// Disconnect backpressure policy.
+	DisconnectEvictedSlow DisconnectReason = "evicted_slow"
+
+	// DisconnectIdle means nothing was delivered to the client for longer
+	// than the time set with WithIdleTimeout.
+	DisconnectIdle DisconnectReason = "idle_timeout"
+)
+
+// logLevel returns the level at which a disconnect for reason is logged:
+// the ordinary ends of a stream at debug level, and those decided by the
+// server or caused by failures at info level or above. Evictions and idle
+// timeouts are already logged when they are decided, so their disconnect
+// is only logged at debug level.
+func (r DisconnectReason) logLevel() LogLevel {
+	switch r {
+	case DisconnectClientClosed, DisconnectClientRemoved, DisconnectServerShutdown, DisconnectEvictedSlow, DisconnectIdle:
+		return LevelDebug
+	case DisconnectWriteTimeout:
+		return LevelWarn
+	default:
+		return LevelInfo
+	}
+}
+
+// ClientInfo is a point-in-time snapshot of a client. Once the client has
+// disconnected, it is the client's final record: DisconnectedAt, Reason and
+// Err tell why the stream ended.
+type ClientInfo struct {
+	ID             string           // Unique identifier for the client.
+	ConnectedAt    time.Time        // Timestamp when the client connected.
+	LastActiveAt   time.Time        // Timestamp of the last message queued for the client.
+	DisconnectedAt time.Time        // Timestamp when the client disconnected, zero while connected.
+	Reason         DisconnectReason // Why the client disconnected, empty while connected.
+	Err            error            // Underlying error, such as a write error, if any.
+	Identity       string           // Identity the connection was coalesced under, if any (see WithHandlerCoalescing).
+}
+
+// Connected reports whether the snapshot was taken before the client
+// disconnected.
+func (i ClientInfo) Connected() bool {
+	return i.Reason == ""
+}
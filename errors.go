@@ -0,0 +1,69 @@
+package gosse
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Sentinel errors returned by the Server. They are always wrapped with
+// additional context (such as the client ID), so callers should compare
+// against them with errors.Is rather than by matching error strings.
+var (
+	// ErrClientNotFound is returned when an operation targets a client ID
+	// that is not connected to the server.
+	ErrClientNotFound = errors.New("client not found")
+
+	// ErrClientNotReady is returned when a client exists but cannot accept
+	// a message right now.
+	ErrClientNotReady = errors.New("client not ready to receive messages")
+
+	// ErrBufferFull is returned alongside ErrClientNotReady when a message
+	// could not be queued because the client's buffer is full.
+	ErrBufferFull = errors.New("client buffer full")
+
+	// ErrServerClosed is returned by operations attempted after Shutdown.
+	ErrServerClosed = errors.New("server closed")
+
+	// ErrTooManyClients is returned when adding a client would exceed the
+	// limit set with WithMaxClients.
+	ErrTooManyClients = errors.New("too many clients")
+
+	// ErrNotRunning is returned when a client is added or removed, or a
+	// message is published, on a server whose Run loop has not been started.
+	ErrNotRunning = errors.New("server not running")
+
+	// ErrMaintenance is returned while the server is in maintenance mode:
+	// by AddClient, and by publishes if they are paused. The wrapping error
+	// carries the maintenance message.
+	ErrMaintenance = errors.New("server in maintenance")
+
+	// ErrNilServer is returned by methods called on a nil *Server.
+	ErrNilServer = errors.New("nil server")
+
+	// ErrInvalidOption is returned when a configuration value, such as a
+	// buffer size, is out of range. The wrapping error names the setting,
+	// the rejected value and the accepted range.
+	ErrInvalidOption = errors.New("invalid option")
+
+	// ErrDeadlineExceeded is returned by SendMessageToClientWithDeadline
+	// when the client's buffer stayed full for the whole deadline.
+	ErrDeadlineExceeded = errors.New("delivery deadline exceeded")
+
+	// ErrQuotaExceeded is returned by publishes beyond the rate set with
+	// WithPublishRate or a HubQuota.
+	ErrQuotaExceeded = errors.New("quota exceeded")
+
+	// ErrInvalidFilter is returned by ParseFilter for malformed filter
+	// expressions. The wrapping error gives the offset of the problem.
+	ErrInvalidFilter = errors.New("invalid filter")
+
+	// ErrStandby is returned by AddClient while the server is a standby
+	// that has not been promoted (see WithStandby).
+	ErrStandby = errors.New("server on standby")
+)
+
+// invalidOption builds an error wrapping ErrInvalidOption that describes why
+// value is not acceptable for the named setting.
+func invalidOption(name string, value interface{}, reason string) error {
+	return fmt.Errorf("%w: %s=%v: %s", ErrInvalidOption, name, value, reason)
+}
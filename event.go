@@ -0,0 +1,172 @@
+package gosse
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event is a single message delivered to a client. Clients receive Events
+// from Client.Messages, and the HTTP handler encodes each one as an SSE frame.
+type Event struct {
+	Data  []byte // Payload written as the frame's data field.
+	Topic string // Topic the event was published to, empty for broadcasts and targeted messages. It is not written to the stream.
+	ID    string // Written as the frame's id field; set for events kept in history (see WithHistory).
+	Name  string // Written as the frame's event field, empty for the browser's default "message" event.
+	Key   string // Partition key given to PublishKeyed, empty otherwise. It is not written to the stream.
+
+	// Retry is written as the frame's retry field, in milliseconds: the
+	// delay before the browser reconnects if the stream drops. Zero writes
+	// no field.
+	Retry time.Duration
+
+	// Comment is set for comment frames queued by BroadcastComment and
+	// SendCommentToClient, which carry no data and should be skipped by
+	// consumers other than the HTTP handler.
+	Comment string
+
+	// Schema is the version of the payload's schema, for handlers set up
+	// with WithHandlerSchemas. Zero means the handler's current version.
+	Schema int
+
+	// Fields are written as extra "x-<name>: <value>" lines of the frame, in
+	// order of name, for lightweight metadata without changing the payload.
+	// EventSource ignores them; custom parsers such as sseclient read them.
+	// Names must not be empty or contain colons or line breaks, and values
+	// must not contain line breaks. The map must not be modified once the
+	// event is published.
+	Fields map[string]string
+
+	// Trace tags the event for delivery tracing: every client it is queued
+	// for, written to or dropped from is recorded under this ID (see
+	// DeliveryTrace). Empty for untraced events. It is not written to the
+	// stream.
+	Trace string
+
+	seq     uint64        // Position in the history, 0 if the event is not kept
+	barrier chan struct{} // If set, the event only marks a position: closed once everything queued before it is written or dropped
+	at      time.Time     // When the event was published, zero unless it is kept or handed to a sink
+	shared  *sharedFrame  // Frame formatted once for every recipient, nil to format it per client
+}
+
+// sharedFrame caches the frame of an event sent to many clients, such as a
+// BroadcastJSON payload, so handlers format it once instead of per client.
+type sharedFrame struct {
+	once  sync.Once
+	ev    Event // The event the frame was formatted from
+	frame string
+}
+
+// get returns the frame of ev, formatting it with format the first time.
+// Events that no longer match the cached one, because a transform or the
+// replay changed them, are formatted afresh.
+func (f *sharedFrame) get(ev Event, format func(Event) string) string {
+	f.once.Do(func() {
+		f.ev, f.frame = ev, format(ev)
+	})
+	if ev.ID != f.ev.ID || ev.Name != f.ev.Name || ev.Retry != f.ev.Retry || !sameBytes(ev.Data, f.ev.Data) || !sameFields(ev.Fields, f.ev.Fields) {
+		return format(ev)
+	}
+	return f.frame
+}
+
+// sameBytes reports whether a and b are the same slice of memory.
+func sameBytes(a, b []byte) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
+
+// sameFields reports whether a and b hold the same fields.
+func sameFields(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, value := range a {
+		if other, ok := b[name]; !ok || other != value {
+			return false
+		}
+	}
+	return true
+}
+
+// PublishedAt returns when the event was published, for events kept in
+// the history (see WithHistory) or handed to a Sink, and the zero time for
+// others.
+func (ev Event) PublishedAt() time.Time {
+	return ev.at
+}
+
+// validate rejects events whose fields would break their frame.
+func (ev Event) validate() error {
+	if strings.ContainsAny(ev.ID, "\r\n") {
+		return invalidOption("Event.ID", strconv.Quote(ev.ID), "must not contain line breaks")
+	}
+	if strings.ContainsAny(ev.Name, "\r\n") {
+		return invalidOption("Event.Name", strconv.Quote(ev.Name), "must not contain line breaks")
+	}
+	if ev.Retry < 0 {
+		return invalidOption("Event.Retry", ev.Retry, "must not be negative")
+	}
+	if ev.Schema < 0 {
+		return invalidOption("Event.Schema", ev.Schema, "must not be negative")
+	}
+	for name, value := range ev.Fields {
+		if name == "" || strings.ContainsAny(name, ":\r\n") {
+			return invalidOption("Event.Fields", strconv.Quote(name), "names must not be empty or contain colons or line breaks")
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return invalidOption("Event.Fields", strconv.Quote(value), "values must not contain line breaks")
+		}
+	}
+	return nil
+}
+
+// CompressedPrefix starts the data of an event whose payload was compressed
+// with gzip by a handler set up with WithHandlerPayloadCompression. The rest
+// of the data is the gzip-compressed payload in standard base64; payloads
+// compressed with other codecs start with the codec's name instead (see
+// Codec). DecodePayload reverses the encoding.
+const CompressedPrefix = "gzip;base64,"
+
+// DecodePayload returns the original payload of an event's data as written
+// by a Handler: payloads compressed with a registered codec (see
+// CompressedPrefix and RegisterCodec) are decompressed and any other data
+// is returned as is.
+func DecodePayload(data string) ([]byte, error) {
+	codec, encoded := compressedWith(data)
+	if codec == nil {
+		return []byte(data), nil
+	}
+	compressed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("decode payload: %w", err)
+	}
+	payload, err := codec.Decompress(compressed)
+	if err != nil {
+		return nil, fmt.Errorf("decode payload: %s: %w", codec.Name(), err)
+	}
+	return payload, nil
+}
+
+// encodePayload returns data as written to the stream: compressed with
+// codec if it is at least threshold bytes long, or if it starts with the
+// prefix of a registered codec and would otherwise be mistaken for a
+// compressed payload. Without a codec, for clients sharing none with the
+// handler, only such payloads are compressed, with gzip. A zero threshold
+// disables compression.
+func encodePayload(data []byte, codec Codec, threshold int) string {
+	if threshold <= 0 {
+		return string(data)
+	}
+	if codec == nil || len(data) < threshold {
+		if c, _ := compressedWith(string(data)); c == nil {
+			return string(data)
+		}
+		if codec == nil {
+			codec = gzipCodec{} // Every consumer of CompressedPrefix decodes it
+		}
+	}
+	return codec.Name() + codecSeparator + base64.StdEncoding.EncodeToString(codec.Compress(data))
+}
@@ -0,0 +1,89 @@
+package gosse
+
+import "time"
+
+// WithTopicExpiry frees the state of topics that have had no subscribers
+// and no publishes for idle: the retained event reported by Topics and
+// Snapshot, the publish rate and the events kept in the history (see
+// WithHistory). Applications with dynamic topic names, one per document or
+// chat room say, use it so topics nobody uses any more do not pile up. A
+// topic that is published to or subscribed again starts afresh. Topics are
+// checked every idle/2, at most every minute. Zero, the default, keeps
+// topic state for the server's lifetime.
+func WithTopicExpiry(idle time.Duration) Option {
+	return func(o *options) error {
+		if idle < 0 {
+			return invalidOption("WithTopicExpiry", idle, "must not be negative")
+		}
+		o.topicExpiry = idle
+		return nil
+	}
+}
+
+// WithOnTopicExpired registers a hook called with the last state of every
+// topic freed by WithTopicExpiry, for example to drop the application's
+// own data about it. The hook runs on the goroutine checking topics, so it
+// must not block.
+func WithOnTopicExpired(hook func(TopicInfo)) Option {
+	return func(o *options) error {
+		if hook == nil {
+			return invalidOption("WithOnTopicExpired", "nil", "must not be nil")
+		}
+		o.onTopicExpired = hook
+		return nil
+	}
+}
+
+// sweepInterval returns how often to look for topics or clients that have
+// been idle for idle: every idle/2, at most every minute.
+func sweepInterval(idle time.Duration) time.Duration {
+	interval := idle / 2
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+	return interval
+}
+
+// watchTopics expires idle topics until the server shuts down.
+func (s *Server) watchTopics() {
+	ticker := time.NewTicker(sweepInterval(s.opts.topicExpiry))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.expireTopics(s.opts.now())
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// expireTopics frees the topics idle for longer than WithTopicExpiry at now.
+// An expired state is marked before it is deleted, under its lock, so
+// publishes and subscribers racing with the expiry move on to a fresh one
+// (see lockedTopic).
+func (s *Server) expireTopics(now time.Time) {
+	s.topics.Range(func(key, value interface{}) bool {
+		name, t := key.(string), value.(*topicState)
+		t.mu.Lock()
+		idle := t.subscribers == 0 && now.Sub(t.activeAt) >= s.opts.topicExpiry
+		if idle {
+			t.expired = true
+			s.topics.CompareAndDelete(name, t)
+			// Events published since belong to the fresh state
+			s.history.forget(name, t.activeAt)
+		}
+		t.mu.Unlock()
+		if !idle {
+			return true
+		}
+		s.logf(LevelDebug, "topic %s expired after %s without use", name, now.Sub(t.activeAt))
+		if s.opts.onTopicExpired != nil {
+			s.opts.onTopicExpired(t.info(name, now))
+		}
+		return true
+	})
+}
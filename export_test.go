@@ -0,0 +1,11 @@
+package gosse
+
+import "io"
+
+// SetRandReader replaces the random source used for client IDs and returns
+// a function restoring the previous one.
+func SetRandReader(r io.Reader) (restore func()) {
+	previous := randReader
+	randReader = r
+	return func() { randReader = previous }
+}
@@ -0,0 +1,127 @@
+// Package federation republishes topics of remote gosse servers on a local
+// one, so edge nodes can aggregate the streams of regional hubs and serve
+// them to their own clients:
+//
+//	mirror := federation.Mirror{
+//		Remote: "https://hub-eu.example.com/events",
+//		Topics: []string{"prices", "alerts"},
+//		Prefix: "eu/",
+//	}
+//	go mirror.Run(ctx, server)
+//
+// Each topic is read over a connection of its own with the Go client (see
+// sseclient), which reconnects with Last-Event-ID when a connection drops,
+// so with gosse.WithHistory on the remote server nothing is missed.
+package federation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Firoz01/gosse/v2"
+	"github.com/Firoz01/gosse/v2/sseclient"
+	"net/url"
+	"sync/atomic"
+)
+
+// skipped are the names of the events a remote Handler writes about the
+// stream itself rather than its topic, which are not republished.
+var skipped = map[string]bool{
+	"replay-start": true,
+	"replay-end":   true,
+	"checkpoint":   true,
+}
+
+// Mirror republishes topics of a remote server's Handler on a local server.
+// Events keep their data and name; the remote IDs are not kept, as the
+// local history numbers events itself, and partition keys never leave the
+// remote server. The remote replay markers and checkpoints (see
+// gosse.WithHandlerCheckpoints) are not republished.
+type Mirror struct {
+	Remote  string             // URL of the remote Handler, such as "https://hub-eu.example.com/events".
+	Topics  []string           // Remote topics to republish.
+	Prefix  string             // Prepended to the topic names locally, such as "eu/", to keep the hubs apart.
+	Options []sseclient.Option // Configure the connections, for example with sseclient.WithHTTPClient for authentication.
+
+	// OnError, if set, is called with events the local server would not
+	// take, for example over its publish rate (see gosse.WithPublishRate).
+	// Those events are skipped either way. It is called from one goroutine
+	// per topic, so it must be safe for concurrent use.
+	OnError func(topic string, err error)
+}
+
+// Run republishes the topics until ctx is done, the local server shuts
+// down, which is noticed at the next event, or the remote server refuses a
+// stream. It returns the error that
+// stopped it: ctx.Err() wrapped with context, gosse.ErrServerClosed, or an
+// error wrapping sseclient.ErrBadResponse. A remote server that is down or
+// drops the connection is retried rather than reported.
+func (m Mirror) Run(ctx context.Context, local *gosse.Server) error {
+	if local == nil {
+		return gosse.ErrNilServer
+	}
+	if len(m.Topics) == 0 {
+		return fmt.Errorf("%w: Mirror.Topics: at least one topic is required", gosse.ErrInvalidOption)
+	}
+	clients := make([]*sseclient.Client, len(m.Topics))
+	for i, topic := range m.Topics {
+		target, err := topicURL(m.Remote, topic)
+		if err != nil {
+			return err
+		}
+		if clients[i], err = sseclient.New(target, m.Options...); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var closed atomic.Bool
+	errc := make(chan error, len(m.Topics))
+	for i, topic := range m.Topics {
+		name := m.Prefix + topic
+		go func(client *sseclient.Client) {
+			errc <- client.Run(ctx, func(ev sseclient.Event) {
+				if skipped[ev.Name] {
+					return
+				}
+				_, _, err := local.TryPublish(name, gosse.Event{Data: ev.Data, Name: ev.Name, Fields: ev.Fields})
+				switch {
+				case errors.Is(err, gosse.ErrServerClosed):
+					closed.Store(true)
+					cancel()
+				case err != nil && m.OnError != nil:
+					m.OnError(name, err)
+				}
+			})
+		}(clients[i])
+	}
+	// One stream failing stops the others; report the failure rather than
+	// the cancellations it caused
+	var first error
+	for range m.Topics {
+		if err := <-errc; first == nil || !errors.Is(err, context.Canceled) && errors.Is(first, context.Canceled) {
+			first = err
+		}
+		cancel()
+	}
+	if closed.Load() {
+		return gosse.ErrServerClosed
+	}
+	return first
+}
+
+// topicURL returns remote with topic added to its query.
+func topicURL(remote, topic string) (string, error) {
+	u, err := url.Parse(remote)
+	if err != nil {
+		return "", fmt.Errorf("%w: Mirror.Remote=%q: %v", gosse.ErrInvalidOption, remote, err)
+	}
+	if topic == "" {
+		return "", fmt.Errorf("%w: Mirror.Topics: topic names must not be empty", gosse.ErrInvalidOption)
+	}
+	query := u.Query()
+	query.Add("topic", topic)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
@@ -0,0 +1,63 @@
+package federation_test
+
+import (
+	"context"
+	"errors"
+	"github.com/Firoz01/gosse/v2"
+	"github.com/Firoz01/gosse/v2/federation"
+	"github.com/Firoz01/gosse/v2/sseclient"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMirror(t *testing.T) {
+	hub := gosse.NewServer(gosse.WithAutoRun())
+	defer hub.Shutdown()
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gosse.SSEHandlerEndpoint(hub, w, r)
+	}))
+	defer remote.Close()
+	edge := gosse.NewServer(gosse.WithAutoRun())
+	defer edge.Shutdown()
+	subscriber, err := edge.SubscribeContext(context.Background(), "eu/prices")
+	if err != nil {
+		t.Fatalf("Unexpected error subscribing: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	mirror := federation.Mirror{Remote: remote.URL, Topics: []string{"prices", "alerts"}, Prefix: "eu/"}
+	go func() { done <- mirror.Run(ctx, edge) }()
+	for deadline := time.Now().Add(time.Second); hub.ClientCount() < 2; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Timeout waiting for the mirror to connect")
+		}
+	}
+
+	_ = hub.Publish("prices", []byte("42"))
+	select {
+	case ev := <-subscriber.Messages():
+		if string(ev.Data) != "42" || ev.Topic != "eu/prices" {
+			t.Errorf("Expected 42 on eu/prices, got %q on %q", ev.Data, ev.Topic)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for the mirrored event")
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled once ctx is done, got %v", err)
+	}
+
+	refusing := httptest.NewServer(http.NotFoundHandler())
+	defer refusing.Close()
+	err = federation.Mirror{Remote: refusing.URL, Topics: []string{"prices"}}.Run(context.Background(), edge)
+	if !errors.Is(err, sseclient.ErrBadResponse) {
+		t.Errorf("Expected ErrBadResponse from a refusing remote, got %v", err)
+	}
+	if err := (federation.Mirror{Remote: remote.URL}).Run(context.Background(), edge); !errors.Is(err, gosse.ErrInvalidOption) {
+		t.Errorf("Expected ErrInvalidOption without topics, got %v", err)
+	}
+}
@@ -0,0 +1,389 @@
+package gosse
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Filter is a compiled filter expression selecting events by their JSON
+// payload. Expressions compare fields of the payload with literals:
+//
+//	symbol == "ACME" && price >= 100
+//	!(level == "debug") || user.id == 42
+//
+// Fields are named by dotted paths into nested objects. Literals are
+// numbers, double-quoted strings, true, false and null. The operators are
+// == != < <= > >= for comparisons, && || ! for logic, and parentheses for
+// grouping. A field on its own is true only if it holds true.
+//
+// Numbers compare numerically and strings lexically; comparisons between
+// different types are false, except != which is true. Missing fields are
+// null. Payloads that are not JSON match no filter.
+type Filter struct {
+	expr string
+	root filterNode
+}
+
+// ParseFilter compiles expr. Malformed expressions return an error wrapping
+// ErrInvalidFilter.
+func ParseFilter(expr string) (*Filter, error) {
+	p := &filterParser{src: expr}
+	p.next()
+	root, err := p.or()
+	if err == nil && p.tok.kind != tokEOF {
+		err = p.errorf("unexpected %s", p.tok)
+	}
+	if err == nil {
+		err = p.err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Filter{expr: expr, root: root}, nil
+}
+
+// String returns the expression the filter was parsed from.
+func (f *Filter) String() string {
+	return f.expr
+}
+
+// Match reports whether the JSON payload data satisfies the filter.
+func (f *Filter) Match(data []byte) bool {
+	return f.matches(&filterInput{data: data})
+}
+
+// matches is like Match for a payload that may already be decoded.
+func (f *Filter) matches(in *filterInput) bool {
+	doc, ok := in.decode()
+	return ok && truthy(f.root.eval(doc))
+}
+
+// filterInput decodes a payload at most once, however many clients'
+// filters look at it.
+type filterInput struct {
+	data    []byte
+	decoded bool
+	doc     interface{}
+	ok      bool
+}
+
+// decode returns the decoded payload, and whether it is valid JSON.
+func (in *filterInput) decode() (interface{}, bool) {
+	if !in.decoded {
+		in.decoded = true
+		dec := json.NewDecoder(bytes.NewReader(in.data))
+		dec.UseNumber()
+		in.ok = dec.Decode(&in.doc) == nil
+	}
+	return in.doc, in.ok
+}
+
+// filterNode is a node of a parsed expression.
+type filterNode interface {
+	eval(doc interface{}) interface{}
+}
+
+type (
+	filterLiteral struct{ value interface{} }
+	filterPath    []string
+	filterNot     struct{ x filterNode }
+	filterLogic   struct {
+		and  bool
+		x, y filterNode
+	}
+	filterCompare struct {
+		op   string
+		x, y filterNode
+	}
+)
+
+func (n filterLiteral) eval(interface{}) interface{} { return n.value }
+
+func (n filterPath) eval(doc interface{}) interface{} {
+	for _, key := range n {
+		obj, ok := doc.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		doc = obj[key]
+	}
+	if num, ok := doc.(json.Number); ok {
+		f, err := num.Float64()
+		if err != nil {
+			return nil
+		}
+		return f
+	}
+	return doc
+}
+
+func (n filterNot) eval(doc interface{}) interface{} { return !truthy(n.x.eval(doc)) }
+
+func (n filterLogic) eval(doc interface{}) interface{} {
+	if n.and {
+		return truthy(n.x.eval(doc)) && truthy(n.y.eval(doc))
+	}
+	return truthy(n.x.eval(doc)) || truthy(n.y.eval(doc))
+}
+
+func (n filterCompare) eval(doc interface{}) interface{} {
+	x, y := n.x.eval(doc), n.y.eval(doc)
+	var cmp int
+	switch xv := x.(type) {
+	case float64:
+		yv, ok := y.(float64)
+		if !ok {
+			return n.op == "!="
+		}
+		switch {
+		case xv < yv:
+			cmp = -1
+		case xv > yv:
+			cmp = 1
+		}
+	case string:
+		yv, ok := y.(string)
+		if !ok {
+			return n.op == "!="
+		}
+		cmp = strings.Compare(xv, yv)
+	case bool, nil:
+		if yb, ok := y.(bool); (ok || y == nil) && (n.op == "==" || n.op == "!=") {
+			xb, _ := x.(bool)
+			equal := (x == nil) == (y == nil) && xb == yb
+			return equal == (n.op == "==")
+		}
+		return n.op == "!="
+	default:
+		// Objects and arrays are only ever unequal
+		return n.op == "!="
+	}
+	switch n.op {
+	case "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	default:
+		return cmp >= 0
+	}
+}
+
+// truthy reports whether v is the boolean true.
+func truthy(v interface{}) bool {
+	b, ok := v.(bool)
+	return ok && b
+}
+
+// Tokens of the filter language.
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokOp
+)
+
+type filterToken struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t filterToken) String() string {
+	if t.kind == tokEOF {
+		return "end of expression"
+	}
+	return strconv.Quote(t.text)
+}
+
+// filterParser is a recursive descent parser for filter expressions:
+//
+//	or      = and { "||" and }
+//	and     = unary { "&&" unary }
+//	unary   = "!" unary | compare
+//	compare = operand [ ("==" | "!=" | "<" | "<=" | ">" | ">=") operand ]
+//	operand = "(" or ")" | literal | path
+type filterParser struct {
+	src string
+	off int
+	tok filterToken
+	err error // First lexical error, reported by the parser
+}
+
+func (p *filterParser) errorf(format string, args ...interface{}) error {
+	if p.err != nil {
+		return p.err
+	}
+	return fmt.Errorf("%w: %s at offset %d", ErrInvalidFilter, fmt.Sprintf(format, args...), p.tok.pos)
+}
+
+func (p *filterParser) or() (filterNode, error) {
+	x, err := p.and()
+	for err == nil && p.tok.text == "||" {
+		p.next()
+		var y filterNode
+		if y, err = p.and(); err == nil {
+			x = filterLogic{x: x, y: y}
+		}
+	}
+	return x, err
+}
+
+func (p *filterParser) and() (filterNode, error) {
+	x, err := p.unary()
+	for err == nil && p.tok.text == "&&" {
+		p.next()
+		var y filterNode
+		if y, err = p.unary(); err == nil {
+			x = filterLogic{and: true, x: x, y: y}
+		}
+	}
+	return x, err
+}
+
+func (p *filterParser) unary() (filterNode, error) {
+	if p.tok.kind == tokOp && p.tok.text == "!" {
+		p.next()
+		x, err := p.unary()
+		return filterNot{x}, err
+	}
+	return p.compare()
+}
+
+func (p *filterParser) compare() (filterNode, error) {
+	x, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	switch op := p.tok.text; {
+	case p.tok.kind == tokOp && (op == "==" || op == "!=" || op == "<" || op == "<=" || op == ">" || op == ">="):
+		p.next()
+		y, err := p.operand()
+		return filterCompare{op: op, x: x, y: y}, err
+	}
+	return x, nil
+}
+
+func (p *filterParser) operand() (filterNode, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokOp:
+		if tok.text != "(" {
+			break
+		}
+		p.next()
+		x, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.text != ")" {
+			return nil, p.errorf("expected ) but found %s", p.tok)
+		}
+		p.next()
+		return x, nil
+	case tokNumber:
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, p.errorf("bad number %s", tok)
+		}
+		p.next()
+		return filterLiteral{f}, nil
+	case tokString:
+		s, err := strconv.Unquote(tok.text)
+		if err != nil {
+			return nil, p.errorf("bad string %s", tok)
+		}
+		p.next()
+		return filterLiteral{s}, nil
+	case tokIdent:
+		p.next()
+		switch tok.text {
+		case "true":
+			return filterLiteral{true}, nil
+		case "false":
+			return filterLiteral{false}, nil
+		case "null":
+			return filterLiteral{nil}, nil
+		}
+		return filterPath(strings.Split(tok.text, ".")), nil
+	}
+	return nil, p.errorf("expected a field or literal but found %s", tok)
+}
+
+// next scans the next token into p.tok.
+func (p *filterParser) next() {
+	for p.off < len(p.src) && strings.IndexByte(" \t\r\n", p.src[p.off]) >= 0 {
+		p.off++
+	}
+	start := p.off
+	if p.off == len(p.src) {
+		p.tok = filterToken{kind: tokEOF, pos: start}
+		return
+	}
+	c := p.src[p.off]
+	switch {
+	case isIdentByte(c) && (c < '0' || c > '9'):
+		for p.off < len(p.src) && (isIdentByte(p.src[p.off]) || p.src[p.off] == '.') {
+			p.off++
+		}
+		p.tok = filterToken{kind: tokIdent, text: p.src[start:p.off], pos: start}
+		if strings.HasSuffix(p.tok.text, ".") || strings.Contains(p.tok.text, "..") {
+			p.fail(start, "bad field path %q", p.tok.text)
+		}
+	case c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		p.off++
+		for p.off < len(p.src) && strings.IndexByte("0123456789.eE+-", p.src[p.off]) >= 0 {
+			p.off++
+		}
+		p.tok = filterToken{kind: tokNumber, text: p.src[start:p.off], pos: start}
+	case c == '"':
+		p.off++
+		for p.off < len(p.src) && p.src[p.off] != '"' {
+			if p.src[p.off] == '\\' {
+				p.off++
+			}
+			p.off++
+		}
+		if p.off >= len(p.src) {
+			p.fail(start, "unterminated string")
+			p.off = len(p.src)
+		} else {
+			p.off++
+		}
+		p.tok = filterToken{kind: tokString, text: p.src[start:p.off], pos: start}
+	default:
+		for _, op := range []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")"} {
+			if strings.HasPrefix(p.src[p.off:], op) {
+				p.off += len(op)
+				p.tok = filterToken{kind: tokOp, text: op, pos: start}
+				return
+			}
+		}
+		p.fail(start, "unexpected character %q", c)
+		p.off = len(p.src)
+		p.tok = filterToken{kind: tokEOF, pos: start}
+	}
+}
+
+// fail records the first lexical error.
+func (p *filterParser) fail(pos int, format string, args ...interface{}) {
+	if p.err == nil {
+		p.err = fmt.Errorf("%w: %s at offset %d", ErrInvalidFilter, fmt.Sprintf(format, args...), pos)
+	}
+}
+
+// isIdentByte reports whether c may appear in a field name.
+func isIdentByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
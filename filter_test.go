@@ -0,0 +1,94 @@
+package gosse_test
+
+import (
+	"context"
+	"errors"
+	"github.com/Firoz01/gosse/v2"
+	"testing"
+)
+
+func TestFilter_Match(t *testing.T) {
+	payload := []byte(`{"symbol":"ACME","price":101.5,"halted":false,"tags":["x"],"user":{"id":42,"name":"ann"}}`)
+	for expr, want := range map[string]bool{
+		`symbol == "ACME"`:                          true,
+		`symbol != "ACME"`:                          false,
+		`price > 100 && price <= 101.5`:             true,
+		`price < 100 || user.id == 42`:              true,
+		`!(user.name >= "b")`:                       true,
+		`halted`:                                    false,
+		`!halted && symbol == "ACME"`:               true,
+		`missing == null`:                           true,
+		`missing != null`:                           false,
+		`user.missing.deeper == null`:               true,
+		`price == "101.5"`:                          false,
+		`price != "101.5"`:                          true,
+		`tags == null`:                              false,
+		`halted == false`:                           true,
+		`user.id == 42 && (symbol == "X" || 1 < 2)`: true,
+	} {
+		f, err := gosse.ParseFilter(expr)
+		if err != nil {
+			t.Errorf("Unexpected error parsing %s: %v", expr, err)
+			continue
+		}
+		if got := f.Match(payload); got != want {
+			t.Errorf("Expected %s to be %v, got %v", expr, want, got)
+		}
+	}
+
+	f, _ := gosse.ParseFilter(`price > 0`)
+	if f.Match([]byte("not json")) {
+		t.Error("Expected payloads that are not JSON to match nothing")
+	}
+}
+
+func TestParseFilter_Errors(t *testing.T) {
+	for _, expr := range []string{
+		``,
+		`price >`,
+		`(price > 1`,
+		`price > 1)`,
+		`symbol == "ACME`,
+		`user. == 1`,
+		`price = 1`,
+		`price > 1 &&`,
+	} {
+		if _, err := gosse.ParseFilter(expr); !errors.Is(err, gosse.ErrInvalidFilter) {
+			t.Errorf("Expected ErrInvalidFilter for %q, got %v", expr, err)
+		}
+	}
+}
+
+func TestServer_FilteredDelivery(t *testing.T) {
+	server := gosse.NewServer()
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	client, err := server.SubscribeContext(context.Background(), "quotes")
+	if err != nil {
+		t.Fatalf("Unexpected error subscribing: %v", err)
+	}
+	f, err := gosse.ParseFilter(`symbol == "ACME"`)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing filter: %v", err)
+	}
+	client.SetFilter(f)
+
+	_ = server.Publish("quotes", []byte(`{"symbol":"OTHER"}`))
+	_ = server.Publish("quotes", []byte(`{"symbol":"ACME"}`))
+	_ = server.BroadcastMessage([]byte(`{"symbol":"OTHER"}`))
+	_ = server.SendMessageToClient(client.ID, []byte("direct")) // Never filtered
+
+	for _, want := range []string{`{"symbol":"ACME"}`, "direct"} {
+		if ev := <-client.Messages(); string(ev.Data) != want {
+			t.Errorf("Expected %s, got %s", want, ev.Data)
+		}
+	}
+	select {
+	case ev := <-client.Messages():
+		t.Errorf("Expected no more events, got %s", ev.Data)
+	default:
+	}
+}
@@ -0,0 +1,78 @@
+package gosse
+
+import (
+	"hash/fnv"
+	"sort"
+)
+
+// SetGroup makes the client a member of group for topic, or takes it out
+// of its group if group is "". The members of a group share the topic's
+// events instead of each receiving all of them, like a consumer group:
+// every event goes to one member that would otherwise have received it.
+// Events with a key (see PublishKeyed) go to the member the key hashes to,
+// so each key sticks to one member while the membership is stable; other
+// events go to the members in turn. Clients outside any group still
+// receive every event. A member whose buffer is full drops the event it is
+// given like any subscriber, and replays (see WithHistory) are not shared
+// out.
+func (c *Client) SetGroup(topic, group string) {
+	// Fan-out reads the group of each subscriber through group on the
+	// publisher's goroutine, without holding groupM, so changes store a
+	// new map instead of writing to the one it may be reading
+	c.groupM.Lock()
+	defer c.groupM.Unlock()
+	next := make(map[string]string)
+	if current := c.groups.Load(); current != nil {
+		for t, g := range *current {
+			next[t] = g
+		}
+	}
+	if group == "" {
+		delete(next, topic)
+	} else {
+		next[topic] = group
+	}
+	c.groups.Store(&next)
+}
+
+// group returns the client's group for topic, or "" if it has none.
+func (c *Client) group(topic string) string {
+	groups := c.groups.Load()
+	if groups == nil {
+		return ""
+	}
+	return (*groups)[topic]
+}
+
+// pick returns the member of group that receives an event with key: the
+// member with the highest hash of key and its ID for keyed events, so only
+// the keys of members that join or leave move, and the next member in turn
+// for the rest.
+func (t *topicState) pick(group string, members []*Client, key string) *Client {
+	if key != "" {
+		var best *Client
+		var bestScore uint32
+		for _, member := range members {
+			h := fnv.New32a()
+			h.Write([]byte(key))
+			h.Write([]byte{0})
+			h.Write([]byte(member.ID))
+			if score := h.Sum32(); best == nil || score > bestScore || score == bestScore && member.ID < best.ID {
+				best, bestScore = member, score
+			}
+		}
+		return best
+	}
+
+	// Members are visited in no particular order; sort them so turns
+	// rotate through a stable sequence
+	sort.Slice(members, func(i, j int) bool { return members[i].ID < members[j].ID })
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.turns == nil {
+		t.turns = make(map[string]uint64)
+	}
+	turn := t.turns[group]
+	t.turns[group]++
+	return members[turn%uint64(len(members))]
+}
@@ -1,41 +1,1137 @@
 package gosse
 
 import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
+// errStreamingUnsupported is recorded when the ResponseWriter cannot flush.
+var errStreamingUnsupported = errors.New("streaming unsupported: response writer cannot flush")
+
+// Handler serves a Server's events over SSE. A Handler can override selected
+// server defaults with HandlerOptions, so one server can back several
+// endpoints, for example a public stream limited to a few topics next to an
+// internal stream that sees everything.
+type Handler struct {
+	server    *Server
+	heartbeat *time.Duration            // Overrides the server's heartbeat if set
+	beatRange [2]time.Duration          // Bounds of client-requested heartbeats, zero if not allowed
+	topics    map[string]struct{}       // Topics clients may subscribe to, nil for any
+	auth      func(*http.Request) error // Admits or rejects each request, nil to admit all
+	gzip      *sync.Pool                // Of *gzip.Writer, nil if compression is off
+	compress  int                       // Payload size from which events are compressed, 0 for never
+	codecs    []Codec                   // Payload codecs offered, in order of preference; nil for gzip only
+	proxies   bool                      // Defeat buffering by reverse proxies
+	filters   bool                      // Accept filter expressions from clients
+	markers   *[2]string                // Names of the replay start and end events, nil for the defaults
+	session   bool                      // Announce the client ID first, for SessionHandler
+	opening   *Event                    // Written first on every stream, nil for nothing
+
+	identify func(*http.Request) string // Names the identity a request is coalesced under, nil for none
+	window   *replayWindow              // Limits of client-chosen replay windows, nil if not allowed
+	trace    *WriteTrace                // Hooks around frame writes, nil for none
+
+	replayRate  float64 // Replayed frames per second, 0 for no separate limit
+	replayBurst int     // Replayed frames written back to back before replayRate applies
+
+	probe     *deliveryProbe                     // Probes of incremental delivery, nil if off
+	transform func(*Client, Event) (Event, bool) // Rewrites or drops events per client, nil for none
+	schemas   *schemaSet                         // Payload schema versions clients may pick, nil if not versioned
+
+	metadata func(*http.Request) map[string]string // Names each client's metadata, nil for none
+
+	checkpoints time.Duration // Interval of checkpoint events, 0 for none
+}
+
+// HandlerOption configures a Handler.
+type HandlerOption func(*Handler) error
+
+// NewHandler returns a Handler serving server's events. Invalid options are
+// reported together in an error wrapping ErrInvalidOption.
+func NewHandler(server *Server, opts ...HandlerOption) (*Handler, error) {
+	h := &Handler{server: server}
+	var errs []error
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if err := opt(h); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// WithHandlerHeartbeat overrides the server's heartbeat interval (see
+// WithHeartbeat) for this handler's connections. Zero disables heartbeats.
+// Once overridden, heartbeat changes made with UpdateConfig no longer apply
+// to the handler.
+func WithHandlerHeartbeat(interval time.Duration) HandlerOption {
+	return func(h *Handler) error {
+		if interval < 0 || (interval > 0 && interval < time.Millisecond) {
+			return invalidOption("WithHandlerHeartbeat", interval, "must be 0 or at least 1ms")
+		}
+		h.heartbeat = &interval
+		return nil
+	}
+}
+
+// WithHandlerHeartbeatRange lets each client choose its own heartbeat
+// interval between min and max, so for example mobile clients can send
+// fewer keep-alives to spare their radio. Clients ask with a "heartbeat"
+// query parameter or a Heartbeat-Interval header, either a duration such as
+// "45s" or a number of seconds; requests outside the range are clamped to
+// it, and malformed ones are rejected with 400 Bad Request. Clients that do
+// not ask get the handler's usual heartbeat.
+func WithHandlerHeartbeatRange(min, max time.Duration) HandlerOption {
+	return func(h *Handler) error {
+		if min < time.Millisecond || max < min {
+			return invalidOption("WithHandlerHeartbeatRange", fmt.Sprintf("%s-%s", min, max), "need 1ms <= min <= max")
+		}
+		h.beatRange = [2]time.Duration{min, max}
+		return nil
+	}
+}
+
+// WithHandlerTopics limits the topics clients of this handler may subscribe
+// to. Clients choose topics with repeated "topic" query parameters; asking
+// for a topic that is not listed is rejected with 403 Forbidden. Without
+// this option clients may subscribe to any topic.
+func WithHandlerTopics(topics ...string) HandlerOption {
+	return func(h *Handler) error {
+		if err := validateTopics("WithHandlerTopics", topics...); err != nil {
+			return err
+		}
+		h.topics = make(map[string]struct{}, len(topics))
+		for _, topic := range topics {
+			h.topics[topic] = struct{}{}
+		}
+		return nil
+	}
+}
+
+// WithHandlerAuth sets a hook deciding whether a request may open a stream.
+// If auth returns an error, the request is rejected with 401 Unauthorized
+// before a client is added. The error itself is not sent to the client.
+func WithHandlerAuth(auth func(r *http.Request) error) HandlerOption {
+	return func(h *Handler) error {
+		if auth == nil {
+			return invalidOption("WithHandlerAuth", "nil", "must not be nil")
+		}
+		h.auth = auth
+		return nil
+	}
+}
+
+// WithHandlerCompression gzip-compresses the stream for clients that accept
+// it, at the given compress/gzip level. Every frame is still flushed as soon
+// as it is written, so compression only saves bandwidth and never delays
+// events; it pays off for large or repetitive payloads such as JSON.
+// Compressors are pooled, but each streaming connection holds one, which
+// costs several hundred kilobytes at the higher levels.
+func WithHandlerCompression(level int) HandlerOption {
+	return func(h *Handler) error {
+		if _, err := gzip.NewWriterLevel(io.Discard, level); err != nil {
+			return invalidOption("WithHandlerCompression", level, "not a valid gzip level")
+		}
+		h.gzip = &sync.Pool{New: func() interface{} {
+			gz, _ := gzip.NewWriterLevel(io.Discard, level)
+			return gz
+		}}
+		return nil
+	}
+}
+
+// WithHandlerPayloadCompression compresses the payload of each event of at
+// least threshold bytes on its own, independently of the transport. This
+// helps where a proxy strips Content-Encoding, which rules out
+// WithHandlerCompression. A compressed payload is sent as CompressedPrefix
+// followed by the gzip-compressed payload in base64, so consumers must
+// decode it, for example with DecodePayload; smaller events are sent as is.
+// WithHandlerPayloadCodecs offers other codecs, such as zstd.
+func WithHandlerPayloadCompression(threshold int) HandlerOption {
+	return func(h *Handler) error {
+		if threshold < 1 {
+			return invalidOption("WithHandlerPayloadCompression", threshold, "must be at least 1")
+		}
+		h.compress = threshold
+		return nil
+	}
+}
+
+// WithHandlerFilters lets clients narrow what they receive with a "filter"
+// query parameter holding a filter expression (see ParseFilter), for
+// example ?topic=quotes&filter=symbol%20%3D%3D%20%22ACME%22. Malformed
+// expressions are rejected with 400 Bad Request. Filters are evaluated on
+// the server for every broadcast and topic event, which costs CPU but
+// saves bandwidth on busy topics.
+func WithHandlerFilters() HandlerOption {
+	return func(h *Handler) error {
+		h.filters = true
+		return nil
+	}
+}
+
+// WithHandlerReplayMarkers names the events written before and after the
+// events replayed to a reconnecting client (see WithHistory), so client
+// UIs can tell historical catch-up from live data. By default they are
+// named "replay-start" and "replay-end"; an empty name suppresses that
+// marker. The start marker's data is a JSON object with the number of
+// replayed events and whether the history still held every missed event,
+// for example {"events":3,"complete":true}. The end marker's data holds the
+// last event ID covered, {"last_event_id":"42"}, which it also sets as the
+// stream's ID.
+func WithHandlerReplayMarkers(start, end string) HandlerOption {
+	return func(h *Handler) error {
+		for _, name := range []string{start, end} {
+			if strings.ContainsAny(name, "\r\n") {
+				return invalidOption("WithHandlerReplayMarkers", strconv.Quote(name), "must not contain line breaks")
+			}
+		}
+		h.markers = &[2]string{start, end}
+		return nil
+	}
+}
+
+// proxyPadding is the size of the comment written at the start of a stream
+// by handlers set up with WithHandlerProxyFriendly. Some proxies and
+// gateways hold back the first kilobytes of a response before forwarding
+// anything.
+const proxyPadding = 2048
+
+// WithHandlerProxyFriendly makes streams get through buffering proxies
+// such as nginx, Cloudflare and API gateways unchanged and without delay. It
+// sends X-Accel-Buffering: no, which turns off nginx buffering, extends
+// Cache-Control with no-store and no-transform, which keep CDNs from
+// caching or recompressing the stream, and opens the stream with a 2 KiB
+// comment to push it past proxies that buffer the start of a response.
+func WithHandlerProxyFriendly() HandlerOption {
+	return func(h *Handler) error {
+		h.proxies = true
+		return nil
+	}
+}
+
+// WithHandlerOpening writes ev as the first frame of every stream, right
+// after the headers, which are flushed as soon as the client is registered.
+// Clients and proxies that wait for the first bytes of the body before
+// treating the stream as open, or an EventSource onopen that should carry
+// something, then get it without waiting for the first event. An event
+// with Comment set is written as a comment, which EventSource ignores, for
+// example Event{Comment: "connected"}; any other event is written as an
+// event frame, for example one with Retry set to tell browsers how long to
+// wait before reconnecting. The frame is written after the padding of
+// WithHandlerProxyFriendly and before any replay, and is not passed to
+// WithHandlerTransform.
+func WithHandlerOpening(ev Event) HandlerOption {
+	return func(h *Handler) error {
+		if err := ev.validate(); err != nil {
+			return err
+		}
+		h.opening = &ev
+		return nil
+	}
+}
+
+// WithHandlerCoalescing coalesces simultaneous connections of one identity,
+// typically a user with several tabs open. identify names the identity of
+// each request, or returns "" to leave it alone; it runs after the auth hook,
+// so it can rely on what that established. Connections of one identity share
+// their delivery bookkeeping: tabs reconnecting together with the same
+// Last-Event-ID share a single history scan. Server.Identities reports the
+// identities with live connections, and ClientInfo.Identity names a
+// connection's identity.
+func WithHandlerCoalescing(identify func(r *http.Request) string) HandlerOption {
+	return func(h *Handler) error {
+		if identify == nil {
+			return invalidOption("WithHandlerCoalescing", "nil", "must not be nil")
+		}
+		h.identify = identify
+		return nil
+	}
+}
+
+// replayWindow bounds the replays clients choose by count or time.
+type replayWindow struct {
+	maxEvents int           // 0 for as many as the history keeps
+	maxAge    time.Duration // 0 for as old as the history keeps
+}
+
+// WithHandlerReplayWindow lets clients that do not track event IDs choose
+// their replay by count or time: the "replay_last" query parameter asks for
+// the last N kept events, and "replay_since" for those kept since an RFC
+// 3339 time. Requests for more than maxEvents events, or for events older
+// than maxAge, are cut to those limits; zero means no limit beyond what the
+// history keeps (see WithHistory). A Last-Event-ID takes precedence over
+// both parameters, so a reconnecting browser resumes where it left off.
+// Without this option the parameters are ignored.
+func WithHandlerReplayWindow(maxEvents int, maxAge time.Duration) HandlerOption {
+	return func(h *Handler) error {
+		if maxEvents < 0 {
+			return invalidOption("WithHandlerReplayWindow", maxEvents, "must not be negative")
+		}
+		if maxAge < 0 {
+			return invalidOption("WithHandlerReplayWindow", maxAge, "must not be negative")
+		}
+		h.window = &replayWindow{maxEvents: maxEvents, maxAge: maxAge}
+		return nil
+	}
+}
+
+// WithHandlerReplayRate paces the frames of a replay (see WithHistory) at
+// perSecond, with bursts of up to burst frames, separately from live events.
+// While a long backlog is paced out, fresh events are written in between as
+// they arrive, at the live pace (see WithRateLimit), so resuming clients see
+// new events right away. Those fresh events are written without an id until
+// the replay ends, so a client that drops mid-replay resumes the backlog
+// where it left off and may see them again. A perSecond of zero, the default,
+// writes the replay at once before any live event.
+func WithHandlerReplayRate(perSecond float64, burst int) HandlerOption {
+	return func(h *Handler) error {
+		if perSecond < 0 {
+			return invalidOption("WithHandlerReplayRate", perSecond, "rate must not be negative")
+		}
+		if perSecond > 0 && burst < 1 {
+			return invalidOption("WithHandlerReplayRate", burst, "burst must be at least 1")
+		}
+		h.replayRate = perSecond
+		h.replayBurst = burst
+		return nil
+	}
+}
+
+// SSEHandlerEndpoint serves server's events on w using the server's
+// defaults. It is equivalent to a Handler created without options.
 func SSEHandlerEndpoint(server *Server, w http.ResponseWriter, r *http.Request) {
+	(&Handler{server: server}).ServeHTTP(w, r)
+}
+
+// ServeHTTP adds a client subscribed to the topics named by the request's
+// "topic" query parameters and streams its events until the request ends
+// or the client is removed. The "sample_every" and "sample_rate" query
+// parameters thin out each of those topics (see Sampling), the "partition"
+// and "partitions" parameters select a slice of their keyed events (see
+// Partition), and the "group" parameter shares their events out among the
+// clients naming the same group (see Client.SetGroup). Events missed since
+// the Last-Event-ID header, or the "last_event_id" query parameter for a
+// first connection, are replayed first (see WithHistory), as are those
+// chosen by "replay_last" or "replay_since" (see WithHandlerReplayWindow).
+// The "capabilities" parameter or SSE-Capabilities header declares what
+// the client can handle (see Capabilities), and "schema" the payload
+// schema version it understands (see WithHandlerSchemas).
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server := h.server
+	if h.auth != nil {
+		if err := h.auth(r); err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+	if token := r.URL.Query().Get("probe_ack"); h.probe != nil && token != "" {
+		h.probe.ack(w, token)
+		return
+	}
 
-	client := server.AddClient()
+	topics := r.URL.Query()["topic"]
+	if err := validateTopics("topic", topics...); err != nil {
+		http.Error(w, "Invalid topic", http.StatusBadRequest)
+		return
+	}
+	if !h.allowed(topics) {
+		http.Error(w, "Topic not allowed", http.StatusForbidden)
+		return
+	}
+	requested, err := h.requestedHeartbeat(r)
+	if err != nil {
+		http.Error(w, "Invalid heartbeat", http.StatusBadRequest)
+		return
+	}
+	var filter *Filter
+	if expr := r.URL.Query().Get("filter"); h.filters && expr != "" {
+		if filter, err = ParseFilter(expr); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	sampling, err := requestedSampling(r)
+	if err != nil {
+		http.Error(w, "Invalid sampling", http.StatusBadRequest)
+		return
+	}
+	partition, err := requestedPartition(r)
+	if err != nil {
+		http.Error(w, "Invalid partition", http.StatusBadRequest)
+		return
+	}
+	from, err := h.requestedReplay(r)
+	if err != nil {
+		http.Error(w, "Invalid replay window", http.StatusBadRequest)
+		return
+	}
+	caps, err := requestedCapabilities(r)
+	if err != nil {
+		http.Error(w, "Invalid capabilities", http.StatusBadRequest)
+		return
+	}
+	var schema int
+	if h.schemas != nil {
+		if schema, err = h.schemas.requested(r); err != nil {
+			http.Error(w, "Unsupported schema", http.StatusBadRequest)
+			return
+		}
+	}
+
+	group := r.URL.Query().Get("group")
+
+	var identity string
+	if h.identify != nil {
+		identity = h.identify(r)
+	}
+	var metadata map[string]string
+	if h.metadata != nil {
+		metadata = h.metadata(r)
+	}
+
+	client, err := server.subscribe(r.Context(), func(client *Client) {
+		client.streamed = true
+		client.finished = make(chan struct{})
+		client.capabilities = caps
+		client.schema = schema
+		for key, value := range metadata {
+			client.SetMetadata(key, value)
+		}
+		if identity != "" {
+			client.identity = server.joinIdentity(identity)
+		}
+		client.SetFilter(filter)
+		for _, topic := range topics {
+			_ = client.SetSampling(topic, sampling) // Validated above
+			_ = client.SetPartition(topic, partition)
+			if group != "" {
+				client.SetGroup(topic, group)
+			}
+		}
+	}, topics)
+	if err != nil {
+		if msg, ok := server.Maintenance(); ok && errors.Is(err, ErrMaintenance) {
+			http.Error(w, "Service unavailable: "+msg, http.StatusServiceUnavailable)
+			return
+		}
+		http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
+		return
+	}
 
 	defer server.RemoveClient(client.ID)
 
+	defer close(client.finished) // Tells ShutdownContext the stream has ended
+
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
+	if h.proxies {
+		w.Header().Set("Cache-Control", "no-cache, no-store, no-transform")
+		w.Header().Set("X-Accel-Buffering", "no")
+	}
+	if r.ProtoMajor == 1 {
+		// HTTP/2 and HTTP/3 forbid connection-specific headers
+		w.Header().Set("Connection", "keep-alive")
+	}
+	compress := false
+	if h.gzip != nil {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if compress = acceptsGzip(r.Header.Get("Accept-Encoding")); compress {
+			w.Header().Set("Content-Encoding", "gzip")
+		}
+	}
 
-	flusher, ok := w.(http.Flusher)
-	if !ok {
-		http.Error(w, "Streaming unsupported!", http.StatusInternalServerError)
+	// Send the headers right away so clients see the stream open before
+	// the first event. The ResponseController reaches flushers behind
+	// middleware that wraps the ResponseWriter, and on HTTP/2 every flush
+	// sends the buffered frames as DATA frames on the request's stream.
+	rc := http.NewResponseController(w)
+	if err := rc.Flush(); err != nil {
+		if errors.Is(err, http.ErrNotSupported) {
+			client.disconnect(DisconnectWriteError, errStreamingUnsupported)
+			w.Header().Del("Content-Encoding")
+			http.Error(w, "Streaming unsupported!", http.StatusInternalServerError)
+			return
+		}
+		client.disconnect(writeFailure(err), err)
 		return
 	}
+	var gz *gzip.Writer
+	if compress {
+		gz = h.gzip.Get().(*gzip.Writer)
+		gz.Reset(w)
+		defer func() {
+			_ = gz.Close()
+			h.gzip.Put(gz)
+		}()
+	}
+	fw := &frameWriter{w: w, gz: gz, rc: rc, codec: h.payloadCodec(caps), timeout: server.opts.writeTimeout, trace: h.trace, client: client, lastID: from.lastID, metrics: &server.metrics}
+	if h.proxies {
+		if err := fw.write(": " + strings.Repeat(" ", proxyPadding) + "\n\n"); err != nil {
+			client.disconnect(writeFailure(err), err)
+			return
+		}
+	}
+	if h.opening != nil {
+		opening := comment(h.opening.Comment)
+		if h.opening.Comment == "" {
+			opening = h.frame(*h.opening, fw.codec)
+		}
+		if err := fw.write(opening); err != nil {
+			client.disconnect(writeFailure(err), err)
+			return
+		}
+	}
+
+	if h.session {
+		data, _ := json.Marshal(struct {
+			ClientID string `json:"client_id"`
+		}{client.ID})
+		if err = fw.write("event: session\ndata: " + string(data) + "\n\n"); err != nil {
+			client.disconnect(writeFailure(err), err)
+			return
+		}
+	}
+
+	if h.probe != nil && r.URL.Query().Get("probe") == "1" {
+		disarm, err := h.probe.start(server, fw, client)
+		defer disarm()
+		if err != nil {
+			client.disconnect(writeFailure(err), err)
+			return
+		}
+	}
+
+	// Catch up on missed events. The client was registered first, so live
+	// events published meanwhile are queued too; those up to the newest
+	// replayed one are skipped below.
+	settings, reloaded := server.tunablesAndReload()
+	limiter := newRateLimiter(settings.rateLimit, settings.rateBurst)
+	var replayed uint64
+	if from.lastID != "" || from.window() {
+		if replayed, err = h.replay(r.Context(), fw, client, from, limiter); err != nil {
+			if errors.Is(err, errReplayInterrupted) {
+				return // Removed, shut down or gone; the reason is recorded
+			}
+			client.disconnect(writeFailure(err), err)
+			return
+		}
+	}
+
+	// Keep idle connections alive with periodic comment lines
+	heartbeat := newHeartbeat(h.heartbeatInterval(settings, requested))
+	defer heartbeat.stop()
+	checkpoints := newHeartbeat(h.checkpoints) // Stopped unless set
+	defer checkpoints.stop()
+
+	// While an event waits for the rate limiter, messages is nil so no
+	// further events are read; removal is then noticed through closed
+	messages := client.Messages()
+	var pending *Event
+	var closed <-chan struct{}
+	pace := time.NewTimer(0)
+	<-pace.C
+	defer pace.Stop()
+	var paceC <-chan time.Time
+
+	// holdOrWrite writes ev now if the limiter allows it, or parks it until
+	// the limiter's delay has passed.
+	holdOrWrite := func(ev Event) error {
+		if d := limiter.delay(); d > 0 {
+			client.note("throttled event for %s by the rate limit", d)
+			pending, messages, closed = &ev, nil, client.done
+			client.held.Store(1)
+			pace.Reset(d)
+			paceC = pace.C
+			return nil
+		}
+		limiter.take()
+		pending, messages, closed, paceC = nil, client.Messages(), nil, nil
+		client.held.Store(0)
+		return h.writeEvent(fw, ev)
+	}
 	//
 	for {
 		select {
-		case msg, ok := <-client.Message:
+		case ev, ok := <-messages:
 			if !ok {
+				// Removed or shut down; close already recorded the reason
+				h.farewell(fw, client)
 				return
 			}
-			_, err := w.Write([]byte("data: " + string(msg) + "\n\n"))
-			if err != nil {
+			client.taken(ev)
+			if ev.barrier != nil {
+				close(ev.barrier) // Everything queued before it is written
+				continue
+			}
+			if ev.seq != 0 && ev.seq <= replayed {
+				continue // Already sent by the replay
+			}
+			if ev.Comment != "" {
+				// Diagnostics are not paced by the rate limiter
+				if err = fw.write(comment(ev.Comment)); err != nil {
+					client.disconnect(writeFailure(err), err)
+					return
+				}
+				continue
+			}
+			var keep bool
+			if ev, keep = h.transformed(client, ev); !keep {
+				continue
+			}
+			if err = holdOrWrite(ev); err != nil {
+				client.disconnect(writeFailure(err), err)
 				return
 			}
 
-			flusher.Flush()
+		case <-paceC:
+			if err = holdOrWrite(*pending); err != nil {
+				client.disconnect(writeFailure(err), err)
+				return
+			}
 
-		case <-r.Context().Done():
+		case <-closed:
+			// Removed while an event was waiting for the rate limiter
+			h.farewell(fw, client)
+			return
 
+		case note := <-client.notes:
+			if err = fw.write(comment("debug: " + note)); err != nil {
+				client.disconnect(writeFailure(err), err)
+				return
+			}
+
+		case <-heartbeat.C:
+			if err = fw.write(": ping\n\n"); err != nil {
+				client.disconnect(writeFailure(err), err)
+				return
+			}
+
+		case <-checkpoints.C:
+			if err = fw.write(checkpoint(fw.lastID, server.opts.now())); err != nil {
+				client.disconnect(writeFailure(err), err)
+				return
+			}
+
+		case <-reloaded:
+			// Apply settings changed with UpdateConfig
+			settings, reloaded = server.tunablesAndReload()
+			heartbeat.reset(h.heartbeatInterval(settings, requested))
+			limiter.setRate(settings.rateLimit, settings.rateBurst)
+			if pending != nil {
+				// Re-evaluate the wait under the new rate
+				if !pace.Stop() {
+					select {
+					case <-pace.C:
+					default:
+					}
+				}
+				if err = holdOrWrite(*pending); err != nil {
+					client.disconnect(writeFailure(err), err)
+					return
+				}
+			}
+
+		case <-r.Context().Done():
+			client.disconnect(DisconnectClientClosed, r.Context().Err())
 			return
 		}
 	}
 }
+
+// frame formats ev as an SSE frame, compressing its payload with codec if
+// the handler compresses payloads, or else reuses the frame formatted for
+// another recipient of a shared event.
+func (h *Handler) frame(ev Event, codec Codec) string {
+	if h.compress == 0 {
+		if ev.shared != nil {
+			return ev.shared.get(ev, h.format)
+		}
+		return h.format(ev)
+	}
+	return h.formatWith(ev, codec)
+}
+
+// format formats ev as an SSE frame without payload compression.
+func (h *Handler) format(ev Event) string {
+	return h.formatWith(ev, nil)
+}
+
+// formatWith formats ev as an SSE frame, compressing its payload with codec.
+// Each line of the payload gets its own data field, which the browser joins
+// back together with newlines.
+func (h *Handler) formatWith(ev Event, codec Codec) string {
+	var b strings.Builder
+	if ev.ID != "" {
+		b.WriteString("id: " + ev.ID + "\n")
+	}
+	if ev.Name != "" {
+		b.WriteString("event: " + ev.Name + "\n")
+	}
+	if ev.Retry > 0 {
+		b.WriteString("retry: " + strconv.FormatInt(ev.Retry.Milliseconds(), 10) + "\n")
+	}
+	if len(ev.Fields) > 0 {
+		names := make([]string, 0, len(ev.Fields))
+		for name := range ev.Fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			b.WriteString("x-" + name + ": " + ev.Fields[name] + "\n")
+		}
+	}
+	data := encodePayload(ev.Data, codec, h.compress)
+	for _, line := range strings.Split(lineBreaks.Replace(data), "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// lineBreaks normalizes the line endings SSE recognizes to "\n".
+var lineBreaks = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+
+// farewell writes the event set with WithShutdownEvent to a stream whose
+// client was closed by a shutdown.
+func (h *Handler) farewell(fw *frameWriter, client *Client) {
+	ev := h.server.opts.farewell
+	if ev == nil || client.Info().Reason != DisconnectServerShutdown {
+		return
+	}
+	if final, ok := h.transformed(client, *ev); ok {
+		_ = fw.write(h.frame(final, fw.codec)) // The stream ends either way
+	}
+}
+
+// lastEventID returns the ID of the last event the client saw. Browsers
+// send the Last-Event-ID header only when EventSource reconnects, so a page
+// resuming from a Snapshot cursor passes it as a query parameter instead;
+// the header takes precedence as it is the more recent of the two.
+func lastEventID(r *http.Request) string {
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		return id
+	}
+	return r.URL.Query().Get("last_event_id")
+}
+
+// Default names of the events that frame a replay.
+const (
+	defaultReplayStart = "replay-start"
+	defaultReplayEnd   = "replay-end"
+)
+
+// requestedReplay returns the replay the request asks for: after its
+// Last-Event-ID or, if the handler allows windows, within the bounds of the
+// "replay_last" and "replay_since" query parameters, cut to the handler's
+// limits.
+func (h *Handler) requestedReplay(r *http.Request) (replayFrom, error) {
+	from := replayFrom{lastID: lastEventID(r)}
+	if from.lastID != "" || h.window == nil {
+		return from, nil
+	}
+	query := r.URL.Query()
+	if raw := query.Get("replay_last"); raw != "" {
+		last, err := strconv.Atoi(raw)
+		if err != nil || last < 1 {
+			return from, fmt.Errorf("replay_last %q: must be a positive number", raw)
+		}
+		from.last = last
+		if h.window.maxEvents > 0 && last > h.window.maxEvents {
+			from.last = h.window.maxEvents
+		}
+	}
+	if raw := query.Get("replay_since"); raw != "" {
+		since, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return from, fmt.Errorf("replay_since %q: %w", raw, err)
+		}
+		from.since = since
+		if h.window.maxAge > 0 {
+			if oldest := h.server.opts.now().Add(-h.window.maxAge); since.Before(oldest) {
+				from.since = oldest
+			}
+		}
+	} else if from.last > 0 && h.window.maxAge > 0 {
+		from.since = h.server.opts.now().Add(-h.window.maxAge)
+	}
+	return from, nil
+}
+
+// errReplayInterrupted reports a paced replay cut short because the client
+// was closed or its request ended.
+var errReplayInterrupted = errors.New("replay interrupted")
+
+// replay writes the events the client missed, as selected by from, framed
+// by the replay markers (see WithHandlerReplayMarkers), and returns the
+// sequence number up to which live events are covered by the replay.
+// Without history, or for an ID the server did not issue, nothing is
+// written. A paced replay (see WithHandlerReplayRate) writes live events
+// as the live limiter allows while it waits.
+func (h *Handler) replay(ctx context.Context, fw *frameWriter, client *Client, from replayFrom, live *rateLimiter) (uint64, error) {
+	events, newest, complete, ok := h.server.replay(client, from)
+	if !ok {
+		return 0, nil
+	}
+	start, end := defaultReplayStart, defaultReplayEnd
+	if h.markers != nil {
+		start, end = h.markers[0], h.markers[1]
+	}
+	if start != "" {
+		data := fmt.Sprintf(`{"events":%d,"complete":%t}`, len(events), complete)
+		if err := fw.write("event: " + start + "\ndata: " + data + "\n\n"); err != nil {
+			return 0, err
+		}
+	}
+	if h.replayRate > 0 {
+		if err := h.pacedReplay(ctx, fw, client, events, newest, live); err != nil {
+			return 0, err
+		}
+	} else {
+		for _, ev := range events {
+			ev, ok := h.transformed(client, ev)
+			if !ok {
+				continue
+			}
+			if err := h.writeEvent(fw, ev); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if end != "" {
+		// The id moves the browser's Last-Event-ID past events the client
+		// was not sent, such as other topics'
+		id := strconv.FormatUint(newest, 10)
+		if err := fw.write("id: " + id + "\nevent: " + end + "\ndata: " + `{"last_event_id":"` + id + `"}` + "\n\n"); err != nil {
+			return 0, err
+		}
+		fw.lastID = id
+	}
+	return newest, nil
+}
+
+// pacedReplay writes the replayed events at the handler's replay rate. While
+// it waits for the replay limiter, it writes the live events queued for the
+// client as live allows, without their IDs so the stream's Last-Event-ID
+// keeps tracking the replay. Live events up to newest are left out, as the
+// replay covers them.
+func (h *Handler) pacedReplay(ctx context.Context, fw *frameWriter, client *Client, events []Event, newest uint64, live *rateLimiter) error {
+	pace := newRateLimiter(h.replayRate, h.replayBurst)
+	timer := time.NewTimer(0)
+	<-timer.C
+	defer timer.Stop()
+	for _, ev := range events {
+		ev, ok := h.transformed(client, ev)
+		if !ok {
+			continue
+		}
+		for d := pace.delay(); d > 0; d = pace.delay() {
+			timer.Reset(d)
+			for waiting := true; waiting; {
+				var messages <-chan Event
+				if live.delay() == 0 {
+					messages = client.Messages()
+				}
+				select {
+				case <-timer.C:
+					waiting = false
+				case fresh, ok := <-messages:
+					if !ok {
+						return errReplayInterrupted
+					}
+					client.taken(fresh)
+					if err := h.writeDuringReplay(fw, client, fresh, newest, live); err != nil {
+						return err
+					}
+				case <-ctx.Done():
+					client.disconnect(DisconnectClientClosed, ctx.Err())
+					return errReplayInterrupted
+				}
+			}
+		}
+		pace.take()
+		if err := h.writeEvent(fw, ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeDuringReplay writes a live event received while a paced replay
+// waits.
+func (h *Handler) writeDuringReplay(fw *frameWriter, client *Client, ev Event, newest uint64, live *rateLimiter) error {
+	switch {
+	case ev.barrier != nil:
+		close(ev.barrier) // Everything queued before it is written
+		return nil
+	case ev.seq != 0 && ev.seq <= newest:
+		return nil // Part of the replay
+	case ev.Comment != "":
+		return fw.write(comment(ev.Comment))
+	}
+	ev, ok := h.transformed(client, ev)
+	if !ok {
+		return nil
+	}
+	live.take()
+	ev.ID = ""
+	if err := fw.write(h.frame(ev, fw.codec)); err != nil {
+		return err
+	}
+	fw.client.wrote()
+	return nil
+}
+
+// frameWriter writes SSE frames to a response, flushing each one so it
+// reaches the client right away.
+type frameWriter struct {
+	w       http.ResponseWriter
+	gz      *gzip.Writer // Compresses frames written to w, nil if off
+	codec   Codec        // Compresses payloads, nil if off
+	rc      *http.ResponseController
+	timeout time.Duration // Deadline for writing one frame, 0 for none
+	trace   *WriteTrace   // Hooks around each frame, nil for none
+	client  *Client       // Client the frames are for
+	lastID  string        // ID of the last event written, for checkpoints
+	metrics *metrics      // Counts the frames written, nil for none
+}
+
+// write writes and flushes one frame within the write timeout, if any.
+func (fw *frameWriter) write(frame string) error {
+	if fw.timeout > 0 {
+		// Writers without deadline support simply write without one
+		_ = fw.rc.SetWriteDeadline(time.Now().Add(fw.timeout))
+	}
+	start := time.Now()
+	err := fw.flushFrame(frame)
+	if err == nil && fw.metrics != nil {
+		fw.metrics.countWrite(len(frame), time.Since(start))
+	}
+	return err
+}
+
+// flushFrame writes and flushes one frame, reporting each step to the
+// trace hooks, if any.
+func (fw *frameWriter) flushFrame(frame string) error {
+	if fw.trace == nil {
+		if _, err := fw.writeFrame(frame); err != nil {
+			return err
+		}
+		return fw.rc.Flush()
+	}
+	fw.traceStep(fw.trace.WriteStart, len(frame), nil)
+	n, err := fw.writeFrame(frame)
+	fw.traceStep(fw.trace.WriteDone, n, err)
+	if err != nil {
+		return err
+	}
+	fw.traceStep(fw.trace.FlushStart, len(frame), nil)
+	err = fw.rc.Flush()
+	fw.traceStep(fw.trace.FlushDone, len(frame), err)
+	return err
+}
+
+// writeFrame writes one frame to the response, compressing it if enabled,
+// and returns how many of its bytes were written.
+func (fw *frameWriter) writeFrame(frame string) (int, error) {
+	if fw.gz == nil {
+		return io.WriteString(fw.w, frame)
+	}
+	n, err := io.WriteString(fw.gz, frame)
+	if err != nil {
+		return n, err
+	}
+	// Emit the compressed frame rather than waiting for more input
+	return n, fw.gz.Flush()
+}
+
+// acceptsGzip reports whether an Accept-Encoding header value allows gzip
+// with a non-zero quality, either by name or, failing that, through "*".
+func acceptsGzip(header string) bool {
+	gzipQ, anyQ := -1.0, -1.0
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		switch strings.ToLower(strings.TrimSpace(coding)) {
+		case "gzip":
+			gzipQ = q
+		case "*":
+			anyQ = q
+		}
+	}
+	if gzipQ >= 0 {
+		return gzipQ > 0
+	}
+	return anyQ > 0
+}
+
+// writeFailure classifies a failed write as a timeout or another error.
+func writeFailure(err error) DisconnectReason {
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return DisconnectWriteTimeout
+	}
+	return DisconnectWriteError
+}
+
+// comment formats text as an SSE comment frame, which EventSource ignores.
+// Line breaks in text are replaced so it stays a single comment.
+func comment(text string) string {
+	text = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ").Replace(text)
+	return ": " + text + "\n\n"
+}
+
+// allowed reports whether the handler lets clients subscribe to topics.
+func (h *Handler) allowed(topics []string) bool {
+	if h.topics == nil {
+		return true
+	}
+	for _, topic := range topics {
+		if _, ok := h.topics[topic]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// heartbeatInterval returns the interval requested by the client, if any,
+// then the handler's heartbeat override, if any, or the server's current
+// setting.
+func (h *Handler) heartbeatInterval(settings options, requested time.Duration) time.Duration {
+	if requested > 0 {
+		return requested
+	}
+	if h.heartbeat != nil {
+		return *h.heartbeat
+	}
+	return settings.heartbeat
+}
+
+// requestedHeartbeat returns the heartbeat interval the request asks for,
+// clamped to the handler's range, or zero if it asks for none or the
+// handler does not let clients choose.
+func (h *Handler) requestedHeartbeat(r *http.Request) (time.Duration, error) {
+	raw := r.URL.Query().Get("heartbeat")
+	if raw == "" {
+		raw = r.Header.Get("Heartbeat-Interval")
+	}
+	if raw == "" || h.beatRange[0] == 0 {
+		return 0, nil
+	}
+	interval, err := time.ParseDuration(raw)
+	if err != nil {
+		seconds, serr := strconv.ParseUint(raw, 10, 32)
+		if serr != nil {
+			return 0, fmt.Errorf("heartbeat %q: %w", raw, err)
+		}
+		interval = time.Duration(seconds) * time.Second
+	}
+	switch {
+	case interval < h.beatRange[0]:
+		return h.beatRange[0], nil
+	case interval > h.beatRange[1]:
+		return h.beatRange[1], nil
+	}
+	return interval, nil
+}
+
+// requestedSampling returns the sampling the request asks for with the
+// "sample_every" (every Nth event) and "sample_rate" (events per second)
+// query parameters, applied to each of its topics.
+func requestedSampling(r *http.Request) (Sampling, error) {
+	var sampling Sampling
+	query := r.URL.Query()
+	if raw := query.Get("sample_every"); raw != "" {
+		every, err := strconv.ParseUint(raw, 10, 31)
+		if err != nil {
+			return sampling, err
+		}
+		sampling.Every = int(every)
+	}
+	if raw := query.Get("sample_rate"); raw != "" {
+		rate, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return sampling, err
+		}
+		sampling.MaxRate = rate
+	}
+	return sampling, sampling.validate()
+}
+
+// requestedPartition returns the partition the request asks for with the
+// "partition" (index) and "partitions" (count) query parameters, applied to
+// each of its topics.
+func requestedPartition(r *http.Request) (Partition, error) {
+	var partition Partition
+	query := r.URL.Query()
+	if query.Get("partition") == "" && query.Get("partitions") == "" {
+		return partition, nil
+	}
+	index, err := strconv.ParseUint(query.Get("partition"), 10, 31)
+	if err != nil {
+		return partition, err
+	}
+	count, err := strconv.ParseUint(query.Get("partitions"), 10, 31)
+	if err != nil {
+		return partition, err
+	}
+	partition = Partition{Index: int(index), Count: int(count)}
+	return partition, partition.validate()
+}
+
+// heartbeat wraps a ticker that can be disabled: with a zero interval, C is
+// nil and never fires.
+type heartbeat struct {
+	C      <-chan time.Time
+	ticker *time.Ticker
+}
+
+// newHeartbeat returns a heartbeat firing every interval, or never if
+// interval is zero.
+func newHeartbeat(interval time.Duration) *heartbeat {
+	h := &heartbeat{}
+	h.reset(interval)
+	return h
+}
+
+// reset changes the interval, starting or stopping the ticker as needed.
+func (h *heartbeat) reset(interval time.Duration) {
+	switch {
+	case interval <= 0:
+		h.stop()
+	case h.ticker == nil:
+		h.ticker = time.NewTicker(interval)
+		h.C = h.ticker.C
+	default:
+		h.ticker.Reset(interval)
+	}
+}
+
+// stop stops the ticker, if any.
+func (h *heartbeat) stop() {
+	if h.ticker != nil {
+		h.ticker.Stop()
+		h.ticker = nil
+		h.C = nil
+	}
+}
@@ -0,0 +1,1998 @@
+package gosse_test
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Firoz01/gosse/v2"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHandler_Overrides(t *testing.T) {
+	server := gosse.NewServer()
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	// A public endpoint limited to one topic, and an internal one with
+	// heartbeats that requires a token
+	public, err := gosse.NewHandler(server, gosse.WithHandlerTopics("news"))
+	if err != nil {
+		t.Fatalf("Unexpected error creating handler: %v", err)
+	}
+	internal, err := gosse.NewHandler(server,
+		gosse.WithHandlerHeartbeat(20*time.Millisecond),
+		gosse.WithHandlerAuth(func(r *http.Request) error {
+			if r.Header.Get("Authorization") != "secret" {
+				return errors.New("missing token")
+			}
+			return nil
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error creating handler: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/public", public)
+	mux.Handle("/internal", internal)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	for path, want := range map[string]int{
+		"/public?topic=metrics": http.StatusForbidden,
+		"/public?topic=":        http.StatusBadRequest,
+		"/internal":             http.StatusUnauthorized,
+	} {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatalf("Request to %s failed: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("Expected status %d for %s, got %d", want, path, resp.StatusCode)
+		}
+	}
+
+	// The public stream only receives its topic
+	resp, err := http.Get(ts.URL + "/public?topic=news")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	time.Sleep(50 * time.Millisecond)
+	if err := server.Publish("metrics", []byte("cpu")); err != nil {
+		t.Fatalf("Unexpected error publishing: %v", err)
+	}
+	if err := server.Publish("news", []byte("headline")); err != nil {
+		t.Fatalf("Unexpected error publishing: %v", err)
+	}
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil || line != "data: headline\n" {
+		t.Errorf("Expected only the news event, got %q (%v)", line, err)
+	}
+
+	// The internal stream gets heartbeats although the server has none
+	req, _ := http.NewRequest("GET", ts.URL+"/internal", nil)
+	req.Header.Set("Authorization", "secret")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	line, err = bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil || line != ": ping\n" {
+		t.Errorf("Expected heartbeat comment, got %q (%v)", line, err)
+	}
+}
+
+func TestNewHandler_InvalidOptions(t *testing.T) {
+	_, err := gosse.NewHandler(gosse.NewServer(),
+		gosse.WithHandlerHeartbeat(-time.Second),
+		gosse.WithHandlerTopics(""),
+		gosse.WithHandlerAuth(nil),
+	)
+	if !errors.Is(err, gosse.ErrInvalidOption) {
+		t.Errorf("Expected ErrInvalidOption, got %v", err)
+	}
+}
+
+func TestServer_PublishReachesSubscribersOnly(t *testing.T) {
+	server := gosse.NewServer()
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	subscriber, err := server.SubscribeContext(context.Background(), "news")
+	if err != nil {
+		t.Fatalf("Unexpected error subscribing: %v", err)
+	}
+	other := server.AddClient()
+
+	if err := server.Publish("news", []byte("headline")); err != nil {
+		t.Fatalf("Unexpected error publishing: %v", err)
+	}
+	if ev := <-subscriber.Messages(); string(ev.Data) != "headline" || ev.Topic != "news" {
+		t.Errorf("Expected headline on news, got %q on %q", ev.Data, ev.Topic)
+	}
+	select {
+	case ev := <-other.Messages():
+		t.Errorf("Expected no event for a client without topics, got %q", ev.Data)
+	default:
+	}
+
+	if err := server.Publish("", nil); !errors.Is(err, gosse.ErrInvalidOption) {
+		t.Errorf("Expected ErrInvalidOption for an empty topic, got %v", err)
+	}
+}
+
+func TestServer_Topics(t *testing.T) {
+	var nowM sync.Mutex
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time {
+		nowM.Lock()
+		defer nowM.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		nowM.Lock()
+		defer nowM.Unlock()
+		now = now.Add(d)
+	}
+	server := gosse.NewServer(gosse.WithClock(clock))
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	if _, err := server.SubscribeContext(context.Background(), "news", "sports"); err != nil {
+		t.Fatalf("Unexpected error subscribing: %v", err)
+	}
+	for i := 0; i < 30; i++ {
+		_ = server.Publish("news", []byte(fmt.Sprintf("headline %d", i)))
+	}
+	advance(time.Minute)
+	_ = server.Publish("weather", []byte("rain")) // No subscribers
+	advance(30 * time.Second)
+
+	topics := server.Topics()
+	if len(topics) != 3 {
+		t.Fatalf("Expected 3 topics, got %+v", topics)
+	}
+	news, sports, weather := topics[0], topics[1], topics[2]
+	if news.Name != "news" || news.Subscribers != 1 || string(news.Retained.Data) != "headline 29" {
+		t.Errorf("Unexpected news topic %+v", news)
+	}
+	// Half of the window with 30 publishes still overlaps the last minute
+	if news.PublishRate != 0.25 {
+		t.Errorf("Expected news to be published 0.25 times per second, got %v", news.PublishRate)
+	}
+	if sports.Name != "sports" || sports.Subscribers != 1 || sports.Retained != nil || !sports.LastPublishedAt.IsZero() {
+		t.Errorf("Unexpected sports topic %+v", sports)
+	}
+	if weather.Name != "weather" || weather.Subscribers != 0 || weather.LastPublishedAt != clock().Add(-30*time.Second) {
+		t.Errorf("Unexpected weather topic %+v", weather)
+	}
+}
+
+func TestHandler_Compression(t *testing.T) {
+	server := gosse.NewServer()
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	handler, err := gosse.NewHandler(server, gosse.WithHandlerCompression(gzip.BestSpeed))
+	if err != nil {
+		t.Fatalf("Unexpected error creating handler: %v", err)
+	}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	// Setting Accept-Encoding ourselves keeps the transport from
+	// decompressing the body
+	req, _ := http.NewRequest("GET", ts.URL, nil)
+	req.Header.Set("Accept-Encoding", "br;q=1, gzip;q=0.8")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if enc := resp.Header.Get("Content-Encoding"); enc != "gzip" {
+		t.Fatalf("Expected gzip encoding, got %q", enc)
+	}
+
+	_ = server.BroadcastMessage([]byte("compressed"))
+	lines := make(chan string)
+	go func() {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			close(lines)
+			return
+		}
+		line, _ := bufio.NewReader(gz).ReadString('\n')
+		lines <- line
+	}()
+	select {
+	case line := <-lines:
+		if line != "data: compressed\n" {
+			t.Errorf("Expected the decompressed event, got %q", line)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for the compressed event")
+	}
+
+	// Clients that do not accept gzip get a plain stream
+	req, _ = http.NewRequest("GET", ts.URL, nil)
+	req.Header.Set("Accept-Encoding", "gzip;q=0, *")
+	plain, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	plain.Body.Close()
+	if enc := plain.Header.Get("Content-Encoding"); enc != "" {
+		t.Errorf("Expected no encoding, got %q", enc)
+	}
+
+	if _, err := gosse.NewHandler(server, gosse.WithHandlerCompression(42)); !errors.Is(err, gosse.ErrInvalidOption) {
+		t.Errorf("Expected ErrInvalidOption for an invalid level, got %v", err)
+	}
+}
+
+func TestHandler_PayloadCompression(t *testing.T) {
+	server := gosse.NewServer()
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	handler, err := gosse.NewHandler(server, gosse.WithHandlerPayloadCompression(100))
+	if err != nil {
+		t.Fatalf("Unexpected error creating handler: %v", err)
+	}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	large := strings.Repeat(`{"price":42}`, 100)
+	payloads := []string{"small", large, gosse.CompressedPrefix + "not compressed"}
+	for _, payload := range payloads {
+		_ = server.BroadcastMessage([]byte(payload))
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	for i, want := range payloads {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read event %d: %v", i, err)
+		}
+		data := strings.TrimSuffix(strings.TrimPrefix(line, "data: "), "\n")
+		if compressed := strings.HasPrefix(data, gosse.CompressedPrefix); compressed != (i > 0) {
+			t.Errorf("Expected event %d to be compressed: %v, got %q", i, i > 0, data)
+		}
+		if got, err := gosse.DecodePayload(data); err != nil || string(got) != want {
+			t.Errorf("Expected event %d to decode to its payload, got %q (%v)", i, got, err)
+		}
+		_, _ = reader.ReadString('\n') // The blank line ending the frame
+	}
+}
+
+// reverseCodec is a Codec that "compresses" by reversing the payload.
+type reverseCodec struct{}
+
+func (reverseCodec) Name() string { return "reverse" }
+
+func (reverseCodec) Compress(data []byte) []byte {
+	out := make([]byte, len(data))
+	for i, b := range data {
+		out[len(data)-1-i] = b
+	}
+	return out
+}
+
+func (c reverseCodec) Decompress(data []byte) ([]byte, error) { return c.Compress(data), nil }
+
+// registerReverse registers reverseCodec once per test binary.
+var registerReverse sync.Once
+
+func TestHandler_PayloadCodecs(t *testing.T) {
+	registerReverse.Do(func() {
+		if err := gosse.RegisterCodec(reverseCodec{}); err != nil {
+			t.Fatalf("Unexpected error registering codec: %v", err)
+		}
+	})
+	if err := gosse.RegisterCodec(reverseCodec{}); !errors.Is(err, gosse.ErrInvalidOption) {
+		t.Errorf("Expected ErrInvalidOption registering a codec twice, got %v", err)
+	}
+	if err := gosse.RegisterCodec(nil); !errors.Is(err, gosse.ErrInvalidOption) {
+		t.Errorf("Expected ErrInvalidOption for a nil codec, got %v", err)
+	}
+	if _, err := gosse.NewHandler(gosse.NewServer(), gosse.WithHandlerPayloadCodecs("brotli")); !errors.Is(err, gosse.ErrInvalidOption) {
+		t.Errorf("Expected ErrInvalidOption for an unregistered codec, got %v", err)
+	}
+
+	server := gosse.NewServer()
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	handler, err := gosse.NewHandler(server,
+		gosse.WithHandlerPayloadCompression(10),
+		gosse.WithHandlerPayloadCodecs("reverse", "gzip"))
+	if err != nil {
+		t.Fatalf("Unexpected error creating handler: %v", err)
+	}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	// Each client gets the first offered codec it declares; clients that
+	// declare none get gzip, and those declaring only others nothing
+	prefixes := map[string]string{
+		"?capabilities=compression=snappy,compression=reverse": "reverse;base64,",
+		"":                                      gosse.CompressedPrefix,
+		"?capabilities=compression=snappy":      "",
+		"?capabilities=compression=gzip,binary": gosse.CompressedPrefix,
+	}
+	readers := make(map[string]*bufio.Reader)
+	for query := range prefixes {
+		resp, err := http.Get(ts.URL + query)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		readers[query] = bufio.NewReader(resp.Body)
+	}
+
+	payload := strings.Repeat("compress me ", 10)
+	_ = server.BroadcastMessage([]byte(payload))
+	// Too small to compress, but it would be mistaken for a compressed one
+	lookalike := "reverse;base64,abc"
+	_ = server.BroadcastMessage([]byte(lookalike))
+
+	for query, prefix := range prefixes {
+		line, err := readers[query].ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read the event for %q: %v", query, err)
+		}
+		data := strings.TrimSuffix(strings.TrimPrefix(line, "data: "), "\n")
+		if prefix == "" && data != payload {
+			t.Errorf("Expected an uncompressed payload for %q, got %q", query, data)
+		}
+		if !strings.HasPrefix(data, prefix) {
+			t.Errorf("Expected the payload for %q to start with %q, got %q", query, prefix, data)
+		}
+		if got, err := gosse.DecodePayload(data); err != nil || string(got) != payload {
+			t.Errorf("Expected the event for %q to decode to its payload, got %q (%v)", query, got, err)
+		}
+		_, _ = readers[query].ReadString('\n') // The blank line ending the frame
+
+		// Every client gets the lookalike escaped, even without a codec in common
+		line, err = readers[query].ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read the lookalike for %q: %v", query, err)
+		}
+		data = strings.TrimSuffix(strings.TrimPrefix(line, "data: "), "\n")
+		if got, err := gosse.DecodePayload(data); err != nil || string(got) != lookalike {
+			t.Errorf("Expected the lookalike for %q to decode to itself, got %q (%v)", query, got, err)
+		}
+	}
+}
+
+// wrappedWriter is a middleware ResponseWriter that hides the underlying
+// writer's optional interfaces except through Unwrap.
+type wrappedWriter struct {
+	http.ResponseWriter
+}
+
+func (w wrappedWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// nonFlushingWriter cannot flush, so it cannot stream.
+type nonFlushingWriter struct {
+	header http.Header
+	status int
+}
+
+func (w *nonFlushingWriter) Header() http.Header         { return w.header }
+func (w *nonFlushingWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (w *nonFlushingWriter) WriteHeader(status int)      { w.status = status }
+
+// stalledWriter is a streaming ResponseWriter whose peer stopped reading:
+// writes block until release is closed, then fail.
+type stalledWriter struct {
+	header  http.Header
+	release chan struct{}
+}
+
+func (w *stalledWriter) Header() http.Header { return w.header }
+func (w *stalledWriter) WriteHeader(int)     {}
+func (w *stalledWriter) Flush()              {}
+
+func (w *stalledWriter) Write(p []byte) (int, error) {
+	<-w.release
+	return 0, errors.New("connection stalled")
+}
+
+func TestHandler_IdleTimeoutStalledStream(t *testing.T) {
+	var clock atomic.Int64
+	disconnected := make(chan gosse.ClientInfo, 1)
+	server := gosse.NewServer(gosse.WithAutoRun(),
+		gosse.WithClock(func() time.Time { return time.Unix(clock.Load(), 0) }),
+		gosse.WithIdleTimeout(20*time.Millisecond),
+		gosse.WithOnDisconnect(func(info gosse.ClientInfo) { disconnected <- info }))
+	defer server.Shutdown()
+	handler, err := gosse.NewHandler(server)
+	if err != nil {
+		t.Fatalf("Unexpected error creating handler: %v", err)
+	}
+
+	w := &stalledWriter{header: make(http.Header), release: make(chan struct{})}
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	}()
+	for server.ClientCount() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The first event blocks the stream, later ones still fit the buffer
+	clock.Add(60)
+	for i := 0; i < 3; i++ {
+		_ = server.BroadcastMessage([]byte("queued")) // Fails once the client is reaped
+	}
+	select {
+	case info := <-disconnected:
+		if info.Reason != gosse.DisconnectIdle {
+			t.Errorf("Expected the stalled client disconnected for idling, got %s", info.Reason)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the stalled client to be disconnected")
+	}
+	close(w.release)
+	<-served
+}
+
+func TestHandler_MaxBufferedBytes(t *testing.T) {
+	server := gosse.NewServer(gosse.WithAutoRun(), gosse.WithMaxBufferedBytes(10))
+	defer server.Shutdown()
+	handler, err := gosse.NewHandler(server)
+	if err != nil {
+		t.Fatalf("Unexpected error creating handler: %v", err)
+	}
+
+	w := &stalledWriter{header: make(http.Header), release: make(chan struct{})}
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	}()
+	for server.ClientCount() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The handler takes at most one event before the stream blocks, so the
+	// buffer is over the limit by the third publish at the latest
+	if err := server.BroadcastMessage([]byte("twelve bytes")); err != nil {
+		t.Fatalf("Unexpected error broadcasting below the limit: %v", err)
+	}
+	_ = server.BroadcastMessage([]byte("twelve bytes"))
+	if err := server.BroadcastMessage([]byte("over")); !errors.Is(err, gosse.ErrQuotaExceeded) {
+		t.Errorf("Expected ErrQuotaExceeded with the stalled client's buffer over the limit, got %v", err)
+	}
+
+	// Bytes left behind by a removed client no longer count
+	close(w.release)
+	<-served
+	if err := server.BroadcastMessage([]byte("after")); err != nil {
+		t.Errorf("Expected publishes admitted once the stalled client is gone, got %v", err)
+	}
+}
+
+func TestHandler_HTTP2AndWrappedWriters(t *testing.T) {
+	server := gosse.NewServer()
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gosse.SSEHandlerEndpoint(server, wrappedWriter{w}, r)
+	}))
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+
+	resp, err := ts.Client().Get(ts.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		t.Fatalf("Expected HTTP/2, got %s", resp.Proto)
+	}
+	if resp.Header.Get("Connection") != "" {
+		t.Error("Expected no Connection header over HTTP/2")
+	}
+
+	// Each event arrives on its own, without waiting for more data
+	reader := bufio.NewReader(resp.Body)
+	for _, msg := range []string{"one", "two"} {
+		_ = server.BroadcastMessage([]byte(msg))
+		lines := make(chan string)
+		go func() {
+			line, _ := reader.ReadString('\n')
+			_, _ = reader.ReadString('\n') // The blank line ending the frame
+			lines <- line
+		}()
+		select {
+		case line := <-lines:
+			if line != "data: "+msg+"\n" {
+				t.Errorf("Expected %q, got %q", msg, line)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timeout waiting for %q", msg)
+		}
+	}
+
+	// Writers that cannot flush are rejected
+	w := &nonFlushingWriter{header: make(http.Header)}
+	gosse.SSEHandlerEndpoint(server, w, httptest.NewRequest("GET", "/", nil))
+	if w.status != http.StatusInternalServerError {
+		t.Errorf("Expected 500 for a writer that cannot flush, got %d", w.status)
+	}
+}
+
+func TestHandler_ProxyFriendly(t *testing.T) {
+	server := gosse.NewServer()
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	handler, err := gosse.NewHandler(server, gosse.WithHandlerProxyFriendly())
+	if err != nil {
+		t.Fatalf("Unexpected error creating handler: %v", err)
+	}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("X-Accel-Buffering"); got != "no" {
+		t.Errorf("Expected X-Accel-Buffering: no, got %q", got)
+	}
+	if got := resp.Header.Get("Cache-Control"); !strings.Contains(got, "no-transform") {
+		t.Errorf("Expected Cache-Control to include no-transform, got %q", got)
+	}
+
+	// The stream opens with padding before any event
+	_ = server.BroadcastMessage([]byte("hello"))
+	reader := bufio.NewReader(resp.Body)
+	if line, _ := reader.ReadString('\n'); !strings.HasPrefix(line, ":") || len(line) < 2048 {
+		t.Errorf("Expected a padding comment of at least 2 KiB, got %d bytes", len(line))
+	}
+	_, _ = reader.ReadString('\n')
+	if line, _ := reader.ReadString('\n'); line != "data: hello\n" {
+		t.Errorf("Expected the event after the padding, got %q", line)
+	}
+}
+
+func TestHandler_ClientHeartbeat(t *testing.T) {
+	server := gosse.NewServer(gosse.WithHeartbeat(time.Hour))
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	handler, err := gosse.NewHandler(server, gosse.WithHandlerHeartbeatRange(10*time.Millisecond, 50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Unexpected error creating handler: %v", err)
+	}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	// A request above the range is clamped to its maximum
+	req, _ := http.NewRequest("GET", ts.URL, nil)
+	req.Header.Set("Heartbeat-Interval", "3600")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	lines := make(chan string)
+	go func() {
+		line, _ := bufio.NewReader(resp.Body).ReadString('\n')
+		lines <- line
+	}()
+	select {
+	case line := <-lines:
+		if line != ": ping\n" {
+			t.Errorf("Expected a heartbeat, got %q", line)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for the client's heartbeat")
+	}
+
+	bad, err := http.Get(ts.URL + "?heartbeat=often")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	bad.Body.Close()
+	if bad.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a malformed heartbeat, got %s", bad.Status)
+	}
+
+	if _, err := gosse.NewHandler(server, gosse.WithHandlerHeartbeatRange(time.Minute, time.Second)); !errors.Is(err, gosse.ErrInvalidOption) {
+		t.Errorf("Expected ErrInvalidOption for an inverted range, got %v", err)
+	}
+}
+
+func TestHandler_Filters(t *testing.T) {
+	server := gosse.NewServer()
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	handler, err := gosse.NewHandler(server, gosse.WithHandlerFilters())
+	if err != nil {
+		t.Fatalf("Unexpected error creating handler: %v", err)
+	}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	bad, err := http.Get(ts.URL + "?filter=" + url.QueryEscape("price >"))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	bad.Body.Close()
+	if bad.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a malformed filter, got %s", bad.Status)
+	}
+
+	resp, err := http.Get(ts.URL + "?filter=" + url.QueryEscape("price > 100"))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	_ = server.BroadcastMessage([]byte(`{"price":99}`))
+	_ = server.BroadcastMessage([]byte(`{"price":101}`))
+	line, _ := bufio.NewReader(resp.Body).ReadString('\n')
+	if line != "data: {\"price\":101}\n" {
+		t.Errorf("Expected only the matching event, got %q", line)
+	}
+}
+
+func TestServer_Sampling(t *testing.T) {
+	server := gosse.NewServer(gosse.WithBufferSize(100))
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gosse.SSEHandlerEndpoint(server, w, r)
+	}))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "?topic=ticks&sample_every=3")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	for i := 0; i < 7; i++ {
+		_ = server.Publish("ticks", []byte(fmt.Sprint(i)))
+	}
+	_ = server.BroadcastMessage([]byte("broadcast")) // Never sampled
+
+	reader := bufio.NewReader(resp.Body)
+	for _, want := range []string{"0", "3", "6", "broadcast"} {
+		line, _ := reader.ReadString('\n')
+		_, _ = reader.ReadString('\n')
+		if line != "data: "+want+"\n" {
+			t.Errorf("Expected %q, got %q", want, line)
+		}
+	}
+
+	// At most one event per hour gets through
+	client, err := server.SubscribeContext(context.Background(), "ticks")
+	if err != nil {
+		t.Fatalf("Unexpected error subscribing: %v", err)
+	}
+	if err := client.SetSampling("ticks", gosse.Sampling{MaxRate: 1.0 / 3600}); err != nil {
+		t.Fatalf("Unexpected error setting sampling: %v", err)
+	}
+	_ = server.Publish("ticks", []byte("first"))
+	_ = server.Publish("ticks", []byte("second"))
+	if ev := <-client.Messages(); string(ev.Data) != "first" {
+		t.Errorf("Expected the first event, got %q", ev.Data)
+	}
+	select {
+	case ev := <-client.Messages():
+		t.Errorf("Expected the second event to be skipped, got %q", ev.Data)
+	default:
+	}
+
+	if err := client.SetSampling("ticks", gosse.Sampling{Every: -1}); !errors.Is(err, gosse.ErrInvalidOption) {
+		t.Errorf("Expected ErrInvalidOption for a negative sampling, got %v", err)
+	}
+}
+
+// readFrame reads one SSE frame, without its terminating blank line.
+func readFrame(t *testing.T, reader *bufio.Reader) string {
+	t.Helper()
+	var frame strings.Builder
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read frame: %v", err)
+		}
+		if line == "\n" {
+			return frame.String()
+		}
+		frame.WriteString(line)
+	}
+}
+
+func TestHandler_ReplayWithMarkers(t *testing.T) {
+	server := gosse.NewServer(gosse.WithHistory(3))
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	quiet, err := gosse.NewHandler(server, gosse.WithHandlerReplayMarkers("", ""))
+	if err != nil {
+		t.Fatalf("Unexpected error creating handler: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		gosse.SSEHandlerEndpoint(server, w, r)
+	})
+	mux.Handle("/quiet", quiet)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	for i := 1; i <= 4; i++ {
+		_ = server.BroadcastMessage([]byte(fmt.Sprint("event ", i)))
+	}
+	_ = server.Publish("other", []byte("not subscribed"))
+
+	connect := func(path, lastID string) (*http.Response, *bufio.Reader) {
+		req, _ := http.NewRequest("GET", ts.URL+path, nil)
+		req.Header.Set("Last-Event-ID", lastID)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		return resp, bufio.NewReader(resp.Body)
+	}
+
+	// Event 2 is no longer kept, so the replay is incomplete
+	resp, reader := connect("/events", "1")
+	defer resp.Body.Close()
+	for _, want := range []string{
+		"event: replay-start\ndata: {\"events\":2,\"complete\":false}\n",
+		"id: 3\ndata: event 3\n",
+		"id: 4\ndata: event 4\n",
+		"id: 5\nevent: replay-end\ndata: {\"last_event_id\":\"5\"}\n",
+	} {
+		if frame := readFrame(t, reader); frame != want {
+			t.Errorf("Expected frame %q, got %q", want, frame)
+		}
+	}
+	_ = server.BroadcastMessage([]byte("live"))
+	if frame := readFrame(t, reader); frame != "id: 6\ndata: live\n" {
+		t.Errorf("Expected the live event after the replay, got %q", frame)
+	}
+
+	// Markers can be suppressed
+	quietResp, quietReader := connect("/quiet", "4")
+	defer quietResp.Body.Close()
+	_ = server.BroadcastMessage([]byte("live again"))
+	for _, want := range []string{"id: 6\ndata: live\n", "id: 7\ndata: live again\n"} {
+		if frame := readFrame(t, quietReader); frame != want {
+			t.Errorf("Expected frame %q, got %q", want, frame)
+		}
+	}
+}
+
+func TestHandler_StandbyResume(t *testing.T) {
+	broker := gosse.NewMemoryBroker()
+	primary := gosse.NewServer(gosse.WithAutoRun(), gosse.WithInstanceID("primary"), gosse.WithBroker(broker.Connect()),
+		gosse.WithHistory(10))
+	defer primary.Shutdown()
+
+	// Events from before the standby started, which it never numbers
+	_ = primary.BroadcastMessage([]byte("early 1"))
+	_ = primary.BroadcastMessage([]byte("early 2"))
+
+	standby := gosse.NewServer(gosse.WithAutoRun(), gosse.WithInstanceID("standby"), gosse.WithBroker(broker.Connect()),
+		gosse.WithHistory(10), gosse.WithStandby())
+	defer standby.Shutdown()
+
+	connect := func(server *gosse.Server, lastID string) (*http.Response, *bufio.Reader) {
+		handler, err := gosse.NewHandler(server, gosse.WithHandlerReplayMarkers("", ""))
+		if err != nil {
+			t.Fatalf("Unexpected error creating handler: %v", err)
+		}
+		ts := httptest.NewServer(handler)
+		t.Cleanup(ts.Close)
+		req, _ := http.NewRequest("GET", ts.URL, nil)
+		if lastID != "" {
+			req.Header.Set("Last-Event-ID", lastID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		return resp, bufio.NewReader(resp.Body)
+	}
+
+	resp, reader := connect(primary, "2")
+	_ = primary.BroadcastMessage([]byte("seen 3"))
+	_ = primary.Publish("prices", []byte("not subscribed"))
+	_ = primary.BroadcastMessage([]byte("seen 5"))
+	for _, want := range []string{"id: 3\ndata: seen 3\n", "id: 5\ndata: seen 5\n"} {
+		if frame := readFrame(t, reader); frame != want {
+			t.Errorf("Expected frame %q from the primary, got %q", want, frame)
+		}
+	}
+	resp.Body.Close()
+
+	// The primary fails after the client lost its connection
+	_ = primary.BroadcastMessage([]byte("missed 6"))
+	_ = primary.BroadcastMessage([]byte("missed 7"))
+	primary.Shutdown()
+	standby.Promote()
+
+	resp, reader = connect(standby, "5")
+	defer resp.Body.Close()
+	_ = standby.BroadcastMessage([]byte("live 8"))
+	for _, want := range []string{"id: 6\ndata: missed 6\n", "id: 7\ndata: missed 7\n", "id: 8\ndata: live 8\n"} {
+		if frame := readFrame(t, reader); frame != want {
+			t.Errorf("Expected frame %q from the promoted standby, got %q", want, frame)
+		}
+	}
+}
+
+func TestServer_Comments(t *testing.T) {
+	server := gosse.NewServer()
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gosse.SSEHandlerEndpoint(server, w, r)
+	}))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	direct := server.AddClient()
+	if err := server.BroadcastComment("deploy v2\nin progress"); err != nil {
+		t.Fatalf("Unexpected error broadcasting a comment: %v", err)
+	}
+	if frame := readFrame(t, bufio.NewReader(resp.Body)); frame != ": deploy v2 in progress\n" {
+		t.Errorf("Expected a comment frame, got %q", frame)
+	}
+
+	if err := server.SendCommentToClient(direct.ID, "just you"); err != nil {
+		t.Fatalf("Unexpected error sending a comment: %v", err)
+	}
+	<-direct.Messages() // The broadcast comment
+	if ev := <-direct.Messages(); ev.Comment != "just you" || ev.Data != nil {
+		t.Errorf("Expected a comment event, got %+v", ev)
+	}
+	if err := server.SendCommentToClient("missing", "x"); !errors.Is(err, gosse.ErrClientNotFound) {
+		t.Errorf("Expected ErrClientNotFound, got %v", err)
+	}
+	if m := server.Metrics(); m.Published != 0 || m.Delivered != 0 {
+		t.Errorf("Expected comments not to be counted, got %+v", m)
+	}
+}
+
+func TestHandler_Coalescing(t *testing.T) {
+	disconnected := make(chan gosse.ClientInfo, 10)
+	server := gosse.NewServer(gosse.WithHistory(10), gosse.WithOnDisconnect(func(info gosse.ClientInfo) {
+		disconnected <- info
+	}))
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	handler, err := gosse.NewHandler(server, gosse.WithHandlerCoalescing(func(r *http.Request) string {
+		return r.Header.Get("X-User")
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error creating handler: %v", err)
+	}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	for i := 1; i <= 3; i++ {
+		_ = server.BroadcastMessage([]byte(fmt.Sprint("event ", i)))
+	}
+	connect := func(user string) (*http.Response, *bufio.Reader) {
+		req, _ := http.NewRequest("GET", ts.URL, nil)
+		req.Header.Set("X-User", user)
+		req.Header.Set("Last-Event-ID", "1")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		return resp, bufio.NewReader(resp.Body)
+	}
+
+	// Two tabs of one user reconnect together; each gets the full replay
+	var tabs []*http.Response
+	for i := 0; i < 2; i++ {
+		resp, reader := connect("alice")
+		tabs = append(tabs, resp)
+		readFrame(t, reader) // Replay start
+		for _, want := range []string{"id: 2\ndata: event 2\n", "id: 3\ndata: event 3\n"} {
+			if frame := readFrame(t, reader); frame != want {
+				t.Errorf("Tab %d: expected frame %q, got %q", i, want, frame)
+			}
+		}
+	}
+	other, _ := connect("bob")
+	defer other.Body.Close()
+
+	want := []gosse.IdentityInfo{{Identity: "alice", Connections: 2}, {Identity: "bob", Connections: 1}}
+	if got := server.Identities(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected identities %+v, got %+v", want, got)
+	}
+
+	for _, tab := range tabs {
+		tab.Body.Close()
+		if info := <-disconnected; info.Identity != "alice" {
+			t.Errorf("Expected the disconnect record to name alice, got %q", info.Identity)
+		}
+	}
+	want = want[1:]
+	if got := server.Identities(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected identities %+v after alice left, got %+v", want, got)
+	}
+}
+
+func TestServer_Snapshot(t *testing.T) {
+	server := gosse.NewServer(gosse.WithHistory(10))
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gosse.SSEHandlerEndpoint(server, w, r)
+	}))
+	defer ts.Close()
+
+	_ = server.Publish("scores", []byte("1-0"))
+	_ = server.Publish("weather", []byte("sunny"))
+	_ = server.Publish("scores", []byte("2-0"))
+	_ = server.BroadcastMessage([]byte("not retained"))
+
+	events, cursor := server.Snapshot("scores", "weather", "unknown")
+	if len(events) != 2 || string(events[0].Data) != "sunny" || string(events[1].Data) != "2-0" || cursor != "4" {
+		t.Fatalf("Expected the retained events oldest first and cursor 4, got %+v and %q", events, cursor)
+	}
+	if all, _ := server.Snapshot(); len(all) != 2 {
+		t.Errorf("Expected every topic without arguments, got %+v", all)
+	}
+
+	// A connection resuming from the cursor sees only what came after
+	_ = server.Publish("scores", []byte("3-0"))
+	resp, err := http.Get(ts.URL + "?topic=scores&topic=weather&last_event_id=" + cursor)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+	readFrame(t, reader) // Replay start
+	if frame := readFrame(t, reader); frame != "id: 5\ndata: 3-0\n" {
+		t.Errorf("Expected only the event after the snapshot, got %q", frame)
+	}
+
+	if events, cursor := gosse.NewServer().Snapshot(); events != nil || cursor != "" {
+		t.Errorf("Expected an empty snapshot without history, got %+v and %q", events, cursor)
+	}
+}
+
+func TestServer_Partitions(t *testing.T) {
+	server := gosse.NewServer()
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gosse.SSEHandlerEndpoint(server, w, r)
+	}))
+	defer ts.Close()
+
+	// Three workers split the jobs between them
+	var readers []*bufio.Reader
+	for i := 0; i < 3; i++ {
+		resp, err := http.Get(fmt.Sprintf("%s?topic=jobs&partition=%d&partitions=3", ts.URL, i))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		readers = append(readers, bufio.NewReader(resp.Body))
+	}
+	keys := []string{"alpha", "beta", "gamma", "delta", "epsilon", "zeta"}
+	for _, key := range keys {
+		if err := server.PublishKeyed("jobs", key, []byte(key)); err != nil {
+			t.Fatalf("Unexpected error publishing: %v", err)
+		}
+	}
+	_ = server.Publish("jobs", []byte("everyone"))
+
+	// Each worker sees its own keys in order, then the unkeyed event
+	for i, reader := range readers {
+		for _, key := range keys {
+			if gosse.PartitionOf(key, 3) != i {
+				continue
+			}
+			if frame := readFrame(t, reader); frame != "data: "+key+"\n" {
+				t.Errorf("Worker %d: expected %q, got %q", i, key, frame)
+			}
+		}
+		if frame := readFrame(t, reader); frame != "data: everyone\n" {
+			t.Errorf("Worker %d: expected the unkeyed event, got %q", i, frame)
+		}
+	}
+
+	resp, err := http.Get(ts.URL + "?topic=jobs&partition=3&partitions=3")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an index out of range, got %d", resp.StatusCode)
+	}
+}
+
+func TestHandler_ReplayCompaction(t *testing.T) {
+	server := gosse.NewServer(gosse.WithHistory(10), gosse.WithHistoryCompaction("prices"))
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gosse.SSEHandlerEndpoint(server, w, r)
+	}))
+	defer ts.Close()
+
+	_ = server.PublishKeyed("prices", "ACME", []byte("ACME 1"))
+	_ = server.PublishKeyed("prices", "ACME", []byte("ACME 2"))
+	_ = server.PublishKeyed("prices", "XYZ", []byte("XYZ 1"))
+	_ = server.PublishKeyed("trades", "ACME", []byte("trade 1"))
+	_ = server.PublishKeyed("trades", "ACME", []byte("trade 2"))
+	_ = server.PublishKeyed("prices", "ACME", []byte("ACME 3"))
+	_ = server.Publish("prices", []byte("market open"))
+
+	resp, err := http.Get(ts.URL + "?topic=prices&topic=trades&last_event_id=0")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+
+	// Only the latest price per key is replayed; trades are not compacted
+	if frame := readFrame(t, reader); frame != "event: replay-start\ndata: {\"events\":5,\"complete\":true}\n" {
+		t.Errorf("Expected five replayed events, got %q", frame)
+	}
+	for _, want := range []string{"XYZ 1", "trade 1", "trade 2", "ACME 3", "market open"} {
+		if frame := readFrame(t, reader); !strings.HasSuffix(frame, "data: "+want+"\n") {
+			t.Errorf("Expected %q, got %q", want, frame)
+		}
+	}
+}
+
+func TestHandler_ReplayWindow(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	var elapsed atomic.Int64
+	clock := func() time.Time { return start.Add(time.Duration(elapsed.Load())) }
+	server := gosse.NewServer(gosse.WithHistory(10), gosse.WithClock(clock))
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	handler, err := gosse.NewHandler(server, gosse.WithHandlerReplayWindow(3, time.Hour))
+	if err != nil {
+		t.Fatalf("Unexpected error creating handler: %v", err)
+	}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	// One event a minute, the first one too old for the handler's limit
+	for i := 1; i <= 5; i++ {
+		_ = server.BroadcastMessage([]byte(fmt.Sprint("event ", i)))
+		elapsed.Add(int64(time.Minute))
+		if i == 1 {
+			elapsed.Add(int64(time.Hour))
+		}
+	}
+
+	replay := func(query string) []string {
+		t.Helper()
+		resp, err := http.Get(ts.URL + "?" + query)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		reader := bufio.NewReader(resp.Body)
+		var frames []string
+		for {
+			frame := readFrame(t, reader)
+			frames = append(frames, frame)
+			if strings.Contains(frame, "event: replay-end") {
+				return frames
+			}
+		}
+	}
+
+	// The count is cut to the handler's maximum
+	frames := replay("replay_last=10")
+	want := []string{
+		"event: replay-start\ndata: {\"events\":3,\"complete\":true}\n",
+		"id: 3\ndata: event 3\n",
+		"id: 4\ndata: event 4\n",
+		"id: 5\ndata: event 5\n",
+		"id: 5\nevent: replay-end\ndata: {\"last_event_id\":\"5\"}\n",
+	}
+	if !reflect.DeepEqual(frames, want) {
+		t.Errorf("Expected frames %q, got %q", want, frames)
+	}
+
+	// A time before the handler's maximum age leaves out the first event
+	frames = replay("replay_since=" + start.Format(time.RFC3339))
+	if len(frames) != 6 || frames[1] != "id: 2\ndata: event 2\n" {
+		t.Errorf("Expected events 2 to 5, got %q", frames)
+	}
+	since := start.Add(time.Hour + 3*time.Minute).Format(time.RFC3339)
+	frames = replay("replay_since=" + since)
+	if len(frames) != 4 || frames[1] != "id: 4\ndata: event 4\n" {
+		t.Errorf("Expected events 4 and 5, got %q", frames)
+	}
+
+	// A Last-Event-ID takes precedence
+	frames = replay("replay_last=1&last_event_id=3")
+	if len(frames) != 4 || frames[1] != "id: 4\ndata: event 4\n" {
+		t.Errorf("Expected the events after ID 3, got %q", frames)
+	}
+
+	for _, query := range []string{"replay_last=0", "replay_last=x", "replay_since=yesterday"} {
+		resp, err := http.Get(ts.URL + "?" + query)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s, got %d", query, resp.StatusCode)
+		}
+	}
+}
+
+func TestHandler_ReplayRetention(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	var elapsed atomic.Int64
+	clock := func() time.Time { return start.Add(time.Duration(elapsed.Load())) }
+	server := gosse.NewServer(gosse.WithHistory(10), gosse.WithClock(clock),
+		gosse.WithHistoryRetention("tick", time.Minute),
+		gosse.WithHistoryRetention("alert", 24*time.Hour))
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gosse.SSEHandlerEndpoint(server, w, r)
+	}))
+	defer ts.Close()
+
+	_ = server.BroadcastHTML("tick", []byte("tick 1"))
+	_ = server.BroadcastHTML("alert", []byte("disk full"))
+	_ = server.BroadcastMessage([]byte("hello"))
+	elapsed.Add(int64(time.Hour))
+	_ = server.BroadcastHTML("tick", []byte("tick 2"))
+
+	resp, err := http.Get(ts.URL + "?last_event_id=0")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+
+	// The old tick has expired, which does not make the replay incomplete
+	for _, want := range []string{
+		"event: replay-start\ndata: {\"events\":3,\"complete\":true}\n",
+		"id: 2\nevent: alert\ndata: disk full\n",
+		"id: 3\ndata: hello\n",
+		"id: 4\nevent: tick\ndata: tick 2\n",
+	} {
+		if frame := readFrame(t, reader); frame != want {
+			t.Errorf("Expected frame %q, got %q", want, frame)
+		}
+	}
+
+	if _, err := gosse.New(gosse.WithHistoryRetention("tick", 0)); !errors.Is(err, gosse.ErrInvalidOption) {
+		t.Errorf("Expected ErrInvalidOption for a zero retention, got %v", err)
+	}
+}
+
+func TestHandler_WriteTrace(t *testing.T) {
+	server := gosse.NewServer()
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	var mu sync.Mutex
+	var steps []string
+	record := func(step string) func(gosse.WriteInfo) {
+		return func(info gosse.WriteInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			if info.ClientID == "" || info.Err != nil {
+				t.Errorf("Unexpected %s info %+v", step, info)
+			}
+			steps = append(steps, fmt.Sprint(step, " ", info.Bytes))
+		}
+	}
+	handler, err := gosse.NewHandler(server, gosse.WithHandlerWriteTrace(gosse.WriteTrace{
+		WriteStart: record("write-start"),
+		WriteDone:  record("write-done"),
+		FlushStart: record("flush-start"),
+		FlushDone:  record("flush-done"),
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error creating handler: %v", err)
+	}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+	_ = server.BroadcastMessage([]byte("hello"))
+	if frame := readFrame(t, reader); frame != "data: hello\n" {
+		t.Fatalf("Expected the event, got %q", frame)
+	}
+
+	// "data: hello\n\n" is 13 bytes
+	want := []string{"write-start 13", "write-done 13", "flush-start 13", "flush-done 13"}
+	deadline := time.Now().Add(time.Second)
+	for {
+		mu.Lock()
+		got := append([]string(nil), steps...)
+		mu.Unlock()
+		if reflect.DeepEqual(got, want) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected steps %q, got %q", want, got)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestServer_ShutdownContextReport(t *testing.T) {
+	server := gosse.NewServer(gosse.WithRateLimit(1, 1))
+
+	// Start the server
+	go server.Run()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gosse.SSEHandlerEndpoint(server, w, r)
+	}))
+	defer ts.Close()
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+
+	// The rate limit lets the first event through and holds back the others
+	for _, msg := range []string{"one", "two", "three"} {
+		_ = server.BroadcastMessage([]byte(msg))
+	}
+	if frame := readFrame(t, reader); frame != "data: one\n" {
+		t.Fatalf("Expected the first event, got %q", frame)
+	}
+
+	report, err := server.ShutdownContext(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error shutting down: %v", err)
+	}
+	want := gosse.ShutdownReport{Clients: 1, Pending: 2, Dropped: 2, Duration: report.Duration}
+	if report != want {
+		t.Errorf("Expected report %+v, got %+v", want, report)
+	}
+}
+
+func TestServer_ShutdownContextFlushes(t *testing.T) {
+	server := gosse.NewServer()
+
+	// Start the server
+	go server.Run()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gosse.SSEHandlerEndpoint(server, w, r)
+	}))
+	defer ts.Close()
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	direct, err := server.AddClientContext(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error adding client: %v", err)
+	}
+
+	_ = server.BroadcastMessage([]byte("bye"))
+	report, err := server.ShutdownContext(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error shutting down: %v", err)
+	}
+	if report.Clients != 2 || report.Dropped != 0 || report.Flushed != report.Pending {
+		t.Errorf("Expected every pending event flushed, got %+v", report)
+	}
+
+	// The stream wrote its event before ending, and the direct client can
+	// still read its own
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "data: bye\n") {
+		t.Errorf("Expected the stream to end with the event, got %q", body)
+	}
+	if ev, ok := <-direct.Messages(); !ok || string(ev.Data) != "bye" {
+		t.Errorf("Expected the direct client's event, got %q, %v", ev.Data, ok)
+	}
+}
+
+func TestHandler_StructuredEvents(t *testing.T) {
+	server := gosse.NewServer()
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gosse.SSEHandlerEndpoint(server, w, r)
+	}))
+	defer ts.Close()
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+
+	err = server.BroadcastEvent(gosse.Event{ID: "7", Name: "update", Retry: 5 * time.Second, Data: []byte("x")})
+	if err != nil {
+		t.Fatalf("Unexpected error broadcasting: %v", err)
+	}
+	if frame := readFrame(t, reader); frame != "id: 7\nevent: update\nretry: 5000\ndata: x\n" {
+		t.Errorf("Unexpected frame %q", frame)
+	}
+
+	direct, err := server.AddClientContext(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error adding client: %v", err)
+	}
+	if err := server.SendEventToClient(direct.ID, gosse.Event{Name: "hello", Retry: time.Second, Data: []byte("you")}); err != nil {
+		t.Fatalf("Unexpected error sending: %v", err)
+	}
+	if ev := <-direct.Messages(); ev.Name != "hello" || ev.Retry != time.Second || string(ev.Data) != "you" {
+		t.Errorf("Unexpected event %+v", ev)
+	}
+
+	for _, ev := range []gosse.Event{{ID: "1\n2"}, {Name: "a\rb"}, {Retry: -time.Second}} {
+		if err := server.BroadcastEvent(ev); !errors.Is(err, gosse.ErrInvalidOption) {
+			t.Errorf("Expected ErrInvalidOption for %+v, got %v", ev, err)
+		}
+	}
+}
+
+func TestHandler_ReplayRate(t *testing.T) {
+	server := gosse.NewServer(gosse.WithHistory(10))
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	handler, err := gosse.NewHandler(server, gosse.WithHandlerReplayRate(10, 1))
+	if err != nil {
+		t.Fatalf("Unexpected error creating handler: %v", err)
+	}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	for i := 1; i <= 3; i++ {
+		_ = server.BroadcastMessage([]byte(fmt.Sprint("event ", i)))
+	}
+	resp, err := http.Get(ts.URL + "?last_event_id=0")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+	for _, want := range []string{"event: replay-start\ndata: {\"events\":3,\"complete\":true}\n", "id: 1\ndata: event 1\n"} {
+		if frame := readFrame(t, reader); frame != want {
+			t.Fatalf("Expected frame %q, got %q", want, frame)
+		}
+	}
+
+	// A fresh event overtakes the paced backlog, without an ID
+	_ = server.BroadcastMessage([]byte("fresh"))
+	for _, want := range []string{
+		"data: fresh\n",
+		"id: 2\ndata: event 2\n",
+		"id: 3\ndata: event 3\n",
+		"id: 3\nevent: replay-end\ndata: {\"last_event_id\":\"3\"}\n",
+	} {
+		if frame := readFrame(t, reader); frame != want {
+			t.Errorf("Expected frame %q, got %q", want, frame)
+		}
+	}
+
+	if _, err := gosse.NewHandler(server, gosse.WithHandlerReplayRate(1, 0)); !errors.Is(err, gosse.ErrInvalidOption) {
+		t.Errorf("Expected ErrInvalidOption for a zero burst, got %v", err)
+	}
+}
+
+func TestHandler_DeliveryProbe(t *testing.T) {
+	server := gosse.NewServer()
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	timedOut := make(chan string, 2)
+	handler, err := gosse.NewHandler(server, gosse.WithHandlerDeliveryProbe(50*time.Millisecond, func(clientID string) {
+		timedOut <- clientID
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error creating handler: %v", err)
+	}
+	if _, err := gosse.NewHandler(server, gosse.WithHandlerDeliveryProbe(0, nil)); !errors.Is(err, gosse.ErrInvalidOption) {
+		t.Fatalf("Expected ErrInvalidOption for a zero timeout, got %v", err)
+	}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	// probe opens a probed stream and returns its token
+	probe := func() (string, *http.Response) {
+		t.Helper()
+		resp, err := http.Get(ts.URL + "?probe=1")
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		frame := readFrame(t, bufio.NewReader(resp.Body))
+		data, ok := strings.CutPrefix(frame, "event: probe\ndata: ")
+		if !ok {
+			t.Fatalf("Expected a probe event, got %q", frame)
+		}
+		var payload struct {
+			Token string `json:"token"`
+		}
+		if err := json.Unmarshal([]byte(data), &payload); err != nil || payload.Token == "" {
+			t.Fatalf("Expected a token in %q: %v", data, err)
+		}
+		return payload.Token, resp
+	}
+	ack := func(token string) int {
+		t.Helper()
+		resp, err := http.Get(ts.URL + "?probe_ack=" + url.QueryEscape(token))
+		if err != nil {
+			t.Fatalf("Ack failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// An acknowledged probe does not time out
+	token, resp := probe()
+	defer resp.Body.Close()
+	if status := ack(token); status != http.StatusNoContent {
+		t.Fatalf("Expected 204 for the ack, got %d", status)
+	}
+	if status := ack(token); status != http.StatusNotFound {
+		t.Fatalf("Expected 404 for a repeated ack, got %d", status)
+	}
+
+	// An unacknowledged one does, naming the client
+	_, resp2 := probe()
+	defer resp2.Body.Close()
+	select {
+	case clientID := <-timedOut:
+		if clientID == "" {
+			t.Fatal("Expected the client ID")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the probe to time out")
+	}
+	select {
+	case clientID := <-timedOut:
+		t.Fatalf("Unexpected second timeout for %s", clientID)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestServer_ShutdownEvent(t *testing.T) {
+	server := gosse.NewServer(gosse.WithAutoRun(), gosse.WithShutdownEvent(gosse.Event{
+		Name:  "server-closing",
+		Data:  []byte("restarting"),
+		Retry: 10 * time.Second,
+	}))
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gosse.SSEHandlerEndpoint(server, w, r)
+	}))
+	defer ts.Close()
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	_ = server.BroadcastMessage([]byte("last"))
+	if _, err := server.ShutdownContext(context.Background()); err != nil {
+		t.Fatalf("Unexpected error shutting down: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if want := "data: last\n\nevent: server-closing\nretry: 10000\ndata: restarting\n\n"; !strings.HasSuffix(string(body), want) {
+		t.Errorf("Expected the stream to end with %q, got %q", want, body)
+	}
+
+	// New clients are turned away
+	resp2, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp2.Body.Close()
+	if resp2.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 after shutdown, got %d", resp2.StatusCode)
+	}
+
+	if _, err := gosse.New(gosse.WithShutdownEvent(gosse.Event{Name: "a\nb"})); !errors.Is(err, gosse.ErrInvalidOption) {
+		t.Errorf("Expected ErrInvalidOption for a multi-line name, got %v", err)
+	}
+}
+
+func TestServer_TopicExpiry(t *testing.T) {
+	var clock atomic.Int64
+	expired := make(chan gosse.TopicInfo, 10)
+	server := gosse.NewServer(gosse.WithAutoRun(), gosse.WithHistory(10),
+		gosse.WithClock(func() time.Time { return time.Unix(clock.Load(), 0) }),
+		gosse.WithTopicExpiry(20*time.Millisecond),
+		gosse.WithOnTopicExpired(func(info gosse.TopicInfo) { expired <- info }))
+	defer server.Shutdown()
+	handler, err := gosse.NewHandler(server, gosse.WithHandlerReplayWindow(0, 0))
+	if err != nil {
+		t.Fatalf("Unexpected error creating handler: %v", err)
+	}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	// A topic with a subscriber stays however long it is quiet
+	if _, err := server.SubscribeContext(context.Background(), "lobby"); err != nil {
+		t.Fatalf("Unexpected error subscribing: %v", err)
+	}
+	_ = server.Publish("room-1", []byte("hello"))
+	_ = server.Publish("lobby", []byte("welcome"))
+	clock.Add(60)
+
+	select {
+	case info := <-expired:
+		if info.Name != "room-1" || info.Retained == nil || string(info.Retained.Data) != "hello" {
+			t.Errorf("Expected room-1's last state, got %+v", info)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected room-1 to expire")
+	}
+	topics := server.Topics()
+	if len(topics) != 1 || topics[0].Name != "lobby" {
+		t.Errorf("Expected only the lobby left, got %+v", topics)
+	}
+
+	// The expired topic's history is gone too
+	resp, err := http.Get(ts.URL + "?topic=room-1&topic=lobby&replay_last=10")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+	if frame := readFrame(t, reader); !strings.HasPrefix(frame, "event: replay-start\n") {
+		t.Fatalf("Expected the replay to start, got %q", frame)
+	}
+	if frame := readFrame(t, reader); frame != "id: 2\ndata: welcome\n" {
+		t.Errorf("Expected only the lobby's event, got %q", frame)
+	}
+
+	// Publishing again starts afresh
+	_ = server.Publish("room-1", []byte("again"))
+	for _, info := range server.Topics() {
+		if info.Name == "room-1" && (info.Retained == nil || string(info.Retained.Data) != "again") {
+			t.Errorf("Expected a fresh room-1, got %+v", info)
+		}
+	}
+}
+
+func TestHandler_CapabilitiesAndTransform(t *testing.T) {
+	server := gosse.NewServer(gosse.WithAutoRun())
+	defer server.Shutdown()
+
+	// Payloads over a client's size limit are replaced by a pointer, and
+	// clients without the "v2" capability get the old event name
+	seen := make(chan gosse.Capabilities, 10)
+	handler, err := gosse.NewHandler(server, gosse.WithHandlerTransform(func(client *gosse.Client, ev gosse.Event) (gosse.Event, bool) {
+		caps := client.Capabilities()
+		seen <- caps
+		if max := caps.MaxEventSize; max > 0 && len(ev.Data) > max {
+			ev.Data = []byte(`{"too_large":true}`)
+		}
+		if !caps.Has("v2") {
+			ev.Name = ""
+		}
+		return ev, string(ev.Data) != "secret"
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error creating handler: %v", err)
+	}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"?capabilities=binary,v2", nil)
+	req.Header.Set("SSE-Capabilities", "max-event-size=8")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+
+	_ = server.BroadcastMessage([]byte("secret"))
+	_ = server.BroadcastEvent(gosse.Event{Name: "update", Data: []byte("a long payload")})
+	if frame := readFrame(t, reader); frame != "event: update\ndata: {\"too_large\":true}\n" {
+		t.Errorf("Expected the transformed event, got %q", frame)
+	}
+	caps := <-seen
+	if !caps.Binary || caps.Patches || caps.MaxEventSize != 8 || !reflect.DeepEqual(caps.Other, []string{"v2"}) {
+		t.Errorf("Unexpected capabilities %+v", caps)
+	}
+
+	resp2, err := http.Get(ts.URL + "?capabilities=max-event-size=big")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp2.Body.Close()
+	if resp2.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a malformed size, got %d", resp2.StatusCode)
+	}
+}
+
+func TestServer_BroadcastJSON(t *testing.T) {
+	server := gosse.NewServer(gosse.WithAutoRun())
+	defer server.Shutdown()
+	plain, err := gosse.NewHandler(server)
+	if err != nil {
+		t.Fatalf("Unexpected error creating handler: %v", err)
+	}
+	// Events a transform rewrote do not get the shared frame
+	upper, err := gosse.NewHandler(server, gosse.WithHandlerTransform(func(_ *gosse.Client, ev gosse.Event) (gosse.Event, bool) {
+		ev.Data = []byte(strings.ToUpper(string(ev.Data)))
+		return ev, true
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error creating handler: %v", err)
+	}
+	var readers []*bufio.Reader
+	for _, handler := range []http.Handler{plain, plain, upper} {
+		ts := httptest.NewServer(handler)
+		defer ts.Close()
+		resp, err := http.Get(ts.URL)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		readers = append(readers, bufio.NewReader(resp.Body))
+	}
+
+	if err := server.BroadcastJSON(map[string]int{"price": 42}); err != nil {
+		t.Fatalf("Unexpected error broadcasting: %v", err)
+	}
+	for i, want := range []string{`data: {"price":42}` + "\n", `data: {"price":42}` + "\n", `data: {"PRICE":42}` + "\n"} {
+		if frame := readFrame(t, readers[i]); frame != want {
+			t.Errorf("Expected stream %d to get %q, got %q", i, want, frame)
+		}
+	}
+
+	client := server.AddClient()
+	if err := server.SendJSONToClient(client.ID, []string{"a", "b"}); err != nil {
+		t.Fatalf("Unexpected error sending: %v", err)
+	}
+	select {
+	case ev := <-client.Messages():
+		if string(ev.Data) != `["a","b"]` {
+			t.Errorf("Expected the JSON array, got %q", ev.Data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for the JSON event")
+	}
+	if err := server.BroadcastJSON(make(chan int)); err == nil {
+		t.Error("Expected an error for a value JSON cannot encode")
+	}
+}
+
+func TestHandler_Schemas(t *testing.T) {
+	server := gosse.NewServer(gosse.WithAutoRun())
+	defer server.Shutdown()
+	rename := func(from, to string) func(gosse.Event) (gosse.Event, error) {
+		return func(ev gosse.Event) (gosse.Event, error) {
+			ev.Data = []byte(strings.Replace(string(ev.Data), from, to, 1))
+			return ev, nil
+		}
+	}
+	handler, err := gosse.NewHandler(server, gosse.WithHandlerSchemas(2,
+		gosse.SchemaConverter{Version: 1, Up: rename("name", "title"), Down: rename("title", "name")},
+		gosse.SchemaConverter{Version: 2, Up: rename("title", "heading")},
+	), gosse.WithHandlerTransform(func(client *gosse.Client, ev gosse.Event) (gosse.Event, bool) {
+		if ev.Schema != client.Schema() {
+			t.Errorf("Expected the transform to see schema %d, got %d", client.Schema(), ev.Schema)
+		}
+		return ev, true
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error creating handler: %v", err)
+	}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "?schema=4")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a schema no converter reaches, got %d", resp.StatusCode)
+	}
+
+	var readers []*bufio.Reader
+	for _, query := range []string{"?schema=1", "", "?schema=3"} {
+		resp, err := http.Get(ts.URL + query)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		readers = append(readers, bufio.NewReader(resp.Body))
+	}
+	_ = server.BroadcastMessage([]byte(`{"title":"a"}`))
+	_ = server.BroadcastEvent(gosse.Event{Data: []byte(`{"name":"b"}`), Schema: 1})
+	wants := [][]string{
+		{`{"name":"a"}`, `{"name":"b"}`},
+		{`{"title":"a"}`, `{"title":"b"}`},
+		{`{"heading":"a"}`, `{"heading":"b"}`},
+	}
+	for i, want := range wants {
+		for _, data := range want {
+			if frame := readFrame(t, readers[i]); frame != "data: "+data+"\n" {
+				t.Errorf("Expected client %d to get %s, got %q", i, data, frame)
+			}
+		}
+	}
+
+	for _, c := range []gosse.SchemaConverter{{Version: 0, Up: rename("a", "b")}, {Version: 1}} {
+		if _, err := gosse.NewHandler(server, gosse.WithHandlerSchemas(1, c)); !errors.Is(err, gosse.ErrInvalidOption) {
+			t.Errorf("Expected ErrInvalidOption for %+v, got %v", c, err)
+		}
+	}
+}
+
+func TestServer_BroadcastMessageWhere(t *testing.T) {
+	server := gosse.NewServer(gosse.WithAutoRun())
+	defer server.Shutdown()
+	handler, err := gosse.NewHandler(server, gosse.WithHandlerMetadata(func(r *http.Request) map[string]string {
+		return map[string]string{"tenant": r.URL.Query().Get("tenant")}
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error creating handler: %v", err)
+	}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+	resp, err := http.Get(ts.URL + "?tenant=acme")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+
+	direct := server.AddClient()
+	direct.SetMetadata("tenant", "globex")
+	direct.SetMetadata("locale", "de")
+	if got := direct.Metadata(); !reflect.DeepEqual(got, map[string]string{"tenant": "globex", "locale": "de"}) {
+		t.Errorf("Unexpected metadata %v", got)
+	}
+
+	if err := server.BroadcastMessageWhere("tenant", "globex", []byte("for globex")); err != nil {
+		t.Fatalf("Unexpected error broadcasting: %v", err)
+	}
+	if err := server.BroadcastMessageWhere("tenant", "acme", []byte("for acme")); err != nil {
+		t.Fatalf("Unexpected error broadcasting: %v", err)
+	}
+	if frame := readFrame(t, reader); frame != "data: for acme\n" {
+		t.Errorf("Expected the stream to get only the acme message, got %q", frame)
+	}
+	select {
+	case ev := <-direct.Messages():
+		if string(ev.Data) != "for globex" {
+			t.Errorf("Expected the globex message, got %q", ev.Data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for the globex message")
+	}
+	select {
+	case ev := <-direct.Messages():
+		t.Errorf("Expected no other message, got %q", ev.Data)
+	default:
+	}
+
+	direct.SetMetadata("tenant", "")
+	if got := direct.MetadataValue("tenant"); got != "" {
+		t.Errorf("Expected the tenant to be removed, got %q", got)
+	}
+	if err := server.BroadcastMessageWhere("tenant", "", []byte("x")); !errors.Is(err, gosse.ErrInvalidOption) {
+		t.Errorf("Expected ErrInvalidOption for an empty value, got %v", err)
+	}
+}
+
+func TestHandler_Opening(t *testing.T) {
+	server := gosse.NewServer(gosse.WithAutoRun())
+	defer server.Shutdown()
+	for _, tc := range []struct {
+		opening gosse.Event
+		want    string
+	}{
+		{gosse.Event{Comment: "connected"}, ": connected\n"},
+		{gosse.Event{Name: "hello", Retry: 3 * time.Second}, "event: hello\nretry: 3000\ndata: \n"},
+	} {
+		handler, err := gosse.NewHandler(server, gosse.WithHandlerOpening(tc.opening))
+		if err != nil {
+			t.Fatalf("Unexpected error creating handler: %v", err)
+		}
+		ts := httptest.NewServer(handler)
+		defer ts.Close()
+		resp, err := http.Get(ts.URL)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		// The frame arrives with no event published
+		if frame := readFrame(t, bufio.NewReader(resp.Body)); frame != tc.want {
+			t.Errorf("Expected the opening frame %q, got %q", tc.want, frame)
+		}
+	}
+
+	if _, err := gosse.NewHandler(server, gosse.WithHandlerOpening(gosse.Event{Name: "a\nb"})); !errors.Is(err, gosse.ErrInvalidOption) {
+		t.Errorf("Expected ErrInvalidOption for a multi-line name, got %v", err)
+	}
+}
+
+func TestHandler_Checkpoints(t *testing.T) {
+	server := gosse.NewServer(gosse.WithAutoRun(), gosse.WithHistory(10),
+		gosse.WithClock(func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) }))
+	defer server.Shutdown()
+	handler, err := gosse.NewHandler(server, gosse.WithHandlerCheckpoints(20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Unexpected error creating handler: %v", err)
+	}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+
+	if frame := readFrame(t, reader); frame != "event: checkpoint\ndata: {\"time\":\"2024-05-01T12:00:00Z\"}\n" {
+		t.Errorf("Expected a checkpoint without an ID, got %q", frame)
+	}
+	_ = server.BroadcastMessage([]byte("one"))
+	// Skip the event and any checkpoint that beat it
+	frame := readFrame(t, reader)
+	for !strings.Contains(frame, "last_event_id") {
+		frame = readFrame(t, reader)
+	}
+	if want := "event: checkpoint\ndata: {\"last_event_id\":\"1\",\"time\":\"2024-05-01T12:00:00Z\"}\n"; frame != want {
+		t.Errorf("Expected checkpoint %q, got %q", want, frame)
+	}
+
+	if _, err := gosse.NewHandler(server, gosse.WithHandlerCheckpoints(0)); !errors.Is(err, gosse.ErrInvalidOption) {
+		t.Errorf("Expected ErrInvalidOption for a zero interval, got %v", err)
+	}
+}
+
+func TestServer_DeliveryTrace(t *testing.T) {
+	server := gosse.NewServer(gosse.WithAutoRun())
+	defer server.Shutdown()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gosse.SSEHandlerEndpoint(server, w, r)
+	}))
+	defer ts.Close()
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+	for deadline := time.Now().Add(time.Second); server.ClientCount() == 0; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Timeout waiting for the stream to connect")
+		}
+	}
+	full := server.AddClient(1)
+	_ = server.BroadcastMessage([]byte("filler"))
+	readFrame(t, reader)
+
+	_ = server.BroadcastEvent(gosse.Event{Data: []byte("traced"), Trace: "t1"})
+	if frame := readFrame(t, reader); frame != "data: traced\n" {
+		t.Errorf("Expected the traced event without its trace, got %q", frame)
+	}
+	var records []gosse.DeliveryRecord
+	for deadline := time.Now().Add(time.Second); len(records) < 3; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected 3 records, got %+v", records)
+		}
+		records = server.DeliveryTrace("t1")
+	}
+	stages := make(map[gosse.DeliveryStage]string)
+	for _, rec := range records {
+		stages[rec.Stage] = rec.ClientID
+	}
+	if stages[gosse.DeliveryDropped] != full.ID {
+		t.Errorf("Expected the event dropped from the full client, got %+v", records)
+	}
+	if id := stages[gosse.DeliveryWritten]; id == "" || id == full.ID || stages[gosse.DeliveryQueued] != id {
+		t.Errorf("Expected the event queued for and written to the stream, got %+v", records)
+	}
+	if got := server.DeliveryTrace("unknown"); got != nil {
+		t.Errorf("Expected no records for an unknown trace, got %+v", got)
+	}
+}
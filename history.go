@@ -0,0 +1,288 @@
+package gosse
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WithHistory keeps the last size broadcasts and topic events in memory so
+// clients that reconnect can catch up on what they missed. Kept events get
+// increasing numeric IDs, which the handler writes as the frames' id field;
+// browsers send the last one back in the Last-Event-ID header when they
+// reconnect. Messages sent to a single client are not kept. Zero, the
+// default, keeps no history.
+func WithHistory(size int) Option {
+	return func(o *options) error {
+		if size < 0 {
+			return invalidOption("WithHistory", size, "must not be negative")
+		}
+		o.historySize = size
+		return nil
+	}
+}
+
+// WithHistoryCompaction compacts replays of keyed events (see PublishKeyed)
+// the way a compacted log does: of several kept events with the same topic
+// and key, a reconnecting client is sent only the latest, in its original
+// place among the other events. State-heavy topics, where each event
+// replaces the previous value of its key, then replay one event per key
+// plus whatever else happened since, instead of every intermediate value.
+// Without topics, the keyed events of every topic are compacted.
+func WithHistoryCompaction(topics ...string) Option {
+	return func(o *options) error {
+		if err := validateTopics("WithHistoryCompaction", topics...); err != nil {
+			return err
+		}
+		o.compaction = make(map[string]struct{}, len(topics))
+		for _, topic := range topics {
+			o.compaction[topic] = struct{}{}
+		}
+		return nil
+	}
+}
+
+// WithHistoryRetention limits how long the history keeps events named name
+// (see Event.Name) to maxAge, so short-lived events such as ticks make room
+// for those worth replaying much later, such as alerts. An empty name
+// covers unnamed events. Each call sets the retention of one name; events
+// of other names are kept until WithHistory's size pushes them out.
+// Expired events are left out of replays right away and freed within a
+// second. As they are dropped deliberately, replays missing them are still
+// reported complete.
+func WithHistoryRetention(name string, maxAge time.Duration) Option {
+	return func(o *options) error {
+		if strings.ContainsAny(name, "\r\n") {
+			return invalidOption("WithHistoryRetention", strconv.Quote(name), "must not contain line breaks")
+		}
+		if maxAge <= 0 {
+			return invalidOption("WithHistoryRetention", maxAge, "must be positive")
+		}
+		if o.retention == nil {
+			o.retention = make(map[string]time.Duration)
+		}
+		o.retention[name] = maxAge
+		return nil
+	}
+}
+
+// historySweepInterval is how often appending to a history with retention
+// limits frees expired events.
+const historySweepInterval = time.Second
+
+// history is a ring buffer of the most recent events.
+type history struct {
+	mu        sync.Mutex
+	events    []Event // Ring of up to cap(events) events, oldest at start
+	start     int
+	seq       uint64                   // Sequence number of the newest event
+	evicted   uint64                   // Sequence number of the newest event pushed out for room
+	now       func() time.Time         // Clock stamping kept events
+	retention map[string]time.Duration // See WithHistoryRetention, nil for no limit
+	swept     time.Time                // When expired events were last freed
+}
+
+// newHistory returns a history keeping size events, or nil if size is 0.
+func newHistory(size int, now func() time.Time, retention map[string]time.Duration) *history {
+	if size == 0 {
+		return nil
+	}
+	return &history{events: make([]Event, 0, size), now: now, retention: retention}
+}
+
+// append numbers ev, keeps it and returns the numbered event. An event
+// that another instance numbered ahead of this history, as set by
+// fromBroker in ev.seq, keeps its number, so that instances fed by the same
+// publisher agree on IDs. On a nil history, ev is returned unchanged.
+func (h *history) append(ev Event) Event {
+	if h == nil {
+		return ev
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if ev.seq > h.seq {
+		h.seq = ev.seq
+	} else {
+		h.seq++
+	}
+	ev.seq = h.seq
+	ev.ID = strconv.FormatUint(h.seq, 10)
+	ev.at = h.now()
+	if h.retention != nil && ev.at.Sub(h.swept) >= historySweepInterval {
+		h.sweep(ev.at)
+	}
+	if len(h.events) < cap(h.events) {
+		h.events = append(h.events, ev)
+	} else {
+		h.evicted = h.events[h.start].seq
+		h.events[h.start] = ev
+		h.start = (h.start + 1) % len(h.events)
+	}
+	return ev
+}
+
+// sweep frees the events that have outlived their retention, leaving the
+// others in order at the start of the ring. h.mu must be held.
+func (h *history) sweep(now time.Time) {
+	h.swept = now
+	kept := make([]Event, 0, cap(h.events))
+	for i := range h.events {
+		if ev := h.events[(h.start+i)%len(h.events)]; !h.expired(ev, now) {
+			kept = append(kept, ev)
+		}
+	}
+	h.events, h.start = kept, 0
+}
+
+// forget frees the kept events of topic published up to before. On a nil
+// history, it does nothing.
+func (h *history) forget(topic string, before time.Time) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	kept := make([]Event, 0, cap(h.events))
+	for i := range h.events {
+		if ev := h.events[(h.start+i)%len(h.events)]; ev.Topic != topic || ev.at.After(before) {
+			kept = append(kept, ev)
+		}
+	}
+	h.events, h.start = kept, 0
+}
+
+// expired reports whether ev has outlived its retention at now.
+func (h *history) expired(ev Event, now time.Time) bool {
+	maxAge, ok := h.retention[ev.Name]
+	return ok && now.Sub(ev.at) > maxAge
+}
+
+// newest returns the sequence number of the newest event.
+func (h *history) newest() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.seq
+}
+
+// since returns the kept events numbered after seq, oldest first, and the
+// sequence number of the newest event. complete is false if events after
+// seq have already been pushed out to make room, or if seq is from before
+// a restart, in which case every kept event is returned.
+func (h *history) since(seq uint64) (events []Event, newest uint64, complete bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	complete = true
+	if seq > h.seq {
+		seq, complete = 0, false
+	}
+	if seq < h.evicted {
+		complete = false
+	}
+	for i := range h.events {
+		if ev := h.events[(h.start+i)%len(h.events)]; ev.seq > seq {
+			events = append(events, ev)
+		}
+	}
+	return events, h.seq, complete
+}
+
+// replayFrom selects the kept events a replay starts from: those after the
+// event with ID lastID or, without one, the last events or those kept since
+// a time, as chosen by clients that do not track IDs.
+type replayFrom struct {
+	lastID string
+	last   int       // Number of events, 0 for no limit
+	since  time.Time // Zero for no limit
+}
+
+// window reports whether the replay is chosen by count or time rather than
+// by ID.
+func (f replayFrom) window() bool {
+	return f.lastID == "" && (f.last > 0 || !f.since.IsZero())
+}
+
+// replay returns the kept events selected by from that client would have
+// received: broadcasts and events of its topics that pass its filter.
+// newest is the sequence number of the newest kept event, so live events up
+// to it can be skipped as already replayed. complete is false if some of
+// the selected events were already dropped from the history. ok is false
+// if the server keeps no history, or if lastID is not one of its IDs and
+// from selects no window. Connections of one coalesced identity share the
+// history scan.
+func (s *Server) replay(client *Client, from replayFrom) (events []Event, newest uint64, complete, ok bool) {
+	var seq uint64
+	if !from.window() {
+		var err error
+		if seq, err = strconv.ParseUint(from.lastID, 10, 64); err != nil {
+			return nil, 0, false, false
+		}
+	}
+	if s.history == nil {
+		return nil, 0, false, false
+	}
+	var all []Event
+	if client.identity != nil {
+		all, newest, complete = client.identity.since(s.history, seq)
+	} else {
+		all, newest, complete = s.history.since(seq)
+	}
+	if from.window() && !from.since.IsZero() {
+		// Nothing since the time was dropped if the oldest kept event
+		// precedes it
+		if len(all) > 0 && all[0].at.Before(from.since) {
+			complete = true
+		}
+		i := 0
+		for i < len(all) && all[i].at.Before(from.since) {
+			i++
+		}
+		all = all[i:]
+	}
+	now := s.opts.now()
+	aliases := s.aliases.Load()
+	for _, ev := range all {
+		if s.history.expired(ev, now) {
+			continue
+		}
+		if ev.Topic != "" {
+			if name, _ := match(client, ev.Topic, aliases.of(ev.Topic)); name == "" || !client.inPartition(ev) {
+				continue
+			}
+		}
+		if !client.wants(&filterInput{data: ev.Data}) {
+			continue
+		}
+		events = append(events, ev)
+	}
+	if s.opts.compaction != nil {
+		events = compact(events, s.opts.compaction)
+	}
+	if from.window() && from.last > 0 && len(events) >= from.last {
+		events, complete = events[len(events)-from.last:], true
+	}
+	return events, newest, complete, true
+}
+
+// compact drops the keyed events of the topics in compacted, or of every
+// topic if it is empty, that a later event with the same topic and key
+// supersedes.
+func compact(events []Event, compacted map[string]struct{}) []Event {
+	type key struct{ topic, key string }
+	latest := make(map[key]bool)
+	kept := make([]Event, len(events))
+	n := len(kept)
+	for i := len(events) - 1; i >= 0; i-- {
+		ev := events[i]
+		if _, ok := compacted[ev.Topic]; ev.Key != "" && (ok || len(compacted) == 0) {
+			k := key{ev.Topic, ev.Key}
+			if latest[k] {
+				continue
+			}
+			latest[k] = true
+		}
+		n--
+		kept[n] = ev
+	}
+	return kept[n:]
+}
@@ -0,0 +1,73 @@
+package gosse
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"strings"
+)
+
+// The helpers below shape events for htmx's SSE extension, which connects
+// with sse-connect and swaps each event's HTML into the elements whose
+// sse-swap attribute names the event:
+//
+//	<div hx-ext="sse" sse-connect="/events">
+//		<ul sse-swap="orders"></ul>
+//	</div>
+//
+// An empty swap name sends an unnamed event, which htmx knows as "message".
+
+// BroadcastHTML sends an HTML fragment to every client as an event named
+// swap. It reports errors like BroadcastMessage, and one wrapping
+// ErrInvalidOption if swap contains a line break.
+func (s *Server) BroadcastHTML(swap string, html []byte) error {
+	if s == nil {
+		return ErrNilServer
+	}
+	if err := validateSwap(swap); err != nil {
+		return err
+	}
+	return s.broadcastEvent(Event{Data: html, Name: swap})
+}
+
+// PublishHTML sends an HTML fragment as an event named swap to the
+// subscribers of topic. It reports errors like Publish.
+func (s *Server) PublishHTML(topic, swap string, html []byte) error {
+	if s == nil {
+		return ErrNilServer
+	}
+	if err := validateSwap(swap); err != nil {
+		return err
+	}
+	return s.publish(Event{Data: html, Topic: topic, Name: swap})
+}
+
+// SendHTMLToClient sends an HTML fragment as an event named swap to one
+// client. It reports errors like SendMessageToClient.
+func (s *Server) SendHTMLToClient(clientID, swap string, html []byte) error {
+	if s == nil {
+		return ErrNilServer
+	}
+	if err := validateSwap(swap); err != nil {
+		return err
+	}
+	return s.sendEvent(clientID, Event{Data: html, Name: swap})
+}
+
+// RenderHTML executes tmpl with data and returns the fragment, ready for
+// BroadcastHTML and its siblings. html/template escapes data as usual.
+func RenderHTML(tmpl *template.Template, data interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("render %s: %w", tmpl.Name(), err)
+	}
+	return buf.Bytes(), nil
+}
+
+// validateSwap rejects swap names that would break the frame's event line.
+func validateSwap(swap string) error {
+	if strings.ContainsAny(swap, "\r\n") {
+		return invalidOption("swap", swap, "must not contain line breaks")
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package gosse_test
+
+import (
+	"bufio"
+	"errors"
+	"github.com/Firoz01/gosse/v2"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServer_HTML(t *testing.T) {
+	server := gosse.NewServer()
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gosse.SSEHandlerEndpoint(server, w, r)
+	}))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "?topic=orders")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+
+	tmpl := template.Must(template.New("order").Parse("<li>\n{{.}}\n</li>"))
+	html, err := gosse.RenderHTML(tmpl, "tea & cake")
+	if err != nil {
+		t.Fatalf("Unexpected error rendering: %v", err)
+	}
+	if err := server.BroadcastHTML("orders", html); err != nil {
+		t.Fatalf("Unexpected error broadcasting: %v", err)
+	}
+	// Every line of the fragment is a data field of the named event
+	if frame := readFrame(t, reader); frame != "event: orders\ndata: <li>\ndata: tea &amp; cake\ndata: </li>\n" {
+		t.Errorf("Expected a named multi-line frame, got %q", frame)
+	}
+
+	if err := server.PublishHTML("orders", "", []byte("<p>plain</p>")); err != nil {
+		t.Fatalf("Unexpected error publishing: %v", err)
+	}
+	if frame := readFrame(t, reader); frame != "data: <p>plain</p>\n" {
+		t.Errorf("Expected an unnamed frame, got %q", frame)
+	}
+
+	if err := server.BroadcastHTML("bad\nname", html); !errors.Is(err, gosse.ErrInvalidOption) {
+		t.Errorf("Expected ErrInvalidOption for a line break, got %v", err)
+	}
+	if err := server.SendHTMLToClient("missing", "orders", html); !errors.Is(err, gosse.ErrClientNotFound) {
+		t.Errorf("Expected ErrClientNotFound, got %v", err)
+	}
+}
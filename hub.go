@@ -0,0 +1,206 @@
+package gosse
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// HubManager creates named Servers ("hubs") on demand and shuts them down
+// once they have been idle for a while, for applications with many
+// short-lived streams such as one per game or document. Every hub is
+// configured with the Options given to NewHubManager, plus its own from
+// NewHubManagerFunc, and is running by the time Hub returns it.
+type HubManager struct {
+	opts        []Option
+	idleTimeout time.Duration // How long a hub may go without clients, 0 to keep hubs forever
+	mu          sync.Mutex    // Guards hubs and closed
+	hubs        map[string]*managedHub
+	quotas      map[string]HubQuota // Per-hub overrides set with SetQuota
+	closed      bool
+	done        chan struct{} // Closed by Close to stop the janitor
+	closeOnce   sync.Once
+
+	perHub func(name string) []Option // Options of each hub, nil for none
+	logger Logger                     // Reports hubs that perHub made invalid
+}
+
+// managedHub is a hub and the bookkeeping used to expire it.
+type managedHub struct {
+	server   *Server
+	lastUsed time.Time // Last Hub call, or when the hub was last seen with clients
+}
+
+// NewHubManager returns a HubManager whose hubs are created with opts and
+// shut down after idleTimeout without any clients or Hub calls. An
+// idleTimeout of zero keeps hubs until Close. The options are validated
+// once, here, so Hub itself cannot fail; invalid options are reported in an
+// error wrapping ErrInvalidOption.
+//
+// As every hub gets the same options, they must not include WithBroker or
+// WithSink: the hubs would share one broker subscription or interleave
+// their events in one sink. Give each hub its own with NewHubManagerFunc.
+func NewHubManager(idleTimeout time.Duration, opts ...Option) (*HubManager, error) {
+	return NewHubManagerFunc(idleTimeout, nil, opts...)
+}
+
+// NewHubManagerFunc is NewHubManager with options of each hub's own, which
+// perHub returns given the hub's name and which apply after opts. They
+// carry what hubs must not share, such as a broker on a channel per hub or
+// a sink archiving to a file per hub:
+//
+//	hubs, err := gosse.NewHubManagerFunc(5*time.Minute, func(name string) []gosse.Option {
+//		return []gosse.Option{gosse.WithBroker(&redis.Broker{Client: rdb, Channel: "hub." + name})}
+//	})
+//
+// perHub is called once per hub created. Its options are only validated
+// then: Hub logs invalid ones and returns nil.
+func NewHubManagerFunc(idleTimeout time.Duration, perHub func(name string) []Option, opts ...Option) (*HubManager, error) {
+	if idleTimeout < 0 {
+		return nil, invalidOption("idleTimeout", idleTimeout, "must not be negative")
+	}
+	o, err := newOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if o.broker != nil {
+		return nil, invalidOption("WithBroker", "hub manager", "would be shared by every hub; return it from perHub with NewHubManagerFunc")
+	}
+	if o.sink != nil {
+		return nil, invalidOption("WithSink", "hub manager", "would be shared by every hub; return it from perHub with NewHubManagerFunc")
+	}
+	m := &HubManager{
+		opts:        opts,
+		perHub:      perHub,
+		logger:      o.logger,
+		idleTimeout: idleTimeout,
+		hubs:        make(map[string]*managedHub),
+		done:        make(chan struct{}),
+	}
+	if idleTimeout > 0 {
+		go m.janitor()
+	}
+	return m, nil
+}
+
+// Hub returns the running hub with the given name, creating it if needed.
+// Each call counts as activity, so a hub is never expired right after Hub
+// returns it. After Close, or if the options from NewHubManagerFunc's
+// perHub are invalid, Hub returns nil.
+func (m *HubManager) Hub(name string) *Server {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil
+	}
+	hub, ok := m.hubs[name]
+	if !ok {
+		opts := m.opts
+		if m.perHub != nil {
+			opts = append(opts[:len(opts):len(opts)], m.perHub(name)...)
+		}
+		if quota, ok := m.quotas[name]; ok {
+			opts = append(opts[:len(opts):len(opts)], quota.options()...)
+		}
+		server, err := New(opts...) // Validated by NewHubManager and SetQuota, except perHub's
+		if err != nil {
+			m.logger.Printf("gosse: error: hub %s not created: %v", name, err)
+			return nil
+		}
+		go server.Run()
+		hub = &managedHub{server: server}
+		m.hubs[name] = hub
+	}
+	hub.lastUsed = time.Now()
+	return hub.server
+}
+
+// Lookup returns the hub with the given name if it exists, without creating
+// it or counting as activity.
+func (m *HubManager) Lookup(name string) (*Server, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hub, ok := m.hubs[name]
+	if !ok {
+		return nil, false
+	}
+	return hub.server, true
+}
+
+// Names returns the names of the current hubs in sorted order.
+func (m *HubManager) Names() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.hubs))
+	for name := range m.hubs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Remove shuts down and forgets the hub with the given name, if any. A
+// later Hub call with the same name creates a fresh hub.
+func (m *HubManager) Remove(name string) {
+	m.mu.Lock()
+	hub, ok := m.hubs[name]
+	delete(m.hubs, name)
+	m.mu.Unlock()
+	if ok {
+		hub.server.Shutdown()
+	}
+}
+
+// Close shuts down every hub and stops expiring them. It is safe to call
+// Close more than once.
+func (m *HubManager) Close() {
+	m.closeOnce.Do(func() {
+		close(m.done)
+		m.mu.Lock()
+		hubs := m.hubs
+		m.hubs = make(map[string]*managedHub)
+		m.closed = true
+		m.mu.Unlock()
+		for _, hub := range hubs {
+			hub.server.Shutdown()
+		}
+	})
+}
+
+// janitor periodically expires idle hubs until Close is called.
+func (m *HubManager) janitor() {
+	interval := m.idleTimeout / 2
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			m.expire(now)
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// expire shuts down the hubs that have had no clients for idleTimeout.
+func (m *HubManager) expire(now time.Time) {
+	var idle []*Server
+	m.mu.Lock()
+	for name, hub := range m.hubs {
+		if hub.server.ClientCount() > 0 {
+			hub.lastUsed = now
+			continue
+		}
+		if now.Sub(hub.lastUsed) >= m.idleTimeout {
+			delete(m.hubs, name)
+			idle = append(idle, hub.server)
+		}
+	}
+	m.mu.Unlock()
+	for _, server := range idle {
+		server.Shutdown()
+	}
+}
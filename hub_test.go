@@ -0,0 +1,167 @@
+package gosse_test
+
+import (
+	"context"
+	"errors"
+	"github.com/Firoz01/gosse/v2"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHubManager_HubLifecycle(t *testing.T) {
+	manager, err := gosse.NewHubManager(30*time.Millisecond, gosse.WithBufferSize(4))
+	if err != nil {
+		t.Fatalf("Unexpected error creating manager: %v", err)
+	}
+	defer manager.Close()
+
+	game := manager.Hub("game-1")
+	if manager.Hub("game-1") != game {
+		t.Error("Expected the same hub for the same name")
+	}
+	idle := manager.Hub("game-2")
+	if names := manager.Names(); !reflect.DeepEqual(names, []string{"game-1", "game-2"}) {
+		t.Errorf("Expected both hubs, got %v", names)
+	}
+
+	// Hubs are running, so clients can join right away
+	client := game.AddClient()
+	if client == nil {
+		t.Fatal("Expected a client from the hub")
+	}
+
+	// The hub without clients expires; the busy one stays
+	time.Sleep(100 * time.Millisecond)
+	if _, ok := manager.Lookup("game-2"); ok {
+		t.Error("Expected the idle hub to expire")
+	}
+	if err := idle.BroadcastMessage([]byte("late")); !errors.Is(err, gosse.ErrServerClosed) {
+		t.Errorf("Expected the expired hub to be shut down, got %v", err)
+	}
+	if _, ok := manager.Lookup("game-1"); !ok {
+		t.Error("Expected the hub with a client to stay")
+	}
+
+	// Close shuts down every hub
+	manager.Close()
+	if _, ok := <-client.Messages(); ok {
+		t.Error("Expected the client's channel to be closed")
+	}
+	if manager.Hub("game-3") != nil {
+		t.Error("Expected no new hubs after Close")
+	}
+}
+
+func TestNewHubManager_InvalidOptions(t *testing.T) {
+	if _, err := gosse.NewHubManager(time.Minute, gosse.WithBufferSize(0)); !errors.Is(err, gosse.ErrInvalidOption) {
+		t.Errorf("Expected ErrInvalidOption, got %v", err)
+	}
+	if _, err := gosse.NewHubManager(-time.Minute); !errors.Is(err, gosse.ErrInvalidOption) {
+		t.Errorf("Expected ErrInvalidOption for a negative timeout, got %v", err)
+	}
+}
+
+func TestHubManager_Quotas(t *testing.T) {
+	manager, err := gosse.NewHubManager(0)
+	if err != nil {
+		t.Fatalf("Unexpected error creating manager: %v", err)
+	}
+	defer manager.Close()
+
+	if err := manager.SetQuota("noisy", gosse.HubQuota{MaxClients: 1, PublishRate: 0.001, PublishBurst: 2}); err != nil {
+		t.Fatalf("Unexpected error setting quota: %v", err)
+	}
+	noisy, quiet := manager.Hub("noisy"), manager.Hub("quiet")
+
+	for i := 0; i < 2; i++ {
+		if err := noisy.BroadcastMessage([]byte("burst")); err != nil {
+			t.Fatalf("Unexpected error within the burst: %v", err)
+		}
+	}
+	if err := noisy.Publish("news", []byte("over")); !errors.Is(err, gosse.ErrQuotaExceeded) {
+		t.Errorf("Expected ErrQuotaExceeded, got %v", err)
+	}
+	if _, err := noisy.AddClientContext(context.Background()); err != nil {
+		t.Fatalf("Unexpected error adding the first client: %v", err)
+	}
+	if _, err := noisy.AddClientContext(context.Background()); !errors.Is(err, gosse.ErrTooManyClients) {
+		t.Errorf("Expected ErrTooManyClients, got %v", err)
+	}
+
+	// Other tenants are unaffected
+	for i := 0; i < 10; i++ {
+		if err := quiet.BroadcastMessage([]byte("fine")); err != nil {
+			t.Fatalf("Unexpected error on another hub: %v", err)
+		}
+	}
+
+	// Quotas apply to running hubs, and invalid ones are rejected
+	if err := manager.SetQuota("noisy", gosse.HubQuota{}); err != nil {
+		t.Fatalf("Unexpected error lifting quota: %v", err)
+	}
+	if err := noisy.BroadcastMessage([]byte("lifted")); err != nil {
+		t.Errorf("Expected the lifted quota to admit publishes, got %v", err)
+	}
+	if err := manager.SetQuota("noisy", gosse.HubQuota{PublishRate: 5}); !errors.Is(err, gosse.ErrInvalidOption) {
+		t.Errorf("Expected ErrInvalidOption for a rate without burst, got %v", err)
+	}
+}
+
+func TestHubManager_PerHubOptions(t *testing.T) {
+	if _, err := gosse.NewHubManager(0, gosse.WithBroker(gosse.NewMemoryBroker().Connect())); !errors.Is(err, gosse.ErrInvalidOption) {
+		t.Errorf("Expected ErrInvalidOption for a broker shared by every hub, got %v", err)
+	}
+
+	// Two replicas, whose hubs of the same name share a broker
+	var mu sync.Mutex
+	brokers := make(map[string]*gosse.MemoryBroker)
+	perHub := func(name string) []gosse.Option {
+		if name == "invalid" {
+			return []gosse.Option{gosse.WithBufferSize(-1)}
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if brokers[name] == nil {
+			brokers[name] = gosse.NewMemoryBroker()
+		}
+		return []gosse.Option{gosse.WithBroker(brokers[name].Connect())}
+	}
+	replicas := make([]*gosse.HubManager, 2)
+	for i := range replicas {
+		manager, err := gosse.NewHubManagerFunc(0, perHub)
+		if err != nil {
+			t.Fatalf("Unexpected error creating manager: %v", err)
+		}
+		defer manager.Close()
+		replicas[i] = manager
+	}
+
+	game1, err := replicas[1].Hub("game-1").AddClientContext(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error adding a client: %v", err)
+	}
+	game2, err := replicas[1].Hub("game-2").AddClientContext(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error adding a client: %v", err)
+	}
+	_ = replicas[0].Hub("game-1").BroadcastMessage([]byte("move"))
+	select {
+	case ev := <-game1.Messages():
+		if string(ev.Data) != "move" {
+			t.Errorf("Expected the move, got %q", ev.Data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for the other replica's event")
+	}
+	select {
+	case ev := <-game2.Messages():
+		t.Errorf("Expected other hubs to get nothing, got %q", ev.Data)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	if hub := replicas[0].Hub("invalid"); hub != nil {
+		t.Error("Expected no hub for invalid per-hub options")
+	}
+}
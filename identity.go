@@ -0,0 +1,93 @@
+package gosse
+
+import (
+	"sort"
+	"sync"
+)
+
+// identity is the state shared by the connections of one identity (see
+// WithHandlerCoalescing).
+type identity struct {
+	name  string
+	conns int // Live connections, guarded by Server.identitiesM
+
+	mu     sync.Mutex
+	replay identityReplay // The last replay computed for one of the connections
+}
+
+// identityReplay caches what the history returned for one Last-Event-ID, so
+// tabs reconnecting together after a network blip share one history scan.
+type identityReplay struct {
+	from, newest uint64
+	events       []Event
+	complete     bool
+}
+
+// IdentityInfo describes the live connections of one identity.
+type IdentityInfo struct {
+	Identity    string
+	Connections int
+}
+
+// joinIdentity records a new connection of the identity name and returns
+// its shared state.
+func (s *Server) joinIdentity(name string) *identity {
+	s.identitiesM.Lock()
+	defer s.identitiesM.Unlock()
+	if s.identities == nil {
+		s.identities = make(map[string]*identity)
+	}
+	id, ok := s.identities[name]
+	if !ok {
+		id = &identity{name: name}
+		s.identities[name] = id
+	}
+	id.conns++
+	if id.conns > 1 {
+		s.logf(LevelDebug, "identity %s has %d connections, sharing their replays", name, id.conns)
+	}
+	return id
+}
+
+// leaveIdentity records that a connection of the identity name ended,
+// forgetting the identity with its last connection.
+func (s *Server) leaveIdentity(name string) {
+	s.identitiesM.Lock()
+	defer s.identitiesM.Unlock()
+	if id, ok := s.identities[name]; ok {
+		if id.conns--; id.conns == 0 {
+			delete(s.identities, name)
+		}
+	}
+}
+
+// Identities returns the identities with live coalesced connections, sorted
+// by name. An identity with more than one connection is typically a user
+// with several tabs open.
+func (s *Server) Identities() []IdentityInfo {
+	if s == nil {
+		return nil
+	}
+	s.identitiesM.Lock()
+	infos := make([]IdentityInfo, 0, len(s.identities))
+	for name, id := range s.identities {
+		infos = append(infos, IdentityInfo{Identity: name, Connections: id.conns})
+	}
+	s.identitiesM.Unlock()
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Identity < infos[j].Identity })
+	return infos
+}
+
+// since is history.since, reusing the result computed for another connection
+// of the identity if it asked for the same events and none were appended
+// since.
+func (id *identity) since(h *history, seq uint64) (events []Event, newest uint64, complete bool) {
+	id.mu.Lock()
+	defer id.mu.Unlock()
+	if r := id.replay; r.from == seq && r.newest == h.newest() && r.newest != 0 {
+		return r.events, r.newest, r.complete
+	}
+	events, newest, complete = h.since(seq)
+	id.replay = identityReplay{from: seq, newest: newest, events: events, complete: complete}
+	return events, newest, complete
+}
@@ -0,0 +1,55 @@
+package gosse
+
+import "time"
+
+// WithIdleTimeout disconnects clients that nothing has been delivered to
+// for timeout, such as streams left open by sleeping laptops, abandoned
+// tabs behind proxies that never report the connection closed and stalled
+// connections whose buffer still takes events. For clients streamed by a
+// Handler, only events successfully written to the stream count; for
+// clients read directly through Client.Messages, events queued for them
+// (see Client.LastActiveAt). The clients' channels are closed and they are
+// reported with DisconnectIdle, to the WithOnDisconnect hook among others.
+// Heartbeats do not count as deliveries, so on quiet streams the timeout
+// must exceed the longest gap between events. Clients are checked every
+// timeout/2, at most every minute. Zero, the default, never disconnects
+// idle clients.
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(o *options) error {
+		if timeout < 0 {
+			return invalidOption("WithIdleTimeout", timeout, "must not be negative")
+		}
+		o.idleTimeout = timeout
+		return nil
+	}
+}
+
+// watchIdle disconnects idle clients until the server shuts down.
+func (s *Server) watchIdle() {
+	ticker := time.NewTicker(sweepInterval(s.opts.idleTimeout))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.reapIdle(s.opts.now())
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// reapIdle disconnects the clients idle for longer than WithIdleTimeout at
+// now. Like evict, it closes them right away and leaves the map entry and
+// count to the Run loop.
+func (s *Server) reapIdle(now time.Time) {
+	s.rangeClients(func(client *Client) bool {
+		idle := now.Sub(client.lastDelivery())
+		if idle < s.opts.idleTimeout {
+			return true
+		}
+		s.logf(LevelInfo, "disconnecting client %s: idle for %s", client.ID, idle.Round(time.Millisecond))
+		client.close(DisconnectIdle)
+		go s.RemoveClient(client.ID)
+		return true
+	})
+}
@@ -0,0 +1,115 @@
+package gosse
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync/atomic"
+)
+
+// InstanceID returns the identifier of this server instance, set with
+// WithInstanceID. It defaults to the host name, the process ID and a random
+// suffix, so that several servers in a deployment, or in one process, can
+// be told apart.
+func (s *Server) InstanceID() string {
+	if s == nil {
+		return ""
+	}
+	s.init()
+	return s.opts.instanceID
+}
+
+// Labels returns a copy of the labels set with WithLabels, or nil if there
+// are none.
+func (s *Server) Labels() map[string]string {
+	if s == nil {
+		return nil
+	}
+	s.init()
+	if len(s.opts.labels) == 0 {
+		return nil
+	}
+	labels := make(map[string]string, len(s.opts.labels))
+	for k, v := range s.opts.labels {
+		labels[k] = v
+	}
+	return labels
+}
+
+// WithInstanceID names this server instance, for attributing events and
+// statistics in multi-instance deployments. The default is the host name,
+// the process ID and a random suffix, which differs between the servers of
+// one process, such as those sharing a MemoryBroker, but also between
+// restarts.
+func WithInstanceID(id string) Option {
+	return func(o *options) error {
+		if id == "" {
+			return invalidOption("WithInstanceID", `""`, "must not be empty")
+		}
+		o.instanceID = id
+		return nil
+	}
+}
+
+// WithLabels attaches descriptive labels, such as region or deployment, to
+// the server instance. Label names must be usable as metric label names:
+// letters, digits and underscores, not starting with a digit. Labels from
+// repeated WithLabels options are merged.
+func WithLabels(labels map[string]string) Option {
+	return func(o *options) error {
+		names := make([]string, 0, len(labels))
+		for name := range labels {
+			names = append(names, name)
+		}
+		sort.Strings(names) // Report problems in a stable order
+		for _, name := range names {
+			if !validLabelName(name) {
+				return invalidOption("WithLabels", name, "label names must match [a-zA-Z_][a-zA-Z0-9_]*")
+			}
+		}
+		if o.labels == nil {
+			o.labels = make(map[string]string, len(labels))
+		}
+		for name, value := range labels {
+			o.labels[name] = value
+		}
+		return nil
+	}
+}
+
+// validLabelName reports whether name is a valid metric label name.
+func validLabelName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// instanceCounter numbers the default instance IDs of a process when
+// randReader fails.
+var instanceCounter uint32
+
+// defaultInstanceID identifies one server: host name, process ID and a
+// suffix telling apart the servers of the process, which would otherwise
+// drop each other's events as their own (see WithBroker).
+func defaultInstanceID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "gosse"
+	}
+	suffix := make([]byte, 4)
+	if _, err := io.ReadFull(randReader, suffix); err != nil {
+		binary.BigEndian.PutUint32(suffix, atomic.AddUint32(&instanceCounter, 1))
+	}
+	return fmt.Sprintf("%s-%d-%x", host, os.Getpid(), suffix)
+}
@@ -0,0 +1,60 @@
+package gosse
+
+import "fmt"
+
+// LogLevel filters the messages written to the server's Logger.
+type LogLevel int
+
+const (
+	LevelDebug LogLevel = iota - 1 // Per-message decisions such as drops
+	LevelInfo                      // Lifecycle events; the default
+	LevelWarn                      // Recoverable problems such as evictions
+	LevelError                     // Failures that need attention
+	LevelOff                       // Nothing is logged
+)
+
+// logLevelNames maps levels to the names used by String and UnmarshalText.
+var logLevelNames = map[LogLevel]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+	LevelOff:   "off",
+}
+
+// String returns the level's name.
+func (l LogLevel) String() string {
+	if name, ok := logLevelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("LogLevel(%d)", int(l))
+}
+
+// MarshalText implements encoding.TextMarshaler using the level's name.
+func (l LogLevel) MarshalText() ([]byte, error) {
+	if _, ok := logLevelNames[l]; !ok {
+		return nil, invalidOption("log_level", int(l), "unknown level")
+	}
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, accepting the names
+// returned by String.
+func (l *LogLevel) UnmarshalText(text []byte) error {
+	for level, name := range logLevelNames {
+		if name == string(text) {
+			*l = level
+			return nil
+		}
+	}
+	return invalidOption("log_level", string(text), "want debug, info, warn, error or off")
+}
+
+// logf writes a message to the configured Logger if level is enabled.
+func (s *Server) logf(level LogLevel, format string, v ...interface{}) {
+	t := s.tunables()
+	if level < t.logLevel {
+		return
+	}
+	s.opts.logger.Printf("gosse: "+level.String()+": "+format, v...)
+}
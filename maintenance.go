@@ -0,0 +1,89 @@
+package gosse
+
+import (
+	"errors"
+	"fmt"
+)
+
+// maintenance describes the server's maintenance mode.
+type maintenance struct {
+	active  bool
+	message string
+	paused  bool // Publishes are rejected
+}
+
+// err builds the error returned to callers turned away by maintenance mode.
+func (m maintenance) err() error {
+	return fmt.Errorf("%w: %s", ErrMaintenance, m.message)
+}
+
+// EnterMaintenance puts the server into maintenance mode: msg is broadcast
+// to every connected client, and new clients are turned away with an error
+// wrapping ErrMaintenance, which SSEHandlerEndpoint answers with 503 Service
+// Unavailable. Connected clients stay connected. If pausePublishes is true,
+// publishes such as BroadcastMessage also fail with ErrMaintenance until
+// ExitMaintenance is called.
+//
+// Calling EnterMaintenance again replaces the message and the pause setting
+// and broadcasts the new message. The returned error reports failed
+// deliveries of msg like BroadcastMessage does.
+func (s *Server) EnterMaintenance(msg string, pausePublishes bool) error {
+	if s == nil {
+		return ErrNilServer
+	}
+	s.init()
+	s.stateM.Lock()
+	if s.state == stateClosed {
+		s.stateM.Unlock()
+		return ErrServerClosed
+	}
+	s.maintenance = maintenance{active: true, message: msg, paused: pausePublishes}
+	s.stateM.Unlock()
+
+	s.stateM.RLock()
+	defer s.stateM.RUnlock()
+	if s.state == stateClosed {
+		return ErrServerClosed
+	}
+	s.logf(LevelWarn, "entering maintenance: %s", msg)
+	return errors.Join(s.broadcast(Event{Data: []byte(msg)}, false).errs...) // Everyone should see the notice
+}
+
+// ExitMaintenance leaves maintenance mode, admitting new clients and
+// publishes again. It does nothing if the server is not in maintenance mode.
+func (s *Server) ExitMaintenance() {
+	if s == nil {
+		return
+	}
+	s.stateM.Lock()
+	defer s.stateM.Unlock()
+	if s.maintenance.active {
+		s.logf(LevelInfo, "leaving maintenance")
+	}
+	s.maintenance = maintenance{}
+}
+
+// Maintenance reports whether the server is in maintenance mode, and with
+// which message.
+func (s *Server) Maintenance() (msg string, active bool) {
+	if s == nil {
+		return "", false
+	}
+	s.stateM.RLock()
+	defer s.stateM.RUnlock()
+	return s.maintenance.message, s.maintenance.active
+}
+
+// admitError returns the error for a client turned away by maintenance
+// mode or the standby, or nil if clients are admitted.
+func (s *Server) admitError() error {
+	s.stateM.RLock()
+	defer s.stateM.RUnlock()
+	if s.maintenance.active {
+		return s.maintenance.err()
+	}
+	if s.standby {
+		return standbyError()
+	}
+	return nil
+}
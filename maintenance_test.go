@@ -0,0 +1,67 @@
+package gosse_test
+
+import (
+	"context"
+	"errors"
+	"github.com/Firoz01/gosse/v2"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServer_Maintenance(t *testing.T) {
+	server := gosse.NewServer()
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	client := server.AddClient()
+	if err := server.EnterMaintenance("upgrading, back soon", true); err != nil {
+		t.Fatalf("Unexpected error entering maintenance: %v", err)
+	}
+
+	// Connected clients are told, and stay connected
+	if ev := <-client.Messages(); string(ev.Data) != "upgrading, back soon" {
+		t.Errorf("Expected the maintenance message, got %q", ev.Data)
+	}
+	if msg, ok := server.Maintenance(); !ok || msg != "upgrading, back soon" {
+		t.Errorf("Expected maintenance mode, got %q, %v", msg, ok)
+	}
+
+	// New clients and paused publishes are turned away
+	if _, err := server.AddClientContext(context.Background()); !errors.Is(err, gosse.ErrMaintenance) {
+		t.Errorf("Expected ErrMaintenance adding a client, got %v", err)
+	}
+	if err := server.BroadcastMessage([]byte("news")); !errors.Is(err, gosse.ErrMaintenance) {
+		t.Errorf("Expected ErrMaintenance broadcasting, got %v", err)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gosse.SSEHandlerEndpoint(server, w, r)
+	}))
+	defer ts.Close()
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || !strings.Contains(string(body), "upgrading") {
+		t.Errorf("Expected 503 with the maintenance message, got %s %q", resp.Status, body)
+	}
+
+	// Leaving maintenance restores normal operation
+	server.ExitMaintenance()
+	if _, ok := server.Maintenance(); ok {
+		t.Error("Expected maintenance mode to be over")
+	}
+	if err := server.BroadcastMessage([]byte("news")); err != nil {
+		t.Errorf("Unexpected error broadcasting: %v", err)
+	}
+	if server.AddClient() == nil {
+		t.Error("Expected new clients to be admitted again")
+	}
+}
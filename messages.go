@@ -0,0 +1,80 @@
+package gosse
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// BroadcastJSON sends v, encoded as JSON, to every client like
+// BroadcastMessage. v is encoded once and the SSE frame is formatted once
+// for all the handlers' streams, which matters when a struct goes out to
+// thousands of clients. It reports the encoding error, or errors like
+// BroadcastMessage.
+func (s *Server) BroadcastJSON(v any) error {
+	if s == nil {
+		return ErrNilServer
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("broadcast JSON: %w", err)
+	}
+	return s.broadcastEvent(Event{Data: data, shared: &sharedFrame{}})
+}
+
+// SendJSONToClient sends v, encoded as JSON, to one client like
+// SendMessageToClient. It reports the encoding error, or errors like
+// SendMessageToClient.
+func (s *Server) SendJSONToClient(clientID string, v any) error {
+	if s == nil {
+		return ErrNilServer
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("send JSON to client %s: %w", clientID, err)
+	}
+	return s.sendEvent(clientID, Event{Data: data})
+}
+
+// NotificationLevel is the severity of a notification built with Notify.
+type NotificationLevel string
+
+// Notification levels, from least to most urgent.
+const (
+	NotifyInfo    NotificationLevel = "info"
+	NotifySuccess NotificationLevel = "success"
+	NotifyWarning NotificationLevel = "warning"
+	NotifyError   NotificationLevel = "error"
+)
+
+// Notify returns the payload of a user-facing notification, ready for
+// BroadcastMessage, Publish or SendMessageToClient:
+//
+//	{"type":"notification","title":"Saved","body":"All changes saved","level":"success"}
+func Notify(title, body string, level NotificationLevel) []byte {
+	data, _ := json.Marshal(struct {
+		Type  string            `json:"type"`
+		Title string            `json:"title"`
+		Body  string            `json:"body,omitempty"`
+		Level NotificationLevel `json:"level"`
+	}{"notification", title, body, level})
+	return data
+}
+
+// Progress returns the payload of a progress update for the task with the
+// given ID, with percent clamped to 0-100 and a done flag at 100:
+//
+//	{"type":"progress","id":"export-7","percent":42.5,"done":false}
+func Progress(id string, percent float64) []byte {
+	if math.IsNaN(percent) {
+		percent = 0
+	}
+	percent = math.Max(0, math.Min(100, percent))
+	data, _ := json.Marshal(struct {
+		Type    string  `json:"type"`
+		ID      string  `json:"id"`
+		Percent float64 `json:"percent"`
+		Done    bool    `json:"done"`
+	}{"progress", id, percent, percent == 100})
+	return data
+}
@@ -0,0 +1,23 @@
+package gosse_test
+
+import (
+	"github.com/Firoz01/gosse/v2"
+	"testing"
+)
+
+func TestMessageBuilders(t *testing.T) {
+	for _, tc := range []struct {
+		got  []byte
+		want string
+	}{
+		{gosse.Notify("Saved", "All changes saved", gosse.NotifySuccess), `{"type":"notification","title":"Saved","body":"All changes saved","level":"success"}`},
+		{gosse.Notify("Heads up", "", gosse.NotifyWarning), `{"type":"notification","title":"Heads up","level":"warning"}`},
+		{gosse.Progress("export-7", 42.5), `{"type":"progress","id":"export-7","percent":42.5,"done":false}`},
+		{gosse.Progress("export-7", 120), `{"type":"progress","id":"export-7","percent":100,"done":true}`},
+		{gosse.Progress("export-7", -3), `{"type":"progress","id":"export-7","percent":0,"done":false}`},
+	} {
+		if string(tc.got) != tc.want {
+			t.Errorf("Expected %s, got %s", tc.want, tc.got)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package gosse
+
+import "net/http"
+
+// SetMetadata attaches value to the client under key, such as a user ID,
+// tenant or locale, or removes key if value is "". Metadata lets the
+// application find its clients again, with Metadata and
+// BroadcastMessageWhere, without keeping a map of its own. It is safe to
+// call concurrently with deliveries.
+func (c *Client) SetMetadata(key, value string) {
+	// BroadcastMessageWhere predicates read the metadata of every client
+	// without metadataM, so the map they load is never written to; each
+	// change stores a new one
+	c.metadataM.Lock()
+	defer c.metadataM.Unlock()
+	next := make(map[string]string)
+	if current := c.metadata.Load(); current != nil {
+		for k, v := range *current {
+			next[k] = v
+		}
+	}
+	if value == "" {
+		delete(next, key)
+	} else {
+		next[key] = value
+	}
+	c.metadata.Store(&next)
+}
+
+// MetadataValue returns the client's metadata under key, or "" if it has
+// none.
+func (c *Client) MetadataValue(key string) string {
+	metadata := c.metadata.Load()
+	if metadata == nil {
+		return ""
+	}
+	return (*metadata)[key]
+}
+
+// Metadata returns a copy of the client's metadata, or nil if it has none.
+func (c *Client) Metadata() map[string]string {
+	metadata := c.metadata.Load()
+	if metadata == nil || len(*metadata) == 0 {
+		return nil
+	}
+	copied := make(map[string]string, len(*metadata))
+	for k, v := range *metadata {
+		copied[k] = v
+	}
+	return copied
+}
+
+// WithHandlerMetadata sets the metadata of each client (see
+// Client.SetMetadata) from its request before the client is registered,
+// so targeted broadcasts reach it from its first event. metadata runs
+// after the auth hook, so it can rely on what that established.
+func WithHandlerMetadata(metadata func(r *http.Request) map[string]string) HandlerOption {
+	return func(h *Handler) error {
+		if metadata == nil {
+			return invalidOption("WithHandlerMetadata", "nil", "must not be nil")
+		}
+		h.metadata = metadata
+		return nil
+	}
+}
+
+// BroadcastMessageWhere sends msg, like BroadcastMessage, to the clients
+// whose metadata under key is value, for example every client of one
+// tenant. Clients that set a filter (see Client.SetFilter) must also match
+// it. The message is not kept in the history, as a replay could not tell
+// who it was for. It reports errors like BroadcastMessage, and one
+// wrapping ErrInvalidOption if key or value is empty.
+func (s *Server) BroadcastMessageWhere(key, value string, msg []byte) error {
+	if s == nil {
+		return ErrNilServer
+	}
+	return s.broadcastWhere(key, value, Event{Data: msg})
+}
+
+// BroadcastEventWhere is BroadcastMessageWhere for an event with its ID,
+// Name and Retry written as the frame's fields (see BroadcastEvent).
+func (s *Server) BroadcastEventWhere(key, value string, ev Event) error {
+	if s == nil {
+		return ErrNilServer
+	}
+	if err := ev.validate(); err != nil {
+		return err
+	}
+	return s.broadcastWhere(key, value, Event{Data: ev.Data, ID: ev.ID, Name: ev.Name, Retry: ev.Retry, Schema: ev.Schema, Fields: ev.Fields, Trace: ev.Trace})
+}
+
+// broadcastWhere delivers ev to the clients whose metadata under key is
+// value.
+func (s *Server) broadcastWhere(key, value string, ev Event) error {
+	if key == "" || value == "" {
+		return invalidOption("metadata", key+"="+value, "key and value must not be empty")
+	}
+	return s.broadcastMatching(ev, func(client *Client) bool {
+		return client.MetadataValue(key) == value
+	})
+}
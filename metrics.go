@@ -0,0 +1,348 @@
+package gosse
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// OtherTopics is the topic name under which Metrics aggregates the topics
+// beyond the limit set with WithMetricsTopicLimit.
+const OtherTopics = "_other"
+
+// defaultMetricsTopicLimit is the number of topics tracked individually
+// when WithMetricsTopicLimit is not set.
+const defaultMetricsTopicLimit = 100
+
+// Metrics is a snapshot of the server's counters. Counters only grow over
+// the server's lifetime; Clients and Subscribers are current values.
+type Metrics struct {
+	Clients   int    // Connected clients.
+	Published uint64 // Events published with BroadcastMessage, Publish or a targeted send.
+	Delivered uint64 // Events queued for a client.
+	Dropped   uint64 // Events lost to a full buffer, whether rejected or discarded to make room.
+
+	// Connects counts the clients that have been added, which with
+	// Disconnects gives the connect and disconnect rates.
+	Connects uint64
+
+	// ConnectFailures counts clients that could not be added, for example
+	// because of WithMaxClients or maintenance mode.
+	ConnectFailures uint64
+
+	// Disconnects counts the clients that have left, by reason.
+	Disconnects map[DisconnectReason]uint64
+
+	// SinkDropped counts the published events the sink set with WithSink
+	// never received.
+	SinkDropped uint64
+
+	// EventSizes is the distribution of the published events' payload
+	// sizes, to size buffers and limits from real traffic.
+	EventSizes SizeHistogram
+
+	// BytesWritten counts the bytes of the frames Handlers have written to
+	// streams, before any compression.
+	BytesWritten uint64
+
+	// FlushLatency is the distribution of the time Handlers take to write
+	// and flush one frame, which grows when clients or the network cannot
+	// keep up.
+	FlushLatency LatencyHistogram
+
+	// Topics breaks the counters down by topic. Only the first topics seen,
+	// up to the limit set with WithMetricsTopicLimit, are listed by name;
+	// the rest are added up under OtherTopics.
+	Topics map[string]TopicMetrics
+
+	// TopicAliases counts the use of each alias set with AddTopicAlias,
+	// by alias name.
+	TopicAliases map[string]AliasMetrics
+}
+
+// eventSizeBounds are the upper bounds, in bytes, of the buckets of
+// Metrics.EventSizes.
+var eventSizeBounds = [...]int{64, 256, 1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20}
+
+// SizeHistogram is a histogram of sizes in bytes, laid out like a
+// Prometheus histogram.
+type SizeHistogram struct {
+	Bounds []int    // Upper bounds of the buckets, ascending.
+	Counts []uint64 // Counts[i] is the number of sizes up to Bounds[i], so the counts are cumulative.
+	Count  uint64   // Number of sizes observed, including those above every bound.
+	Sum    uint64   // Sum of the sizes observed.
+}
+
+// flushLatencyBounds are the upper bounds of the buckets of
+// Metrics.FlushLatency.
+var flushLatencyBounds = [...]time.Duration{
+	100 * time.Microsecond, time.Millisecond, 5 * time.Millisecond, 25 * time.Millisecond,
+	100 * time.Millisecond, 500 * time.Millisecond, 2500 * time.Millisecond,
+}
+
+// LatencyHistogram is a histogram of durations, laid out like a Prometheus
+// histogram.
+type LatencyHistogram struct {
+	Bounds []time.Duration // Upper bounds of the buckets, ascending.
+	Counts []uint64        // Counts[i] is the number of durations up to Bounds[i], so the counts are cumulative.
+	Count  uint64          // Number of durations observed, including those above every bound.
+	Sum    time.Duration   // Sum of the durations observed.
+}
+
+// TopicMetrics are the counters of a single topic.
+type TopicMetrics struct {
+	Publishes   uint64 // Publish calls for the topic.
+	Deliveries  uint64 // Events queued for the topic's subscribers.
+	Drops       uint64 // Topic events lost to full buffers.
+	Subscribers int64  // Connected clients subscribed to the topic.
+}
+
+// metrics holds the live counters behind Metrics. The zero value is ready
+// to use; counters are updated atomically.
+type metrics struct {
+	published uint64
+	delivered uint64
+	dropped   uint64
+
+	connectFailures uint64
+	sinkDropped     uint64
+
+	sizes    [len(eventSizeBounds) + 1]uint64 // Events per size bucket, the last one above every bound
+	sizesSum uint64
+
+	connects     uint64
+	bytesWritten uint64
+	flushes      [len(flushLatencyBounds) + 1]uint64 // Frames per latency bucket, the last one above every bound
+	flushSum     uint64                              // In nanoseconds
+
+	disconnectsM sync.Mutex
+	disconnects  map[DisconnectReason]uint64 // Guarded by disconnectsM
+
+	topics     sync.Map   // Topic name to *topicCounters
+	topicsM    sync.Mutex // Serializes adding topics so the limit holds
+	topicCount int        // Topics tracked by name, guarded by topicsM
+}
+
+// topicCounters are the live counters of one topic.
+type topicCounters struct {
+	publishes   uint64
+	deliveries  uint64
+	drops       uint64
+	subscribers int64
+}
+
+// topic returns the counters for name, or those of OtherTopics once limit
+// topics are tracked by name.
+func (m *metrics) topic(name string, limit int) *topicCounters {
+	if c, ok := m.topics.Load(name); ok {
+		return c.(*topicCounters)
+	}
+	m.topicsM.Lock()
+	defer m.topicsM.Unlock()
+	if c, ok := m.topics.Load(name); ok {
+		return c.(*topicCounters)
+	}
+	if m.topicCount >= limit {
+		name = OtherTopics
+		if c, ok := m.topics.Load(name); ok {
+			return c.(*topicCounters)
+		}
+	} else {
+		m.topicCount++
+	}
+	c := &topicCounters{}
+	m.topics.Store(name, c)
+	return c
+}
+
+// Metrics returns a snapshot of the server's counters.
+func (s *Server) Metrics() Metrics {
+	if s == nil {
+		return Metrics{}
+	}
+	m := Metrics{
+		Clients:   s.ClientCount(),
+		Published: atomic.LoadUint64(&s.metrics.published),
+		Delivered: atomic.LoadUint64(&s.metrics.delivered),
+		Dropped:   atomic.LoadUint64(&s.metrics.dropped),
+		Topics:    make(map[string]TopicMetrics),
+
+		Connects:        atomic.LoadUint64(&s.metrics.connects),
+		ConnectFailures: atomic.LoadUint64(&s.metrics.connectFailures),
+		SinkDropped:     atomic.LoadUint64(&s.metrics.sinkDropped),
+		BytesWritten:    atomic.LoadUint64(&s.metrics.bytesWritten),
+	}
+	m.TopicAliases = s.aliasMetrics()
+	m.EventSizes = s.metrics.eventSizes()
+	m.FlushLatency = s.metrics.flushLatency()
+	s.metrics.disconnectsM.Lock()
+	m.Disconnects = make(map[DisconnectReason]uint64, len(s.metrics.disconnects))
+	for reason, n := range s.metrics.disconnects {
+		m.Disconnects[reason] = n
+	}
+	s.metrics.disconnectsM.Unlock()
+	s.metrics.topics.Range(func(key, value interface{}) bool {
+		c := value.(*topicCounters)
+		m.Topics[key.(string)] = TopicMetrics{
+			Publishes:   atomic.LoadUint64(&c.publishes),
+			Deliveries:  atomic.LoadUint64(&c.deliveries),
+			Drops:       atomic.LoadUint64(&c.drops),
+			Subscribers: atomic.LoadInt64(&c.subscribers),
+		}
+		return true
+	})
+	return m
+}
+
+// ConnectionAges summarizes how long the connected clients have been
+// connected.
+type ConnectionAges struct {
+	Count int           // Connected clients.
+	P50   time.Duration // Median age.
+	P95   time.Duration // Age exceeded by only 5% of clients.
+	Max   time.Duration // Age of the oldest connection.
+}
+
+// ConnectionAges returns the distribution of the connected clients' ages,
+// which shows whether maximum connection ages and load balancer
+// rebalancing take effect: without them, the oldest connections date back
+// to the last deploy.
+func (s *Server) ConnectionAges() ConnectionAges {
+	if s == nil {
+		return ConnectionAges{}
+	}
+	s.init()
+	now := s.opts.now()
+	var ages []time.Duration
+	s.rangeClients(func(client *Client) bool {
+		ages = append(ages, now.Sub(client.ConnectedAt))
+		return true
+	})
+	if len(ages) == 0 {
+		return ConnectionAges{}
+	}
+	sort.Slice(ages, func(i, j int) bool { return ages[i] < ages[j] })
+	// Nearest-rank percentiles
+	rank := func(p int) time.Duration {
+		return ages[(len(ages)*p+99)/100-1]
+	}
+	return ConnectionAges{Count: len(ages), P50: rank(50), P95: rank(95), Max: ages[len(ages)-1]}
+}
+
+// WithMetricsTopicLimit sets how many topics Metrics breaks down by name,
+// which bounds the number of per-topic series a metrics exporter produces.
+// Topics beyond the limit are counted together under OtherTopics. The
+// default is 100.
+func WithMetricsTopicLimit(limit int) Option {
+	return func(o *options) error {
+		if limit < 1 {
+			return invalidOption("WithMetricsTopicLimit", limit, "must be at least 1")
+		}
+		o.metricsTopicLimit = limit
+		return nil
+	}
+}
+
+// countPublish records the publish of ev with its size, and for topic
+// events the topic's publish.
+func (s *Server) countPublish(ev Event) {
+	atomic.AddUint64(&s.metrics.published, 1)
+	s.metrics.countSize(len(ev.Data))
+	if ev.Topic != "" {
+		atomic.AddUint64(&s.metrics.topic(ev.Topic, s.opts.metricsTopicLimit).publishes, 1)
+	}
+}
+
+// countSize records an event of size bytes in the size histogram.
+func (m *metrics) countSize(size int) {
+	i := sort.SearchInts(eventSizeBounds[:], size)
+	atomic.AddUint64(&m.sizes[i], 1)
+	atomic.AddUint64(&m.sizesSum, uint64(size))
+}
+
+// eventSizes returns the size histogram with cumulative counts. Sizes
+// recorded while it runs may be missing from some of the totals.
+func (m *metrics) eventSizes() SizeHistogram {
+	h := SizeHistogram{
+		Bounds: append([]int(nil), eventSizeBounds[:]...),
+		Counts: make([]uint64, len(eventSizeBounds)),
+		Sum:    atomic.LoadUint64(&m.sizesSum),
+	}
+	var total uint64
+	for i := range eventSizeBounds {
+		total += atomic.LoadUint64(&m.sizes[i])
+		h.Counts[i] = total
+	}
+	h.Count = total + atomic.LoadUint64(&m.sizes[len(eventSizeBounds)])
+	return h
+}
+
+// countWrite records a frame of size bytes written and flushed in took.
+func (m *metrics) countWrite(size int, took time.Duration) {
+	atomic.AddUint64(&m.bytesWritten, uint64(size))
+	i := sort.Search(len(flushLatencyBounds), func(i int) bool { return flushLatencyBounds[i] >= took })
+	atomic.AddUint64(&m.flushes[i], 1)
+	atomic.AddUint64(&m.flushSum, uint64(took))
+}
+
+// flushLatency returns the flush latency histogram with cumulative counts,
+// like eventSizes.
+func (m *metrics) flushLatency() LatencyHistogram {
+	h := LatencyHistogram{
+		Bounds: append([]time.Duration(nil), flushLatencyBounds[:]...),
+		Counts: make([]uint64, len(flushLatencyBounds)),
+		Sum:    time.Duration(atomic.LoadUint64(&m.flushSum)),
+	}
+	var total uint64
+	for i := range flushLatencyBounds {
+		total += atomic.LoadUint64(&m.flushes[i])
+		h.Counts[i] = total
+	}
+	h.Count = total + atomic.LoadUint64(&m.flushes[len(flushLatencyBounds)])
+	return h
+}
+
+// countDelivery records ev as queued for a client.
+func (s *Server) countDelivery(ev Event) {
+	atomic.AddUint64(&s.metrics.delivered, 1)
+	if ev.Topic != "" {
+		atomic.AddUint64(&s.metrics.topic(ev.Topic, s.opts.metricsTopicLimit).deliveries, 1)
+	}
+}
+
+// countDrop records ev as lost to a full buffer.
+func (s *Server) countDrop(ev Event) {
+	atomic.AddUint64(&s.metrics.dropped, 1)
+	if ev.Topic != "" {
+		atomic.AddUint64(&s.metrics.topic(ev.Topic, s.opts.metricsTopicLimit).drops, 1)
+	}
+}
+
+// countConnect records a client added by the Run loop.
+func (s *Server) countConnect() {
+	atomic.AddUint64(&s.metrics.connects, 1)
+}
+
+// countConnectFailure records a client that could not be added.
+func (s *Server) countConnectFailure() {
+	atomic.AddUint64(&s.metrics.connectFailures, 1)
+}
+
+// countDisconnect records a client leaving for reason.
+func (s *Server) countDisconnect(reason DisconnectReason) {
+	s.metrics.disconnectsM.Lock()
+	defer s.metrics.disconnectsM.Unlock()
+	if s.metrics.disconnects == nil {
+		s.metrics.disconnects = make(map[DisconnectReason]uint64)
+	}
+	s.metrics.disconnects[reason]++
+}
+
+// countSubscribers adds delta to the subscriber count of each of the
+// client's topics.
+func (s *Server) countSubscribers(client *Client, delta int64) {
+	for topic := range client.topics {
+		atomic.AddInt64(&s.metrics.topic(topic, s.opts.metricsTopicLimit).subscribers, delta)
+	}
+}
@@ -0,0 +1,142 @@
+// Package metrics exports the counters of a gosse Server to Prometheus.
+//
+//	collector := metrics.NewCollector(server)
+//	prometheus.MustRegister(collector)
+//	http.Handle("/metrics", promhttp.Handler())
+//
+// Applications without a registry of their own serve Handler instead:
+//
+//	http.Handle("/metrics", metrics.Handler(server))
+//
+// Every series carries the server's instance ID and labels (see
+// gosse.WithInstanceID and gosse.WithLabels) as constant labels, so several
+// servers can be registered side by side.
+package metrics
+
+import (
+	"github.com/Firoz01/gosse/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+)
+
+// Collector is a prometheus.Collector reporting a Server's Metrics.
+type Collector struct {
+	server *gosse.Server
+
+	clients   *prometheus.Desc
+	published *prometheus.Desc
+	delivered *prometheus.Desc
+	dropped   *prometheus.Desc
+
+	connectFailures *prometheus.Desc
+	disconnects     *prometheus.Desc
+	eventSizes      *prometheus.Desc
+	sinkDropped     *prometheus.Desc
+
+	connects     *prometheus.Desc
+	bytesWritten *prometheus.Desc
+	flushLatency *prometheus.Desc
+
+	topicPublishes   *prometheus.Desc
+	topicDeliveries  *prometheus.Desc
+	topicDrops       *prometheus.Desc
+	topicSubscribers *prometheus.Desc
+
+	aliasPublishes  *prometheus.Desc
+	aliasDeliveries *prometheus.Desc
+}
+
+// NewCollector returns a Collector for server. Per-topic series are
+// labeled with the topic name; their number is bounded by
+// gosse.WithMetricsTopicLimit.
+func NewCollector(server *gosse.Server) *Collector {
+	constLabels := prometheus.Labels{"instance_id": server.InstanceID()}
+	for name, value := range server.Labels() {
+		constLabels[name] = value
+	}
+	desc := func(name, help string, labels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName("gosse", "", name), help, labels, constLabels)
+	}
+	return &Collector{
+		server:    server,
+		clients:   desc("clients", "Connected clients."),
+		published: desc("events_published_total", "Events published with BroadcastMessage, Publish or a targeted send."),
+		delivered: desc("events_delivered_total", "Events queued for a client."),
+		dropped:   desc("events_dropped_total", "Events lost to a full client buffer."),
+
+		connectFailures: desc("connect_failures_total", "Clients that could not be added."),
+		disconnects:     desc("disconnects_total", "Clients that have left, by reason.", "reason"),
+		eventSizes:      desc("event_size_bytes", "Payload sizes of published events."),
+		sinkDropped:     desc("sink_dropped_total", "Published events the archival sink never received."),
+
+		connects:     desc("connects_total", "Clients that have been added."),
+		bytesWritten: desc("bytes_written_total", "Frame bytes written to streams, before compression."),
+		flushLatency: desc("flush_latency_seconds", "Time to write and flush one frame to a stream."),
+
+		topicPublishes:   desc("topic_publishes_total", "Publish calls per topic.", "topic"),
+		topicDeliveries:  desc("topic_deliveries_total", "Topic events queued for subscribers.", "topic"),
+		topicDrops:       desc("topic_drops_total", "Topic events lost to full buffers.", "topic"),
+		topicSubscribers: desc("topic_subscribers", "Connected clients subscribed to the topic.", "topic"),
+
+		aliasPublishes:  desc("topic_alias_publishes_total", "Publishes to a topic alias.", "alias", "topic"),
+		aliasDeliveries: desc("topic_alias_deliveries_total", "Events queued for clients subscribed by a topic alias.", "alias", "topic"),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{
+		c.clients, c.published, c.delivered, c.dropped, c.connectFailures, c.disconnects, c.eventSizes, c.sinkDropped,
+		c.connects, c.bytesWritten, c.flushLatency,
+		c.topicPublishes, c.topicDeliveries, c.topicDrops, c.topicSubscribers,
+		c.aliasPublishes, c.aliasDeliveries,
+	} {
+		ch <- d
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	m := c.server.Metrics()
+	ch <- prometheus.MustNewConstMetric(c.clients, prometheus.GaugeValue, float64(m.Clients))
+	ch <- prometheus.MustNewConstMetric(c.published, prometheus.CounterValue, float64(m.Published))
+	ch <- prometheus.MustNewConstMetric(c.delivered, prometheus.CounterValue, float64(m.Delivered))
+	ch <- prometheus.MustNewConstMetric(c.dropped, prometheus.CounterValue, float64(m.Dropped))
+	ch <- prometheus.MustNewConstMetric(c.connectFailures, prometheus.CounterValue, float64(m.ConnectFailures))
+	ch <- prometheus.MustNewConstMetric(c.sinkDropped, prometheus.CounterValue, float64(m.SinkDropped))
+	ch <- prometheus.MustNewConstMetric(c.connects, prometheus.CounterValue, float64(m.Connects))
+	ch <- prometheus.MustNewConstMetric(c.bytesWritten, prometheus.CounterValue, float64(m.BytesWritten))
+	for reason, n := range m.Disconnects {
+		ch <- prometheus.MustNewConstMetric(c.disconnects, prometheus.CounterValue, float64(n), string(reason))
+	}
+	buckets := make(map[float64]uint64, len(m.EventSizes.Bounds))
+	for i, bound := range m.EventSizes.Bounds {
+		buckets[float64(bound)] = m.EventSizes.Counts[i]
+	}
+	ch <- prometheus.MustNewConstHistogram(c.eventSizes, m.EventSizes.Count, float64(m.EventSizes.Sum), buckets)
+	latencies := make(map[float64]uint64, len(m.FlushLatency.Bounds))
+	for i, bound := range m.FlushLatency.Bounds {
+		latencies[bound.Seconds()] = m.FlushLatency.Counts[i]
+	}
+	ch <- prometheus.MustNewConstHistogram(c.flushLatency, m.FlushLatency.Count, m.FlushLatency.Sum.Seconds(), latencies)
+	for topic, t := range m.Topics {
+		ch <- prometheus.MustNewConstMetric(c.topicPublishes, prometheus.CounterValue, float64(t.Publishes), topic)
+		ch <- prometheus.MustNewConstMetric(c.topicDeliveries, prometheus.CounterValue, float64(t.Deliveries), topic)
+		ch <- prometheus.MustNewConstMetric(c.topicDrops, prometheus.CounterValue, float64(t.Drops), topic)
+		ch <- prometheus.MustNewConstMetric(c.topicSubscribers, prometheus.GaugeValue, float64(t.Subscribers), topic)
+	}
+	for alias, a := range m.TopicAliases {
+		ch <- prometheus.MustNewConstMetric(c.aliasPublishes, prometheus.CounterValue, float64(a.Publishes), alias, a.Topic)
+		ch <- prometheus.MustNewConstMetric(c.aliasDeliveries, prometheus.CounterValue, float64(a.Deliveries), alias, a.Topic)
+	}
+}
+
+// Handler serves server's metrics in the Prometheus exposition format from
+// a registry of their own, for applications that do not register the
+// Collector with a registry they already serve.
+func Handler(server *gosse.Server) http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewCollector(server))
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,88 @@
+package metrics_test
+
+import (
+	"bufio"
+	"context"
+	"github.com/Firoz01/gosse/v2"
+	"github.com/Firoz01/gosse/v2/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCollector(t *testing.T) {
+	server := gosse.NewServer(
+		gosse.WithInstanceID("edge-1"),
+		gosse.WithLabels(map[string]string{"region": "eu"}),
+	)
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	if _, err := server.SubscribeContext(context.Background(), "news"); err != nil {
+		t.Fatalf("Unexpected error subscribing: %v", err)
+	}
+	_ = server.Publish("news", []byte("headline"))
+
+	expected := `
+# HELP gosse_events_published_total Events published with BroadcastMessage, Publish or a targeted send.
+# TYPE gosse_events_published_total counter
+gosse_events_published_total{instance_id="edge-1",region="eu"} 1
+# HELP gosse_event_size_bytes Payload sizes of published events.
+# TYPE gosse_event_size_bytes histogram
+gosse_event_size_bytes_bucket{instance_id="edge-1",region="eu",le="64"} 1
+gosse_event_size_bytes_bucket{instance_id="edge-1",region="eu",le="256"} 1
+gosse_event_size_bytes_bucket{instance_id="edge-1",region="eu",le="1024"} 1
+gosse_event_size_bytes_bucket{instance_id="edge-1",region="eu",le="4096"} 1
+gosse_event_size_bytes_bucket{instance_id="edge-1",region="eu",le="16384"} 1
+gosse_event_size_bytes_bucket{instance_id="edge-1",region="eu",le="65536"} 1
+gosse_event_size_bytes_bucket{instance_id="edge-1",region="eu",le="262144"} 1
+gosse_event_size_bytes_bucket{instance_id="edge-1",region="eu",le="1.048576e+06"} 1
+gosse_event_size_bytes_bucket{instance_id="edge-1",region="eu",le="+Inf"} 1
+gosse_event_size_bytes_sum{instance_id="edge-1",region="eu"} 8
+gosse_event_size_bytes_count{instance_id="edge-1",region="eu"} 1
+# HELP gosse_topic_subscribers Connected clients subscribed to the topic.
+# TYPE gosse_topic_subscribers gauge
+gosse_topic_subscribers{instance_id="edge-1",region="eu",topic="news"} 1
+`
+	err := testutil.CollectAndCompare(metrics.NewCollector(server), strings.NewReader(expected),
+		"gosse_events_published_total", "gosse_event_size_bytes", "gosse_topic_subscribers")
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	server := gosse.NewServer(gosse.WithAutoRun(), gosse.WithInstanceID("edge-1"))
+	defer server.Shutdown()
+	stream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gosse.SSEHandlerEndpoint(server, w, r)
+	}))
+	defer stream.Close()
+	resp, err := http.Get(stream.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	_ = server.BroadcastMessage([]byte("hello"))
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil || line != "data: hello\n" {
+		t.Fatalf("Expected the event, got %q (%v)", line, err)
+	}
+
+	rec := httptest.NewRecorder()
+	metrics.Handler(server).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		`gosse_connects_total{instance_id="edge-1"} 1`,
+		`gosse_bytes_written_total{instance_id="edge-1"} 13`,
+		`gosse_flush_latency_seconds_count{instance_id="edge-1"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %q in the exposition, got:\n%s", want, body)
+		}
+	}
+}
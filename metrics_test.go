@@ -0,0 +1,194 @@
+package gosse_test
+
+import (
+	"context"
+	"errors"
+	"github.com/Firoz01/gosse/v2"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestServer_MetricsPerTopic(t *testing.T) {
+	server := gosse.NewServer(gosse.WithBufferSize(1), gosse.WithMetricsTopicLimit(2))
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	for _, topic := range []string{"news", "sports", "weather"} {
+		if _, err := server.SubscribeContext(context.Background(), topic); err != nil {
+			t.Fatalf("Unexpected error subscribing to %s: %v", topic, err)
+		}
+	}
+
+	_ = server.Publish("news", []byte("one"))
+	_ = server.Publish("news", []byte("two")) // The buffer holds one event
+	_ = server.Publish("sports", []byte("goal"))
+	_ = server.Publish("weather", []byte("rain"))
+	_ = server.BroadcastMessage([]byte("hello")) // Every buffer is full
+
+	m := server.Metrics()
+	if m.Clients != 3 || m.Published != 5 || m.Delivered != 3 || m.Dropped != 4 {
+		t.Errorf("Unexpected totals %+v", m)
+	}
+	want := map[string]gosse.TopicMetrics{
+		"news":            {Publishes: 2, Deliveries: 1, Drops: 1, Subscribers: 1},
+		"sports":          {Publishes: 1, Deliveries: 1, Subscribers: 1},
+		gosse.OtherTopics: {Publishes: 1, Deliveries: 1, Subscribers: 1},
+	}
+	if len(m.Topics) != len(want) {
+		t.Errorf("Expected topics %v, got %v", want, m.Topics)
+	}
+	for topic, w := range want {
+		if got := m.Topics[topic]; got != w {
+			t.Errorf("Expected %+v for %s, got %+v", w, topic, got)
+		}
+	}
+}
+
+func TestServer_MetricsEventSizes(t *testing.T) {
+	server := gosse.NewServer(gosse.WithAutoRun())
+	defer server.Shutdown()
+
+	_ = server.BroadcastMessage(make([]byte, 10))
+	_ = server.Publish("news", make([]byte, 100))
+	_ = server.Publish("news", make([]byte, 2<<20)) // Above every bound
+
+	sizes := server.Metrics().EventSizes
+	if sizes.Count != 3 || sizes.Sum != 110+2<<20 {
+		t.Errorf("Expected 3 sizes adding up to %d, got %+v", 110+2<<20, sizes)
+	}
+	if sizes.Bounds[0] != 64 || sizes.Counts[0] != 1 || sizes.Counts[1] != 2 || sizes.Counts[len(sizes.Counts)-1] != 2 {
+		t.Errorf("Unexpected buckets %v %v", sizes.Bounds, sizes.Counts)
+	}
+}
+
+func TestServer_MetricsDisconnectReasons(t *testing.T) {
+	records := make(chan gosse.ClientInfo, 3)
+	server := gosse.NewServer(gosse.WithOnDisconnect(func(info gosse.ClientInfo) {
+		records <- info
+	}))
+
+	// Start the server
+	go server.Run()
+
+	revoked := server.AddClient()
+	removed := server.AddClient()
+	remaining := server.AddClient()
+
+	if err := server.RevokeClient(revoked.ID); err != nil {
+		t.Fatalf("Unexpected error revoking client: %v", err)
+	}
+	if err := server.RevokeClient("unknown"); !errors.Is(err, gosse.ErrClientNotFound) {
+		t.Errorf("Expected ErrClientNotFound, got %v", err)
+	}
+	server.RemoveClient(removed.ID)
+	server.Shutdown()
+
+	// The hook runs once each disconnect has been counted
+	for range []*gosse.Client{revoked, removed, remaining} {
+		select {
+		case <-records:
+		case <-time.After(time.Second):
+			t.Fatal("Timeout waiting for the OnDisconnect hook")
+		}
+	}
+
+	if reason := revoked.Info().Reason; reason != gosse.DisconnectAuthRevoked {
+		t.Errorf("Expected reason %q, got %q", gosse.DisconnectAuthRevoked, reason)
+	}
+	want := map[gosse.DisconnectReason]uint64{
+		gosse.DisconnectAuthRevoked:    1,
+		gosse.DisconnectClientRemoved:  1,
+		gosse.DisconnectServerShutdown: 1,
+	}
+	if got := server.Metrics().Disconnects; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected disconnects %v, got %v", want, got)
+	}
+}
+
+func TestServer_Alerts(t *testing.T) {
+	alerts := make(chan gosse.Alert, 10)
+	server := gosse.NewServer(
+		gosse.WithBufferSize(2),
+		gosse.WithMaxClients(1),
+		gosse.WithAlertInterval(10*time.Millisecond),
+		gosse.WithAlert(gosse.AlertQueueUtilization, 0.5, func(a gosse.Alert) { alerts <- a }),
+		gosse.WithAlert(gosse.AlertDropRate, 0.1, func(a gosse.Alert) { alerts <- a }),
+	)
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	next := func() gosse.Alert {
+		t.Helper()
+		select {
+		case a := <-alerts:
+			return a
+		case <-time.After(time.Second):
+			t.Fatal("Timeout waiting for an alert")
+			return gosse.Alert{}
+		}
+	}
+
+	client := server.AddClient()
+	_ = server.BroadcastMessage([]byte("one"))
+	_ = server.BroadcastMessage([]byte("two"))
+	if a := next(); a.Metric != gosse.AlertQueueUtilization || a.Value != 1 || a.Resolved {
+		t.Errorf("Expected a full queue alert, got %+v", a)
+	}
+
+	// Draining the buffer resolves the alert
+	<-client.Messages()
+	<-client.Messages()
+	if a := next(); a.Metric != gosse.AlertQueueUtilization || !a.Resolved {
+		t.Errorf("Expected the queue alert to resolve, got %+v", a)
+	}
+
+	// Failed connects are counted
+	if _, err := server.AddClientContext(context.Background()); !errors.Is(err, gosse.ErrTooManyClients) {
+		t.Errorf("Expected ErrTooManyClients, got %v", err)
+	}
+	if n := server.Metrics().ConnectFailures; n != 1 {
+		t.Errorf("Expected 1 connect failure, got %d", n)
+	}
+
+	_, err := gosse.New(gosse.WithAlert(gosse.AlertDropRate, 2, func(gosse.Alert) {}))
+	if !errors.Is(err, gosse.ErrInvalidOption) {
+		t.Errorf("Expected ErrInvalidOption for a drop rate above 1, got %v", err)
+	}
+}
+
+func TestServer_ConnectionAges(t *testing.T) {
+	var nowM sync.Mutex
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time {
+		nowM.Lock()
+		defer nowM.Unlock()
+		return now
+	}
+	server := gosse.NewServer(gosse.WithClock(clock))
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	if ages := server.ConnectionAges(); ages != (gosse.ConnectionAges{}) {
+		t.Errorf("Expected no ages without clients, got %+v", ages)
+	}
+
+	// Twenty clients connecting a minute apart
+	for i := 0; i < 20; i++ {
+		server.AddClient()
+		nowM.Lock()
+		now = now.Add(time.Minute)
+		nowM.Unlock()
+	}
+	want := gosse.ConnectionAges{Count: 20, P50: 10 * time.Minute, P95: 19 * time.Minute, Max: 20 * time.Minute}
+	if ages := server.ConnectionAges(); ages != want {
+		t.Errorf("Expected %+v, got %+v", want, ages)
+	}
+}
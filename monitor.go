@@ -0,0 +1,76 @@
+package gosse
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// monitorBufferSize is the buffer of each client watching the monitor
+// stream. Ops events are informational, so the oldest are dropped when a
+// watcher falls behind.
+const monitorBufferSize = 256
+
+// opsEvent is an operational event on the monitor stream.
+type opsEvent struct {
+	Type   string           `json:"type"` // connect, disconnect, drop, alert or probe_timeout
+	Time   time.Time        `json:"time"`
+	Client string           `json:"client,omitempty"`
+	Topic  string           `json:"topic,omitempty"`
+	Reason DisconnectReason `json:"reason,omitempty"`
+	Alert  *opsAlert        `json:"alert,omitempty"`
+}
+
+// opsAlert is the JSON form of an Alert.
+type opsAlert struct {
+	Metric    AlertMetric `json:"metric"`
+	Value     float64     `json:"value"`
+	Threshold float64     `json:"threshold"`
+	Resolved  bool        `json:"resolved"`
+}
+
+// monitorState is the hub behind the monitor stream. It is created the
+// first time someone watches, so servers that are never watched pay only
+// for an atomic load per ops event.
+type monitorState struct {
+	once sync.Once
+	hub  atomic.Pointer[Server]
+}
+
+// serveMonitor streams the server's ops events to the request. It is served
+// by AdminHandler under GET /stream, which has already checked the
+// request's authorization.
+func (s *Server) serveMonitor(w http.ResponseWriter, r *http.Request) {
+	s.init()
+	s.monitor.once.Do(func() {
+		hub := NewServer(
+			WithBufferSize(monitorBufferSize),
+			WithBackpressure(DropOldest),
+			WithHeartbeat(s.tunables().heartbeat),
+			WithWriteTimeout(s.opts.writeTimeout),
+		)
+		go hub.Run()
+		go func() {
+			<-s.done
+			hub.Shutdown()
+		}()
+		s.monitor.hub.Store(hub)
+	})
+	SSEHandlerEndpoint(s.monitor.hub.Load(), w, r)
+}
+
+// emitOps sends ev to everyone watching the monitor stream, if anyone is.
+func (s *Server) emitOps(ev opsEvent) {
+	hub := s.monitor.hub.Load()
+	if hub == nil || hub.ClientCount() == 0 {
+		return
+	}
+	ev.Time = s.opts.now()
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	_ = hub.BroadcastMessage(data) // Watchers drop their oldest events
+}
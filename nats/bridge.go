@@ -0,0 +1,120 @@
+// Package nats delivers the messages of NATS subjects to the clients of a
+// gosse server, so that a NATS-based backend can push updates to browsers
+// without glue code of its own:
+//
+//	bridge := nats.Bridge{Conn: nc, Subject: "updates.>", Topic: nats.TrimPrefix("updates.")}
+//	go bridge.Run(ctx, server)
+//
+// With the Topic mapping above, a message published to "updates.prices"
+// reaches the subscribers of the "prices" topic. Without a mapping, or for
+// subjects it maps to "", messages are broadcast to every client, like
+// gosse.Server.BroadcastMessage.
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Firoz01/gosse/v2"
+	natsgo "github.com/nats-io/nats.go"
+	"strings"
+)
+
+// Headers of a NATS message that set fields of the delivered event. Both
+// are optional.
+const (
+	HeaderEvent = "SSE-Event" // Event name, see gosse.Event.Name
+	HeaderKey   = "SSE-Key"   // Partition key, see gosse.Server.PublishKeyed
+)
+
+// Bridge subscribes to a NATS subject and delivers its messages to a local
+// server. The message data is the event's data.
+type Bridge struct {
+	Conn    *natsgo.Conn // Connection to NATS.
+	Subject string       // Subject to subscribe to; may contain wildcards such as "updates.>".
+	Queue   string       // Queue group to subscribe in, so that each message reaches one server of the group; empty for every server.
+
+	// Topic maps the subject of each message to the topic it is published
+	// to, or "" to broadcast it. Nil broadcasts every message.
+	Topic func(subject string) string
+
+	// OnError, if set, is called with messages the local server would not
+	// take, for example over its publish rate (see gosse.WithPublishRate),
+	// and with errors of the subscription that do not end it, such as
+	// messages NATS dropped because Run fell behind.
+	OnError func(error)
+}
+
+// TrimPrefix returns a Bridge.Topic mapping that publishes the messages of
+// subjects starting with prefix to the rest of the subject, and broadcasts
+// the others.
+func TrimPrefix(prefix string) func(subject string) string {
+	return func(subject string) string {
+		if !strings.HasPrefix(subject, prefix) {
+			return ""
+		}
+		return strings.TrimPrefix(subject, prefix)
+	}
+}
+
+// Run subscribes to the subject and delivers its messages to local until
+// ctx is done, the connection is closed or the local server shuts down,
+// which is noticed at the next message. It returns ctx.Err() wrapped with
+// context, gosse.ErrServerClosed, or the error that ended the
+// subscription. The NATS client resubscribes by itself after a reconnect;
+// messages published meanwhile are lost, as core NATS keeps nothing.
+func (b Bridge) Run(ctx context.Context, local *gosse.Server) error {
+	if local == nil {
+		return gosse.ErrNilServer
+	}
+	if b.Conn == nil || b.Subject == "" {
+		return fmt.Errorf("%w: Bridge needs a Conn and a Subject", gosse.ErrInvalidOption)
+	}
+	sub, err := b.Conn.QueueSubscribeSync(b.Subject, b.Queue)
+	if err != nil {
+		return fmt.Errorf("nats bridge: subscribe: %w", err)
+	}
+	defer sub.Unsubscribe()
+	// Wait for the subscription so messages sent once Run is up are not missed
+	if err := b.Conn.Flush(); err != nil {
+		return fmt.Errorf("nats bridge: subscribe: %w", err)
+	}
+	for {
+		msg, err := sub.NextMsgWithContext(ctx)
+		switch {
+		case ctx.Err() != nil:
+			return fmt.Errorf("nats bridge: %w", ctx.Err())
+		case errors.Is(err, natsgo.ErrSlowConsumer):
+			if b.OnError != nil {
+				b.OnError(fmt.Errorf("nats bridge: %w", err))
+			}
+			continue
+		case err != nil:
+			return fmt.Errorf("nats bridge: %w", err)
+		}
+		if err := b.deliver(local, msg); errors.Is(err, gosse.ErrServerClosed) {
+			return err
+		} else if err != nil && b.OnError != nil {
+			b.OnError(err)
+		}
+	}
+}
+
+// deliver hands msg to local.
+func (b Bridge) deliver(local *gosse.Server, msg *natsgo.Msg) error {
+	ev := gosse.Event{Data: msg.Data}
+	if msg.Header != nil {
+		ev.Name, ev.Key = msg.Header.Get(HeaderEvent), msg.Header.Get(HeaderKey)
+	}
+	if b.Topic != nil {
+		if topic := b.Topic(msg.Subject); topic != "" {
+			_, _, err := local.TryPublish(topic, ev)
+			return err
+		}
+	}
+	err := local.BroadcastEvent(gosse.Event{Data: ev.Data, Name: ev.Name})
+	if errors.Is(err, gosse.ErrClientNotReady) {
+		return nil // Full buffers are counted in the server's metrics
+	}
+	return err
+}
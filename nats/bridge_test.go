@@ -0,0 +1,84 @@
+package nats_test
+
+import (
+	"context"
+	"errors"
+	"github.com/Firoz01/gosse/v2"
+	"github.com/Firoz01/gosse/v2/nats"
+	natsserver "github.com/nats-io/nats-server/v2/test"
+	natsgo "github.com/nats-io/nats.go"
+	"testing"
+	"time"
+)
+
+func TestBridge(t *testing.T) {
+	ns := natsserver.RunRandClientPortServer()
+	defer ns.Shutdown()
+	nc, err := natsgo.Connect(ns.ClientURL())
+	if err != nil {
+		t.Fatalf("Unexpected error connecting: %v", err)
+	}
+	defer nc.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server := gosse.NewServer(gosse.WithAutoRun())
+	defer server.Shutdown()
+	subscriber, err := server.SubscribeContext(ctx, "prices")
+	if err != nil {
+		t.Fatalf("Unexpected error subscribing: %v", err)
+	}
+	other := server.AddClient()
+	bridge := nats.Bridge{Conn: nc, Subject: "*.>", Topic: nats.TrimPrefix("updates.")}
+	before := ns.NumSubscriptions()
+	done := make(chan error, 1)
+	go func() { done <- bridge.Run(ctx, server) }()
+	for deadline := time.Now().Add(time.Second); ns.NumSubscriptions() == before; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Timeout waiting for the bridge to subscribe")
+		}
+	}
+
+	if err := nc.Publish("updates.prices", []byte("42")); err != nil {
+		t.Fatalf("Unexpected error publishing: %v", err)
+	}
+	select {
+	case ev := <-subscriber.Messages():
+		if ev.Topic != "prices" || string(ev.Data) != "42" {
+			t.Errorf("Expected 42 on prices, got %q on %s", ev.Data, ev.Topic)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for the topic event")
+	}
+	select {
+	case ev := <-other.Messages():
+		t.Errorf("Expected the unsubscribed client to get nothing, got %q", ev.Data)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// Mapped to no topic, the message is broadcast with its event name
+	msg := natsgo.NewMsg("notices.all")
+	msg.Data = []byte("hi")
+	msg.Header.Set(nats.HeaderEvent, "notice")
+	if err := nc.PublishMsg(msg); err != nil {
+		t.Fatalf("Unexpected error publishing: %v", err)
+	}
+	for _, client := range []*gosse.Client{subscriber, other} {
+		select {
+		case ev := <-client.Messages():
+			if ev.Name != "notice" || string(ev.Data) != "hi" {
+				t.Errorf("Expected the notice, got %q named %q", ev.Data, ev.Name)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Timeout waiting for the broadcast")
+		}
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled once ctx is done, got %v", err)
+	}
+	if err := (nats.Bridge{}).Run(context.Background(), server); !errors.Is(err, gosse.ErrInvalidOption) {
+		t.Errorf("Expected ErrInvalidOption without a connection, got %v", err)
+	}
+}
@@ -0,0 +1,355 @@
+package gosse
+
+import (
+	"errors"
+	"time"
+)
+
+// Option configures a Server. Options are passed to NewServer and validated
+// when the server is created, so a misconfigured server fails at startup
+// rather than misbehaving later.
+type Option func(*options) error
+
+// options holds the configuration assembled from Options. A zero field means
+// "not set"; applyDefaults fills those in.
+type options struct {
+	bufferSize   int                    // Default buffer size for new clients
+	maxClients   int                    // Maximum number of connected clients, 0 for no limit
+	heartbeat    time.Duration          // Interval between keep-alive comments, 0 to disable
+	backpressure BackpressurePolicy     // What to do when a client's buffer is full
+	rateLimit    float64                // Events per second written to each client, 0 for no limit
+	rateBurst    int                    // Events a client may receive back to back before rateLimit applies
+	logger       Logger                 // Destination for diagnostic messages
+	logLevel     LogLevel               // Minimum level of messages passed to logger
+	now          func() time.Time       // Clock used for client timestamps
+	idGenerator  func() (string, error) // Custom client ID generator, nil for the built-in one
+	onConnect    func(ClientInfo)       // Called with each client once it is registered
+	onDisconnect func(ClientInfo)       // Called with each client's final record
+	onDropped    func(string, Event)    // Called with the client ID and event for every drop
+	instanceID   string                 // Identifies this server instance
+	labels       map[string]string      // Descriptive labels of this instance
+
+	metricsTopicLimit int           // Topics broken down by name in Metrics
+	writeTimeout      time.Duration // Deadline for writing one frame, 0 for none
+	alerts            []alertRule   // Thresholds checked by watchAlerts
+	alertInterval     time.Duration // How often the thresholds are checked
+	historySize       int           // Events kept for replay, 0 for none
+	autoRun           bool          // Start the Run loop in New
+	publishRate       float64       // Events per second accepted from publishers, 0 for no limit
+	publishBurst      int           // Events publishers may hand over back to back before publishRate applies
+
+	compaction map[string]struct{}      // Topics whose replays are compacted by key, empty for all, nil for none
+	retention  map[string]time.Duration // Longest kept age of events by name, nil for no limit
+
+	sink         Sink          // Receives a copy of every topic event, nil for none
+	sinkBatch    int           // Events per batch handed to sink
+	sinkFlush    time.Duration // Longest wait for a batch to fill
+	sinkAttempts int           // Tries per batch before it is dropped
+	sinkBackoff  time.Duration // Wait before the second try, doubled for each one after
+
+	farewell *Event // Written last to streams ended by a shutdown, nil for none
+
+	topicExpiry    time.Duration   // Idle time after which topic state is freed, 0 for never
+	onTopicExpired func(TopicInfo) // Called with each expired topic's last state
+
+	broker Broker // Relays events to and from other instances, nil to stand alone
+
+	idleTimeout time.Duration // Time without deliveries after which clients are disconnected, 0 for never
+	standby     bool          // Turn clients away until Promote
+
+	maxBufferedBytes int // Payload bytes streamed clients may hold queued before publishes are rejected, 0 for no limit
+}
+
+// applyDefaults fills in every setting that no Option has set.
+func (o *options) applyDefaults() {
+	if o.bufferSize == 0 {
+		o.bufferSize = defaultClientBufferSize
+	}
+	if o.logger == nil {
+		o.logger = nopLogger{}
+	}
+	if o.now == nil {
+		o.now = time.Now
+	}
+	if o.instanceID == "" {
+		o.instanceID = defaultInstanceID()
+	}
+	if o.metricsTopicLimit == 0 {
+		o.metricsTopicLimit = defaultMetricsTopicLimit
+	}
+	if o.alertInterval == 0 {
+		o.alertInterval = defaultAlertInterval
+	}
+	if o.sinkAttempts == 0 {
+		o.sinkAttempts = defaultSinkAttempts
+		o.sinkBackoff = defaultSinkBackoff
+	}
+}
+
+// newOptions applies opts on top of the defaults and returns every
+// validation error joined together.
+func newOptions(opts ...Option) (options, error) {
+	var o options
+	var errs []error
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if err := opt(&o); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	o.applyDefaults()
+	return o, errors.Join(errs...)
+}
+
+// BackpressurePolicy decides what happens to a message sent to a client
+// whose buffer is full.
+type BackpressurePolicy int
+
+const (
+	// DropNewest rejects the new message with ErrBufferFull. This is the default.
+	DropNewest BackpressurePolicy = iota
+
+	// DropOldest discards the oldest queued message to make room for the new one.
+	DropOldest
+
+	// Disconnect rejects the new message and removes the slow client, whose
+	// ClientInfo then reports DisconnectEvictedSlow.
+	Disconnect
+)
+
+// String returns the policy's name.
+func (p BackpressurePolicy) String() string {
+	switch p {
+	case DropNewest:
+		return "drop_newest"
+	case DropOldest:
+		return "drop_oldest"
+	case Disconnect:
+		return "disconnect"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler using the policy's name.
+func (p BackpressurePolicy) MarshalText() ([]byte, error) {
+	if p.String() == "unknown" {
+		return nil, invalidOption("backpressure", int(p), "unknown policy")
+	}
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, accepting the names
+// returned by String.
+func (p *BackpressurePolicy) UnmarshalText(text []byte) error {
+	for _, policy := range []BackpressurePolicy{DropNewest, DropOldest, Disconnect} {
+		if policy.String() == string(text) {
+			*p = policy
+			return nil
+		}
+	}
+	return invalidOption("backpressure", string(text), "want drop_newest, drop_oldest or disconnect")
+}
+
+// Logger receives diagnostic messages from the Server. *log.Logger
+// satisfies it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// nopLogger discards everything; it is the default Logger.
+type nopLogger struct{}
+
+func (nopLogger) Printf(string, ...interface{}) {}
+
+// WithBufferSize sets the message buffer size for clients added without an
+// explicit size. It must be at least 1; the default is 10.
+func WithBufferSize(size int) Option {
+	return func(o *options) error {
+		if size < 1 {
+			return invalidOption("WithBufferSize", size, "must be at least 1")
+		}
+		o.bufferSize = size
+		return nil
+	}
+}
+
+// WithMaxClients limits the number of simultaneously connected clients.
+// Adding a client beyond the limit fails with ErrTooManyClients. Zero, the
+// default, means no limit.
+func WithMaxClients(limit int) Option {
+	return func(o *options) error {
+		if limit < 0 {
+			return invalidOption("WithMaxClients", limit, "must not be negative")
+		}
+		o.maxClients = limit
+		return nil
+	}
+}
+
+// WithHeartbeat makes SSEHandlerEndpoint write a comment line every interval
+// so idle connections are not closed by proxies. Zero, the default,
+// disables heartbeats.
+func WithHeartbeat(interval time.Duration) Option {
+	return func(o *options) error {
+		if interval < 0 || (interval > 0 && interval < time.Millisecond) {
+			return invalidOption("WithHeartbeat", interval, "must be 0 or at least 1ms")
+		}
+		o.heartbeat = interval
+		return nil
+	}
+}
+
+// WithWriteTimeout bounds how long SSEHandlerEndpoint may take to write a
+// single frame. A connection whose peer stops reading is closed once the
+// timeout passes, and its ClientInfo reports DisconnectWriteTimeout. Zero,
+// the default, means no timeout.
+func WithWriteTimeout(timeout time.Duration) Option {
+	return func(o *options) error {
+		if timeout < 0 {
+			return invalidOption("WithWriteTimeout", timeout, "must not be negative")
+		}
+		o.writeTimeout = timeout
+		return nil
+	}
+}
+
+// WithBackpressure sets what happens when a message is sent to a client
+// whose buffer is full. The default is DropNewest.
+func WithBackpressure(policy BackpressurePolicy) Option {
+	return func(o *options) error {
+		switch policy {
+		case DropNewest, DropOldest, Disconnect:
+			o.backpressure = policy
+			return nil
+		}
+		return invalidOption("WithBackpressure", int(policy), "unknown policy")
+	}
+}
+
+// WithRateLimit paces the events written to each connection to perSecond
+// events per second, with bursts of up to burst events. Events that arrive
+// faster wait in the client's buffer, where the backpressure policy applies.
+// A perSecond of zero, the default, disables rate limiting.
+func WithRateLimit(perSecond float64, burst int) Option {
+	return func(o *options) error {
+		var errs []error
+		if perSecond < 0 {
+			errs = append(errs, invalidOption("WithRateLimit", perSecond, "rate must not be negative"))
+		}
+		if perSecond > 0 && burst < 1 {
+			errs = append(errs, invalidOption("WithRateLimit", burst, "burst must be at least 1"))
+		}
+		if len(errs) > 0 {
+			return errors.Join(errs...)
+		}
+		o.rateLimit = perSecond
+		o.rateBurst = burst
+		return nil
+	}
+}
+
+// WithLogLevel sets the minimum level of messages passed to the Logger. The
+// default is LevelInfo.
+func WithLogLevel(level LogLevel) Option {
+	return func(o *options) error {
+		if _, ok := logLevelNames[level]; !ok {
+			return invalidOption("WithLogLevel", int(level), "unknown level")
+		}
+		o.logLevel = level
+		return nil
+	}
+}
+
+// WithLogger sets where the server writes diagnostic messages. By default
+// nothing is logged.
+func WithLogger(logger Logger) Option {
+	return func(o *options) error {
+		if logger == nil {
+			return invalidOption("WithLogger", logger, "must not be nil")
+		}
+		o.logger = logger
+		return nil
+	}
+}
+
+// WithClock sets the function used to timestamp clients, which is mostly
+// useful in tests. The default is time.Now.
+func WithClock(now func() time.Time) Option {
+	return func(o *options) error {
+		if now == nil {
+			return invalidOption("WithClock", "nil", "must not be nil")
+		}
+		o.now = now
+		return nil
+	}
+}
+
+// WithIDGenerator replaces the built-in random client IDs. The server still
+// guarantees uniqueness: if generate fails or keeps returning IDs that are
+// already in use, the built-in generator is used for that client instead.
+func WithIDGenerator(generate func() (string, error)) Option {
+	return func(o *options) error {
+		if generate == nil {
+			return invalidOption("WithIDGenerator", "nil", "must not be nil")
+		}
+		o.idGenerator = generate
+		return nil
+	}
+}
+
+// WithOnConnect registers a hook called for every client once it has joined
+// the server, before AddClient returns and before any OnDisconnect call for
+// it, so applications can log connections or mark users present. The hook
+// runs on the Run loop, which cannot add or remove clients meanwhile, so it
+// must not block.
+func WithOnConnect(hook func(ClientInfo)) Option {
+	return func(o *options) error {
+		if hook == nil {
+			return invalidOption("WithOnConnect", "nil", "must not be nil")
+		}
+		o.onConnect = hook
+		return nil
+	}
+}
+
+// WithOnDisconnect registers a hook called once for every client that leaves
+// the server, with its final ClientInfo record: Reason and Err tell why the
+// stream ended. The hook runs on the goroutine that removed the client,
+// often the Run loop, so it must not block.
+func WithOnDisconnect(hook func(ClientInfo)) Option {
+	return func(o *options) error {
+		if hook == nil {
+			return invalidOption("WithOnDisconnect", "nil", "must not be nil")
+		}
+		o.onDisconnect = hook
+		return nil
+	}
+}
+
+// WithOnMessageDropped registers a hook called for every event a client
+// loses to a full buffer, with the client's ID and the event, whether the
+// event was rejected or discarded to make room (see WithBackpressure). The
+// hook runs on the publishing goroutine while the event is being delivered,
+// so it must not block or publish.
+func WithOnMessageDropped(hook func(clientID string, ev Event)) Option {
+	return func(o *options) error {
+		if hook == nil {
+			return invalidOption("WithOnMessageDropped", "nil", "must not be nil")
+		}
+		o.onDropped = hook
+		return nil
+	}
+}
+
+// WithAutoRun makes New start the server's Run loop itself, so callers need
+// not remember `go server.Run()`. Shutdown stops the loop as usual, and a
+// later call to Run blocks until then like any extra Run call.
+func WithAutoRun() Option {
+	return func(o *options) error {
+		o.autoRun = true
+		return nil
+	}
+}
@@ -0,0 +1,215 @@
+package gosse_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Firoz01/gosse/v2"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewServer_InvalidOptionsPanic(t *testing.T) {
+	defer func() {
+		r := recover()
+		err, ok := r.(error)
+		if !ok || !errors.Is(err, gosse.ErrInvalidOption) {
+			t.Fatalf("Expected panic wrapping ErrInvalidOption, got %v", r)
+		}
+		// Every invalid option is reported, not just the first
+		for _, name := range []string{"WithBufferSize", "WithMaxClients"} {
+			if !strings.Contains(err.Error(), name) {
+				t.Errorf("Expected panic to mention %s, got %v", name, err)
+			}
+		}
+	}()
+	gosse.NewServer(gosse.WithBufferSize(0), gosse.WithMaxClients(-1))
+}
+
+func TestNew_InvalidOptions(t *testing.T) {
+	server, err := gosse.New(gosse.WithBufferSize(0), gosse.WithHeartbeat(time.Nanosecond))
+	if server != nil || !errors.Is(err, gosse.ErrInvalidOption) {
+		t.Fatalf("Expected ErrInvalidOption and no server, got %v, %v", server, err)
+	}
+	for _, name := range []string{"WithBufferSize", "WithHeartbeat"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("Expected error to mention %s, got %v", name, err)
+		}
+	}
+
+	if _, err := gosse.New(gosse.WithBufferSize(1)); err != nil {
+		t.Errorf("Unexpected error for valid options: %v", err)
+	}
+}
+
+func TestNewServer_WithMaxClients(t *testing.T) {
+	server := gosse.NewServer(gosse.WithMaxClients(1))
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	if _, err := server.AddClientContext(context.Background()); err != nil {
+		t.Fatalf("Unexpected error adding first client: %v", err)
+	}
+	if _, err := server.AddClientContext(context.Background()); !errors.Is(err, gosse.ErrTooManyClients) {
+		t.Errorf("Expected ErrTooManyClients, got %v", err)
+	}
+}
+
+func TestNewServer_WithBackpressureDropOldest(t *testing.T) {
+	server := gosse.NewServer(gosse.WithBufferSize(2), gosse.WithBackpressure(gosse.DropOldest))
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	client := server.AddClient()
+	for i := 1; i <= 3; i++ {
+		if err := server.BroadcastMessage([]byte(fmt.Sprint(i))); err != nil {
+			t.Fatalf("Unexpected error broadcasting message %d: %v", i, err)
+		}
+	}
+
+	// The first message was dropped to make room for the third
+	for _, want := range []string{"2", "3"} {
+		if ev := <-client.Messages(); string(ev.Data) != want {
+			t.Errorf("Expected message %s, got %s", want, ev.Data)
+		}
+	}
+}
+
+func TestNewServer_WithBackpressureDisconnect(t *testing.T) {
+	server := gosse.NewServer(gosse.WithBufferSize(1), gosse.WithBackpressure(gosse.Disconnect))
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	client := server.AddClient()
+	_ = server.BroadcastMessage([]byte("one"))
+	if err := server.BroadcastMessage([]byte("two")); !errors.Is(err, gosse.ErrBufferFull) {
+		t.Fatalf("Expected ErrBufferFull, got %v", err)
+	}
+
+	// Drain until the evicted client's channel is closed
+	for range client.Messages() {
+	}
+	if reason := client.Info().Reason; reason != gosse.DisconnectEvictedSlow {
+		t.Errorf("Expected reason %q, got %q", gosse.DisconnectEvictedSlow, reason)
+	}
+}
+
+func TestNewServer_WithIDGeneratorAndClock(t *testing.T) {
+	connectedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	server := gosse.NewServer(
+		gosse.WithIDGenerator(func() (string, error) { return "fixed", nil }),
+		gosse.WithClock(func() time.Time { return connectedAt }),
+	)
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	first := server.AddClient()
+	if first.ID != "fixed" {
+		t.Errorf("Expected custom ID %q, got %q", "fixed", first.ID)
+	}
+	if !first.ConnectedAt.Equal(connectedAt) {
+		t.Errorf("Expected ConnectedAt %v, got %v", connectedAt, first.ConnectedAt)
+	}
+
+	// A duplicate custom ID falls back to a built-in one
+	second := server.AddClient()
+	if second.ID == "fixed" || second.ID == "" {
+		t.Errorf("Expected a built-in ID for the duplicate, got %q", second.ID)
+	}
+}
+
+func TestNewServer_WithHeartbeat(t *testing.T) {
+	server := gosse.NewServer(gosse.WithHeartbeat(20 * time.Millisecond))
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gosse.SSEHandlerEndpoint(server, w, r)
+	}))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil {
+		t.Fatalf("Failed to read SSE response body: %v", err)
+	}
+	if line != ": ping\n" {
+		t.Errorf("Expected heartbeat comment, got %q", line)
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	for name, profile := range map[string]gosse.Option{
+		"notifications": gosse.ProfileNotifications(),
+		"ticker":        gosse.ProfileTicker(),
+		"live logs":     gosse.ProfileLiveLogs(),
+	} {
+		if _, err := gosse.New(profile); err != nil {
+			t.Errorf("Unexpected error for the %s profile: %v", name, err)
+		}
+	}
+
+	// Later options override the profile's settings
+	server := gosse.NewServer(gosse.ProfileTicker(), gosse.WithBufferSize(2))
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	client := server.AddClient()
+	for i := 1; i <= 3; i++ {
+		if err := server.BroadcastMessage([]byte(fmt.Sprint(i))); err != nil {
+			t.Fatalf("Unexpected error broadcasting message %d: %v", i, err)
+		}
+	}
+	for _, want := range []string{"2", "3"} {
+		if ev := <-client.Messages(); string(ev.Data) != want {
+			t.Errorf("Expected message %s, got %s", want, ev.Data)
+		}
+	}
+}
+
+func TestNewServer_InstanceIdentity(t *testing.T) {
+	server := gosse.NewServer(
+		gosse.WithInstanceID("edge-1"),
+		gosse.WithLabels(map[string]string{"region": "eu"}),
+		gosse.WithLabels(map[string]string{"zone": "a"}),
+	)
+	if id := server.InstanceID(); id != "edge-1" {
+		t.Errorf("Expected instance ID edge-1, got %q", id)
+	}
+	labels := server.Labels()
+	if labels["region"] != "eu" || labels["zone"] != "a" {
+		t.Errorf("Expected merged labels, got %v", labels)
+	}
+	labels["region"] = "us"
+	if server.Labels()["region"] != "eu" {
+		t.Error("Expected Labels to return a copy")
+	}
+
+	if gosse.NewServer().InstanceID() == "" {
+		t.Error("Expected a default instance ID")
+	}
+	if _, err := gosse.New(gosse.WithLabels(map[string]string{"bad-name": "x"})); !errors.Is(err, gosse.ErrInvalidOption) {
+		t.Errorf("Expected ErrInvalidOption for an invalid label name, got %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package gosse
+
+import "hash/fnv"
+
+// Partition selects a deterministic slice of a topic's keyed events (see
+// PublishKeyed), for sharded consumers such as worker dashboards that each
+// watch part of a workload. A client with partition Index of Count receives
+// the events whose key hashes to Index (see PartitionOf); clients covering
+// every index between them see each keyed event exactly once. Events
+// published without a key reach every partition. The zero value means no
+// partitioning.
+type Partition struct {
+	Index int
+	Count int
+}
+
+// validate rejects partitions outside their count.
+func (p Partition) validate() error {
+	if p == (Partition{}) {
+		return nil
+	}
+	if p.Count < 1 {
+		return invalidOption("Partition.Count", p.Count, "must be at least 1")
+	}
+	if p.Index < 0 || p.Index >= p.Count {
+		return invalidOption("Partition.Index", p.Index, "must be between 0 and Count-1")
+	}
+	return nil
+}
+
+// PartitionOf returns the partition, between 0 and count-1, that events
+// with key belong to when a topic is split into count partitions. It is
+// stable across processes and releases.
+func PartitionOf(key string, count int) int {
+	if count < 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(count))
+}
+
+// PublishKeyed is Publish for an event with a partition key: clients that
+// have a Partition of topic receive it only if key falls in their slice.
+// Clients without one receive it as usual. It reports errors like Publish.
+func (s *Server) PublishKeyed(topic, key string, msg []byte) error {
+	if s == nil {
+		return ErrNilServer
+	}
+	return s.publish(Event{Data: msg, Topic: topic, Key: key})
+}
+
+// SetPartition restricts the keyed events the client receives from topic
+// to partition, or lifts the restriction if partition is the zero value. It
+// returns an error wrapping ErrInvalidOption if the index is out of range.
+func (c *Client) SetPartition(topic string, partition Partition) error {
+	if err := partition.validate(); err != nil {
+		return err
+	}
+	// inPartition runs for keyed events both in fan-out and in replays,
+	// without partitionM, so a change stores a new map rather than
+	// writing to one either may be reading
+	c.partitionM.Lock()
+	defer c.partitionM.Unlock()
+	next := make(map[string]Partition)
+	if current := c.partitions.Load(); current != nil {
+		for t, p := range *current {
+			next[t] = p
+		}
+	}
+	if partition == (Partition{}) {
+		delete(next, topic)
+	} else {
+		next[topic] = partition
+	}
+	c.partitions.Store(&next)
+	return nil
+}
+
+// inPartition reports whether ev falls in the client's partition of its
+// topic.
+func (c *Client) inPartition(ev Event) bool {
+	if ev.Key == "" {
+		return true
+	}
+	partitions := c.partitions.Load()
+	if partitions == nil {
+		return true
+	}
+	p, ok := (*partitions)[ev.Topic]
+	return !ok || PartitionOf(ev.Key, p.Count) == p.Index
+}
@@ -0,0 +1,80 @@
+package gosse
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// deliveryProbe tracks the probes a Handler has sent and not yet seen
+// acknowledged.
+type deliveryProbe struct {
+	timeout   time.Duration
+	onTimeout func(clientID string) // Nil for none
+	pending   sync.Map              // Token to *time.Timer
+}
+
+// WithHandlerDeliveryProbe detects streams that are accepted but never
+// delivered incrementally, typically because a proxy buffers the response
+// or strips its chunked encoding. Clients that connect with the "probe=1"
+// query parameter get a "probe" event right after the stream opens, whose
+// data is {"token":"..."}; they acknowledge it by requesting the same
+// endpoint with "probe_ack=<token>", which answers 204 No Content. A probe
+// not acknowledged within timeout while its stream is still open is logged
+// as a warning, sent to the admin ops stream (see AdminHandler) as a
+// "probe_timeout" event, and passed to onTimeout if that is not nil.
+// Acknowledgements go through the auth hook like streams do.
+func WithHandlerDeliveryProbe(timeout time.Duration, onTimeout func(clientID string)) HandlerOption {
+	return func(h *Handler) error {
+		if timeout <= 0 {
+			return invalidOption("WithHandlerDeliveryProbe", timeout, "must be positive")
+		}
+		h.probe = &deliveryProbe{timeout: timeout, onTimeout: onTimeout}
+		return nil
+	}
+}
+
+// start writes a probe to client's stream and arms its timeout. The
+// returned func disarms it and must be called when the stream ends.
+func (p *deliveryProbe) start(server *Server, fw *frameWriter, client *Client) (func(), error) {
+	token, err := randomClientID()
+	if err != nil {
+		server.logf(LevelWarn, "client %s not probed: random source failed: %v", client.ID, err)
+		return func() {}, nil
+	}
+	data, _ := json.Marshal(struct {
+		Token string `json:"token"`
+	}{token})
+	if err := fw.write("event: probe\ndata: " + string(data) + "\n\n"); err != nil {
+		return func() {}, err
+	}
+
+	timer := time.AfterFunc(p.timeout, func() {
+		if _, ok := p.pending.LoadAndDelete(token); !ok {
+			return // Acknowledged or ended meanwhile
+		}
+		server.logf(LevelWarn, "client %s did not acknowledge the delivery probe within %s; a proxy may be buffering the stream", client.ID, p.timeout)
+		server.emitOps(opsEvent{Type: "probe_timeout", Client: client.ID})
+		if p.onTimeout != nil {
+			p.onTimeout(client.ID)
+		}
+	})
+	p.pending.Store(token, timer)
+	return func() {
+		if _, ok := p.pending.LoadAndDelete(token); ok {
+			timer.Stop()
+		}
+	}, nil
+}
+
+// ack answers a probe acknowledgement for token.
+func (p *deliveryProbe) ack(w http.ResponseWriter, token string) {
+	timer, ok := p.pending.LoadAndDelete(token)
+	if !ok {
+		http.Error(w, "Unknown probe", http.StatusNotFound)
+		return
+	}
+	timer.(*time.Timer).Stop()
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,59 @@
+package gosse
+
+import (
+	"errors"
+	"time"
+)
+
+// Profiles bundle Options tuned for common workloads. They are ordinary
+// Options, so later options override their settings:
+//
+//	server := gosse.NewServer(gosse.ProfileTicker(), gosse.WithHeartbeat(5*time.Second))
+
+// ProfileNotifications suits low-volume streams where every event matters,
+// such as user notifications: a roomy buffer, and slow clients are
+// disconnected rather than silently missing events, so they reconnect
+// instead and catch up from a history of the last 256 events.
+func ProfileNotifications() Option {
+	return combine(
+		WithBufferSize(64),
+		WithBackpressure(Disconnect),
+		WithHeartbeat(30*time.Second),
+		WithHistory(256),
+	)
+}
+
+// ProfileTicker suits frequently updated values, such as prices or scores,
+// where only the latest events matter: a small buffer that drops the oldest
+// events when a client falls behind.
+func ProfileTicker() Option {
+	return combine(
+		WithBufferSize(8),
+		WithBackpressure(DropOldest),
+		WithHeartbeat(15*time.Second),
+	)
+}
+
+// ProfileLiveLogs suits high-volume streams, such as log tailing, that
+// arrive in bursts: a large buffer to absorb the bursts, dropping the oldest
+// lines when a client cannot keep up.
+func ProfileLiveLogs() Option {
+	return combine(
+		WithBufferSize(1024),
+		WithBackpressure(DropOldest),
+		WithHeartbeat(30*time.Second),
+	)
+}
+
+// combine returns an Option applying opts in order, reporting every error.
+func combine(opts ...Option) Option {
+	return func(o *options) error {
+		var errs []error
+		for _, opt := range opts {
+			if err := opt(o); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	}
+}
@@ -0,0 +1,125 @@
+package gosse
+
+import (
+	"fmt"
+	"sync"
+)
+
+// WithPublishRate caps how many events per second publishers may hand to
+// the server, with bursts of up to burst events. Publishes beyond the rate
+// are rejected with an error wrapping ErrQuotaExceeded rather than queued,
+// so a noisy producer learns to back off instead of filling every client's
+// buffer. Comments are not counted. A perSecond of zero, the default, means
+// no limit.
+func WithPublishRate(perSecond float64, burst int) Option {
+	return func(o *options) error {
+		if perSecond < 0 {
+			return invalidOption("WithPublishRate", perSecond, "rate must not be negative")
+		}
+		if perSecond > 0 && burst < 1 {
+			return invalidOption("WithPublishRate", burst, "burst must be at least 1")
+		}
+		o.publishRate = perSecond
+		o.publishBurst = burst
+		return nil
+	}
+}
+
+// publishQuota is the token bucket enforcing WithPublishRate. Unlike the
+// per-connection rateLimiter it is shared by every publisher, so it locks.
+type publishQuota struct {
+	mu      sync.Mutex
+	limiter *rateLimiter // Created on first use and re-rated by UpdateConfig
+}
+
+// WithMaxBufferedBytes caps the payload bytes waiting in the buffers of
+// clients streamed by a Handler. While slow clients hold more than n bytes
+// between them, publishes are rejected with an error wrapping
+// ErrQuotaExceeded, so stalled consumers cannot pin an unbounded amount of
+// memory; the limit lifts as their buffers drain or they disconnect.
+// Clients read directly through Messages are not counted, as the server
+// cannot tell when an event leaves their buffer. Zero, the default, means
+// no limit.
+func WithMaxBufferedBytes(n int) Option {
+	return func(o *options) error {
+		if n < 0 {
+			return invalidOption("WithMaxBufferedBytes", n, "must not be negative")
+		}
+		o.maxBufferedBytes = n
+		return nil
+	}
+}
+
+// admitPublish takes a token from the publish quota, or reports an error
+// wrapping ErrQuotaExceeded if none is available or slow clients buffer
+// more than WithMaxBufferedBytes allows.
+func (s *Server) admitPublish() error {
+	settings := s.tunables()
+	if limit := int64(settings.maxBufferedBytes); limit > 0 {
+		if buffered := s.bufferedBytes.Load(); buffered > limit {
+			return fmt.Errorf("%w: %d bytes buffered for slow clients, limit is %d", ErrQuotaExceeded, buffered, limit)
+		}
+	}
+	if settings.publishRate <= 0 {
+		return nil
+	}
+	q := &s.publishQuota
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	switch {
+	case q.limiter == nil:
+		q.limiter = newRateLimiter(settings.publishRate, settings.publishBurst)
+	case q.limiter.rate != settings.publishRate || q.limiter.burst != float64(settings.publishBurst):
+		q.limiter.setRate(settings.publishRate, settings.publishBurst)
+	}
+	if q.limiter.delay() > 0 {
+		return fmt.Errorf("%w: more than %g events per second published", ErrQuotaExceeded, settings.publishRate)
+	}
+	q.limiter.take()
+	return nil
+}
+
+// HubQuota limits what one hub of a HubManager, typically one tenant, may
+// use. Zero fields mean no limit.
+type HubQuota struct {
+	MaxClients   int     // See WithMaxClients
+	PublishRate  float64 // Events per second, see WithPublishRate
+	PublishBurst int     // Burst size, see WithPublishRate
+
+	MaxBufferedBytes int // Bytes queued for slow clients, see WithMaxBufferedBytes
+}
+
+// options converts the quota into the Options enforcing it.
+func (q HubQuota) options() []Option {
+	return []Option{WithMaxClients(q.MaxClients), WithPublishRate(q.PublishRate, q.PublishBurst), WithMaxBufferedBytes(q.MaxBufferedBytes)}
+}
+
+// SetQuota sets the quota of the hub with the given name, overriding the
+// limits among the manager's Options. It applies to the hub right away if
+// it exists, and to the hub created by a later Hub call otherwise; lowering
+// MaxClients does not disconnect anyone. Hubs share no workers to schedule
+// fairly between them: each has its own Run loop and publishes are
+// delivered on the publisher's goroutine, so a tenant that exhausts its
+// quota slows down only its own hub. An invalid quota is
+// reported in an error wrapping ErrInvalidOption and not applied.
+func (m *HubManager) SetQuota(name string, quota HubQuota) error {
+	if _, err := newOptions(quota.options()...); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	if m.quotas == nil {
+		m.quotas = make(map[string]HubQuota)
+	}
+	m.quotas[name] = quota
+	hub, ok := m.hubs[name]
+	m.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return hub.server.UpdateConfig(ConfigPatch{
+		MaxClients:       &quota.MaxClients,
+		PublishRate:      &quota.PublishRate,
+		PublishBurst:     &quota.PublishBurst,
+		MaxBufferedBytes: &quota.MaxBufferedBytes,
+	})
+}
@@ -0,0 +1,76 @@
+package gosse
+
+import "time"
+
+// maxPaceDelay caps a single rate-limit wait. Longer waits are split into
+// several timer rounds, so a tiny rate never overflows time.Duration and a
+// rate changed with UpdateConfig is re-evaluated at least this often.
+const maxPaceDelay = time.Minute
+
+// rateLimiter is a token bucket pacing the frames written to one connection.
+// It is only used by the goroutine serving that connection, so it needs no
+// locking. A rate of zero disables limiting.
+type rateLimiter struct {
+	rate   float64   // Tokens added per second
+	burst  float64   // Bucket capacity
+	tokens float64   // Tokens currently available
+	last   time.Time // When tokens was last refilled
+}
+
+// newRateLimiter returns a limiter allowing rate events per second with
+// bursts of up to burst events. The bucket starts full.
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	l := &rateLimiter{last: time.Now()}
+	l.setRate(rate, burst)
+	l.tokens = l.burst
+	return l
+}
+
+// setRate changes the limits, keeping the tokens already accumulated up to
+// the new burst size.
+func (l *rateLimiter) setRate(rate float64, burst int) {
+	l.refill(time.Now())
+	if burst < 1 {
+		burst = 1
+	}
+	l.rate = rate
+	l.burst = float64(burst)
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+}
+
+// refill adds the tokens earned since the last refill.
+func (l *rateLimiter) refill(now time.Time) {
+	if l.rate > 0 {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+}
+
+// delay returns how long to wait before a token is available, at most
+// maxPaceDelay, or zero if one is available now. It does not take the token.
+func (l *rateLimiter) delay() time.Duration {
+	if l.rate <= 0 {
+		return 0
+	}
+	l.refill(time.Now())
+	if l.tokens >= 1 {
+		return 0
+	}
+	seconds := (1 - l.tokens) / l.rate
+	if seconds >= maxPaceDelay.Seconds() {
+		return maxPaceDelay
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// take consumes a token. Callers check delay first.
+func (l *rateLimiter) take() {
+	if l.rate > 0 {
+		l.tokens--
+	}
+}
@@ -0,0 +1,162 @@
+// Package redis relays broadcasts and topic events between the gosse
+// servers of several replicas over Redis pub/sub, so that an event
+// published on one replica reaches the clients connected to all of them,
+// whichever replica the load balancer sent each client to:
+//
+//	bridge := redis.Bridge{Client: redisClient, Channel: "gosse"}
+//	go bridge.Run(ctx, server)
+//
+//	// Instead of server.Publish
+//	err := bridge.Publish(ctx, "prices", data)
+//
+// Every replica runs the bridge with the same channel. Events go through
+// Redis to every replica, the publishing one included, so all replicas
+// deliver them in the same order.
+//
+// Broker instead plugs into the server (see gosse.WithBroker), so that the
+// server's own Publish and Broadcast methods reach every replica:
+//
+//	server := gosse.NewServer(
+//		gosse.WithInstanceID(os.Getenv("POD_NAME")),
+//		gosse.WithBroker(&redis.Broker{Client: redisClient, Channel: "gosse"}))
+//
+// Each replica needs its own instance ID; the default one differs between
+// servers, but naming them after the replica makes logs and metrics easier
+// to follow.
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Firoz01/gosse/v2"
+	goredis "github.com/redis/go-redis/v9"
+	"time"
+)
+
+// message is an event as sent over the Redis channel.
+type message struct {
+	Topic string `json:"topic,omitempty"` // Empty for broadcasts
+	Name  string `json:"name,omitempty"`
+	Key   string `json:"key,omitempty"`
+	Data  []byte `json:"data"`
+
+	// Set by Broker only
+	Origin string            `json:"origin,omitempty"` // Instance the event was published on
+	ID     string            `json:"id,omitempty"`
+	Retry  time.Duration     `json:"retry,omitempty"`
+	Schema int               `json:"schema,omitempty"`
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// Bridge publishes events to a Redis channel and delivers the events of
+// that channel to a local server. Events keep their data, name and
+// partition key; each replica's history numbers them itself.
+type Bridge struct {
+	Client  goredis.UniversalClient // Connection to Redis, shared by every replica.
+	Channel string                  // Redis channel the replicas exchange events on.
+
+	// OnError, if set, is called with messages Run could not decode and
+	// events the local server would not take, for example over its publish
+	// rate (see gosse.WithPublishRate). Those are skipped either way.
+	OnError func(error)
+}
+
+// BroadcastMessage sends msg to every client of every replica, like
+// gosse.Server.BroadcastMessage. It only reports whether Redis took the
+// message; full client buffers on the replicas are not reported.
+func (b Bridge) BroadcastMessage(ctx context.Context, msg []byte) error {
+	return b.send(ctx, message{Data: msg})
+}
+
+// BroadcastEvent sends ev to every client of every replica with its name,
+// like gosse.Server.BroadcastEvent.
+func (b Bridge) BroadcastEvent(ctx context.Context, ev gosse.Event) error {
+	return b.send(ctx, message{Name: ev.Name, Data: ev.Data})
+}
+
+// Publish sends msg to the subscribers of topic on every replica, like
+// gosse.Server.Publish.
+func (b Bridge) Publish(ctx context.Context, topic string, msg []byte) error {
+	if topic == "" {
+		return fmt.Errorf("%w: topic: must not be empty", gosse.ErrInvalidOption)
+	}
+	return b.send(ctx, message{Topic: topic, Data: msg})
+}
+
+// PublishEvent sends ev to the subscribers of topic on every replica, with
+// its name and partition key, like gosse.Server.TryPublish.
+func (b Bridge) PublishEvent(ctx context.Context, topic string, ev gosse.Event) error {
+	if topic == "" {
+		return fmt.Errorf("%w: topic: must not be empty", gosse.ErrInvalidOption)
+	}
+	return b.send(ctx, message{Topic: topic, Name: ev.Name, Key: ev.Key, Data: ev.Data})
+}
+
+// send publishes m to the channel.
+func (b Bridge) send(ctx context.Context, m message) error {
+	payload, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("redis bridge: %w", err)
+	}
+	if err := b.Client.Publish(ctx, b.Channel, payload).Err(); err != nil {
+		return fmt.Errorf("redis bridge: publish: %w", err)
+	}
+	return nil
+}
+
+// Run subscribes to the channel and delivers its events to local until ctx
+// is done or the local server shuts down, which is noticed at the next
+// event. It returns ctx.Err() wrapped with context, gosse.ErrServerClosed,
+// or the error of a subscription Redis refused. The Redis client
+// resubscribes by itself after a dropped connection; events sent
+// meanwhile are lost, as Redis pub/sub keeps nothing.
+func (b Bridge) Run(ctx context.Context, local *gosse.Server) error {
+	if local == nil {
+		return gosse.ErrNilServer
+	}
+	if b.Client == nil || b.Channel == "" {
+		return fmt.Errorf("%w: Bridge needs a Client and a Channel", gosse.ErrInvalidOption)
+	}
+	sub := b.Client.Subscribe(ctx, b.Channel)
+	defer sub.Close()
+	// Wait for the subscription so events sent once Run is up are not missed
+	if _, err := sub.Receive(ctx); err != nil {
+		return fmt.Errorf("redis bridge: subscribe: %w", err)
+	}
+	messages := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("redis bridge: %w", ctx.Err())
+		case msg, ok := <-messages:
+			if !ok {
+				return fmt.Errorf("redis bridge: subscription closed")
+			}
+			if err := b.deliver(local, msg.Payload); errors.Is(err, gosse.ErrServerClosed) {
+				return err
+			} else if err != nil && b.OnError != nil {
+				b.OnError(err)
+			}
+		}
+	}
+}
+
+// deliver hands the event in payload to local.
+func (b Bridge) deliver(local *gosse.Server, payload string) error {
+	var m message
+	if err := json.Unmarshal([]byte(payload), &m); err != nil {
+		return fmt.Errorf("redis bridge: decode message: %w", err)
+	}
+	ev := gosse.Event{Data: m.Data, Name: m.Name, Key: m.Key}
+	if m.Topic != "" {
+		_, _, err := local.TryPublish(m.Topic, ev)
+		return err
+	}
+	err := local.BroadcastEvent(ev)
+	if errors.Is(err, gosse.ErrClientNotReady) {
+		return nil // Full buffers are counted in the server's metrics
+	}
+	return err
+}
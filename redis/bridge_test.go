@@ -0,0 +1,71 @@
+package redis_test
+
+import (
+	"context"
+	"errors"
+	"github.com/Firoz01/gosse/v2"
+	"github.com/Firoz01/gosse/v2/redis"
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+	"testing"
+	"time"
+)
+
+func TestBridge(t *testing.T) {
+	mr := miniredis.RunT(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Two replicas, each with a client of its own
+	var clients []*gosse.Client
+	var bridges []redis.Bridge
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		server := gosse.NewServer(gosse.WithAutoRun())
+		defer server.Shutdown()
+		client, err := server.SubscribeContext(ctx, "prices")
+		if err != nil {
+			t.Fatalf("Unexpected error subscribing: %v", err)
+		}
+		clients = append(clients, client)
+		rdb := goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+		defer rdb.Close()
+		bridge := redis.Bridge{Client: rdb, Channel: "gosse"}
+		bridges = append(bridges, bridge)
+		go func() { done <- bridge.Run(ctx, server) }()
+	}
+	for deadline := time.Now().Add(time.Second); mr.PubSubNumSub("gosse")["gosse"] < 2; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Timeout waiting for the bridges to subscribe")
+		}
+	}
+
+	if err := bridges[0].Publish(ctx, "prices", []byte("42")); err != nil {
+		t.Fatalf("Unexpected error publishing: %v", err)
+	}
+	if err := bridges[0].BroadcastEvent(ctx, gosse.Event{Name: "notice", Data: []byte("hi")}); err != nil {
+		t.Fatalf("Unexpected error broadcasting: %v", err)
+	}
+	for i, client := range clients {
+		for _, want := range []string{"prices/:42", "/notice:hi"} {
+			select {
+			case ev := <-client.Messages():
+				if got := ev.Topic + "/" + ev.Name + ":" + string(ev.Data); got != want {
+					t.Errorf("Expected replica %d to get %s, got %s", i, want, got)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("Timeout waiting for replica %d to get %s", i, want)
+			}
+		}
+	}
+
+	cancel()
+	for i := 0; i < 2; i++ {
+		if err := <-done; !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled once ctx is done, got %v", err)
+		}
+	}
+	if err := (redis.Bridge{}).Run(context.Background(), gosse.NewServer()); !errors.Is(err, gosse.ErrInvalidOption) {
+		t.Errorf("Expected ErrInvalidOption without a client, got %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Firoz01/gosse/v2"
+	goredis "github.com/redis/go-redis/v9"
+	"sync"
+)
+
+// Broker is a gosse.Broker over a Redis channel. Each replica's server gets
+// its own Broker with the same channel; replicas must have distinct
+// instance IDs (see gosse.WithInstanceID). Unlike with Bridge, each server
+// delivers its own events straight away and the others' as they arrive, so
+// replicas may see events of different publishers in different orders.
+type Broker struct {
+	Client  goredis.UniversalClient // Connection to Redis, shared by every replica.
+	Channel string                  // Redis channel the replicas exchange events on.
+
+	// OnError, if set, is called with messages that could not be decoded,
+	// which are skipped.
+	OnError func(error)
+
+	mu   sync.Mutex
+	sub  *goredis.PubSub // Set by Subscribe
+	done chan struct{}   // Closed once the subscription's goroutine has ended
+}
+
+// Publish implements gosse.Broker. It waits for Redis to take the event.
+func (b *Broker) Publish(origin string, ev gosse.Event) error {
+	payload, err := json.Marshal(message{
+		Topic: ev.Topic, Name: ev.Name, Key: ev.Key, Data: ev.Data,
+		Origin: origin, ID: ev.ID, Retry: ev.Retry, Schema: ev.Schema, Fields: ev.Fields,
+	})
+	if err != nil {
+		return fmt.Errorf("redis broker: %w", err)
+	}
+	if err := b.Client.Publish(context.Background(), b.Channel, payload).Err(); err != nil {
+		return fmt.Errorf("redis broker: publish: %w", err)
+	}
+	return nil
+}
+
+// Subscribe implements gosse.Broker. It returns once Redis has confirmed
+// the subscription, and calls deliver from a goroutine of its own. The
+// Redis client resubscribes by itself after a dropped connection; events
+// sent meanwhile are lost, as Redis pub/sub keeps nothing.
+func (b *Broker) Subscribe(deliver func(origin string, ev gosse.Event)) error {
+	if b.Client == nil || b.Channel == "" {
+		return fmt.Errorf("%w: Broker needs a Client and a Channel", gosse.ErrInvalidOption)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.sub != nil {
+		return fmt.Errorf("redis broker: already subscribed")
+	}
+	sub := b.Client.Subscribe(context.Background(), b.Channel)
+	if _, err := sub.Receive(context.Background()); err != nil {
+		sub.Close()
+		return fmt.Errorf("redis broker: subscribe: %w", err)
+	}
+	b.sub, b.done = sub, make(chan struct{})
+	go func() {
+		defer close(b.done)
+		for msg := range sub.Channel() {
+			var m message
+			if err := json.Unmarshal([]byte(msg.Payload), &m); err != nil {
+				if b.OnError != nil {
+					b.OnError(fmt.Errorf("redis broker: decode message: %w", err))
+				}
+				continue
+			}
+			deliver(m.Origin, gosse.Event{
+				Data: m.Data, Topic: m.Topic, ID: m.ID, Name: m.Name,
+				Key: m.Key, Retry: m.Retry, Schema: m.Schema, Fields: m.Fields,
+			})
+		}
+	}()
+	return nil
+}
+
+// Close implements gosse.Broker. It ends the subscription and waits until
+// deliver is no longer called. The Client is left open.
+func (b *Broker) Close() error {
+	b.mu.Lock()
+	sub, done := b.sub, b.done
+	b.mu.Unlock()
+	if sub == nil {
+		return nil
+	}
+	err := sub.Close()
+	<-done
+	return err
+}
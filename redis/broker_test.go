@@ -0,0 +1,56 @@
+package redis_test
+
+import (
+	"github.com/Firoz01/gosse/v2"
+	"github.com/Firoz01/gosse/v2/redis"
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+	"testing"
+	"time"
+)
+
+func TestBroker(t *testing.T) {
+	mr := miniredis.RunT(t)
+
+	// Two replicas, each with a client of its own
+	var servers []*gosse.Server
+	var clients []*gosse.Client
+	for _, id := range []string{"a", "b"} {
+		rdb := goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+		defer rdb.Close()
+		server := gosse.NewServer(gosse.WithAutoRun(), gosse.WithInstanceID(id), gosse.WithBroker(&redis.Broker{Client: rdb, Channel: "gosse"}))
+		defer server.Shutdown()
+		servers = append(servers, server)
+		clients = append(clients, server.AddClient())
+	}
+	if n := mr.PubSubNumSub("gosse")["gosse"]; n != 2 {
+		t.Fatalf("Expected both brokers subscribed once Run started, got %d", n)
+	}
+
+	if err := servers[0].BroadcastEvent(gosse.Event{Data: []byte("hello"), Name: "greeting", Retry: time.Second}); err != nil {
+		t.Fatalf("Unexpected error broadcasting: %v", err)
+	}
+	for i, client := range clients {
+		select {
+		case ev := <-client.Messages():
+			if string(ev.Data) != "hello" || ev.Name != "greeting" || ev.Retry != time.Second {
+				t.Errorf("Replica %d: expected the greeting, got %+v", i, ev)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Replica %d: timeout waiting for the broadcast", i)
+		}
+	}
+	select {
+	case ev := <-clients[0].Messages():
+		t.Errorf("Expected the publishing replica to deliver once, also got %q", ev.Data)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Shutdown ends the subscription
+	servers[1].Shutdown()
+	for deadline := time.Now().Add(time.Second); mr.PubSubNumSub("gosse")["gosse"] != 1; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Timeout waiting for the broker to unsubscribe")
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package gosse
+
+import (
+	"errors"
+	"time"
+)
+
+// ConfigPatch lists runtime-tunable settings to change with UpdateConfig.
+// Nil fields are left unchanged.
+type ConfigPatch struct {
+	Heartbeat  *time.Duration // See WithHeartbeat.
+	MaxClients *int           // See WithMaxClients.
+	RateLimit  *float64       // Events per second, see WithRateLimit.
+	RateBurst  *int           // Burst size, see WithRateLimit.
+	LogLevel   *LogLevel      // See WithLogLevel.
+
+	PublishRate  *float64 // Events per second, see WithPublishRate.
+	PublishBurst *int     // Burst size, see WithPublishRate.
+
+	MaxBufferedBytes *int // See WithMaxBufferedBytes.
+}
+
+// UpdateConfig applies patch to a running server. The patch is validated as
+// a whole and applied atomically: either every field takes effect or, if any
+// is invalid, none does and the returned error lists every problem.
+//
+// Connected clients pick up new heartbeat and rate limit settings right away.
+// Lowering MaxClients does not disconnect anyone; it only rejects new clients
+// until the count drops below the limit.
+func (s *Server) UpdateConfig(patch ConfigPatch) error {
+	if s == nil {
+		return ErrNilServer
+	}
+	s.init()
+
+	s.optsM.Lock()
+	defer s.optsM.Unlock()
+
+	next := s.opts
+	var errs []error
+	for _, opt := range patch.options(next) {
+		if err := opt(&next); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	// Copy only the tunable fields: the others are read without optsM
+	s.opts.heartbeat = next.heartbeat
+	s.opts.maxClients = next.maxClients
+	s.opts.rateLimit = next.rateLimit
+	s.opts.rateBurst = next.rateBurst
+	s.opts.logLevel = next.logLevel
+	s.opts.publishRate = next.publishRate
+	s.opts.publishBurst = next.publishBurst
+	s.opts.maxBufferedBytes = next.maxBufferedBytes
+
+	// Wake up every handler so it re-reads the settings
+	close(s.reloaded)
+	s.reloaded = make(chan struct{})
+	return nil
+}
+
+// options converts the patch into Options. current supplies the rate or
+// burst when only one of the two is being changed.
+func (p ConfigPatch) options(current options) []Option {
+	var opts []Option
+	if p.Heartbeat != nil {
+		opts = append(opts, WithHeartbeat(*p.Heartbeat))
+	}
+	if p.MaxClients != nil {
+		opts = append(opts, WithMaxClients(*p.MaxClients))
+	}
+	if p.RateLimit != nil || p.RateBurst != nil {
+		rate, burst := current.rateLimit, current.rateBurst
+		if p.RateLimit != nil {
+			rate = *p.RateLimit
+		}
+		if p.RateBurst != nil {
+			burst = *p.RateBurst
+		}
+		opts = append(opts, WithRateLimit(rate, burst))
+	}
+	if p.LogLevel != nil {
+		opts = append(opts, WithLogLevel(*p.LogLevel))
+	}
+	if p.PublishRate != nil || p.PublishBurst != nil {
+		rate, burst := current.publishRate, current.publishBurst
+		if p.PublishRate != nil {
+			rate = *p.PublishRate
+		}
+		if p.PublishBurst != nil {
+			burst = *p.PublishBurst
+		}
+		opts = append(opts, WithPublishRate(rate, burst))
+	}
+	if p.MaxBufferedBytes != nil {
+		opts = append(opts, WithMaxBufferedBytes(*p.MaxBufferedBytes))
+	}
+	return opts
+}
+
+// tunables returns a consistent snapshot of the server's configuration,
+// including the settings UpdateConfig may change concurrently.
+func (s *Server) tunables() options {
+	s.optsM.RLock()
+	defer s.optsM.RUnlock()
+	return s.opts
+}
+
+// tunablesAndReload returns the same snapshot as tunables together with a
+// channel that is closed the next time UpdateConfig succeeds. Both are read
+// under one lock, so an update can never slip in between them unnoticed.
+func (s *Server) tunablesAndReload() (options, <-chan struct{}) {
+	s.optsM.RLock()
+	defer s.optsM.RUnlock()
+	return s.opts, s.reloaded
+}
@@ -0,0 +1,146 @@
+package gosse_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"github.com/Firoz01/gosse/v2"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_UpdateConfigIsAtomic(t *testing.T) {
+	server := gosse.NewServer(gosse.WithMaxClients(1))
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	// One invalid field rejects the whole patch
+	limit, heartbeat := 2, -time.Second
+	err := server.UpdateConfig(gosse.ConfigPatch{MaxClients: &limit, Heartbeat: &heartbeat})
+	if !errors.Is(err, gosse.ErrInvalidOption) {
+		t.Fatalf("Expected ErrInvalidOption, got %v", err)
+	}
+	server.AddClient()
+	if _, err := server.AddClientContext(context.Background()); !errors.Is(err, gosse.ErrTooManyClients) {
+		t.Errorf("Expected the old limit to still apply, got %v", err)
+	}
+
+	// A valid patch takes effect immediately
+	if err := server.UpdateConfig(gosse.ConfigPatch{MaxClients: &limit}); err != nil {
+		t.Fatalf("Unexpected error updating config: %v", err)
+	}
+	if _, err := server.AddClientContext(context.Background()); err != nil {
+		t.Errorf("Expected the new limit to apply, got %v", err)
+	}
+}
+
+func TestServer_UpdateConfigHeartbeatAndLogLevel(t *testing.T) {
+	var logs bytes.Buffer
+	server := gosse.NewServer(
+		gosse.WithLogger(log.New(&logs, "", 0)),
+		gosse.WithLogLevel(gosse.LevelOff),
+		gosse.WithBufferSize(1),
+		gosse.WithBackpressure(gosse.Disconnect),
+	)
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gosse.SSEHandlerEndpoint(server, w, r)
+	}))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// Enable heartbeats on the already connected client
+	interval := 20 * time.Millisecond
+	if err := server.UpdateConfig(gosse.ConfigPatch{Heartbeat: &interval}); err != nil {
+		t.Fatalf("Unexpected error updating config: %v", err)
+	}
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil || line != ": ping\n" {
+		t.Errorf("Expected heartbeat comment after UpdateConfig, got %q (%v)", line, err)
+	}
+
+	// Raising the log level makes evictions visible
+	level := gosse.LevelWarn
+	if err := server.UpdateConfig(gosse.ConfigPatch{LogLevel: &level}); err != nil {
+		t.Fatalf("Unexpected error updating config: %v", err)
+	}
+	slow := server.AddClient()
+	_ = server.SendMessageToClient(slow.ID, []byte("one"))
+	_ = server.SendMessageToClient(slow.ID, []byte("two"))
+	if !strings.Contains(logs.String(), "evicting client "+slow.ID) {
+		t.Errorf("Expected eviction to be logged, got %q", logs.String())
+	}
+}
+
+func TestServer_UpdateConfigLiftsRateLimit(t *testing.T) {
+	// One event per thousand seconds: the second event has to wait
+	server := gosse.NewServer(gosse.WithRateLimit(0.001, 1))
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gosse.SSEHandlerEndpoint(server, w, r)
+	}))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// Wait briefly to ensure client addition is processed
+	time.Sleep(50 * time.Millisecond)
+
+	_ = server.BroadcastMessage([]byte("first"))
+	_ = server.BroadcastMessage([]byte("second"))
+
+	// Lifting the limit releases the waiting event right away
+	time.Sleep(50 * time.Millisecond)
+	unlimited := 0.0
+	if err := server.UpdateConfig(gosse.ConfigPatch{RateLimit: &unlimited}); err != nil {
+		t.Fatalf("Unexpected error updating config: %v", err)
+	}
+
+	received := make(chan string, 2)
+	go func() {
+		reader := bufio.NewReader(resp.Body)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if strings.HasPrefix(line, "data: ") {
+				received <- line
+			}
+		}
+	}()
+	for _, want := range []string{"data: first\n", "data: second\n"} {
+		select {
+		case line := <-received:
+			if line != want {
+				t.Errorf("Expected %q, got %q", want, line)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timeout waiting for %q", want)
+		}
+	}
+}
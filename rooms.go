@@ -0,0 +1,135 @@
+package gosse
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// JoinRoom adds a connected client to room. Rooms are like topics that
+// clients join and leave while connected, any number at a time, as in
+// socket.io: the server decides who is in a room, with JoinRoom and
+// LeaveRoom, and BroadcastToRoom reaches its members. A room exists while
+// it has members, and clients leave every room when they disconnect.
+// Joining a room twice is a no-op. It returns an error wrapping
+// ErrClientNotFound if no client has the ID, or ErrInvalidOption if room is
+// empty.
+func (s *Server) JoinRoom(clientID, room string) error {
+	if s == nil {
+		return ErrNilServer
+	}
+	if room == "" {
+		return invalidOption("room", `""`, "must not be empty")
+	}
+	client, ok := s.loadClient(clientID)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrClientNotFound, clientID)
+	}
+	s.roomsM.Lock()
+	defer s.roomsM.Unlock()
+	select {
+	case <-client.done:
+		// Closed, and leaveRooms has run or waits for roomsM
+		return fmt.Errorf("%w: %s", ErrClientNotFound, clientID)
+	default:
+	}
+	if s.rooms == nil {
+		s.rooms = make(map[string]map[string]*Client)
+		s.clientRooms = make(map[string]map[string]struct{})
+	}
+	if s.rooms[room] == nil {
+		s.rooms[room] = make(map[string]*Client)
+	}
+	s.rooms[room][clientID] = client
+	if s.clientRooms[clientID] == nil {
+		s.clientRooms[clientID] = make(map[string]struct{})
+	}
+	s.clientRooms[clientID][room] = struct{}{}
+	return nil
+}
+
+// LeaveRoom takes a client out of room. Leaving a room the client is not
+// in is a no-op.
+func (s *Server) LeaveRoom(clientID, room string) {
+	if s == nil {
+		return
+	}
+	s.roomsM.Lock()
+	defer s.roomsM.Unlock()
+	s.leaveRoom(clientID, room)
+}
+
+// leaveRoom is LeaveRoom with roomsM held.
+func (s *Server) leaveRoom(clientID, room string) {
+	delete(s.rooms[room], clientID)
+	if len(s.rooms[room]) == 0 {
+		delete(s.rooms, room)
+	}
+	delete(s.clientRooms[clientID], room)
+	if len(s.clientRooms[clientID]) == 0 {
+		delete(s.clientRooms, clientID)
+	}
+}
+
+// leaveRooms takes a disconnected client out of all its rooms.
+func (s *Server) leaveRooms(clientID string) {
+	s.roomsM.Lock()
+	defer s.roomsM.Unlock()
+	for room := range s.clientRooms[clientID] {
+		s.leaveRoom(clientID, room)
+	}
+}
+
+// RoomClients returns the IDs of the clients in room, sorted, or nil if
+// the room has no members.
+func (s *Server) RoomClients(room string) []string {
+	if s == nil {
+		return nil
+	}
+	s.roomsM.Lock()
+	defer s.roomsM.Unlock()
+	var ids []string
+	for id := range s.rooms[room] {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// BroadcastToRoom sends msg, like BroadcastMessage, to the clients in
+// room. Clients that set a filter (see Client.SetFilter) must also match
+// it. The message is not kept in the history, as a replay could not tell
+// who was in the room. It reports errors like BroadcastMessage; a room
+// without members is not an error.
+func (s *Server) BroadcastToRoom(room string, msg []byte) error {
+	if s == nil {
+		return ErrNilServer
+	}
+	if err := s.acquireOpen(); err != nil {
+		return err
+	}
+	defer s.releaseOpen()
+	if err := s.admitPublish(); err != nil {
+		return err
+	}
+	s.roomsM.Lock()
+	members := make([]*Client, 0, len(s.rooms[room]))
+	for _, client := range s.rooms[room] {
+		members = append(members, client)
+	}
+	s.roomsM.Unlock()
+
+	ev := Event{Data: msg}
+	s.countPublish(ev)
+	var errs []error
+	in := &filterInput{data: ev.Data}
+	for _, client := range members {
+		if !client.wants(in) {
+			continue
+		}
+		if err := s.deliver(client, ev); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
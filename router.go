@@ -0,0 +1,115 @@
+package gosse
+
+import "path"
+
+// maxRouteDepth bounds how many routes an event passes through, so routes
+// that feed each other in a cycle cannot republish forever.
+const maxRouteDepth = 8
+
+// Route is a rule republishing the events of matching topics to another
+// topic, for example every "*.errors" topic into an "all-errors" topic that
+// dashboards subscribe to. Routes apply to events published to topics, not
+// to broadcasts or targeted messages.
+type Route struct {
+	Topic string // Pattern of the topics routed, in path.Match syntax such as "*.errors"
+	Name  string // Pattern of the event names routed, empty for any event
+	To    string // Topic the events are republished to
+
+	// Transform rewrites each routed event, or drops it by returning false.
+	// Its result is published to To with the result's Data, Name and Key.
+	// Nil republishes events unchanged. It runs on the publisher's
+	// goroutine.
+	Transform func(Event) (Event, bool)
+}
+
+// route is a registered Route.
+type route struct {
+	Route
+}
+
+// matches reports whether r routes ev.
+func (r *route) matches(ev Event) bool {
+	if ok, _ := path.Match(r.Topic, ev.Topic); !ok {
+		return false
+	}
+	if r.Name == "" {
+		return true
+	}
+	ok, _ := path.Match(r.Name, ev.Name)
+	return ok
+}
+
+// AddRoute registers r; it applies to events published from then on, and
+// stops applying once remove is called. An event is routed by every route
+// it matches, and routed events are routed again, up to a depth of 8 so
+// cycles end. Routed events count as publishes in Metrics but are exempt
+// from WithPublishRate. AddRoute returns an error wrapping ErrInvalidOption
+// if a pattern is malformed or To is empty.
+func (s *Server) AddRoute(r Route) (remove func(), err error) {
+	if s == nil {
+		return nil, ErrNilServer
+	}
+	if err := validateTopics("Route.To", r.To); err != nil {
+		return nil, err
+	}
+	for name, pattern := range map[string]string{"Route.Topic": r.Topic, "Route.Name": r.Name} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, invalidOption(name, pattern, err.Error())
+		}
+	}
+	added := &route{r}
+	s.updateRoutes(func(routes []*route) []*route { return append(routes, added) })
+	return func() {
+		s.updateRoutes(func(routes []*route) []*route {
+			for i, r := range routes {
+				if r == added {
+					return append(routes[:i], routes[i+1:]...)
+				}
+			}
+			return routes
+		})
+	}, nil
+}
+
+// updateRoutes replaces the routes with update's result. update receives a
+// copy it may modify.
+func (s *Server) updateRoutes(update func([]*route) []*route) {
+	// route walks the routes it loaded without routesM, as its Transform
+	// calls may themselves add or remove routes; so updates store a new
+	// slice rather than modify the one being walked
+	s.routesM.Lock()
+	defer s.routesM.Unlock()
+	var routes []*route
+	if current := s.routes.Load(); current != nil {
+		routes = append(routes, *current...)
+	}
+	routes = update(routes)
+	s.routes.Store(&routes)
+}
+
+// route republishes ev through every route it matches. depth is the number
+// of routes ev has already passed through.
+func (s *Server) route(ev Event, depth int) {
+	routes := s.routes.Load()
+	if routes == nil || depth >= maxRouteDepth {
+		return
+	}
+	for _, r := range *routes {
+		if r.To == ev.Topic || !r.matches(ev) {
+			continue
+		}
+		routed := ev
+		if r.Transform != nil {
+			var ok bool
+			if routed, ok = r.Transform(ev); !ok {
+				continue
+			}
+		}
+		routed = Event{Data: routed.Data, Topic: r.To, Name: routed.Name, Key: routed.Key}
+		if _, err := s.offer(routed, false); err != nil {
+			s.logf(LevelDebug, "route %s -> %s: %v", ev.Topic, r.To, err)
+			continue
+		}
+		s.route(routed, depth+1)
+	}
+}
@@ -0,0 +1,81 @@
+package gosse
+
+import (
+	"time"
+)
+
+// Sampling thins out the events of a topic for one client, for dashboards
+// that only need a representative sample of a firehose. The zero value
+// delivers every event.
+type Sampling struct {
+	// Every delivers only every Nth event, starting with the first.
+	// Zero or one delivers every event.
+	Every int
+
+	// MaxRate delivers at most this many events per second, skipping the
+	// events that arrive too soon after the last one delivered. Zero means
+	// no limit.
+	MaxRate float64
+}
+
+// validate rejects negative settings.
+func (s Sampling) validate() error {
+	if s.Every < 0 {
+		return invalidOption("Sampling.Every", s.Every, "must not be negative")
+	}
+	if s.MaxRate < 0 {
+		return invalidOption("Sampling.MaxRate", s.MaxRate, "must not be negative")
+	}
+	return nil
+}
+
+// sampler applies a Sampling to the events of one topic.
+type sampler struct {
+	Sampling
+	offered uint64    // Events offered so far
+	last    time.Time // When the last event was delivered
+}
+
+// take reports whether the event offered at now should be delivered.
+func (s *sampler) take(now time.Time) bool {
+	n := s.offered
+	s.offered++
+	if s.Every > 1 && n%uint64(s.Every) != 0 {
+		return false
+	}
+	if s.MaxRate > 0 && !s.last.IsZero() && now.Sub(s.last).Seconds() < 1/s.MaxRate {
+		return false
+	}
+	s.last = now
+	return true
+}
+
+// SetSampling thins out the events the client receives from topic, or
+// delivers all of them again if sampling is the zero value. Broadcasts and
+// messages sent to the client by ID are never sampled. It returns an error
+// wrapping ErrInvalidOption for negative settings.
+func (c *Client) SetSampling(topic string, sampling Sampling) error {
+	if err := sampling.validate(); err != nil {
+		return err
+	}
+	c.samplingM.Lock()
+	defer c.samplingM.Unlock()
+	if sampling == (Sampling{}) {
+		delete(c.samplers, topic)
+		return nil
+	}
+	if c.samplers == nil {
+		c.samplers = make(map[string]*sampler)
+	}
+	c.samplers[topic] = &sampler{Sampling: sampling}
+	return nil
+}
+
+// sample reports whether the client's sampling of topic lets an event
+// published at now through.
+func (c *Client) sample(topic string, now time.Time) bool {
+	c.samplingM.Lock()
+	defer c.samplingM.Unlock()
+	s, ok := c.samplers[topic]
+	return !ok || s.take(now)
+}
@@ -0,0 +1,133 @@
+package gosse
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSessionMessageSize limits the body of a message posted to a session.
+const maxSessionMessageSize = 1 << 20
+
+// SessionHandler emulates a bidirectional connection without WebSockets by
+// pairing each SSE stream with an upstream POST endpoint. Mount it under a
+// prefix with http.StripPrefix:
+//
+//	session, err := gosse.NewSessionHandler(server, onMessage)
+//	http.Handle("/events/", http.StripPrefix("/events", session))
+//
+// GET / opens the stream. Its first event, named "session", carries the
+// client's ID as {"client_id":"..."}. The client then sends messages with
+// POST /{clientID}/send; each request body, up to 1 MiB, is passed to the
+// onMessage callback together with the client it came from. The client ID
+// is the only proof that a POST belongs to a stream, so IDs must stay hard
+// to guess (see WithIDGenerator), and an auth hook set with
+// WithHandlerAuth checks the POST requests as well.
+//
+// A POST answers only once the client's stream has written every event
+// queued for it by then, including those onMessage published, so a UI sees
+// the effects of its own messages before the POST resolves. With
+// WithHistory, the answer's Last-Event-ID header gives the ID of the newest
+// event at that point.
+type SessionHandler struct {
+	stream    *Handler
+	onMessage func(r *http.Request, client *Client, msg []byte) error
+}
+
+// NewSessionHandler returns a SessionHandler streaming server's events with
+// a Handler configured by opts, and passing messages posted by its clients
+// to onMessage. A nil error from onMessage answers the POST with 204 No
+// Content; otherwise the error text is returned with 400 Bad Request.
+func NewSessionHandler(server *Server, onMessage func(r *http.Request, client *Client, msg []byte) error, opts ...HandlerOption) (*SessionHandler, error) {
+	if onMessage == nil {
+		return nil, invalidOption("onMessage", "nil", "must not be nil")
+	}
+	stream, err := NewHandler(server, opts...)
+	if err != nil {
+		return nil, err
+	}
+	stream.session = true
+	return &SessionHandler{stream: stream, onMessage: onMessage}, nil
+}
+
+// ServeHTTP routes stream and message requests.
+func (h *SessionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "":
+		if allowMethods(w, r, http.MethodGet) {
+			h.stream.ServeHTTP(w, r)
+		}
+	case len(parts) == 2 && parts[1] == "send":
+		if allowMethods(w, r, http.MethodPost) {
+			h.serveSend(w, r, parts[0])
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveSend passes a posted message to the onMessage callback.
+func (h *SessionHandler) serveSend(w http.ResponseWriter, r *http.Request, clientID string) {
+	if h.stream.auth != nil {
+		if err := h.stream.auth(r); err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+	client, ok := h.stream.server.loadClient(clientID)
+	if !ok {
+		http.Error(w, "Client not found", http.StatusNotFound)
+		return
+	}
+	msg, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSessionMessageSize))
+	if err != nil {
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err := h.onMessage(r, client, msg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Read your writes: events the callback published to this client are
+	// queued by now, so once the stream has written everything queued so
+	// far, the UI already has them when the POST returns
+	ctx, cancel := context.WithTimeout(r.Context(), maxSessionFlushWait)
+	defer cancel()
+	if !client.flush(ctx) {
+		h.stream.server.logf(LevelDebug, "client %s: stream not flushed before answering its POST", client.ID)
+	}
+	if history := h.stream.server.history; history != nil {
+		w.Header().Set("Last-Event-ID", strconv.FormatUint(history.newest(), 10))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// maxSessionFlushWait bounds how long a POST waits for the events it caused
+// to be written to the client's stream.
+const maxSessionFlushWait = 5 * time.Second
+
+// flush waits until the Handler streaming the client has written or dropped
+// every event queued for it so far. It reports false if ctx is done first,
+// the client is closed, or no Handler streams it.
+func (c *Client) flush(ctx context.Context) bool {
+	if !c.streamed {
+		return false
+	}
+	barrier := make(chan struct{})
+	if err := c.sendContext(ctx, Event{barrier: barrier}); err != nil {
+		return false
+	}
+	select {
+	case <-barrier:
+		return true
+	case <-c.done:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,123 @@
+package gosse_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"github.com/Firoz01/gosse/v2"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessionHandler(t *testing.T) {
+	server := gosse.NewServer()
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	// Echo every message back on the sender's stream
+	session, err := gosse.NewSessionHandler(server, func(r *http.Request, client *gosse.Client, msg []byte) error {
+		if len(msg) == 0 {
+			return errors.New("empty message")
+		}
+		return server.SendMessageToClient(client.ID, append([]byte("echo: "), msg...))
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error creating session handler: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/events/", http.StripPrefix("/events", session))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/events/")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+
+	// The stream opens by announcing the client ID
+	frame := readFrame(t, reader)
+	data, ok := strings.CutPrefix(frame, "event: session\ndata: ")
+	var announced struct {
+		ClientID string `json:"client_id"`
+	}
+	if !ok || json.Unmarshal([]byte(data), &announced) != nil || announced.ClientID == "" {
+		t.Fatalf("Expected a session event, got %q", frame)
+	}
+
+	post := func(clientID, body string) int {
+		resp, err := http.Post(ts.URL+"/events/"+clientID+"/send", "text/plain", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if status := post(announced.ClientID, "hello"); status != http.StatusNoContent {
+		t.Errorf("Expected 204 sending a message, got %d", status)
+	}
+	if frame := readFrame(t, reader); frame != "data: echo: hello\n" {
+		t.Errorf("Expected the echo, got %q", frame)
+	}
+
+	if status := post(announced.ClientID, ""); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 when the callback fails, got %d", status)
+	}
+	if status := post("missing", "hello"); status != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown client, got %d", status)
+	}
+}
+
+func TestSessionHandler_ReadYourWrites(t *testing.T) {
+	// The rate limit holds the second echo back for about 100ms
+	server := gosse.NewServer(gosse.WithHistory(10), gosse.WithRateLimit(10, 1))
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	session, err := gosse.NewSessionHandler(server, func(r *http.Request, client *gosse.Client, msg []byte) error {
+		_ = server.SendMessageToClient(client.ID, []byte("first"))
+		return server.SendMessageToClient(client.ID, []byte("second"))
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error creating session handler: %v", err)
+	}
+	ts := httptest.NewServer(session)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+	var announced struct {
+		ClientID string `json:"client_id"`
+	}
+	_ = json.Unmarshal([]byte(strings.TrimPrefix(readFrame(t, reader), "event: session\ndata: ")), &announced)
+
+	start := time.Now()
+	post, err := http.Post(ts.URL+"/"+announced.ClientID+"/send", "text/plain", strings.NewReader("go"))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	post.Body.Close()
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected the POST to wait for the held event, returned after %v", elapsed)
+	}
+	if id := post.Header.Get("Last-Event-ID"); id != "0" {
+		t.Errorf("Expected Last-Event-ID 0 with only targeted messages, got %q", id)
+	}
+	for _, want := range []string{"data: first\n", "data: second\n"} {
+		if frame := readFrame(t, reader); frame != want {
+			t.Errorf("Expected frame %q, got %q", want, frame)
+		}
+	}
+}
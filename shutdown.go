@@ -0,0 +1,110 @@
+package gosse
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// ShutdownReport tells what a graceful shutdown delivered, so operators and
+// tests can check that events pending at shutdown reached their clients.
+type ShutdownReport struct {
+	Clients  int           // Clients disconnected by the shutdown.
+	Pending  int           // Events queued for them when it began.
+	Flushed  int           // Pending events written to streams, or left readable on Client.Messages.
+	Dropped  int           // Pending events streams had not written when they ended or the context was done.
+	Duration time.Duration // Time from the start of the shutdown until the streams ended or the context was done.
+}
+
+// WithShutdownEvent makes every stream served by a Handler end with ev when
+// the server shuts down, after the events queued for it. A Name such as
+// "server-closing" lets browsers tell a planned shutdown from a failure,
+// and a Retry spreads out their reconnections, for example to give a
+// rolling deploy time to bring the next instance up. Clients consumed
+// through Client.Messages do not receive it. It returns an error wrapping
+// ErrInvalidOption if ev's ID or Name contains a line break or its Retry
+// is negative.
+func WithShutdownEvent(ev Event) Option {
+	return func(o *options) error {
+		if err := ev.validate(); err != nil {
+			return err
+		}
+		ev.Data = append([]byte(nil), ev.Data...)
+		o.farewell = &ev
+		return nil
+	}
+}
+
+// shutdownTally is what the Run loop found when closing the clients on
+// shutdown.
+type shutdownTally struct {
+	clients int
+	pending int
+	streams []*Client // Clients a Handler is streaming
+}
+
+// record counts client and its queued events. It runs on the Run loop
+// before the client is closed.
+func (t *shutdownTally) record(client *Client) {
+	t.clients++
+	t.pending += len(client.messages) + int(client.held.Load())
+	if client.finished != nil {
+		t.streams = append(t.streams, client)
+	}
+}
+
+// ShutdownContext shuts the server down like Shutdown, then waits until
+// every stream served by a Handler has written the events queued for it
+// and ended, or until ctx is done, and reports the outcome. Clients
+// consumed through Client.Messages are not waited for: their queued events
+// stay readable on the closed channel. If ctx ends first, the returned
+// error wraps ctx.Err() and the report counts the events still queued as
+// dropped. With WithSink, it also waits for the sink to receive the events
+// still waiting for it.
+func (s *Server) ShutdownContext(ctx context.Context) (ShutdownReport, error) {
+	if s == nil {
+		return ShutdownReport{}, ErrNilServer
+	}
+	s.init()
+	start := s.opts.now()
+	s.Shutdown()
+	if atomic.LoadInt32(&s.running) != 0 {
+		select {
+		case <-s.stopped:
+		case <-ctx.Done():
+			return ShutdownReport{Duration: s.opts.now().Sub(start)}, fmt.Errorf("shutdown: %w", ctx.Err())
+		}
+	}
+
+	// The Run loop wrote the tally before closing stopped
+	t := &s.shutdown
+	report := ShutdownReport{Clients: t.clients, Pending: t.pending}
+	var err error
+	for _, client := range t.streams {
+		if err == nil {
+			select {
+			case <-client.finished:
+			case <-ctx.Done():
+				err = fmt.Errorf("shutdown: %w", ctx.Err())
+			}
+		}
+		// What the stream has not written is still queued or held back
+		report.Dropped += len(client.messages) + int(client.held.Load())
+	}
+	if report.Dropped > report.Pending {
+		// An event moving from the queue to the rate limiter while the
+		// tally was taken was counted in neither
+		report.Pending = report.Dropped
+	}
+	report.Flushed = report.Pending - report.Dropped
+	if s.sinkDone != nil && err == nil && atomic.LoadInt32(&s.running) != 0 {
+		select {
+		case <-s.sinkDone:
+		case <-ctx.Done():
+			err = fmt.Errorf("shutdown: flush sink: %w", ctx.Err())
+		}
+	}
+	report.Duration = s.opts.now().Sub(start)
+	return report, err
+}
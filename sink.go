@@ -0,0 +1,187 @@
+package gosse
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Sink receives a copy of every broadcast and topic event, to archive
+// streams to files, object storage or a warehouse for audit and replay
+// tooling (see WithSink). Event.PublishedAt tells when each event was
+// published. Write is never called concurrently. ArchiveSink writes events
+// to a file or any io.Writer.
+type Sink interface {
+	Write(Event) error
+}
+
+// BatchSink is a Sink that takes whole batches, such as one object per
+// batch in S3. WithSink calls WriteBatch instead of Write for sinks that
+// implement it. The slice is only valid until WriteBatch returns.
+type BatchSink interface {
+	Sink
+	WriteBatch([]Event) error
+}
+
+// sinkQueueSize bounds the events waiting for the sink. Publishers never
+// wait for the sink; beyond this, events are dropped.
+const sinkQueueSize = 4096
+
+// Defaults of WithSinkRetry.
+const (
+	defaultSinkAttempts = 3
+	defaultSinkBackoff  = 100 * time.Millisecond
+)
+
+// WithSink tees every broadcast (BroadcastMessage, BroadcastEvent,
+// BroadcastJSON and the like) and every event published to a topic,
+// through Publish, PublishKeyed, TryPublish or a route (see AddRoute),
+// into sink; broadcasts have an empty Event.Topic. Events
+// are handed over in batches of up to batchSize, once a batch is full or
+// flushInterval after its first event, from a goroutine of their own, so
+// a slow sink does not hold up publishers. A failed batch is retried (see
+// WithSinkRetry) and then dropped. Events the sink never received, because
+// their batch failed or more than 4096 were waiting, are logged and counted
+// in Metrics.SinkDropped. On shutdown the waiting events are flushed;
+// ShutdownContext waits for that.
+func WithSink(sink Sink, batchSize int, flushInterval time.Duration) Option {
+	return func(o *options) error {
+		if sink == nil {
+			return invalidOption("WithSink", "nil", "must not be nil")
+		}
+		if batchSize < 1 {
+			return invalidOption("WithSink", batchSize, "batch size must be at least 1")
+		}
+		if flushInterval <= 0 {
+			return invalidOption("WithSink", flushInterval, "flush interval must be positive")
+		}
+		o.sink = sink
+		o.sinkBatch = batchSize
+		o.sinkFlush = flushInterval
+		return nil
+	}
+}
+
+// WithSinkRetry sets how many times in total the sink is given a batch
+// before it is dropped, and how long to wait before the second attempt,
+// doubling for each one after. The defaults are 3 attempts and 100ms.
+func WithSinkRetry(attempts int, backoff time.Duration) Option {
+	return func(o *options) error {
+		if attempts < 1 {
+			return invalidOption("WithSinkRetry", attempts, "must be at least 1")
+		}
+		if backoff < 0 {
+			return invalidOption("WithSinkRetry", backoff, "must not be negative")
+		}
+		o.sinkAttempts = attempts
+		o.sinkBackoff = backoff
+		return nil
+	}
+}
+
+// teeSink queues a copy of ev, published at now, for the sink, if there is
+// one. The data is copied because callers may reuse their buffer once
+// Publish returns.
+func (s *Server) teeSink(ev Event, now time.Time) {
+	if s.sinkQueue == nil {
+		return
+	}
+	ev.Data = append([]byte(nil), ev.Data...)
+	if ev.at.IsZero() {
+		ev.at = now
+	}
+	select {
+	case s.sinkQueue <- ev:
+	default:
+		if atomic.AddUint64(&s.metrics.sinkDropped, 1) == 1 {
+			s.logf(LevelWarn, "sink queue full, dropping events; see Metrics.SinkDropped")
+		}
+	}
+}
+
+// runSink hands the queued events to the sink in batches until the server
+// shuts down, then flushes what is left.
+func (s *Server) runSink() {
+	defer close(s.sinkDone)
+	var batch []Event
+	var timer *time.Timer
+	var flushC <-chan time.Time
+	flush := func() {
+		if timer != nil {
+			timer.Stop()
+		}
+		flushC = nil
+		s.writeSink(batch)
+		batch = nil
+	}
+	add := func(ev Event) {
+		batch = append(batch, ev)
+		if len(batch) == 1 {
+			timer = time.NewTimer(s.opts.sinkFlush)
+			flushC = timer.C
+		}
+		if len(batch) >= s.opts.sinkBatch {
+			flush()
+		}
+	}
+	for {
+		select {
+		case ev := <-s.sinkQueue:
+			add(ev)
+		case <-flushC:
+			flush()
+		case <-s.done:
+			// Shutdown waited for in-flight publishes, so the queue is
+			// complete
+			for {
+				select {
+				case ev := <-s.sinkQueue:
+					add(ev)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// writeSink gives batch to the sink, retrying as set with WithSinkRetry.
+// Events a plain Sink has accepted are not written again on retries.
+func (s *Server) writeSink(batch []Event) {
+	if len(batch) == 0 {
+		return
+	}
+	written := 0
+	write := func() error {
+		if bs, ok := s.opts.sink.(BatchSink); ok {
+			if err := bs.WriteBatch(batch); err != nil {
+				return err
+			}
+			written = len(batch)
+			return nil
+		}
+		for ; written < len(batch); written++ {
+			if err := s.opts.sink.Write(batch[written]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	backoff := s.opts.sinkBackoff
+	for attempt := 1; ; attempt++ {
+		err := write()
+		if err == nil {
+			return
+		}
+		if attempt == s.opts.sinkAttempts {
+			lost := len(batch) - written
+			atomic.AddUint64(&s.metrics.sinkDropped, uint64(lost))
+			s.logf(LevelError, "sink dropped %d events after %d attempts: %v", lost, attempt, err)
+			return
+		}
+		s.logf(LevelWarn, "sink write failed (attempt %d of %d), retrying in %s: %v", attempt, s.opts.sinkAttempts, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
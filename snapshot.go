@@ -0,0 +1,54 @@
+package gosse
+
+import (
+	"sort"
+	"strconv"
+)
+
+// Snapshot returns the latest retained event of each named topic, or of
+// every topic if none are named, together with a cursor. A
+// server-rendered page can embed the events as its initial state and pass
+// the cursor as the Last-Event-ID of its SSE connection, which then resumes
+// exactly after the snapshot: every event published later is replayed or
+// delivered live, and none published earlier is repeated.
+//
+// Resuming needs the history enabled with WithHistory; without it the
+// cursor is empty and the events are in the order of topics rather than
+// oldest first. Topics that have never been published to are left out.
+func (s *Server) Snapshot(topics ...string) ([]Event, string) {
+	if s == nil {
+		return nil, ""
+	}
+	if len(topics) == 0 {
+		for _, info := range s.Topics() {
+			topics = append(topics, info.Name)
+		}
+	}
+
+	// Publishes hold the read side while they record their event, so
+	// nothing can slip in between reading the topics and the cursor
+	s.stateM.Lock()
+	var events []Event
+	for _, name := range topics {
+		t, ok := s.topics.Load(name)
+		if !ok {
+			continue
+		}
+		state := t.(*topicState)
+		state.mu.Lock()
+		if state.retained != nil {
+			ev := *state.retained
+			ev.Data = append([]byte(nil), ev.Data...)
+			events = append(events, ev)
+		}
+		state.mu.Unlock()
+	}
+	var cursor string
+	if s.history != nil {
+		cursor = strconv.FormatUint(s.history.newest(), 10)
+	}
+	s.stateM.Unlock()
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].seq < events[j].seq })
+	return events, cursor
+}
@@ -5,51 +5,121 @@
 package gosse
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"io"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// Client represents a single SSE (Server-Sent Events) client connection.
-// It contains fields for uniquely identifying the client, managing message
-// communication, and tracking connection and activity times.
-type Client struct {
-	ID           string      // Unique identifier for the client.
-	Message      chan []byte // Channel for receiving messages from the server.
-	ConnectedAt  time.Time   // Timestamp when the client initially connected to the server.
-	LastActiveAt time.Time   // Timestamp of the client's last activity, updated on each message received.
-}
-
 // Server manages the connected SSE (Server-Sent Events) clients.
 // It uses a thread-safe sync.Map to store clients, and channels (add and remove)
 // for adding and removing clients respectively. The done channel signals
 // shutdown, and clientCount tracks the current number of connected clients
 // with clientCountM used to synchronize updates safely.
+//
+// The zero value is ready to use, and methods called on a nil *Server return
+// ErrNilServer (or do nothing) instead of panicking.
 type Server struct {
 	clients      sync.Map      // Map to store connected clients (thread-safe)
 	add          chan *Client  // Channel for adding clients
 	remove       chan string   // Channel for removing clients by ID
 	done         chan struct{} // Channel to signal shutdown
+	doneOnce     sync.Once     // Guards closing done so Shutdown is idempotent
+	initOnce     sync.Once     // Guards lazy initialization of a zero-value Server
+	running      int32         // Set to 1 (atomically) once the Run loop has started
+	started      chan struct{} // Closed once the Run loop has started
+	opts         options       // Configuration from NewServer's Options; runtime-tunable fields are guarded by optsM
+	optsM        sync.RWMutex  // Guards opts against UpdateConfig
+	reloaded     chan struct{} // Closed and replaced by UpdateConfig to notify handlers
+	state        serverState   // Lifecycle state, guarded by stateM
+	maintenance  maintenance   // Maintenance mode, guarded by stateM
+	standby      bool          // Clients are turned away until Promote, guarded by stateM
+	stateM       sync.RWMutex  // Held for reading by publishes, for writing by Shutdown
 	clientCount  int           // Track current number of clients
 	clientCountM sync.Mutex    // Mutex to synchronize client count updates
+	metrics      metrics       // Counters reported by Metrics
+	topics       sync.Map      // Topic name to *topicState, reported by Topics
+	monitor      monitorState  // Ops event stream served by AdminHandler
+	history      *history      // Recent events for replay, nil if WithHistory is not set
+
+	publishQuota  publishQuota // Enforces WithPublishRate
+	bufferedBytes atomic.Int64 // Payload bytes queued for streamed clients, see WithMaxBufferedBytes
+
+	identitiesM sync.Mutex
+	identities  map[string]*identity // Coalesced identities with live connections, guarded by identitiesM
+
+	routesM sync.Mutex
+	routes  atomic.Pointer[[]*route] // Registered by AddRoute, replaced as a whole under routesM
+
+	aliasesM sync.Mutex
+	aliases  atomic.Pointer[aliasTable] // Registered by AddTopicAlias, replaced as a whole under aliasesM, nil for none
+
+	stopped  chan struct{} // Closed once the Run loop has closed every client on shutdown
+	shutdown shutdownTally // What the shutdown found, written by the Run loop before stopped is closed
+
+	sinkQueue chan Event    // Events waiting for WithSink's sink, nil if there is none
+	sinkDone  chan struct{} // Closed once runSink has flushed the queue on shutdown
+
+	traces deliveryTraces // Records of traced events, see DeliveryTrace
+
+	roomsM      sync.Mutex
+	rooms       map[string]map[string]*Client  // Room to its members by client ID, guarded by roomsM
+	clientRooms map[string]map[string]struct{} // Client ID to the rooms it is in, guarded by roomsM
 }
 
+// serverState describes where a Server is in its lifecycle.
+type serverState int
+
+const (
+	stateOpen   serverState = iota // Accepting clients and publishes
+	stateClosed                    // Shutdown has been called
+)
+
 // NewServer creates a new Server instance with initialized fields.
 // It sets up a thread-safe map for storing connected clients,
 // channels for adding and removing clients, and signaling shutdown.
 // The client count is initialized to zero, and a mutex is used to synchronize
 // updates to the client count.
-func NewServer() *Server {
-	return &Server{
+//
+// The server is configured with opts (see the With* functions). NewServer
+// panics if any option is invalid; use New to handle the error instead.
+func NewServer(opts ...Option) *Server {
+	s, err := New(opts...)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// New is like NewServer but returns an error instead of panicking when an
+// option is invalid. The error wraps ErrInvalidOption and lists every
+// rejected option.
+func New(opts ...Option) (*Server, error) {
+	o, err := newOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
 		clients:      sync.Map{},          // Initialize thread-safe map for clients
 		add:          make(chan *Client),  // Initialize channel for adding clients
 		remove:       make(chan string),   // Initialize channel for removing clients
 		done:         make(chan struct{}), // Initialize channel for signaling shutdown
 		clientCount:  0,                   // Initialize client count
 		clientCountM: sync.Mutex{},        // Initialize mutex for client count synchronization
+		opts:         o,                   // Validated configuration
+		reloaded:     make(chan struct{}), // Initialize channel for signaling configuration updates
+		history:      newHistory(o.historySize, o.now, o.retention),
+		standby:      o.standby,
 	}
+	if o.autoRun && s.start() {
+		go s.loop()
+	}
+	return s, nil
 }
 
 // Run starts the Server to manage SSE clients asynchronously.
@@ -64,140 +134,746 @@ func NewServer() *Server {
 //
 // This function runs indefinitely until the 'done' channel is closed,
 // ensuring proper client management and shutdown handling in a concurrent environment.
+//
+// If Run is called again while the loop is running, the extra call blocks
+// until the server is shut down without starting a second loop. A server
+// created with WithAutoRun is already running, so Run need not be called.
 func (s *Server) Run() {
+	if s == nil {
+		return
+	}
+	if !s.start() {
+		<-s.done
+		return
+	}
+	s.loop()
+}
+
+// start marks the server as running and reports whether the caller won the
+// right to run its loop, which it must then do.
+func (s *Server) start() bool {
+	s.init()
+	if !atomic.CompareAndSwapInt32(&s.running, 0, 1) {
+		return false
+	}
+	close(s.started)
+	if len(s.opts.alerts) > 0 {
+		go s.watchAlerts()
+	}
+	if s.sinkQueue != nil {
+		go s.runSink()
+	}
+	if s.opts.topicExpiry > 0 {
+		go s.watchTopics()
+	}
+	if s.opts.idleTimeout > 0 {
+		go s.watchIdle()
+	}
+	s.subscribeBroker()
+	return true
+}
+
+// loop is the body of Run; it must only be started once per Server.
+func (s *Server) loop() {
 	for {
 		select {
 		case client := <-s.add:
-			// Add client to the map with generated ID
+			// Add client to the map with generated ID; its slot in the
+			// client count was reserved by AddClientContext
 			s.clients.Store(client.ID, client)
-			// Increment client count safely
-			s.incrementClientCount()
+			s.countConnect()
+			s.countSubscribers(client, 1)
+			s.trackSubscribers(client, 1)
+			s.emitOps(opsEvent{Type: "connect", Client: client.ID})
+			if s.opts.onConnect != nil {
+				s.opts.onConnect(client.Info())
+			}
+			close(client.registered) // Let AddClientContext return
 
 		case clientID := <-s.remove:
 			// Remove client from the map by ID
-			if client, ok := s.clients.Load(clientID); ok {
+			if client, ok := s.loadClient(clientID); ok {
 				s.clients.Delete(clientID)
+				s.countSubscribers(client, -1)
+				s.trackSubscribers(client, -1)
 				// Close client's message channel
-				close(client.(*Client).Message)
+				client.close(DisconnectClientRemoved)
 				// Decrement client count safely
 				s.decrementClientCount()
 			}
 
 		case <-s.done:
 			// Cleanup all clients on shutdown
-			s.clients.Range(func(key, value interface{}) bool {
-				client := value.(*Client)
-				close(client.Message) // Close client's message channel
+			s.rangeClients(func(client *Client) bool {
+				s.shutdown.record(client)
+				client.close(DisconnectServerShutdown) // Close client's message channel
 				return true
 			})
+			close(s.stopped)
 			return
 		}
 	}
 }
 
+// init lazily creates the channels and default configuration of a zero-value
+// Server. Servers built with NewServer already have them, so init leaves
+// those untouched.
+func (s *Server) init() {
+	s.initOnce.Do(func() {
+		s.opts.applyDefaults()
+		if s.add == nil {
+			s.add = make(chan *Client)
+		}
+		if s.remove == nil {
+			s.remove = make(chan string)
+		}
+		if s.done == nil {
+			s.done = make(chan struct{})
+		}
+		if s.reloaded == nil {
+			s.reloaded = make(chan struct{})
+		}
+		if s.started == nil {
+			s.started = make(chan struct{})
+		}
+		if s.stopped == nil {
+			s.stopped = make(chan struct{})
+		}
+		if s.opts.sink != nil {
+			s.sinkQueue = make(chan Event, sinkQueueSize)
+			s.sinkDone = make(chan struct{})
+		}
+	})
+}
+
+// startGrace is how long AddClient, RemoveClient and publishes wait for Run
+// to start before failing with ErrNotRunning. It covers the common
+// `go server.Run()` followed immediately by AddClient or BroadcastMessage,
+// where the goroutine may not have been scheduled yet.
+const startGrace = time.Second
+
+// waitRunning waits up to startGrace for the Run loop to start, so that
+// AddClient and RemoveClient return an error instead of blocking forever, and
+// publishes one instead of going nowhere, on a server whose Run call was
+// forgotten.
+func (s *Server) waitRunning(ctx context.Context) error {
+	select {
+	case <-s.started:
+		return nil
+	default:
+	}
+	timer := time.NewTimer(startGrace)
+	defer timer.Stop()
+	select {
+	case <-s.started:
+		return nil
+	case <-s.done:
+		return ErrServerClosed
+	case <-ctx.Done():
+		return fmt.Errorf("wait for Run: %w", ctx.Err())
+	case <-timer.C:
+		return fmt.Errorf("%w: call Run before using the server", ErrNotRunning)
+	}
+}
+
 // AddClient adds a new client to the server.
 // It optionally accepts a buffer size for the client's message channel.
-// If no buffer size is specified, a default size of 10 is used.
+// If no buffer size is specified, the size set with WithBufferSize is used,
+// which defaults to 10.
+// AddClient blocks until the Run loop registers the client. If Run has not
+// been started, it gives up after a short grace period (see AddClientContext).
+//
+// AddClient is lossy: it reports every failure as a nil *Client and drops the
+// reason. Use AddClientContext to find out why a client could not be added.
 //
 // Parameters:
 //   - bufferSize: Optional integer specifying the size of the buffered channel for messages.
 //
 // Returns:
-//   - *Client: A pointer to the newly created Client instance.
+//   - *Client: A pointer to the newly created Client instance, or nil if the
+//     server has been shut down or bufferSize is invalid (see AddClientContext).
 func (s *Server) AddClient(bufferSize ...int) *Client {
-	size := 10 // Default buffer size
-	if len(bufferSize) > 0 {
-		size = bufferSize[0] // Use the provided buffer size if specified
-	}
-	client := &Client{
-		ID:           s.generateClientID(),
-		Message:      make(chan []byte, size), // Use the specified or default buffer size
-		ConnectedAt:  time.Now(),
-		LastActiveAt: time.Now(),
+	client, err := s.AddClientContext(context.Background(), bufferSize...)
+	if err != nil {
+		return nil
 	}
-	s.add <- client // Send client to 'add' channel for processing in Run()
 	return client
 }
 
+// AddClientContext is like AddClient but gives up when ctx is done or the
+// server is shut down before Run registers the client.
+//
+// Returns:
+//   - *Client: A pointer to the newly created Client instance.
+//   - error: ctx.Err() wrapped with context, ErrServerClosed, ErrNotRunning
+//     if Run has not started within a short grace period, ErrMaintenance
+//     in maintenance mode, ErrStandby before a standby is promoted, or
+//     ErrInvalidOption if bufferSize is not a single positive integer.
+func (s *Server) AddClientContext(ctx context.Context, bufferSize ...int) (*Client, error) {
+	if s == nil {
+		return nil, ErrNilServer
+	}
+	s.init()
+	size, err := clientBufferSize(bufferSize, s.opts.bufferSize)
+	if err != nil {
+		return nil, err
+	}
+	return s.addClient(ctx, size, nil, nil)
+}
+
+// addClient registers a new client with the given buffer size, subscribed
+// to topics. It backs AddClientContext and SubscribeContext.
+func (s *Server) addClient(ctx context.Context, size int, topics []string, setup func(*Client)) (_ *Client, err error) {
+	defer func() {
+		if err != nil {
+			s.countConnectFailure()
+		}
+	}()
+	if err := s.admitError(); err != nil {
+		return nil, err
+	}
+	if err := s.waitRunning(ctx); err != nil {
+		return nil, err
+	}
+	if !s.reserveClientSlot() {
+		return nil, fmt.Errorf("%w: limit is %d", ErrTooManyClients, s.tunables().maxClients)
+	}
+	client := newClient(s.generateClientID(), size, s.opts.now)
+	client.onClose = s.clientClosed
+	client.server = s
+	client.onDrop = func(ev Event) {
+		s.countDrop(ev)
+		s.traceDelivery(ev, client.ID, DeliveryDropped, ErrBufferFull)
+		s.emitOps(opsEvent{Type: "drop", Client: client.ID, Topic: ev.Topic})
+		if s.opts.onDropped != nil {
+			s.opts.onDropped(client.ID, ev)
+		}
+	}
+	client.subscribe(topics)
+	if setup != nil {
+		setup(client) // Before anything can be delivered to it
+	}
+	select {
+	case s.add <- client: // Send client to 'add' channel for processing in Run()
+		// Wait until the client is in the map, so it can be addressed by
+		// ID as soon as AddClient returns
+		<-client.registered
+		return client, nil
+	case <-s.done:
+		s.abandon(client)
+		return nil, ErrServerClosed
+	case <-ctx.Done():
+		s.abandon(client)
+		return nil, fmt.Errorf("add client: %w", ctx.Err())
+	}
+}
+
+// abandon releases what addClient reserved for a client that was never
+// registered: its ID, its slot in the client count and its identity.
+func (s *Server) abandon(client *Client) {
+	s.clients.Delete(client.ID)
+	s.decrementClientCount()
+	if client.identity != nil {
+		s.leaveIdentity(client.identity.name)
+	}
+}
+
+// defaultClientBufferSize is the message buffer size used when AddClient is
+// called without one and WithBufferSize is not set.
+const defaultClientBufferSize = 10
+
+// clientBufferSize validates the optional buffer size passed to AddClient,
+// returning fallback if none was given. A zero-sized buffer would make every
+// non-blocking send fail, and negative sizes cannot be allocated, so both are
+// rejected.
+func clientBufferSize(bufferSize []int, fallback int) (int, error) {
+	switch {
+	case len(bufferSize) == 0:
+		return fallback, nil
+	case len(bufferSize) > 1:
+		return 0, invalidOption("bufferSize", bufferSize, "at most one buffer size may be given")
+	case bufferSize[0] < 1:
+		return 0, invalidOption("bufferSize", bufferSize[0], "must be at least 1")
+	}
+	return bufferSize[0], nil
+}
+
 // RemoveClient removes a client from the server by ID.
 // It sends the client ID to the 'remove' channel for processing in the Run method.
+// Removing a client that is unknown or already removed is a no-op, and after
+// Shutdown the call returns immediately instead of waiting for Run.
 //
 // Parameters:
 //   - clientID: The unique identifier of the client to be removed.
 func (s *Server) RemoveClient(clientID string) {
-	s.remove <- clientID // Send clientID to 'remove' channel for processing in Run()
+	_ = s.RemoveClientContext(context.Background(), clientID)
+}
+
+// RemoveClientContext is like RemoveClient but gives up when ctx is done
+// before Run accepts the removal, returning ctx.Err() wrapped with context,
+// or ErrNotRunning if Run has not started within a short grace period.
+func (s *Server) RemoveClientContext(ctx context.Context, clientID string) error {
+	if s == nil {
+		return ErrNilServer
+	}
+	s.init()
+	if err := s.waitRunning(ctx); err != nil {
+		if errors.Is(err, ErrServerClosed) {
+			return nil // Nothing left to remove
+		}
+		return err
+	}
+	select {
+	case s.remove <- clientID: // Send clientID to 'remove' channel for processing in Run()
+		return nil
+	case <-s.done:
+		// Run has stopped (or is stopping) and closes every client itself
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("remove client %s: %w", clientID, ctx.Err())
+	}
 }
 
 // BroadcastMessage sends a message to all connected clients.
 // It iterates over the clients stored in the Server's sync.Map (`clients`), attempting
-// to send the provided `msg` to each client's Message channel. This is done in a non-blocking
+// to send the provided `msg` to each client's message channel. This is done in a non-blocking
 // manner to ensure the server continues functioning even if some clients are not ready to receive messages.
 //
 // The function does the following:
 // 1. Retrieves each client from the sync.Map (`clients`).
-// 2. Attempts to send the provided message (`msg`) to the client's Message channel.
-// 3. Updates the client's LastActiveAt timestamp to the current time if the message is successfully sent.
-// 4. Logs a message indicating the client's unavailability if the Message channel is not ready to receive the message.
+// 2. Attempts to send the provided message (`msg`) to the client's message channel.
+// 3. Updates the client's last activity timestamp (see Client.LastActiveAt) to the current time if the message is successfully sent.
+// 4. Records an error for the client if the message channel is not ready to receive the message.
 //
 // Parameters:
 //   - msg: The message to be sent to all connected clients, represented as a byte slice.
+//
+// The returned error wraps ErrServerClosed after Shutdown, ErrNotRunning
+// before Run has started, ErrMaintenance while publishes are paused (see
+// EnterMaintenance), and ErrQuotaExceeded beyond the publish rate (see
+// WithPublishRate). Otherwise it joins
+// (see errors.Join) one error per client whose message channel was full, each
+// wrapping ErrClientNotReady and ErrBufferFull and naming the client, so every
+// failed delivery is reported rather than only the last one.
 func (s *Server) BroadcastMessage(msg []byte) error {
-	var err error
-	s.clients.Range(func(key, value interface{}) bool {
-		client := value.(*Client)
-		select {
-		case client.Message <- msg:
-			client.LastActiveAt = time.Now()
-		default:
-			err = fmt.Errorf("client %s is not ready to receive messages", key)
+	if s == nil {
+		return ErrNilServer
+	}
+	return s.broadcastEvent(Event{Data: msg})
+}
+
+// BroadcastEvent sends ev to every client, like BroadcastMessage, with its
+// ID, Name and Retry written as the frame's id, event and retry fields, so
+// browsers can dispatch it to addEventListener(ev.Name) and adjust their
+// reconnection delay, and its Fields as extra fields. The SSE spec calls
+// the name field "event"; it is Name here because an Event.Event field
+// would read poorly. With WithHistory, the history numbers the event and
+// its ID is replaced. BroadcastEvent reports errors like BroadcastMessage,
+// and one wrapping ErrInvalidOption if the ID, name or a field contains a
+// line break or Retry is negative.
+func (s *Server) BroadcastEvent(ev Event) error {
+	if s == nil {
+		return ErrNilServer
+	}
+	if err := ev.validate(); err != nil {
+		return err
+	}
+	return s.broadcastEvent(Event{Data: ev.Data, ID: ev.ID, Name: ev.Name, Retry: ev.Retry, Schema: ev.Schema, Fields: ev.Fields, Trace: ev.Trace})
+}
+
+// BroadcastWhere sends msg, like BroadcastMessage, to the clients filter
+// accepts, for example those connected for more than an hour or with some
+// metadata (see Client.SetMetadata and BroadcastMessageWhere). filter is
+// called once per client while the clients are iterated, so it must be
+// quick and must not call back into the server. Clients that set a filter
+// (see Client.SetFilter) must also match it. The message is not kept in
+// the history, as a replay could not tell who it was for. It reports
+// errors like BroadcastMessage, and one wrapping ErrInvalidOption if
+// filter is nil.
+func (s *Server) BroadcastWhere(msg []byte, filter func(*Client) bool) error {
+	if s == nil {
+		return ErrNilServer
+	}
+	if filter == nil {
+		return invalidOption("BroadcastWhere", "nil", "filter must not be nil")
+	}
+	return s.broadcastMatching(Event{Data: msg}, filter)
+}
+
+// broadcastMatching delivers ev to the clients match accepts, bypassing
+// the history, and joins the errors.
+func (s *Server) broadcastMatching(ev Event, match func(*Client) bool) error {
+	if err := s.acquireOpen(); err != nil {
+		return err
+	}
+	defer s.releaseOpen()
+	if err := s.admitPublish(); err != nil {
+		return err
+	}
+	s.countPublish(ev)
+	var errs []error
+	in := &filterInput{data: ev.Data}
+	s.rangeClients(func(client *Client) bool {
+		if !match(client) || !client.wants(in) {
+			return true
+		}
+		if err := s.deliver(client, ev); err != nil {
+			errs = append(errs, err)
 		}
 		return true
 	})
-	return err
+	return errors.Join(errs...)
+}
+
+// broadcastEvent is BroadcastMessage for a prepared event.
+func (s *Server) broadcastEvent(ev Event) error {
+	result, err := s.fanOutAll(ev)
+	if err != nil {
+		return err
+	}
+	return errors.Join(result.errs...)
+}
+
+// fanOutAll offers ev to every client, then hands it to the broker (see
+// WithBroker). err is set only if the broadcast is rejected as a whole.
+func (s *Server) fanOutAll(ev Event) (result fanOutResult, err error) {
+	if result, err = s.offerAll(ev, true); err == nil {
+		s.relay(result.kept)
+	}
+	return result, err
+}
+
+// offerAll is fanOutAll without the broker. admit applies the publish
+// quota.
+func (s *Server) offerAll(ev Event, admit bool) (result fanOutResult, err error) {
+	if err := s.acquireOpen(); err != nil {
+		return result, err
+	}
+	defer s.releaseOpen()
+	if admit {
+		if err := s.admitPublish(); err != nil {
+			return result, err
+		}
+	}
+	s.countPublish(ev)
+	ev = s.history.append(ev)
+	s.teeSink(ev, s.opts.now())
+	result = s.broadcast(ev, true)
+	result.kept = ev
+	return result, nil
+}
+
+// broadcast delivers ev to every client, or with filtered set to those
+// whose filter (see Client.SetFilter) it matches. Callers hold the read
+// side of stateM.
+func (s *Server) broadcast(ev Event, filtered bool) (result fanOutResult) {
+	in := &filterInput{data: ev.Data}
+	s.rangeClients(func(client *Client) bool {
+		if filtered && !client.wants(in) {
+			return true
+		}
+		result.record(s.deliver(client, ev))
+		return true
+	})
+	return result
+}
+
+// TryBroadcast is BroadcastEvent for producers that react to partial
+// delivery: like TryPublish, it reports how many clients queued ev and how
+// many dropped it because their buffer was full. err is set only if the
+// broadcast is rejected as a whole, for the reasons BroadcastEvent gives;
+// per-client failures are reflected in the counts instead.
+func (s *Server) TryBroadcast(ev Event) (accepted, dropped int, err error) {
+	if s == nil {
+		return 0, 0, ErrNilServer
+	}
+	if err := ev.validate(); err != nil {
+		return 0, 0, err
+	}
+	result, err := s.fanOutAll(Event{Data: ev.Data, ID: ev.ID, Name: ev.Name, Retry: ev.Retry, Schema: ev.Schema, Fields: ev.Fields, Trace: ev.Trace})
+	return result.accepted, result.dropped, err
 }
 
 // SendMessageToClient sends a message to a specific client by their ID.
 // It retrieves the client's connection from the server's sync.Map (`clients`)
-// and attempts to send the provided `msg` to the client's Message channel.
-// If the client is not found, or if the client's Message channel is not ready to
-// receive the message (non-blocking send), it returns an appropriate error.
+// and attempts to send the provided `msg` to the client's message channel.
+// If the client is not found, or if the client's message channel is not ready to
+// receive the message (non-blocking send), it returns an appropriate error
+// wrapping ErrClientNotFound, ErrClientNotReady, ErrServerClosed,
+// ErrNotRunning, ErrMaintenance or ErrQuotaExceeded.
 func (s *Server) SendMessageToClient(clientID string, msg []byte) error {
-	if client, ok := s.clients.Load(clientID); ok {
-		select {
-		case client.(*Client).Message <- msg: // Send message to client's message channel
-			client.(*Client).LastActiveAt = time.Now()
-			return nil
-		default:
-			return fmt.Errorf("client %s is not ready to receive messages", clientID)
-		}
-	} else {
-		return fmt.Errorf("client %s not found", clientID)
+	if s == nil {
+		return ErrNilServer
+	}
+	return s.sendEvent(clientID, Event{Data: msg})
+}
+
+// SendEventToClient sends ev to one client, like SendMessageToClient, with
+// its ID, Name, Retry and Fields written as the frame's fields (see
+// BroadcastEvent).
+// It reports errors like SendMessageToClient, and one wrapping
+// ErrInvalidOption for an event BroadcastEvent would reject.
+func (s *Server) SendEventToClient(clientID string, ev Event) error {
+	if s == nil {
+		return ErrNilServer
+	}
+	if err := ev.validate(); err != nil {
+		return err
 	}
+	return s.sendEvent(clientID, Event{Data: ev.Data, ID: ev.ID, Name: ev.Name, Retry: ev.Retry, Schema: ev.Schema, Fields: ev.Fields, Trace: ev.Trace})
+}
+
+// sendEvent is SendMessageToClient for a prepared event.
+func (s *Server) sendEvent(clientID string, ev Event) error {
+	if err := s.acquireOpen(); err != nil {
+		return err
+	}
+	defer s.releaseOpen()
+	if client, ok := s.loadClient(clientID); ok {
+		return s.sendAdmitted(client, ev)
+	}
+	return fmt.Errorf("%w: %s", ErrClientNotFound, clientID)
+}
+
+// sendAdmitted delivers ev to client as a targeted send, subject to the
+// publish quota. Callers hold the read side of stateM.
+func (s *Server) sendAdmitted(client *Client, ev Event) error {
+	if err := s.admitPublish(); err != nil {
+		return err
+	}
+	s.countPublish(ev)
+	return s.deliver(client, ev) // Send message to client's message channel
+}
+
+// SendMessageToClientContext is like SendMessageToClient, but instead of
+// failing when the client's message channel is full it waits for space until
+// ctx is done. It returns ctx.Err() wrapped with context if the wait is cut
+// short, and ErrServerClosed if the server shuts down in the meantime.
+func (s *Server) SendMessageToClientContext(ctx context.Context, clientID string, msg []byte) error {
+	if s == nil {
+		return ErrNilServer
+	}
+	if err := s.acquireOpen(); err != nil {
+		return err
+	}
+	client, ok := s.loadClient(clientID)
+	// Release before blocking so a waiting send never holds up Shutdown
+	s.releaseOpen()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrClientNotFound, clientID)
+	}
+	if err := s.admitPublish(); err != nil {
+		return err
+	}
+	ev := Event{Data: msg}
+	s.countPublish(ev)
+	err := client.sendContext(ctx, ev)
+	if err == nil {
+		s.countDelivery(ev)
+	}
+	if errors.Is(err, ErrClientNotReady) && s.isClosed() {
+		return ErrServerClosed
+	}
+	return err
+}
+
+// SendMessageToClientWithDeadline is a middle ground between
+// SendMessageToClient, which fails at once when the client's message
+// channel is full, and SendMessageToClientContext, which may wait for as
+// long as its context allows: it waits up to d for space, then fails with an
+// error wrapping ErrDeadlineExceeded and ErrBufferFull. A d of zero or less
+// makes a single attempt, like SendMessageToClient.
+func (s *Server) SendMessageToClientWithDeadline(clientID string, msg []byte, d time.Duration) error {
+	if s == nil {
+		return ErrNilServer
+	}
+	if d <= 0 {
+		return s.SendMessageToClient(clientID, msg)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	err := s.SendMessageToClientContext(ctx, clientID, msg)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w: client %s: no room within %v", ErrDeadlineExceeded, ErrBufferFull, clientID, d)
+	}
+	return err
 }
 
 // Shutdown gracefully shuts down the SSE server.
 // It closes the 'done' channel, which signals the Run() method to initiate
-// shutdown and cleanup of all connected clients.
+// shutdown and cleanup of all connected clients. Calling Shutdown more than
+// once is safe. ShutdownContext also waits for the streams to end and
+// reports what they delivered, and WithShutdownEvent sends them a final
+// event.
 func (s *Server) Shutdown() {
-	close(s.done) // Signal 'done' channel to initiate shutdown in Run()
+	if s == nil {
+		return
+	}
+	s.init()
+	s.doneOnce.Do(func() {
+		// Wait for in-flight publishes and reject new ones
+		s.stateM.Lock()
+		s.state = stateClosed
+		s.stateM.Unlock()
+
+		close(s.done) // Signal 'done' channel to initiate shutdown in Run()
+		s.closeBroker()
+	})
+}
+
+// acquireOpen returns nil if the server is accepting publishes and, if so,
+// holds the read side of stateM until releaseOpen is called. Shutdown
+// takes the write side, so it waits for in-flight publishes to finish before
+// Run starts closing client channels, and publishes that start afterwards
+// observe stateClosed and return ErrServerClosed. While publishes are paused
+// for maintenance, it returns an error wrapping ErrMaintenance. Before Run has
+// started it waits like AddClient does, then fails with ErrNotRunning: no
+// client can be registered yet, so the publish would otherwise be silently
+// lost.
+func (s *Server) acquireOpen() error {
+	if atomic.LoadInt32(&s.running) == 0 {
+		s.init()
+		if err := s.waitRunning(context.Background()); err != nil {
+			return err
+		}
+	}
+	s.stateM.RLock()
+	switch {
+	case s.state == stateClosed:
+		s.stateM.RUnlock()
+		return ErrServerClosed
+	case s.maintenance.paused:
+		err := s.maintenance.err()
+		s.stateM.RUnlock()
+		return err
+	}
+	return nil
+}
+
+// isClosed reports whether Shutdown has been called.
+func (s *Server) isClosed() bool {
+	s.stateM.RLock()
+	defer s.stateM.RUnlock()
+	return s.state == stateClosed
+}
+
+// releaseOpen releases the read lock taken by a successful acquireOpen.
+func (s *Server) releaseOpen() {
+	s.stateM.RUnlock()
+}
+
+// loadClient returns the registered client with the given ID. IDs that are
+// only reserved by generateClientID are reported as missing.
+func (s *Server) loadClient(clientID string) (*Client, bool) {
+	value, ok := s.clients.Load(clientID)
+	if !ok {
+		return nil, false
+	}
+	client, ok := value.(*Client)
+	return client, ok
+}
+
+// rangeClients calls fn for every registered client until fn returns false,
+// skipping IDs that are only reserved by generateClientID.
+func (s *Server) rangeClients(fn func(client *Client) bool) {
+	s.clients.Range(func(key, value interface{}) bool {
+		client, ok := value.(*Client)
+		if !ok {
+			return true
+		}
+		return fn(client)
+	})
+}
+
+// deliver queues ev for client according to the server's backpressure
+// policy, evicting the client if the policy is Disconnect and its buffer is
+// full.
+func (s *Server) deliver(client *Client, ev Event) error {
+	err := client.send(ev, s.opts.backpressure)
+	if err == nil {
+		s.countDelivery(ev)
+		s.traceDelivery(ev, client.ID, DeliveryQueued, nil)
+	}
+	if err != nil && s.opts.backpressure == Disconnect && errors.Is(err, ErrBufferFull) {
+		s.evict(client)
+	}
+	return err
+}
+
+// clientClosed counts and logs a client's disconnect, then passes its final
+// record to the OnDisconnect hook, if any.
+func (s *Server) clientClosed(info ClientInfo) {
+	if info.Identity != "" {
+		s.leaveIdentity(info.Identity)
+	}
+	s.leaveRooms(info.ID)
+	s.countDisconnect(info.Reason)
+	s.emitOps(opsEvent{Type: "disconnect", Client: info.ID, Reason: info.Reason})
+	if info.Err != nil {
+		s.logf(info.Reason.logLevel(), "client %s disconnected: %s: %v", info.ID, info.Reason, info.Err)
+	} else {
+		s.logf(info.Reason.logLevel(), "client %s disconnected: %s", info.ID, info.Reason)
+	}
+	if s.opts.onDisconnect != nil {
+		s.opts.onDisconnect(info)
+	}
+}
+
+// RevokeClient disconnects a client whose authorization has been withdrawn,
+// for example after logout or a permission change. Its ClientInfo reports
+// DisconnectAuthRevoked. It returns an error wrapping ErrClientNotFound if
+// no client has the given ID.
+func (s *Server) RevokeClient(clientID string) error {
+	if s == nil {
+		return ErrNilServer
+	}
+	client, ok := s.loadClient(clientID)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrClientNotFound, clientID)
+	}
+	// Record the reason first; removal keeps the first reason recorded
+	client.disconnect(DisconnectAuthRevoked, nil)
+	return s.RemoveClientContext(context.Background(), clientID)
+}
+
+// evict disconnects a slow client. The client is closed right away so its
+// handler returns; the map entry and count are cleaned up by the Run loop.
+func (s *Server) evict(client *Client) {
+	s.logf(LevelWarn, "evicting client %s: buffer full", client.ID)
+	client.close(DisconnectEvictedSlow)
+	go s.RemoveClient(client.ID)
+}
+
+// notReadyError builds the error returned when a client's message channel
+// cannot accept another message.
+func notReadyError(clientID string) error {
+	return fmt.Errorf("%w: client %s: %w", ErrClientNotReady, clientID, ErrBufferFull)
 }
 
 // ClientCount returns the current number of connected clients.
 // It synchronizes access to the client count using a mutex to prevent
 // concurrent modifications during read operations.
 func (s *Server) ClientCount() int {
+	if s == nil {
+		return 0
+	}
 	s.clientCountM.Lock()
 	defer s.clientCountM.Unlock()
 	return s.clientCount // Return current client count
 }
 
-// incrementClientCount safely increments the client count.
+// reserveClientSlot safely increments the client count unless that would
+// exceed the WithMaxClients limit, reporting whether a slot was reserved.
 // It acquires a mutex lock before incrementing to prevent
 // concurrent modifications to the client count.
-func (s *Server) incrementClientCount() {
+func (s *Server) reserveClientSlot() bool {
 	s.clientCountM.Lock()
 	defer s.clientCountM.Unlock()
+	if limit := s.tunables().maxClients; limit > 0 && s.clientCount >= limit {
+		return false
+	}
 	s.clientCount++ // Increment client count
+	return true
 }
 
 // decrementClientCount safely decrements the client count.
@@ -214,46 +890,73 @@ func (s *Server) decrementClientCount() {
 // The function ensures the uniqueness of the generated ID within the server's client map.
 //
 // The function performs the following steps:
-// 1. Defines a constant `idLength` which sets the length of the client ID to 20 characters.
-// 2. Generates a random byte slice of length `idLength`.
-// 3. Encodes the byte slice to a base64 URL-safe string and truncates it to `idLength`.
-// 4. Checks if the generated ID is unique within the server's client map:
+// 1. Generates a candidate ID with the WithIDGenerator function, if any, or randomClientID.
+// 2. Falls back to fallbackClientID if the system's random source fails.
+// 3. Checks if the generated ID is unique within the server's client map:
 //   - If the ID is unique, it is stored in the client map and returned.
-//   - If the ID already exists, a new random byte slice is generated, and the process is repeated.
+//   - If the ID already exists, a new candidate is generated, and the process is repeated.
 //
 // Error Handling:
-// - If the random byte generation fails, the function panics with the encountered error.
+//   - A failing random source never panics; the time+counter fallback keeps the
+//     host process running and IDs unique, at the cost of being predictable.
 //
 // Returns:
-// - A unique client ID as a 20-character long base64 URL-safe string.
+// - A unique client ID as a 20-character long string.
 func (s *Server) generateClientID() string {
-	const idLength = 20 // Length of the client ID
-
-	// Generate a random byte slice of appropriate length
-	randomBytes := make([]byte, idLength)
-	_, err := rand.Read(randomBytes)
-	if err != nil {
-		// Handle error, if any
-		panic(err) // Example: for simplicity
+	// Give a custom generator a few attempts before falling back
+	if s.opts.idGenerator != nil {
+		for attempt := 0; attempt < maxCustomIDAttempts; attempt++ {
+			clientID, err := s.opts.idGenerator()
+			if err != nil || clientID == "" {
+				s.logf(LevelWarn, "custom ID generator failed (%v), using built-in IDs", err)
+				break
+			}
+			if _, exists := s.clients.LoadOrStore(clientID, struct{}{}); !exists {
+				return clientID
+			}
+		}
 	}
 
-	// Encode the byte slice to a base64 URL-safe string
-	clientID := base64.URLEncoding.EncodeToString(randomBytes)[:idLength]
-
-	// Ensure the generated ID is unique
 	for {
-		_, exists := s.clients.LoadOrStore(clientID, struct{}{})
-		if !exists {
-			break
-		}
-		// If ID already exists, generate a new one
-		_, err := rand.Read(randomBytes)
+		clientID, err := randomClientID()
 		if err != nil {
-			// Handle error, if any
-			panic(err) // Example: for simplicity
+			s.logf(LevelError, "random source failed (%v), using time-based client ID", err)
+			clientID = fallbackClientID()
+		}
+
+		// Ensure the generated ID is unique
+		if _, exists := s.clients.LoadOrStore(clientID, struct{}{}); !exists {
+			return clientID
 		}
-		clientID = base64.URLEncoding.EncodeToString(randomBytes)[:idLength]
 	}
+}
+
+// maxCustomIDAttempts bounds how often a WithIDGenerator function is retried
+// when it returns IDs that are already in use.
+const maxCustomIDAttempts = 3
+
+// clientIDLength is the length of generated client IDs.
+const clientIDLength = 20
+
+// fallbackCounter disambiguates fallback IDs generated within the same nanosecond.
+var fallbackCounter uint32
+
+// randReader is the source of random client IDs. It is a variable so tests
+// can simulate a failing random source.
+var randReader io.Reader = rand.Reader
+
+// randomClientID returns a base64 URL-safe ID built from randReader bytes.
+func randomClientID() (string, error) {
+	randomBytes := make([]byte, clientIDLength)
+	if _, err := io.ReadFull(randReader, randomBytes); err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(randomBytes)[:clientIDLength], nil
+}
 
-	return clientID
+// fallbackClientID returns an ID made of the current time in nanoseconds and a
+// process-wide counter. It is used only when crypto/rand is unavailable.
+func fallbackClientID() string {
+	n := atomic.AddUint32(&fallbackCounter, 1)
+	return fmt.Sprintf("%016x%04x", uint64(time.Now().UnixNano()), n&0xffff)
 }
@@ -3,11 +3,15 @@ package gosse_test
 import (
 	"bufio"
 	"bytes"
-	"fmt"
-	"github.com/Firoz01/gosse"
+	"context"
+	"errors"
+	"github.com/Firoz01/gosse/v2"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -63,9 +67,9 @@ func TestSSEHandler_BroadcastMessage(t *testing.T) {
 
 	// Verify client received the message
 	select {
-	case msg := <-client.Message:
-		if !bytes.Equal(msg, message) {
-			t.Errorf("Expected message %s, got %s", message, msg)
+	case ev := <-client.Messages():
+		if !bytes.Equal(ev.Data, message) {
+			t.Errorf("Expected message %s, got %s", message, ev.Data)
 		}
 	case <-time.After(100 * time.Millisecond):
 		t.Error("Timeout waiting for message")
@@ -93,13 +97,15 @@ func TestSSEHandlerEndpoint(t *testing.T) {
 		// Perform a request to the test server
 		req, err := http.NewRequest("GET", ts.URL, nil)
 		if err != nil {
-			t.Fatalf("Failed to create request: %v", err)
+			t.Errorf("Failed to create request: %v", err)
+			return
 		}
 
 		// Perform the request
 		resp, err := http.DefaultClient.Do(req)
 		if err != nil {
-			t.Fatalf("Request failed: %v", err)
+			t.Errorf("Request failed: %v", err)
+			return
 		}
 		defer resp.Body.Close()
 
@@ -119,7 +125,8 @@ func TestSSEHandlerEndpoint(t *testing.T) {
 		for {
 			line, err := reader.ReadString('\n')
 			if err != nil {
-				t.Fatalf("Failed to read SSE response body: %v", err)
+				t.Errorf("Failed to read SSE response body: %v", err)
+				return
 			}
 			if strings.HasPrefix(line, "data: ") {
 				received <- line
@@ -170,9 +177,9 @@ func TestSSEHandler_SendMessageToClient(t *testing.T) {
 
 	// Verify the specific client received the message
 	select {
-	case msg := <-client.Message:
-		if !bytes.Equal(msg, message) {
-			t.Errorf("Expected message %s, got %s", message, msg)
+	case ev := <-client.Messages():
+		if !bytes.Equal(ev.Data, message) {
+			t.Errorf("Expected message %s, got %s", message, ev.Data)
 		}
 	case <-time.After(100 * time.Millisecond):
 		t.Error("Timeout waiting for message")
@@ -191,8 +198,1100 @@ func TestSSEHandler_SendMessageToClient(t *testing.T) {
 	// Attempt to send a message to a non-existent client
 	err = server.SendMessageToClient(nonExistentClientID, message)
 
-	// Check if the error matches the expected "not found" message
-	if err != nil && err.Error() != fmt.Sprintf("client %s not found", nonExistentClientID) {
+	// Check if the error is the expected "not found" sentinel
+	if !errors.Is(err, gosse.ErrClientNotFound) {
 		t.Errorf("Unexpected error sending message to non-existent client: %v", err)
 	}
 }
+
+func TestSSEHandler_SentinelErrors(t *testing.T) {
+	server := gosse.NewServer()
+
+	// Start the server
+	go server.Run()
+
+	// Add a client with a single-slot buffer
+	client := server.AddClient(1)
+
+	// Wait briefly to ensure client addition is processed
+	time.Sleep(50 * time.Millisecond)
+
+	// Fill the buffer, then expect the next send to report a full buffer
+	if err := server.SendMessageToClient(client.ID, []byte("first")); err != nil {
+		t.Fatalf("Unexpected error on first send: %v", err)
+	}
+	err := server.SendMessageToClient(client.ID, []byte("second"))
+	if !errors.Is(err, gosse.ErrClientNotReady) || !errors.Is(err, gosse.ErrBufferFull) {
+		t.Errorf("Expected ErrClientNotReady and ErrBufferFull, got %v", err)
+	}
+
+	// After shutdown every publish reports ErrServerClosed
+	server.Shutdown()
+	if err := server.BroadcastMessage([]byte("late")); !errors.Is(err, gosse.ErrServerClosed) {
+		t.Errorf("Expected ErrServerClosed, got %v", err)
+	}
+}
+
+func TestSSEHandler_BroadcastWhere(t *testing.T) {
+	server := gosse.NewServer(gosse.WithAutoRun())
+	defer server.Shutdown()
+
+	old := server.AddClient()
+	time.Sleep(10 * time.Millisecond)
+	cutoff := time.Now()
+	fresh := server.AddClient()
+
+	err := server.BroadcastWhere([]byte("welcome"), func(client *gosse.Client) bool {
+		return client.ConnectedAt.After(cutoff)
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error broadcasting: %v", err)
+	}
+	select {
+	case ev := <-fresh.Messages():
+		if string(ev.Data) != "welcome" {
+			t.Errorf("Expected the welcome message, got %q", ev.Data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for the welcome message")
+	}
+	select {
+	case ev := <-old.Messages():
+		t.Errorf("Expected the older client to get nothing, got %q", ev.Data)
+	default:
+	}
+
+	if err := server.BroadcastWhere([]byte("x"), nil); !errors.Is(err, gosse.ErrInvalidOption) {
+		t.Errorf("Expected ErrInvalidOption for a nil filter, got %v", err)
+	}
+}
+
+func TestSSEHandler_BroadcastMessageReportsEveryFailure(t *testing.T) {
+	server := gosse.NewServer()
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	// Add two clients with single-slot buffers and one with room to spare
+	first := server.AddClient(1)
+	second := server.AddClient(1)
+	server.AddClient(5)
+
+	// Wait briefly to ensure client addition is processed
+	time.Sleep(50 * time.Millisecond)
+
+	// The first broadcast fills the single-slot buffers
+	if err := server.BroadcastMessage([]byte("one")); err != nil {
+		t.Fatalf("Unexpected error on first broadcast: %v", err)
+	}
+
+	// The second broadcast must report both full clients
+	err := server.BroadcastMessage([]byte("two"))
+	if !errors.Is(err, gosse.ErrBufferFull) {
+		t.Fatalf("Expected ErrBufferFull, got %v", err)
+	}
+	for _, id := range []string{first.ID, second.ID} {
+		if !strings.Contains(err.Error(), id) {
+			t.Errorf("Expected error to mention client %s, got %v", id, err)
+		}
+	}
+}
+
+func TestSSEHandler_RemoveClientIsIdempotent(t *testing.T) {
+	server := gosse.NewServer()
+
+	// Start the server
+	go server.Run()
+
+	client := server.AddClient()
+
+	// Wait briefly to ensure client addition is processed
+	time.Sleep(50 * time.Millisecond)
+
+	// Keep publishing while the client is removed repeatedly
+	stop := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				_ = server.SendMessageToClient(client.ID, []byte("ping"))
+				_ = server.BroadcastMessage([]byte("ping"))
+			}
+		}
+	}()
+
+	server.RemoveClient(client.ID)
+	server.RemoveClient(client.ID)
+	close(stop)
+
+	// Removal and shutdown after shutdown must not block or panic
+	server.Shutdown()
+	server.Shutdown()
+	server.RemoveClient(client.ID)
+
+	if server.ClientCount() != 0 {
+		t.Errorf("Expected client count 0 after removal, got %d", server.ClientCount())
+	}
+}
+
+func TestSSEHandler_BroadcastDuringShutdown(t *testing.T) {
+	server := gosse.NewServer()
+
+	// Start the server
+	go server.Run()
+
+	for i := 0; i < 5; i++ {
+		server.AddClient(1000)
+	}
+
+	// Wait briefly to ensure client addition is processed
+	time.Sleep(50 * time.Millisecond)
+
+	// Publish continuously until the server reports that it is closed
+	result := make(chan error)
+	go func() {
+		for {
+			err := server.BroadcastMessage([]byte("tick"))
+			if errors.Is(err, gosse.ErrServerClosed) {
+				result <- nil
+				return
+			}
+			// Nobody drains the clients, so full buffers are expected
+			if err != nil && !errors.Is(err, gosse.ErrBufferFull) {
+				result <- err
+				return
+			}
+		}
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	server.Shutdown()
+
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Errorf("Unexpected broadcast error during shutdown: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("Timeout waiting for broadcast to observe shutdown")
+	}
+}
+
+func TestSSEHandler_ContextVariants(t *testing.T) {
+	server := gosse.NewServer()
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	client, err := server.AddClientContext(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("Unexpected error adding client: %v", err)
+	}
+
+	// Fill the buffer, then wait for space freed by a reader
+	if err := server.SendMessageToClient(client.ID, []byte("first")); err != nil {
+		t.Fatalf("Unexpected error on first send: %v", err)
+	}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		<-client.Messages()
+	}()
+	if err := server.SendMessageToClientContext(context.Background(), client.ID, []byte("second")); err != nil {
+		t.Errorf("Expected send to wait for space, got %v", err)
+	}
+
+	// A full buffer and an expired context report the deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := server.SendMessageToClientContext(ctx, client.ID, []byte("third")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+
+	// A delivery deadline gives up the same way, or succeeds once there is room
+	err = server.SendMessageToClientWithDeadline(client.ID, []byte("third"), 20*time.Millisecond)
+	if !errors.Is(err, gosse.ErrDeadlineExceeded) || !errors.Is(err, gosse.ErrBufferFull) {
+		t.Errorf("Expected ErrDeadlineExceeded and ErrBufferFull, got %v", err)
+	}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		<-client.Messages()
+	}()
+	if err := server.SendMessageToClientWithDeadline(client.ID, []byte("fourth"), time.Second); err != nil {
+		t.Errorf("Expected send to wait for space within the deadline, got %v", err)
+	}
+	if err := server.SendMessageToClientWithDeadline("missing", []byte("x"), time.Second); !errors.Is(err, gosse.ErrClientNotFound) {
+		t.Errorf("Expected ErrClientNotFound, got %v", err)
+	}
+
+	if err := server.RemoveClientContext(context.Background(), client.ID); err != nil {
+		t.Errorf("Unexpected error removing client: %v", err)
+	}
+}
+
+func TestSSEHandler_AddClientValidatesBufferSize(t *testing.T) {
+	server := gosse.NewServer()
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	for _, sizes := range [][]int{{0}, {-1}, {5, 10}} {
+		client, err := server.AddClientContext(context.Background(), sizes...)
+		if !errors.Is(err, gosse.ErrInvalidOption) {
+			t.Errorf("Expected ErrInvalidOption for buffer sizes %v, got %v", sizes, err)
+		}
+		if client != nil {
+			t.Errorf("Expected no client for buffer sizes %v", sizes)
+		}
+	}
+
+	if server.AddClient(0) != nil {
+		t.Error("Expected AddClient to reject a zero buffer size")
+	}
+}
+
+func TestSSEHandler_DisconnectReason(t *testing.T) {
+	server := gosse.NewServer()
+
+	// Start the server
+	go server.Run()
+
+	removed := server.AddClient()
+	remaining := server.AddClient()
+
+	// Wait briefly to ensure client addition is processed
+	time.Sleep(50 * time.Millisecond)
+
+	if !removed.Info().Connected() {
+		t.Fatalf("Expected client to be connected, got %+v", removed.Info())
+	}
+
+	server.RemoveClient(removed.ID)
+	server.Shutdown()
+
+	// Wait for the channels to be closed
+	for range removed.Messages() {
+	}
+	for range remaining.Messages() {
+	}
+
+	if reason := removed.Info().Reason; reason != gosse.DisconnectClientRemoved {
+		t.Errorf("Expected reason %q, got %q", gosse.DisconnectClientRemoved, reason)
+	}
+	if reason := remaining.Info().Reason; reason != gosse.DisconnectServerShutdown {
+		t.Errorf("Expected reason %q, got %q", gosse.DisconnectServerShutdown, reason)
+	}
+	if remaining.Info().DisconnectedAt.IsZero() {
+		t.Error("Expected DisconnectedAt to be set")
+	}
+}
+
+func TestSSEHandler_NilAndZeroValueServer(t *testing.T) {
+	// Methods on a nil server report ErrNilServer instead of panicking
+	var nilServer *gosse.Server
+	if err := nilServer.BroadcastMessage([]byte("x")); !errors.Is(err, gosse.ErrNilServer) {
+		t.Errorf("Expected ErrNilServer, got %v", err)
+	}
+	if _, err := nilServer.AddClientContext(context.Background()); !errors.Is(err, gosse.ErrNilServer) {
+		t.Errorf("Expected ErrNilServer, got %v", err)
+	}
+	if nilServer.AddClient() != nil || nilServer.ClientCount() != 0 {
+		t.Error("Expected nil server to have no clients")
+	}
+	nilServer.RemoveClient("missing")
+	nilServer.Shutdown()
+
+	// A zero-value server without Run must report ErrNotRunning, not block
+	var server gosse.Server
+	defer server.Shutdown()
+
+	if _, err := server.AddClientContext(context.Background()); !errors.Is(err, gosse.ErrNotRunning) {
+		t.Fatalf("Expected ErrNotRunning, got %v", err)
+	}
+	// Publishing would otherwise reach no one without saying so
+	if err := server.BroadcastMessage([]byte("lost")); !errors.Is(err, gosse.ErrNotRunning) {
+		t.Errorf("Expected ErrNotRunning from BroadcastMessage, got %v", err)
+	}
+	if err := server.Publish("news", []byte("lost")); !errors.Is(err, gosse.ErrNotRunning) {
+		t.Errorf("Expected ErrNotRunning from Publish, got %v", err)
+	}
+
+	go server.Run()
+	client, err := server.AddClientContext(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error adding client after Run: %v", err)
+	}
+	if err := server.SendMessageToClient(client.ID, []byte("hello")); err != nil {
+		t.Errorf("Unexpected error sending to client: %v", err)
+	}
+}
+
+// failingReader simulates a random source that is unavailable.
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("entropy unavailable")
+}
+
+func TestSSEHandler_ClientIDFallback(t *testing.T) {
+	restore := gosse.SetRandReader(failingReader{})
+	defer restore()
+
+	server := gosse.NewServer()
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	// IDs must stay unique without panicking while the random source fails
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		client := server.AddClient()
+		if client == nil {
+			t.Fatal("Expected a client despite the failing random source")
+		}
+		if seen[client.ID] {
+			t.Fatalf("Duplicate client ID %q", client.ID)
+		}
+		seen[client.ID] = true
+	}
+}
+
+func TestSSEHandler_AddClientReturnsRegisteredClient(t *testing.T) {
+	server := gosse.NewServer()
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	// Without any waiting, the client must be addressable right away
+	for i := 0; i < 100; i++ {
+		client := server.AddClient()
+		if err := server.SendMessageToClient(client.ID, []byte("hello")); err != nil {
+			t.Fatalf("Expected client to be registered on return, got %v", err)
+		}
+	}
+}
+
+func TestSSEHandler_OnDisconnectHook(t *testing.T) {
+	records := make(chan gosse.ClientInfo, 1)
+	server := gosse.NewServer(gosse.WithOnDisconnect(func(info gosse.ClientInfo) {
+		records <- info
+	}))
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gosse.SSEHandlerEndpoint(server, w, r)
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, "GET", ts.URL, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// The peer going away is reported as client_closed
+	cancel()
+	select {
+	case info := <-records:
+		if info.Reason != gosse.DisconnectClientClosed {
+			t.Errorf("Expected reason %q, got %q", gosse.DisconnectClientClosed, info.Reason)
+		}
+		if info.DisconnectedAt.IsZero() {
+			t.Error("Expected DisconnectedAt in the final record")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for the OnDisconnect hook")
+	}
+}
+
+func TestSSEHandler_SendMessageToClientRacingRemoval(t *testing.T) {
+	server := gosse.NewServer()
+
+	// Start the server
+	go server.Run()
+	defer server.Shutdown()
+
+	for i := 0; i < 50; i++ {
+		client := server.AddClient()
+		var wg sync.WaitGroup
+		for j := 0; j < 4; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := server.SendMessageToClient(client.ID, []byte("racing"))
+				if err != nil && !errors.Is(err, gosse.ErrClientNotFound) && !errors.Is(err, gosse.ErrClientNotReady) {
+					t.Errorf("Unexpected error sending during removal: %v", err)
+				}
+			}()
+		}
+		server.RemoveClient(client.ID)
+		wg.Wait()
+	}
+}
+
+func TestSSEHandler_AutoRun(t *testing.T) {
+	server := gosse.NewServer(gosse.WithAutoRun())
+
+	// No Run call: the server is usable as soon as it is created
+	client, err := server.AddClientContext(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error adding client: %v", err)
+	}
+	if err := server.BroadcastMessage([]byte("hello")); err != nil {
+		t.Fatalf("Unexpected error broadcasting: %v", err)
+	}
+	if ev := <-client.Messages(); string(ev.Data) != "hello" {
+		t.Errorf("Expected hello, got %q", ev.Data)
+	}
+
+	// An extra Run call returns once Shutdown stops the loop
+	ran := make(chan struct{})
+	go func() {
+		server.Run()
+		close(ran)
+	}()
+	server.Shutdown()
+	<-ran
+	if _, ok := <-client.Messages(); ok {
+		t.Error("Expected the client channel to be closed by Shutdown")
+	}
+}
+
+func TestSSEHandler_TryPublish(t *testing.T) {
+	server := gosse.NewServer(gosse.WithAutoRun(), gosse.WithBufferSize(1))
+	defer server.Shutdown()
+
+	fast, err := server.SubscribeContext(context.Background(), "news")
+	if err != nil {
+		t.Fatalf("Unexpected error subscribing: %v", err)
+	}
+	if _, err := server.SubscribeContext(context.Background(), "news"); err != nil {
+		t.Fatalf("Unexpected error subscribing: %v", err)
+	}
+
+	accepted, dropped, err := server.TryPublish("news", gosse.Event{Data: []byte("first"), Name: "headline"})
+	if err != nil || accepted != 2 || dropped != 0 {
+		t.Fatalf("Expected 2 accepted and none dropped, got %d, %d, %v", accepted, dropped, err)
+	}
+	if ev := <-fast.Messages(); string(ev.Data) != "first" || ev.Name != "headline" || ev.Topic != "news" {
+		t.Errorf("Unexpected event %+v", ev)
+	}
+
+	// The slow subscriber's buffer is still full
+	accepted, dropped, err = server.TryPublish("news", gosse.Event{Data: []byte("second")})
+	if err != nil || accepted != 1 || dropped != 1 {
+		t.Errorf("Expected 1 accepted and 1 dropped, got %d, %d, %v", accepted, dropped, err)
+	}
+
+	if _, _, err := server.TryPublish("", gosse.Event{}); !errors.Is(err, gosse.ErrInvalidOption) {
+		t.Errorf("Expected ErrInvalidOption for an empty topic, got %v", err)
+	}
+	if _, _, err := server.TryPublish("news", gosse.Event{Name: "a\nb"}); !errors.Is(err, gosse.ErrInvalidOption) {
+		t.Errorf("Expected ErrInvalidOption for a multi-line name, got %v", err)
+	}
+}
+
+func TestSSEHandler_TryBroadcast(t *testing.T) {
+	server := gosse.NewServer(gosse.WithAutoRun(), gosse.WithBufferSize(1))
+	defer server.Shutdown()
+	fast, slow := server.AddClient(), server.AddClient()
+
+	accepted, dropped, err := server.TryBroadcast(gosse.Event{Data: []byte("first"), Name: "headline"})
+	if err != nil || accepted != 2 || dropped != 0 {
+		t.Fatalf("Expected 2 accepted and none dropped, got %d, %d, %v", accepted, dropped, err)
+	}
+	<-fast.Messages()
+
+	// The slow client's buffer is still full
+	accepted, dropped, err = server.TryBroadcast(gosse.Event{Data: []byte("second")})
+	if err != nil || accepted != 1 || dropped != 1 {
+		t.Errorf("Expected 1 accepted and 1 dropped, got %d, %d, %v", accepted, dropped, err)
+	}
+	<-fast.Messages()
+	err = server.BroadcastMessage([]byte("third"))
+	if !errors.Is(err, gosse.ErrBufferFull) || !strings.Contains(err.Error(), slow.ID) || strings.Contains(err.Error(), fast.ID) {
+		t.Errorf("Expected the joined error to name only the slow client, got %v", err)
+	}
+
+	if _, _, err := server.TryBroadcast(gosse.Event{Name: "a\nb"}); !errors.Is(err, gosse.ErrInvalidOption) {
+		t.Errorf("Expected ErrInvalidOption for a multi-line name, got %v", err)
+	}
+}
+
+func TestSSEHandler_Routes(t *testing.T) {
+	server := gosse.NewServer(gosse.WithAutoRun())
+	defer server.Shutdown()
+
+	all, err := server.SubscribeContext(context.Background(), "all-errors")
+	if err != nil {
+		t.Fatalf("Unexpected error subscribing: %v", err)
+	}
+	removeErrors, err := server.AddRoute(gosse.Route{Topic: "*.errors", To: "all-errors"})
+	if err != nil {
+		t.Fatalf("Unexpected error adding route: %v", err)
+	}
+	_, err = server.AddRoute(gosse.Route{Topic: "*", Name: "alert", To: "all-errors", Transform: func(ev gosse.Event) (gosse.Event, bool) {
+		ev.Data = append([]byte("ALERT: "), ev.Data...)
+		return ev, true
+	}})
+	if err != nil {
+		t.Fatalf("Unexpected error adding route: %v", err)
+	}
+
+	_ = server.Publish("billing.errors", []byte("card declined"))
+	_ = server.Publish("billing.info", []byte("invoice sent"))
+	_, _, _ = server.TryPublish("disk", gosse.Event{Data: []byte("full"), Name: "alert"})
+	for _, want := range []string{"card declined", "ALERT: full"} {
+		select {
+		case ev := <-all.Messages():
+			if string(ev.Data) != want || ev.Topic != "all-errors" {
+				t.Errorf("Expected %q on all-errors, got %q on %s", want, ev.Data, ev.Topic)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for %q", want)
+		}
+	}
+
+	// Removed routes no longer apply
+	removeErrors()
+	_ = server.Publish("billing.errors", []byte("ignored"))
+	select {
+	case ev := <-all.Messages():
+		t.Errorf("Unexpected routed event %q", ev.Data)
+	default:
+	}
+
+	if _, err := server.AddRoute(gosse.Route{Topic: "[", To: "x"}); !errors.Is(err, gosse.ErrInvalidOption) {
+		t.Errorf("Expected ErrInvalidOption for a malformed pattern, got %v", err)
+	}
+	if _, err := server.AddRoute(gosse.Route{Topic: "*"}); !errors.Is(err, gosse.ErrInvalidOption) {
+		t.Errorf("Expected ErrInvalidOption without a target, got %v", err)
+	}
+}
+
+func TestSSEHandler_Groups(t *testing.T) {
+	server := gosse.NewServer(gosse.WithAutoRun(), gosse.WithBufferSize(32))
+	defer server.Shutdown()
+
+	// Three workers share the jobs; an auditor outside the group sees all
+	var workers []*gosse.Client
+	for i := 0; i < 3; i++ {
+		worker, err := server.SubscribeContext(context.Background(), "jobs")
+		if err != nil {
+			t.Fatalf("Unexpected error subscribing: %v", err)
+		}
+		worker.SetGroup("jobs", "workers")
+		workers = append(workers, worker)
+	}
+	auditor, err := server.SubscribeContext(context.Background(), "jobs")
+	if err != nil {
+		t.Fatalf("Unexpected error subscribing: %v", err)
+	}
+
+	// Unkeyed events go round
+	for i := 0; i < 6; i++ {
+		_ = server.Publish("jobs", []byte("job"))
+	}
+	for i, worker := range workers {
+		if n := len(worker.Messages()); n != 2 {
+			t.Errorf("Worker %d: expected 2 jobs, got %d", i, n)
+		}
+	}
+	if n := len(auditor.Messages()); n != 6 {
+		t.Errorf("Expected the auditor to see 6 jobs, got %d", n)
+	}
+
+	// Keyed events stick to one worker per key
+	drain := func(client *gosse.Client) []string {
+		var data []string
+		for len(client.Messages()) > 0 {
+			data = append(data, string((<-client.Messages()).Data))
+		}
+		return data
+	}
+	for _, worker := range workers {
+		drain(worker)
+	}
+	keys := []string{"alpha", "beta", "gamma", "delta", "epsilon", "zeta"}
+	for round := 0; round < 2; round++ {
+		for _, key := range keys {
+			_ = server.PublishKeyed("jobs", key, []byte(key))
+		}
+	}
+	owners := map[string]int{}
+	for i, worker := range workers {
+		for _, key := range drain(worker) {
+			if owner, ok := owners[key]; ok && owner != i {
+				t.Errorf("Key %s went to workers %d and %d", key, owner, i)
+			}
+			owners[key] = i
+		}
+	}
+	if len(owners) != len(keys) {
+		t.Errorf("Expected every key delivered, got %v", owners)
+	}
+
+	// A worker leaving the group receives everything again
+	workers[0].SetGroup("jobs", "")
+	_ = server.Publish("jobs", []byte("job"))
+	if got := drain(workers[0]); len(got) != 1 {
+		t.Errorf("Expected the former member to get the job, got %q", got)
+	}
+	if n := len(workers[1].Messages()) + len(workers[2].Messages()); n != 1 {
+		t.Errorf("Expected one remaining member to get the job, got %d", n)
+	}
+}
+
+// recordingSink is a BatchSink that fails its first failures batches.
+type recordingSink struct {
+	mu       sync.Mutex
+	failures int
+	batches  [][]string
+}
+
+func (s *recordingSink) Write(ev gosse.Event) error {
+	return s.WriteBatch([]gosse.Event{ev})
+}
+
+func (s *recordingSink) WriteBatch(events []gosse.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("unavailable")
+	}
+	var batch []string
+	for _, ev := range events {
+		batch = append(batch, ev.Topic+":"+string(ev.Data))
+	}
+	s.batches = append(s.batches, batch)
+	return nil
+}
+
+func TestSSEHandler_Sink(t *testing.T) {
+	sink := &recordingSink{failures: 1}
+	server := gosse.NewServer(gosse.WithAutoRun(),
+		gosse.WithSink(sink, 2, time.Hour),
+		gosse.WithSinkRetry(2, time.Millisecond))
+
+	// The publisher's buffer is reused; the sink keeps its own copy
+	buf := []byte("a")
+	_ = server.Publish("orders", buf)
+	buf[0] = 'b'
+	_ = server.Publish("orders", buf)
+	_ = server.Publish("refunds", []byte("c")) // Waits for a full batch or shutdown
+
+	report, err := server.ShutdownContext(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error shutting down: %v (%+v)", err, report)
+	}
+	sink.mu.Lock()
+	got := sink.batches
+	sink.mu.Unlock()
+	want := [][]string{{"orders:a", "orders:b"}, {"refunds:c"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected batches %q, got %q", want, got)
+	}
+	if dropped := server.Metrics().SinkDropped; dropped != 0 {
+		t.Errorf("Expected nothing dropped, got %d", dropped)
+	}
+
+	// Batches failing every attempt are dropped and counted
+	failing := &recordingSink{failures: 2}
+	server = gosse.NewServer(gosse.WithAutoRun(),
+		gosse.WithSink(failing, 10, time.Hour),
+		gosse.WithSinkRetry(2, 0))
+	_ = server.Publish("orders", []byte("lost"))
+	if _, err := server.ShutdownContext(context.Background()); err != nil {
+		t.Fatalf("Unexpected error shutting down: %v", err)
+	}
+	if dropped := server.Metrics().SinkDropped; dropped != 1 {
+		t.Errorf("Expected 1 dropped, got %d", dropped)
+	}
+
+	if _, err := gosse.New(gosse.WithSink(nil, 1, time.Second)); !errors.Is(err, gosse.ErrInvalidOption) {
+		t.Errorf("Expected ErrInvalidOption for a nil sink, got %v", err)
+	}
+}
+
+func TestSSEHandler_ConnectAndDropHooks(t *testing.T) {
+	var mu sync.Mutex
+	var connected []string
+	var drops []string
+	server := gosse.NewServer(gosse.WithAutoRun(), gosse.WithBufferSize(1),
+		gosse.WithOnConnect(func(info gosse.ClientInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			connected = append(connected, info.ID)
+		}),
+		gosse.WithOnMessageDropped(func(clientID string, ev gosse.Event) {
+			mu.Lock()
+			defer mu.Unlock()
+			drops = append(drops, clientID+":"+string(ev.Data))
+		}))
+	defer server.Shutdown()
+
+	// The hook has run by the time the client is returned
+	client, err := server.AddClientContext(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error adding client: %v", err)
+	}
+	mu.Lock()
+	if !reflect.DeepEqual(connected, []string{client.ID}) {
+		t.Errorf("Expected OnConnect for %s, got %q", client.ID, connected)
+	}
+	mu.Unlock()
+
+	_ = server.BroadcastMessage([]byte("kept"))
+	_ = server.BroadcastMessage([]byte("lost"))
+	mu.Lock()
+	if want := []string{client.ID + ":lost"}; !reflect.DeepEqual(drops, want) {
+		t.Errorf("Expected drops %q, got %q", want, drops)
+	}
+	mu.Unlock()
+
+	if _, err := gosse.New(gosse.WithOnConnect(nil), gosse.WithOnMessageDropped(nil)); !errors.Is(err, gosse.ErrInvalidOption) {
+		t.Errorf("Expected ErrInvalidOption for nil hooks, got %v", err)
+	}
+}
+
+func TestSSEHandler_ArchiveReplay(t *testing.T) {
+	// Archive four events, the first three a second apart
+	var clock atomic.Int64
+	var archive bytes.Buffer
+	recorder := gosse.NewServer(gosse.WithAutoRun(),
+		gosse.WithClock(func() time.Time { return time.Unix(clock.Load(), 0) }),
+		gosse.WithSink(gosse.NewArchiveSink(&archive), 10, time.Hour))
+	_ = recorder.Publish("orders", []byte("first"))
+	clock.Add(1)
+	_ = recorder.PublishKeyed("orders", "acme", []byte{0, 1, 2})
+	clock.Add(1)
+	_, _, _ = recorder.TryPublish("alerts", gosse.Event{Name: "alert", Data: []byte("third")})
+	_ = recorder.BroadcastEvent(gosse.Event{Name: "notice", Data: []byte("to everyone")})
+	if _, err := recorder.ShutdownContext(context.Background()); err != nil {
+		t.Fatalf("Unexpected error shutting down: %v", err)
+	}
+
+	server := gosse.NewServer(gosse.WithAutoRun())
+	defer server.Shutdown()
+	client, err := server.SubscribeContext(context.Background(), "orders", "alerts")
+	if err != nil {
+		t.Fatalf("Unexpected error subscribing: %v", err)
+	}
+
+	// At ten times the original pace, the two one-second gaps take 200ms
+	start := time.Now()
+	n, err := gosse.ReplayArchive(context.Background(), server, &archive, 10)
+	if err != nil || n != 4 {
+		t.Fatalf("Expected 4 events replayed, got %d, %v", n, err)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("Expected the replay to keep the gaps, took %v", elapsed)
+	}
+	want := []gosse.Event{
+		{Topic: "orders", Data: []byte("first")},
+		{Topic: "orders", Key: "acme", Data: []byte{0, 1, 2}},
+		{Topic: "alerts", Name: "alert", Data: []byte("third")},
+		{Name: "notice", Data: []byte("to everyone")},
+	}
+	for i, w := range want {
+		ev := <-client.Messages()
+		if ev.Topic != w.Topic || ev.Key != w.Key || ev.Name != w.Name || !bytes.Equal(ev.Data, w.Data) {
+			t.Errorf("Event %d: expected %+v, got %+v", i, w, ev)
+		}
+	}
+
+	if _, err := gosse.ReplayArchive(context.Background(), server, strings.NewReader("not json\n"), 0); err == nil {
+		t.Error("Expected an error for a malformed archive")
+	}
+}
+
+func TestServer_Rooms(t *testing.T) {
+	server := gosse.NewServer(gosse.WithAutoRun())
+	defer server.Shutdown()
+	alice, bob := server.AddClient(), server.AddClient()
+
+	for _, room := range []string{"lobby", "game-1"} {
+		if err := server.JoinRoom(alice.ID, room); err != nil {
+			t.Fatalf("Unexpected error joining %s: %v", room, err)
+		}
+	}
+	_ = server.JoinRoom(bob.ID, "lobby")
+	want := []string{alice.ID, bob.ID}
+	if want[0] > want[1] {
+		want[0], want[1] = want[1], want[0]
+	}
+	if got := server.RoomClients("lobby"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v in the lobby, got %v", want, got)
+	}
+
+	if err := server.BroadcastToRoom("game-1", []byte("move")); err != nil {
+		t.Fatalf("Unexpected error broadcasting: %v", err)
+	}
+	select {
+	case ev := <-alice.Messages():
+		if string(ev.Data) != "move" {
+			t.Errorf("Expected the move, got %q", ev.Data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for the room message")
+	}
+	select {
+	case ev := <-bob.Messages():
+		t.Errorf("Expected bob to get nothing, got %q", ev.Data)
+	default:
+	}
+
+	server.LeaveRoom(alice.ID, "game-1")
+	if got := server.RoomClients("game-1"); got != nil {
+		t.Errorf("Expected the room to be gone, got %v", got)
+	}
+
+	// Disconnected clients leave their rooms
+	server.RemoveClient(bob.ID)
+	for deadline := time.Now().Add(time.Second); len(server.RoomClients("lobby")) != 1; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected bob to leave the lobby, got %v", server.RoomClients("lobby"))
+		}
+	}
+	if err := server.JoinRoom(bob.ID, "lobby"); !errors.Is(err, gosse.ErrClientNotFound) {
+		t.Errorf("Expected ErrClientNotFound for a removed client, got %v", err)
+	}
+}
+
+func TestServer_Broker(t *testing.T) {
+	broker := gosse.NewMemoryBroker()
+	a := gosse.NewServer(gosse.WithAutoRun(), gosse.WithInstanceID("a"), gosse.WithBroker(broker.Connect()))
+	defer a.Shutdown()
+	b := gosse.NewServer(gosse.WithAutoRun(), gosse.WithInstanceID("b"), gosse.WithBroker(broker.Connect()))
+	defer b.Shutdown()
+	onA, err := a.SubscribeContext(context.Background(), "prices")
+	if err != nil {
+		t.Fatalf("Unexpected error subscribing: %v", err)
+	}
+	onB, err := b.SubscribeContext(context.Background(), "prices")
+	if err != nil {
+		t.Fatalf("Unexpected error subscribing: %v", err)
+	}
+
+	if err := a.Publish("prices", []byte("42")); err != nil {
+		t.Fatalf("Unexpected error publishing: %v", err)
+	}
+	if err := b.BroadcastEvent(gosse.Event{Data: []byte("hello"), Name: "greeting"}); err != nil {
+		t.Fatalf("Unexpected error broadcasting: %v", err)
+	}
+	for _, client := range []*gosse.Client{onA, onB} {
+		var got []string
+		for len(got) < 2 {
+			select {
+			case ev := <-client.Messages():
+				got = append(got, ev.Topic+"/"+ev.Name+"/"+string(ev.Data))
+			case <-time.After(time.Second):
+				t.Fatalf("Timeout waiting for events, got %v", got)
+			}
+		}
+		if want := []string{"prices//42", "/greeting/hello"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected %v, got %v", want, got)
+		}
+		select {
+		case ev := <-client.Messages():
+			t.Errorf("Expected each event once, also got %q", ev.Data)
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+
+	// Targeted messages stay on their server
+	if err := b.SendMessageToClient(onA.ID, []byte("x")); !errors.Is(err, gosse.ErrClientNotFound) {
+		t.Errorf("Expected ErrClientNotFound on the other server, got %v", err)
+	}
+}
+
+func TestServer_BrokerDefaultInstanceIDs(t *testing.T) {
+	// Servers of one process tell their events apart without WithInstanceID
+	broker := gosse.NewMemoryBroker()
+	a := gosse.NewServer(gosse.WithAutoRun(), gosse.WithBroker(broker.Connect()))
+	defer a.Shutdown()
+	b := gosse.NewServer(gosse.WithAutoRun(), gosse.WithBroker(broker.Connect()))
+	defer b.Shutdown()
+	if a.InstanceID() == b.InstanceID() {
+		t.Fatalf("Expected distinct default instance IDs, got %q twice", a.InstanceID())
+	}
+	onB, err := b.SubscribeContext(context.Background(), "prices")
+	if err != nil {
+		t.Fatalf("Unexpected error subscribing: %v", err)
+	}
+
+	if err := a.Publish("prices", []byte("42")); err != nil {
+		t.Fatalf("Unexpected error publishing: %v", err)
+	}
+	select {
+	case ev := <-onB.Messages():
+		if string(ev.Data) != "42" {
+			t.Errorf("Expected 42, got %q", ev.Data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for the other server's event")
+	}
+}
+
+func TestServer_TopicAlias(t *testing.T) {
+	server := gosse.NewServer(gosse.WithAutoRun())
+	defer server.Shutdown()
+	oldSub, err := server.SubscribeContext(context.Background(), "orders")
+	if err != nil {
+		t.Fatalf("Unexpected error subscribing: %v", err)
+	}
+	newSub, err := server.SubscribeContext(context.Background(), "orders.v2")
+	if err != nil {
+		t.Fatalf("Unexpected error subscribing: %v", err)
+	}
+	if err := server.AddTopicAlias("orders", "orders.v2"); err != nil {
+		t.Fatalf("Unexpected error adding the alias: %v", err)
+	}
+	if err := server.AddTopicAlias("orders.v2", "orders.v3"); !errors.Is(err, gosse.ErrInvalidOption) {
+		t.Errorf("Expected ErrInvalidOption for a chained alias, got %v", err)
+	}
+
+	// Either name reaches both subscribers
+	_ = server.Publish("orders", []byte("old"))
+	_ = server.Publish("orders.v2", []byte("new"))
+	for _, client := range []*gosse.Client{oldSub, newSub} {
+		for _, want := range []string{"old", "new"} {
+			select {
+			case ev := <-client.Messages():
+				if string(ev.Data) != want || ev.Topic != "orders.v2" {
+					t.Errorf("Expected %q on orders.v2, got %q on %s", want, ev.Data, ev.Topic)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("Timeout waiting for %q", want)
+			}
+		}
+	}
+	want := map[string]gosse.AliasMetrics{"orders": {Topic: "orders.v2", Publishes: 1, Deliveries: 2}}
+	if got := server.Metrics().TopicAliases; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected alias metrics %+v, got %+v", want, got)
+	}
+
+	server.RemoveTopicAlias("orders")
+	_ = server.Publish("orders.v2", []byte("after"))
+	select {
+	case ev := <-oldSub.Messages():
+		t.Errorf("Expected nothing by the removed alias, got %q", ev.Data)
+	case <-time.After(20 * time.Millisecond):
+	}
+	if got := server.Metrics().TopicAliases; got != nil {
+		t.Errorf("Expected no alias metrics, got %+v", got)
+	}
+}
+
+func TestServer_IdleTimeout(t *testing.T) {
+	var clock atomic.Int64
+	disconnected := make(chan gosse.ClientInfo, 10)
+	server := gosse.NewServer(gosse.WithAutoRun(),
+		gosse.WithClock(func() time.Time { return time.Unix(clock.Load(), 0) }),
+		gosse.WithIdleTimeout(20*time.Millisecond),
+		gosse.WithOnDisconnect(func(info gosse.ClientInfo) { disconnected <- info }))
+	defer server.Shutdown()
+
+	idle := server.AddClient()
+	clock.Add(60)
+	fresh := server.AddClient()
+
+	select {
+	case info := <-disconnected:
+		if info.ID != idle.ID || info.Reason != gosse.DisconnectIdle {
+			t.Errorf("Expected the idle client disconnected for idling, got %s for %s", info.ID, info.Reason)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the idle client to be disconnected")
+	}
+	if _, ok := <-idle.Messages(); ok {
+		t.Error("Expected the idle client's channel to be closed")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if err := server.SendMessageToClient(fresh.ID, []byte("still here")); err != nil {
+		t.Errorf("Expected the fresh client to stay, got %v", err)
+	}
+}
+
+func TestServer_Standby(t *testing.T) {
+	broker := gosse.NewMemoryBroker()
+	primary := gosse.NewServer(gosse.WithAutoRun(), gosse.WithInstanceID("primary"), gosse.WithBroker(broker.Connect()))
+	defer primary.Shutdown()
+	standby := gosse.NewServer(gosse.WithAutoRun(), gosse.WithInstanceID("standby"), gosse.WithBroker(broker.Connect()),
+		gosse.WithHistory(10), gosse.WithStandby())
+	defer standby.Shutdown()
+
+	if _, err := standby.AddClientContext(context.Background()); !errors.Is(err, gosse.ErrStandby) {
+		t.Fatalf("Expected ErrStandby before promotion, got %v", err)
+	}
+	if err := primary.Publish("prices", []byte("42")); err != nil {
+		t.Fatalf("Unexpected error publishing: %v", err)
+	}
+	topics := standby.Topics()
+	if len(topics) != 1 || topics[0].Retained == nil || string(topics[0].Retained.Data) != "42" {
+		t.Errorf("Expected the standby to keep the primary's event, got %+v", topics)
+	}
+
+	standby.Promote()
+	if standby.Standby() {
+		t.Error("Expected the server to be promoted")
+	}
+	if _, err := standby.AddClientContext(context.Background()); err != nil {
+		t.Errorf("Expected clients to be admitted once promoted, got %v", err)
+	}
+}
+
+func TestClient_SendAndClose(t *testing.T) {
+	reasons := make(chan gosse.DisconnectReason, 1)
+	server := gosse.NewServer(gosse.WithAutoRun(),
+		gosse.WithOnDisconnect(func(info gosse.ClientInfo) { reasons <- info.Reason }))
+	defer server.Shutdown()
+	client := server.AddClient()
+
+	if err := client.Send([]byte("hello")); err != nil {
+		t.Fatalf("Unexpected error sending: %v", err)
+	}
+	if err := client.SendEvent(gosse.Event{Data: []byte("news"), Name: "headline"}); err != nil {
+		t.Fatalf("Unexpected error sending the event: %v", err)
+	}
+	for _, want := range []string{"/hello", "headline/news"} {
+		select {
+		case ev := <-client.Messages():
+			if got := ev.Name + "/" + string(ev.Data); got != want {
+				t.Errorf("Expected %s, got %s", want, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timeout waiting for %s", want)
+		}
+	}
+	if err := client.SendEvent(gosse.Event{Name: "a\nb"}); !errors.Is(err, gosse.ErrInvalidOption) {
+		t.Errorf("Expected ErrInvalidOption for a multi-line name, got %v", err)
+	}
+
+	if err := client.Close(); err != nil {
+		t.Fatalf("Unexpected error closing: %v", err)
+	}
+	select {
+	case reason := <-reasons:
+		if reason != gosse.DisconnectClientRemoved {
+			t.Errorf("Expected %s, got %s", gosse.DisconnectClientRemoved, reason)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for the client to be removed")
+	}
+	if err := client.Send([]byte("late")); !errors.Is(err, gosse.ErrClientNotReady) {
+		t.Errorf("Expected ErrClientNotReady after Close, got %v", err)
+	}
+}
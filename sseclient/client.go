@@ -0,0 +1,375 @@
+// Package sseclient consumes Server-Sent Events streams, such as those
+// served by gosse.SSEHandlerEndpoint, from Go.
+//
+//	client, err := sseclient.New("http://localhost:8080/events",
+//		sseclient.WithIdleTimeout(time.Minute, func() { log.Print("stream went quiet") }))
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	err = client.Run(ctx, func(ev sseclient.Event) {
+//		log.Printf("%s %s: %s", ev.ID, ev.Name, ev.Data)
+//	})
+//
+// Events offers the same stream on a channel instead. The client reconnects when the stream ends or fails, sending the ID of the
+// last event it received as Last-Event-ID so the server can replay what was
+// missed (see gosse.WithHistory). A retry field sent by the server replaces
+// the reconnect delay, as it does for a browser's EventSource.
+package sseclient
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrInvalidOption is returned by New when an option is invalid.
+	ErrInvalidOption = errors.New("invalid option")
+
+	// ErrBadResponse is returned by Run when the server answers with a
+	// status or content type that is not an event stream. Run does not
+	// retry these: they would fail the same way again.
+	ErrBadResponse = errors.New("bad response")
+
+	// ErrIdleTimeout is the error a connection fails with when nothing was
+	// received on it within the window set with WithIdleTimeout.
+	ErrIdleTimeout = errors.New("idle timeout")
+)
+
+// defaultReconnectDelay is how long Run waits before reconnecting, the same
+// as most browsers' EventSource.
+const defaultReconnectDelay = 3 * time.Second
+
+// Event is one event received from the stream.
+type Event struct {
+	ID   string // Value of the last id field seen, which also applies to events without one
+	Name string // Value of the event field, empty for the default "message" type
+	Data []byte // Data lines joined with newlines
+
+	// Fields holds the custom "x-" fields of the event (see
+	// gosse.Event.Fields) by name without the prefix, nil if it has none.
+	Fields map[string]string
+}
+
+// Option configures a Client.
+type Option func(*Client) error
+
+// Client reads events from one SSE endpoint. A Client is used by a single
+// Run call at a time.
+type Client struct {
+	url            string
+	httpClient     *http.Client
+	reconnectDelay time.Duration
+	idleTimeout    time.Duration
+	onIdle         func()
+	probe          bool
+
+	mu     sync.Mutex // Guards lastID, which LastEventID may read while Run updates it
+	lastID string
+}
+
+// New returns a Client for the stream at url. Every invalid option is
+// reported in the returned error, which wraps ErrInvalidOption.
+func New(url string, opts ...Option) (*Client, error) {
+	c := &Client{
+		url:            url,
+		httpClient:     http.DefaultClient,
+		reconnectDelay: defaultReconnectDelay,
+	}
+	var errs []error
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if err := opt(c); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return c, nil
+}
+
+// invalidOption reports that option was given a value it does not accept.
+func invalidOption(option string, value any, reason string) error {
+	return fmt.Errorf("%w: %s=%v: %s", ErrInvalidOption, option, value, reason)
+}
+
+// WithHTTPClient sets the http.Client used to connect. The default is
+// http.DefaultClient. Its Timeout should be zero, since it would cut every
+// stream short.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *Client) error {
+		if client == nil {
+			return invalidOption("WithHTTPClient", "nil", "must not be nil")
+		}
+		c.httpClient = client
+		return nil
+	}
+}
+
+// WithReconnectDelay sets how long Run waits before reconnecting after a
+// stream ends or fails. The default is 3s. A retry field sent by the server
+// replaces it.
+func WithReconnectDelay(delay time.Duration) Option {
+	return func(c *Client) error {
+		if delay < 0 {
+			return invalidOption("WithReconnectDelay", delay, "must not be negative")
+		}
+		c.reconnectDelay = delay
+		return nil
+	}
+}
+
+// WithIdleTimeout starts a watchdog on every connection: if neither an
+// event nor a comment, such as a gosse heartbeat, arrives within window,
+// the connection is dropped, onTimeout is called if not nil, and Run
+// reconnects. It catches half-open connections, which never produce a read
+// error. The window should comfortably exceed the server's heartbeat
+// interval. Zero, the default, disables the watchdog.
+func WithIdleTimeout(window time.Duration, onTimeout func()) Option {
+	return func(c *Client) error {
+		if window < 0 {
+			return invalidOption("WithIdleTimeout", window, "must not be negative")
+		}
+		c.idleTimeout = window
+		c.onIdle = onTimeout
+		return nil
+	}
+}
+
+// WithDeliveryProbe asks the server for a delivery probe, by adding
+// "probe=1" to the URL, and acknowledges the probe events it sends instead
+// of passing them on (see gosse.WithHandlerDeliveryProbe).
+func WithDeliveryProbe() Option {
+	return func(c *Client) error {
+		c.probe = true
+		return nil
+	}
+}
+
+// LastEventID returns the ID of the last event received, which is sent as
+// Last-Event-ID when reconnecting.
+func (c *Client) LastEventID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastID
+}
+
+// Run connects to the stream and calls handle with every event, on the
+// calling goroutine, until ctx is done. Whenever the stream ends or fails,
+// it waits for the reconnect delay and connects again. It returns ctx.Err()
+// wrapped with context once ctx is done, or an error wrapping
+// ErrBadResponse if the server refuses the stream. The idle timeout keeps
+// running while handle runs, so handle should return promptly.
+func (c *Client) Run(ctx context.Context, handle func(Event)) error {
+	for {
+		err := c.connect(ctx, handle)
+		if errors.Is(err, ErrBadResponse) {
+			return err
+		}
+		if errors.Is(err, ErrIdleTimeout) && c.onIdle != nil {
+			c.onIdle()
+		}
+		timer := time.NewTimer(c.reconnectDelay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("run stream: %w", ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// Events runs the client like Run on a new goroutine and delivers its events
+// on the returned channel, which is closed once Run returns; Run's error is
+// then sent on the second channel. The idle timeout keeps running while
+// an event waits to be received, so the channel should be drained
+// promptly.
+func (c *Client) Events(ctx context.Context) (<-chan Event, <-chan error) {
+	events := make(chan Event)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		err := c.Run(ctx, func(ev Event) {
+			select {
+			case events <- ev:
+			case <-ctx.Done():
+			}
+		})
+		close(events)
+		errc <- err
+	}()
+	return events, errc
+}
+
+// connect reads one connection until it ends, returning why.
+func (c *Client) connect(ctx context.Context, handle func(Event)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var idle atomic.Bool
+	touch := func() {}
+	if c.idleTimeout > 0 {
+		watchdog := time.AfterFunc(c.idleTimeout, func() {
+			idle.Store(true)
+			cancel()
+		})
+		defer watchdog.Stop()
+		// Every line read, comments included, proves the connection alive
+		touch = func() { watchdog.Reset(c.idleTimeout) }
+	}
+
+	err := c.stream(ctx, handle, touch)
+	if idle.Load() {
+		return ErrIdleTimeout
+	}
+	return err
+}
+
+// stream opens a connection and dispatches its events, calling touch for
+// every line received.
+func (c *Client) stream(ctx context.Context, handle func(Event), touch func()) (err error) {
+	target := c.url
+	if c.probe {
+		if target, err = withQuery(c.url, "probe", "1"); err != nil {
+			return fmt.Errorf("%w: %v", ErrBadResponse, err)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBadResponse, err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Cache-Control", "no-cache")
+	if lastID := c.LastEventID(); lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 500:
+		return fmt.Errorf("connect: %s", resp.Status)
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("%w: %s", ErrBadResponse, resp.Status)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "text/event-stream" {
+		return fmt.Errorf("%w: content type %q", ErrBadResponse, resp.Header.Get("Content-Type"))
+	}
+	if c.probe {
+		handle = c.acking(ctx, handle)
+	}
+	return c.read(resp.Body, handle, touch)
+}
+
+// acking returns handle wrapped to acknowledge probe events in the
+// background rather than pass them on.
+func (c *Client) acking(ctx context.Context, handle func(Event)) func(Event) {
+	return func(ev Event) {
+		if ev.Name != "probe" {
+			handle(ev)
+			return
+		}
+		var probe struct {
+			Token string `json:"token"`
+		}
+		if json.Unmarshal(ev.Data, &probe) != nil || probe.Token == "" {
+			return
+		}
+		go func() {
+			target, err := withQuery(c.url, "probe_ack", probe.Token)
+			if err != nil {
+				return
+			}
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+			if err != nil {
+				return
+			}
+			if resp, err := c.httpClient.Do(req); err == nil {
+				resp.Body.Close()
+			}
+		}()
+	}
+}
+
+// withQuery returns rawURL with the query parameter key set to value.
+func withQuery(rawURL, key, value string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	query.Set(key, value)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// read parses the stream in body, calling handle for each complete event,
+// until the stream ends. A retry field replaces the reconnect delay, custom
+// fields starting with "x-" are collected into Event.Fields, and other
+// unknown fields are ignored.
+func (c *Client) read(body io.Reader, handle func(Event), touch func()) error {
+	reader := bufio.NewReader(body)
+	var data []string
+	var name string
+	var fields map[string]string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		touch()
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		if line == "" {
+			if data != nil {
+				handle(Event{ID: c.LastEventID(), Name: name, Data: []byte(strings.Join(data, "\n")), Fields: fields})
+			}
+			data, name, fields = nil, "", nil
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "": // Comment
+		case "data":
+			data = append(data, value)
+		case "event":
+			name = value
+		case "retry":
+			// Only ASCII digits are valid; anything else is ignored
+			if ms, err := strconv.ParseUint(value, 10, 32); err == nil {
+				c.reconnectDelay = time.Duration(ms) * time.Millisecond
+			}
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				c.mu.Lock()
+				c.lastID = value
+				c.mu.Unlock()
+			}
+		default:
+			if custom, ok := strings.CutPrefix(field, "x-"); ok && custom != "" {
+				if fields == nil {
+					fields = make(map[string]string)
+				}
+				fields[custom] = value
+			}
+		}
+	}
+}
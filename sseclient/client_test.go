@@ -0,0 +1,251 @@
+package sseclient_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Firoz01/gosse/v2"
+	"github.com/Firoz01/gosse/v2/sseclient"
+)
+
+func TestClient_ReceivesEvents(t *testing.T) {
+	server := gosse.NewServer(gosse.WithAutoRun(), gosse.WithHistory(10))
+	defer server.Shutdown()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gosse.SSEHandlerEndpoint(server, w, r)
+	}))
+	defer ts.Close()
+
+	client, err := sseclient.New(ts.URL, sseclient.WithReconnectDelay(10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan sseclient.Event, 100)
+	go client.Run(ctx, func(ev sseclient.Event) { events <- ev })
+
+	// Publish until the client has connected and received an event
+	deadline := time.After(2 * time.Second)
+	var ev sseclient.Event
+	for ev.ID == "" {
+		_ = server.BroadcastMessage([]byte("hello"))
+		select {
+		case ev = <-events:
+		case <-time.After(10 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("Client received nothing")
+		}
+	}
+	if string(ev.Data) != "hello" {
+		t.Errorf("Expected hello, got %q", ev.Data)
+	}
+	if client.LastEventID() != ev.ID {
+		t.Errorf("Expected last event ID %q, got %q", ev.ID, client.LastEventID())
+	}
+}
+
+func TestClient_IdleTimeout(t *testing.T) {
+	// The first connection sends one event and then goes silent without
+	// closing, like a half-open connection
+	var connections atomic.Int32
+	lastIDs := make(chan string, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastIDs <- r.Header.Get("Last-Event-ID")
+		w.Header().Set("Content-Type", "text/event-stream")
+		n := connections.Add(1)
+		fmt.Fprintf(w, ": comment\r\nid: %d\r\ndata: line one\r\ndata:line two\r\n\r\n", n)
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+
+	idle := make(chan struct{}, 10)
+	client, err := sseclient.New(ts.URL,
+		sseclient.WithReconnectDelay(time.Millisecond),
+		sseclient.WithIdleTimeout(50*time.Millisecond, func() { idle <- struct{}{} }))
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan sseclient.Event, 10)
+	done := make(chan error, 1)
+	go func() { done <- client.Run(ctx, func(ev sseclient.Event) { events <- ev }) }()
+
+	if ev := <-events; ev.ID != "1" || string(ev.Data) != "line one\nline two" {
+		t.Errorf("Expected event 1 with both data lines, got %q: %q", ev.ID, ev.Data)
+	}
+
+	select {
+	case <-idle:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the idle callback")
+	}
+	// The reconnect resumes after the last event received
+	if id := <-lastIDs; id != "" {
+		t.Errorf("Expected no Last-Event-ID on the first connection, got %q", id)
+	}
+	if id := <-lastIDs; id != "1" {
+		t.Errorf("Expected Last-Event-ID 1 on reconnect, got %q", id)
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestClient_BadResponse(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no", http.StatusUnauthorized)
+	}))
+	defer ts.Close()
+
+	client, err := sseclient.New(ts.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %v", err)
+	}
+	if err := client.Run(context.Background(), func(sseclient.Event) {}); !errors.Is(err, sseclient.ErrBadResponse) {
+		t.Errorf("Expected ErrBadResponse, got %v", err)
+	}
+
+	if _, err := sseclient.New(ts.URL, sseclient.WithIdleTimeout(-1, nil)); !errors.Is(err, sseclient.ErrInvalidOption) {
+		t.Errorf("Expected ErrInvalidOption, got %v", err)
+	}
+}
+
+func TestClient_EventsChannel(t *testing.T) {
+	// Each connection sends two events and ends; the retry field makes the
+	// client come back in 5ms despite its hour-long reconnect delay
+	var connections atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		connections.Add(1)
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "retry: 5\nevent: update\nid: 7\ndata: a\ndata: b\n\nevent: empty\n\ndata: c\n\n")
+	}))
+	defer ts.Close()
+
+	client, err := sseclient.New(ts.URL, sseclient.WithReconnectDelay(time.Hour))
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	events, errc := client.Events(ctx)
+
+	want := []sseclient.Event{
+		{ID: "7", Name: "update", Data: []byte("a\nb")},
+		{ID: "7", Data: []byte("c")}, // The event name does not carry over
+		{ID: "7", Name: "update", Data: []byte("a\nb")},
+	}
+	for i, w := range want {
+		select {
+		case ev := <-events:
+			if ev.ID != w.ID || ev.Name != w.Name || string(ev.Data) != string(w.Data) {
+				t.Errorf("Event %d: expected %+v, got %+v", i, w, ev)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Event %d not received", i)
+		}
+	}
+	if n := connections.Load(); n < 2 {
+		t.Errorf("Expected a reconnect, got %d connections", n)
+	}
+
+	cancel()
+	for range events {
+	}
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestClient_DeliveryProbe(t *testing.T) {
+	server := gosse.NewServer(gosse.WithAutoRun())
+	defer server.Shutdown()
+	timedOut := make(chan string, 1)
+	handler, err := gosse.NewHandler(server, gosse.WithHandlerDeliveryProbe(100*time.Millisecond, func(clientID string) {
+		timedOut <- clientID
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error creating handler: %v", err)
+	}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	client, err := sseclient.New(ts.URL, sseclient.WithDeliveryProbe())
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, _ := client.Events(ctx)
+
+	// Publish until the client has connected; the probe itself is not passed on
+	deadline := time.After(2 * time.Second)
+	for received := false; !received; {
+		_ = server.BroadcastMessage([]byte("hello"))
+		select {
+		case ev := <-events:
+			if ev.Name == "probe" || string(ev.Data) != "hello" {
+				t.Fatalf("Unexpected event %+v", ev)
+			}
+			received = true
+		case <-time.After(10 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("Client received nothing")
+		}
+	}
+
+	select {
+	case clientID := <-timedOut:
+		t.Fatalf("Probe of %s timed out despite the client's ack", clientID)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestClient_CustomFields(t *testing.T) {
+	server := gosse.NewServer(gosse.WithAutoRun())
+	defer server.Shutdown()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gosse.SSEHandlerEndpoint(server, w, r)
+	}))
+	defer ts.Close()
+
+	client, err := sseclient.New(ts.URL, sseclient.WithReconnectDelay(10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan sseclient.Event, 100)
+	go client.Run(ctx, func(ev sseclient.Event) { events <- ev })
+
+	fields := map[string]string{"trace": "abc123", "tenant": "acme"}
+	deadline := time.After(2 * time.Second)
+	var ev sseclient.Event
+	for ev.Data == nil {
+		_ = server.BroadcastEvent(gosse.Event{Data: []byte("hello"), Fields: fields})
+		select {
+		case ev = <-events:
+		case <-time.After(10 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("Client received nothing")
+		}
+	}
+	if !reflect.DeepEqual(ev.Fields, fields) {
+		t.Errorf("Expected fields %v, got %v", fields, ev.Fields)
+	}
+
+	err = server.BroadcastEvent(gosse.Event{Data: []byte("x"), Fields: map[string]string{"a:b": "c"}})
+	if !errors.Is(err, gosse.ErrInvalidOption) {
+		t.Errorf("Expected ErrInvalidOption for a field name with a colon, got %v", err)
+	}
+}
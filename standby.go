@@ -0,0 +1,49 @@
+package gosse
+
+import "fmt"
+
+// WithStandby starts the server as a warm standby for another one: it
+// turns clients away with an error wrapping ErrStandby, which
+// SSEHandlerEndpoint answers with 503 Service Unavailable, until Promote is
+// called. Meanwhile the events other instances hand to its broker (see
+// WithBroker) fill its history and its topics' retained events, keeping
+// the primary's event IDs, so that once promoted it can replay what clients
+// missed during the failover from their Last-Event-ID. Publishes are
+// accepted as usual, but once the standby publishes events itself its IDs
+// run ahead of the primary's, and clients resuming from an ID of the
+// primary may be sent the wrong events.
+func WithStandby() Option {
+	return func(o *options) error {
+		o.standby = true
+		return nil
+	}
+}
+
+// Promote ends the standby started with WithStandby, admitting clients.
+// It does nothing if the server is not on standby.
+func (s *Server) Promote() {
+	if s == nil {
+		return
+	}
+	s.stateM.Lock()
+	defer s.stateM.Unlock()
+	if s.standby {
+		s.logf(LevelInfo, "promoted from standby")
+	}
+	s.standby = false
+}
+
+// Standby reports whether the server is on standby (see WithStandby).
+func (s *Server) Standby() bool {
+	if s == nil {
+		return false
+	}
+	s.stateM.RLock()
+	defer s.stateM.RUnlock()
+	return s.standby
+}
+
+// standbyError is the error for a client turned away by the standby.
+func standbyError() error {
+	return fmt.Errorf("%w: waiting to be promoted", ErrStandby)
+}
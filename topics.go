@@ -0,0 +1,312 @@
+package gosse
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Publish sends msg to every client subscribed to topic, in the same
+// non-blocking way as BroadcastMessage. Clients that are not subscribed to
+// topic do not see the message. The delivered Event carries the topic name.
+//
+// The returned error wraps ErrInvalidOption if topic is empty,
+// ErrServerClosed after Shutdown, ErrMaintenance while publishes are paused
+// and ErrQuotaExceeded beyond the publish rate. Otherwise it joins one error
+// per subscriber whose message channel was full, like BroadcastMessage.
+func (s *Server) Publish(topic string, msg []byte) error {
+	if s == nil {
+		return ErrNilServer
+	}
+	return s.publish(Event{Data: msg, Topic: topic})
+}
+
+// publish delivers ev to the subscribers of ev.Topic.
+func (s *Server) publish(ev Event) error {
+	result, err := s.fanOut(ev)
+	if err != nil {
+		return err
+	}
+	return errors.Join(result.errs...)
+}
+
+// fanOutResult is what became of an event offered to each subscriber.
+type fanOutResult struct {
+	accepted int     // Subscribers that queued the event
+	dropped  int     // Subscribers whose full buffer turned it away
+	errs     []error // One per subscriber that did not queue it
+	kept     Event   // The event as delivered, with its history ID if it is kept
+}
+
+// fanOut offers ev to the subscribers of ev.Topic, then hands it to the
+// broker (see WithBroker) and passes it to the routes it matches (see
+// AddRoute). err is set only if the publish is rejected as a whole, before
+// any subscriber sees it.
+func (s *Server) fanOut(ev Event) (result fanOutResult, err error) {
+	if result, err = s.offer(ev, true); err == nil {
+		s.relay(result.kept)
+		s.route(ev, 0)
+	}
+	return result, err
+}
+
+// offer is fanOut without the routes. admit applies the publish quota.
+func (s *Server) offer(ev Event, admit bool) (result fanOutResult, err error) {
+	if err := validateTopics("topic", ev.Topic); err != nil {
+		return result, err
+	}
+	topic, aliases := s.aliases.Load().resolve(ev.Topic)
+	ev.Topic = topic
+	if err := s.acquireOpen(); err != nil {
+		return result, err
+	}
+	defer s.releaseOpen()
+	if admit {
+		if err := s.admitPublish(); err != nil {
+			return result, err
+		}
+	}
+	s.countPublish(ev)
+	now := s.opts.now()
+	ev = s.history.append(ev)
+	result.kept = ev
+	s.teeSink(ev, now)
+	state := s.lockedTopic(topic)
+	state.published(ev, now)
+	state.mu.Unlock()
+	in := &filterInput{data: ev.Data}
+	var groups map[string][]*Client // Members of each group that would receive ev
+	var via map[*Client]*topicAlias // Group members subscribed by an alias
+	s.rangeClients(func(client *Client) bool {
+		name, alias := match(client, topic, aliases)
+		if name == "" || !client.inPartition(ev) || !client.wants(in) || !client.sample(name, now) {
+			return true
+		}
+		if group := client.group(name); group != "" {
+			if groups == nil {
+				groups = make(map[string][]*Client)
+			}
+			groups[group] = append(groups[group], client)
+			if alias != nil {
+				if via == nil {
+					via = make(map[*Client]*topicAlias)
+				}
+				via[client] = alias
+			}
+			return true
+		}
+		result.record(s.deliverAs(client, ev, alias))
+		return true
+	})
+	for group, members := range groups {
+		picked := state.pick(group, members, ev.Key)
+		result.record(s.deliverAs(picked, ev, via[picked]))
+	}
+	return result, nil
+}
+
+// record counts the outcome of delivering to one subscriber.
+func (r *fanOutResult) record(err error) {
+	switch {
+	case err == nil:
+		r.accepted++
+	case errors.Is(err, ErrBufferFull):
+		r.dropped++
+		r.errs = append(r.errs, err)
+	default:
+		r.errs = append(r.errs, err)
+	}
+}
+
+// TryPublish is Publish for producers that adapt to their consumers: it
+// reports how many subscribers queued ev and how many dropped it because
+// their buffer was full, so a producer seeing drops can slow down at the
+// source instead of flooding slow clients. With the DropOldest policy, a
+// full buffer makes room and counts as accepted. ev.Data, ev.Name, ev.Key,
+// ev.Retry, ev.Schema and ev.Fields are sent; the event's topic is topic.
+//
+// err is set only if the publish is rejected as a whole, for the reasons
+// Publish gives or because BroadcastEvent would reject ev; per-subscriber
+// failures are reflected in the counts instead.
+func (s *Server) TryPublish(topic string, ev Event) (accepted, dropped int, err error) {
+	if s == nil {
+		return 0, 0, ErrNilServer
+	}
+	if err := ev.validate(); err != nil {
+		return 0, 0, err
+	}
+	result, err := s.fanOut(Event{Data: ev.Data, Topic: topic, Name: ev.Name, Key: ev.Key, Retry: ev.Retry, Schema: ev.Schema, Fields: ev.Fields, Trace: ev.Trace})
+	return result.accepted, result.dropped, err
+}
+
+// SubscribeContext is like AddClientContext but the new client also
+// receives events published to topics (see Publish). Broadcasts and
+// targeted messages reach it as usual. The client uses the buffer size set
+// with WithBufferSize.
+func (s *Server) SubscribeContext(ctx context.Context, topics ...string) (*Client, error) {
+	return s.subscribe(ctx, nil, topics)
+}
+
+// subscribe is SubscribeContext with a setup function, such as setting a
+// filter, that runs before the client can receive anything.
+func (s *Server) subscribe(ctx context.Context, setup func(*Client), topics []string) (*Client, error) {
+	if s == nil {
+		return nil, ErrNilServer
+	}
+	if err := validateTopics("topics", topics...); err != nil {
+		return nil, err
+	}
+	s.init()
+	return s.addClient(ctx, s.opts.bufferSize, topics, setup)
+}
+
+// deliverAs is deliver for a client subscribed to ev's topic by alias, nil
+// if by the topic's own name.
+func (s *Server) deliverAs(client *Client, ev Event, alias *topicAlias) error {
+	err := s.deliver(client, ev)
+	if err == nil && alias != nil {
+		atomic.AddUint64(&alias.deliveries, 1)
+	}
+	return err
+}
+
+// validateTopics rejects empty topic names, which could never be published to.
+func validateTopics(name string, topics ...string) error {
+	for _, topic := range topics {
+		if topic == "" {
+			return invalidOption(name, `""`, "topic names must not be empty")
+		}
+	}
+	return nil
+}
+
+// TopicInfo describes a topic that has had subscribers or publishes.
+type TopicInfo struct {
+	Name            string
+	Subscribers     int       // Connected clients subscribed to the topic.
+	Retained        *Event    // The last event published, or nil if none was.
+	LastPublishedAt time.Time // When Retained was published.
+	PublishRate     float64   // Publishes per second over about the last minute.
+}
+
+// Topics lists every topic that has had subscribers or publishes, sorted by
+// name, except those freed by WithTopicExpiry. Unlike Metrics, it is not limited by WithMetricsTopicLimit, so it
+// suits admin UIs and automation such as removing dead topics: a topic with
+// no subscribers and an old LastPublishedAt is no longer in use.
+func (s *Server) Topics() []TopicInfo {
+	if s == nil {
+		return nil
+	}
+	s.init()
+	now := s.opts.now()
+	var topics []TopicInfo
+	s.topics.Range(func(key, value interface{}) bool {
+		topics = append(topics, value.(*topicState).info(key.(string), now))
+		return true
+	})
+	sort.Slice(topics, func(i, j int) bool { return topics[i].Name < topics[j].Name })
+	return topics
+}
+
+// topic returns the state of the named topic, creating it if needed.
+func (s *Server) topic(name string) *topicState {
+	if t, ok := s.topics.Load(name); ok {
+		return t.(*topicState)
+	}
+	t, _ := s.topics.LoadOrStore(name, &topicState{})
+	return t.(*topicState)
+}
+
+// lockedTopic is topic with the state's mu held, skipping states that
+// WithTopicExpiry has just expired.
+func (s *Server) lockedTopic(name string) *topicState {
+	for {
+		t := s.topic(name)
+		t.mu.Lock()
+		if !t.expired {
+			return t
+		}
+		t.mu.Unlock() // Already deleted, so the next lookup creates a fresh state
+	}
+}
+
+// trackSubscribers adds delta to the subscriber count of each of the
+// client's topics.
+func (s *Server) trackSubscribers(client *Client, delta int) {
+	now := s.opts.now()
+	for name := range client.topics {
+		t := s.lockedTopic(name)
+		t.subscribers += delta
+		t.activeAt = now
+		t.mu.Unlock()
+	}
+}
+
+// rateWindow is the period over which TopicInfo.PublishRate is measured.
+const rateWindow = time.Minute
+
+// topicState is what Topics reports about one topic.
+type topicState struct {
+	mu          sync.Mutex
+	subscribers int
+	retained    *Event
+	publishedAt time.Time
+
+	// Publishes are counted in consecutive windows of rateWindow; the
+	// rate weighs the previous window by how much of it still overlaps
+	// the last rateWindow.
+	windowStart time.Time
+	current     int // Publishes since windowStart
+	previous    int // Publishes in the window before
+
+	turns map[string]uint64 // Group to the number of unkeyed events shared out among its members
+
+	activeAt time.Time // Last publish or change of subscribers, for WithTopicExpiry
+	expired  bool      // Set once expireTopics has deleted the state
+}
+
+// published records ev as the topic's latest event. The data is copied
+// because callers may reuse their buffer once Publish returns. t.mu must
+// be held.
+func (t *topicState) published(ev Event, now time.Time) {
+	ev.Data = append([]byte(nil), ev.Data...)
+	t.retained = &ev
+	t.publishedAt = now
+	t.activeAt = now
+	t.roll(now)
+	t.current++
+}
+
+// roll moves the rate windows forward to now.
+func (t *topicState) roll(now time.Time) {
+	switch elapsed := now.Sub(t.windowStart); {
+	case elapsed >= 2*rateWindow:
+		t.windowStart, t.previous, t.current = now, 0, 0
+	case elapsed >= rateWindow:
+		t.windowStart = t.windowStart.Add(rateWindow)
+		t.previous, t.current = t.current, 0
+	}
+}
+
+// info returns a snapshot of the topic as of now.
+func (t *topicState) info(name string, now time.Time) TopicInfo {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.roll(now)
+	overlap := 1 - float64(now.Sub(t.windowStart))/float64(rateWindow)
+	info := TopicInfo{
+		Name:            name,
+		Subscribers:     t.subscribers,
+		LastPublishedAt: t.publishedAt,
+		PublishRate:     (float64(t.previous)*overlap + float64(t.current)) / rateWindow.Seconds(),
+	}
+	if t.retained != nil {
+		retained := *t.retained
+		retained.Data = append([]byte(nil), retained.Data...)
+		info.Retained = &retained
+	}
+	return info
+}
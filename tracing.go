@@ -0,0 +1,105 @@
+package gosse
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// DeliveryStage is a step of a traced event's way to one client (see
+// Event.Trace).
+type DeliveryStage string
+
+const (
+	// DeliveryQueued means the event was queued on the client's buffer.
+	DeliveryQueued DeliveryStage = "queued"
+
+	// DeliveryWritten means a handler wrote the event to the client's
+	// stream, live or in a replay.
+	DeliveryWritten DeliveryStage = "written"
+
+	// DeliveryDropped means the event was lost to the client: its buffer
+	// was full, the handler's transform dropped it, or writing it failed.
+	DeliveryDropped DeliveryStage = "dropped"
+)
+
+// Bounds of the delivery traces kept for DeliveryTrace.
+const (
+	maxDeliveryTraces  = 64    // Traces kept; the oldest is forgotten first
+	maxDeliveryRecords = 10000 // Records kept per trace; later ones are not
+)
+
+// errTransformDropped is the error of a traced event dropped by a handler's
+// transform or schema conversion.
+var errTransformDropped = errors.New("dropped by the handler's transform")
+
+// DeliveryRecord is one step of a traced event's delivery to one client.
+type DeliveryRecord struct {
+	Trace    string        // Event.Trace of the event.
+	ClientID string        // Client the event was delivered to.
+	Stage    DeliveryStage // What happened to the event.
+	At       time.Time     // When it happened.
+	Err      error         // Why the event was dropped, nil for the other stages.
+}
+
+// deliveryTraces holds the records of the most recent traces.
+type deliveryTraces struct {
+	mu      sync.Mutex
+	records map[string][]DeliveryRecord // Trace to its records, in the order they happened
+	order   []string                    // Traces from oldest to newest
+}
+
+// DeliveryTrace returns what became of the events published with
+// Event.Trace set to trace, for every client: where they were queued,
+// written or dropped, in the order it happened. It answers whether a
+// client ever received an event: a DeliveryWritten record for the client
+// means the event reached its stream. Records are also logged at the debug
+// level (see WithLogLevel). The records of the 64 most recent traces are
+// kept, up to 10000 each; DeliveryTrace returns nil for others.
+//
+// Tracing is meant for debugging single events; tagging every event would
+// slow publishing down.
+func (s *Server) DeliveryTrace(trace string) []DeliveryRecord {
+	if s == nil {
+		return nil
+	}
+	s.init()
+	s.traces.mu.Lock()
+	defer s.traces.mu.Unlock()
+	records := s.traces.records[trace]
+	if records == nil {
+		return nil
+	}
+	return append([]DeliveryRecord(nil), records...)
+}
+
+// traceDelivery records that ev reached stage for the client with clientID,
+// if ev is traced. err is why it was dropped.
+func (s *Server) traceDelivery(ev Event, clientID string, stage DeliveryStage, err error) {
+	if ev.Trace == "" {
+		return
+	}
+	rec := DeliveryRecord{Trace: ev.Trace, ClientID: clientID, Stage: stage, At: s.opts.now(), Err: err}
+	if err != nil {
+		s.logf(LevelDebug, "trace %s: client %s: %s: %v", ev.Trace, clientID, stage, err)
+	} else {
+		s.logf(LevelDebug, "trace %s: client %s: %s", ev.Trace, clientID, stage)
+	}
+	t := &s.traces
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	records, ok := t.records[ev.Trace]
+	if !ok {
+		if t.records == nil {
+			t.records = make(map[string][]DeliveryRecord)
+		}
+		if len(t.order) == maxDeliveryTraces {
+			delete(t.records, t.order[0])
+			t.order = t.order[1:]
+		}
+		t.order = append(t.order, ev.Trace)
+	}
+	if len(records) < maxDeliveryRecords {
+		t.records[ev.Trace] = append(records, rec)
+	}
+}
@@ -0,0 +1,37 @@
+package gosse
+
+// WriteTrace holds hooks a Handler calls around each step of writing a
+// frame to a stream, in the spirit of net/http/httptrace, so APM agents
+// such as Datadog's or New Relic's can time writes and flushes and count
+// bytes without a first-party integration. Any hook may be nil. Hooks run
+// on the connection's goroutine, between frames, so slow hooks slow down
+// that client's stream.
+type WriteTrace struct {
+	WriteStart func(WriteInfo) // Before a frame is written, with its size
+	WriteDone  func(WriteInfo) // After the frame is written, with the bytes written and any error
+	FlushStart func(WriteInfo) // Before the frame is flushed to the connection, with its size
+	FlushDone  func(WriteInfo) // After the flush, with any error
+}
+
+// WriteInfo describes one step of writing a frame.
+type WriteInfo struct {
+	ClientID string
+	Bytes    int   // Size of the frame before any compression, or at WriteDone the part of it written
+	Err      error // Set by WriteDone and FlushDone if the step failed
+}
+
+// WithHandlerWriteTrace calls trace's hooks around every frame the handler
+// writes, including heartbeats, comments and replay markers.
+func WithHandlerWriteTrace(trace WriteTrace) HandlerOption {
+	return func(h *Handler) error {
+		h.trace = &trace
+		return nil
+	}
+}
+
+// traceStep calls hook, if set, with the step's details.
+func (fw *frameWriter) traceStep(hook func(WriteInfo), bytes int, err error) {
+	if hook != nil {
+		hook(WriteInfo{ClientID: fw.client.ID, Bytes: bytes, Err: err})
+	}
+}